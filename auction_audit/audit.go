@@ -0,0 +1,407 @@
+// Package auction_audit checks the outcome of an auction without trusting
+// the conodes. Export takes the blocks of the ledger from the spawn of an
+// auction on, with the proofs of the instances it reads, out of the block
+// database of a conode. Verify runs the instructions of these blocks again
+// with the code of the contracts, fully offline, and compares the result
+// with the auction stored on the ledger.
+//
+// The instances the auction reads but does not write, like the darcs and
+// the coin accounts, are taken as they are at the end of the segment. The
+// candle auctions, drawing their end from the state trie, and the auctions
+// listed in an auction house, whose entry depends on the other auctions,
+// cannot be replayed.
+package auction_audit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/dedis/student_19_auctions/auctions"
+	"github.com/dedis/student_19_auctions/sb_auctions"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/trie"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	bbolt "go.etcd.io/bbolt"
+)
+
+// Segment is the part of a ledger needed to replay an auction: the blocks
+// from the spawn of the auction to the latest one, and the proofs, all
+// against the latest block, of the auction and of the instances it reads.
+type Segment struct {
+	Blocks []skipchain.SkipBlock
+	Proofs []byzcoin.Proof
+}
+
+// Report is the outcome of an auction recomputed from its instructions.
+// Payment is what the seller got, Refunds the coins stored back on the
+// other accounts. Match tells if the auction replayed is the one stored on
+// the ledger, otherwise Mismatch gives the reason.
+type Report struct {
+	AuctionID  byzcoin.InstanceID
+	ContractID string
+	Spawned    uint64
+	Latest     uint64
+	Outcome    auctioncore.OutcomeData
+	Lots       []auctioncore.OutcomeData
+	Seller     byzcoin.InstanceID
+	Payment    uint64
+	Refunds    []auctioncore.PayoutData
+	Match      bool
+	Mismatch   string
+}
+
+// ErrNotReplayable is returned for the auctions that cannot be replayed
+// offline.
+var ErrNotReplayable = errors.New("the auction cannot be replayed offline")
+
+// Encode returns the segment to be saved in a file.
+func (seg *Segment) Encode() ([]byte, error) {
+	return protobuf.Encode(seg)
+}
+
+// DecodeSegment is the inverse of Encode.
+func DecodeSegment(buf []byte) (*Segment, error) {
+	seg := &Segment{}
+	err := protobuf.DecodeWithConstructors(buf, seg, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, err
+	}
+	return seg, nil
+}
+
+// Verify checks the segment against the ledger bcID and replays the
+// auction. An error is returned for a segment that is not part of the
+// ledger, a replay differing from the ledger is reported as a mismatch.
+func Verify(seg *Segment, bcID skipchain.SkipBlockID, auctInstID byzcoin.InstanceID) (*Report, error) {
+	if len(seg.Blocks) == 0 || len(seg.Proofs) == 0 {
+		return nil, errors.New("empty segment")
+	}
+	latest := seg.Proofs[0].Latest
+	for _, p := range seg.Proofs {
+		err := p.Verify(bcID)
+		if err != nil {
+			return nil, err
+		}
+		if !p.Latest.Hash.Equal(latest.Hash) {
+			return nil, errors.New("the proofs are not against the same block")
+		}
+	}
+	err := checkBlocks(seg.Blocks, bcID, latest.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	proven, found, err := seg.base(auctInstID.Slice())
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, auctioncore.ErrUnknownInstanceID
+	}
+	err = checkReplayable(proven)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		AuctionID:  auctInstID,
+		ContractID: proven.contractID,
+		Spawned:    uint64(seg.Blocks[0].Index),
+		Latest:     uint64(latest.Index),
+	}
+	r := newReplay(seg.base)
+	_, err = r.run(seg.Blocks, auctInstID)
+	if err != nil {
+		report.Mismatch = err.Error()
+		return report, nil
+	}
+	replayed, found, err := r.get(auctInstID.Slice())
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		report.Mismatch = "the auction is removed in the replay"
+		return report, nil
+	}
+	err = report.fill(replayed, r.payouts)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case replayed.contractID != proven.contractID:
+		report.Mismatch = "the auction is of contract " + replayed.contractID + " in the replay"
+	case !bytes.Equal(replayed.value, proven.value):
+		report.Mismatch = "the auction stored on the ledger differs from the replay"
+	default:
+		report.Match = true
+	}
+	return report, nil
+}
+
+// checkBlocks checks that the blocks follow each other in the ledger up to
+// the latest one. The latest block being proven, so are the blocks before
+// it through their hashes.
+func checkBlocks(blocks []skipchain.SkipBlock, bcID skipchain.SkipBlockID, latest skipchain.SkipBlockID) error {
+	for i := range blocks {
+		sb := &blocks[i]
+		if !sb.CalculateHash().Equal(sb.Hash) {
+			return fmt.Errorf("wrong hash of block %d", sb.Index)
+		}
+		if !sb.SkipChainID().Equal(bcID) {
+			return fmt.Errorf("block %d is of another ledger", sb.Index)
+		}
+		if i > 0 && (len(sb.BackLinkIDs) == 0 || !sb.BackLinkIDs[0].Equal(blocks[i-1].Hash)) {
+			return fmt.Errorf("block %d does not follow block %d", sb.Index, blocks[i-1].Index)
+		}
+		// The transactions are in the payload, which is not hashed with the
+		// block, but their hash is in the header
+		header := byzcoin.DataHeader{}
+		err := protobuf.Decode(sb.Data, &header)
+		if err != nil {
+			return err
+		}
+		body, err := decodeBody(sb)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(header.ClientTransactionHash, body.TxResults.Hash()) {
+			return fmt.Errorf("wrong transactions in block %d", sb.Index)
+		}
+	}
+	if !blocks[len(blocks)-1].Hash.Equal(latest) {
+		return errors.New("the segment does not end at the block of the proofs")
+	}
+	return nil
+}
+
+// checkReplayable refuses the auctions whose replay would depend on the
+// state trie of past blocks.
+func checkReplayable(e entry) error {
+	var registry byzcoin.InstanceID
+	switch e.contractID {
+	case auctions.ContractAuctionID:
+		auction, err := auctions.DecodeAuction(e.value)
+		if err != nil {
+			return err
+		}
+		if auction.Mode == auctions.ModeCandle {
+			return ErrNotReplayable
+		}
+		registry = auction.Registry
+	case sb_auctions.ContractSBAuctionID:
+		auction, err := sb_auctions.DecodeAuction(e.value)
+		if err != nil {
+			return err
+		}
+		registry = auction.Registry
+	default:
+		return errors.New("not an auction of contract " + auctions.ContractAuctionID + " or " + sb_auctions.ContractSBAuctionID)
+	}
+	if !registry.Equal(byzcoin.InstanceID{}) {
+		return ErrNotReplayable
+	}
+	return nil
+}
+
+// fill sets the outcome of the replayed auction and splits its payouts in
+// the payment of the seller and the refunds.
+func (rep *Report) fill(e entry, payouts auctioncore.Payouts) error {
+	switch e.contractID {
+	case auctions.ContractAuctionID:
+		auction, err := auctions.DecodeAuction(e.value)
+		if err != nil {
+			return err
+		}
+		rep.Outcome, rep.Lots = auction.Outcome()
+		rep.Seller = auction.SellerAccount
+	case sb_auctions.ContractSBAuctionID:
+		auction, err := sb_auctions.DecodeAuction(e.value)
+		if err != nil {
+			return err
+		}
+		// The winner of a sealed-bid auction pays its bid to the seller
+		rep.Outcome = auctioncore.OutcomeData{State: auction.State.String(), Winner: auction.WinnerAccount}
+		if !auction.WinnerAccount.Equal(byzcoin.InstanceID{}) {
+			rep.Outcome.Price = payouts.Amount(auction.SellerAccount)
+		}
+		rep.Seller = auction.SellerAccount
+	}
+	for _, p := range payouts.List() {
+		if p.Account.Equal(rep.Seller) {
+			rep.Payment = p.Amount
+		} else {
+			rep.Refunds = append(rep.Refunds, p)
+		}
+	}
+	return nil
+}
+
+// base returns the instance from the proof about it.
+func (seg *Segment) base(key []byte) (entry, bool, error) {
+	for _, p := range seg.Proofs {
+		ok, err := p.InclusionProof.Exists(key)
+		if err != nil {
+			continue
+		}
+		if !ok {
+			return entry{}, false, nil
+		}
+		body := byzcoin.StateChangeBody{}
+		err = protobuf.Decode(p.InclusionProof.Get(key), &body)
+		if err != nil {
+			return entry{}, false, err
+		}
+		return entry{value: body.Value, version: body.Version, contractID: string(body.ContractID), darcID: body.DarcID}, true, nil
+	}
+	return entry{}, false, fmt.Errorf("instance %x is not in the segment", key)
+}
+
+// Export returns the segment of the auction from the database of a conode
+// following the ledger bcID. The conode must be stopped, or the database
+// copied, for it to be opened.
+func Export(db *bbolt.DB, bcID skipchain.SkipBlockID, auctInstID byzcoin.InstanceID) (*Segment, error) {
+	st, err := loadTrie(db, bcID)
+	if err != nil {
+		return nil, err
+	}
+	sbDB := skipchain.NewSkipBlockDB(db, []byte(skipchain.ServiceName+"_skipblocks"))
+	proof, err := byzcoin.NewProof(st, sbDB, bcID, auctInstID.Slice())
+	if err != nil {
+		return nil, err
+	}
+
+	// The blocks back to the spawn of the auction
+	seg := &Segment{}
+	sb := &proof.Latest
+	for {
+		seg.Blocks = append([]skipchain.SkipBlock{*sb}, seg.Blocks...)
+		spawned, err := spawns(sb, auctInstID)
+		if err != nil {
+			return nil, err
+		}
+		if spawned {
+			break
+		}
+		if len(sb.BackLinkIDs) == 0 || sb.Index == 0 {
+			return nil, errors.New("the auction is not spawned in the ledger")
+		}
+		sb = sbDB.GetByID(sb.BackLinkIDs[0])
+		if sb == nil {
+			return nil, fmt.Errorf("missing block %d", seg.Blocks[0].Index-1)
+		}
+	}
+
+	// The instances read by the replay, starting with the auction
+	keys := [][]byte{auctInstID.Slice()}
+	read := map[string]bool{string(auctInstID.Slice()): true}
+	r := newReplay(func(key []byte) (entry, bool, error) {
+		if !read[string(key)] {
+			read[string(key)] = true
+			keys = append(keys, append([]byte{}, key...))
+		}
+		return st.get(key)
+	})
+	// A failing replay is reported by Verify
+	r.run(seg.Blocks, auctInstID)
+
+	for _, key := range keys {
+		p, err := byzcoin.NewProof(st, sbDB, bcID, key)
+		if err != nil {
+			return nil, err
+		}
+		seg.Proofs = append(seg.Proofs, *p)
+	}
+	return seg, nil
+}
+
+// spawns tells if an accepted instruction of the block spawns the auction.
+func spawns(sb *skipchain.SkipBlock, auctInstID byzcoin.InstanceID) (bool, error) {
+	body, err := decodeBody(sb)
+	if err != nil {
+		return false, err
+	}
+	for _, tx := range body.TxResults {
+		if !tx.Accepted {
+			continue
+		}
+		for _, inst := range tx.ClientTransaction.Instructions {
+			if inst.Spawn != nil && inst.DeriveID("").Equal(auctInstID) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func decodeBody(sb *skipchain.SkipBlock) (byzcoin.DataBody, error) {
+	body := byzcoin.DataBody{}
+	err := protobuf.DecodeWithConstructors(sb.Payload, &body, network.DefaultConstructors(cothority.Suite))
+	return body, err
+}
+
+// diskTrie reads the state trie stored by the ByzCoin service.
+type diskTrie struct {
+	*trie.Trie
+}
+
+// trieIndexKey is the key of the index of the trie in its metadata.
+const trieIndexKey = "trieIndexKey"
+
+func loadTrie(db *bbolt.DB, bcID skipchain.SkipBlockID) (*diskTrie, error) {
+	bucket := []byte(fmt.Sprintf("%s_%x", byzcoin.ServiceName, []byte(bcID)))
+	err := db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket(bucket) == nil {
+			return errors.New("the database holds no state of the ledger")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	t, err := trie.LoadTrie(trie.NewDiskDB(db, bucket))
+	if err != nil {
+		return nil, err
+	}
+	return &diskTrie{t}, nil
+}
+
+func (t *diskTrie) get(key []byte) (entry, bool, error) {
+	buf, err := t.Get(key)
+	if err != nil || buf == nil {
+		return entry{}, false, err
+	}
+	body := byzcoin.StateChangeBody{}
+	err = protobuf.Decode(buf, &body)
+	if err != nil {
+		return entry{}, false, err
+	}
+	return entry{value: body.Value, version: body.Version, contractID: string(body.ContractID), darcID: body.DarcID}, true, nil
+}
+
+// GetValues implements byzcoin.ReadOnlyStateTrie.
+func (t *diskTrie) GetValues(key []byte) ([]byte, uint64, string, darc.ID, error) {
+	e, found, err := t.get(key)
+	if err != nil {
+		return nil, 0, "", nil, err
+	}
+	if !found {
+		return nil, 0, "", nil, errKeyNotSet
+	}
+	return e.value, e.version, e.contractID, e.darcID, nil
+}
+
+// GetIndex implements byzcoin.ReadOnlyStateTrie.
+func (t *diskTrie) GetIndex() int {
+	buf := t.GetMetadata([]byte(trieIndexKey))
+	if buf == nil {
+		return -1
+	}
+	return int(binary.LittleEndian.Uint32(buf))
+}
@@ -0,0 +1,168 @@
+package auction_audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/dedis/student_19_auctions/auctions"
+	"github.com/dedis/student_19_auctions/sb_auctions"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	bbolt "go.etcd.io/bbolt"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m, 0)
+}
+
+// auditTest is a ledger allowing the auction and sb_auction contracts.
+type auditTest struct {
+	local   *onet.LocalTest
+	servers []*onet.Server
+	cl      *byzcoin.Client
+	signer  darc.Signer
+	darcID  darc.ID
+}
+
+func newAuditTest(t *testing.T) *auditTest {
+	at := &auditTest{local: onet.NewTCPTest(cothority.Suite)}
+	var roster *onet.Roster
+	at.servers, roster, _ = at.local.GenTree(3, true)
+
+	at.signer = darc.NewSignerEd25519(nil, nil)
+	msg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:coin", "invoke:coin.mint", "invoke:coin.fetch",
+			"spawn:auction", "invoke:auction.bid", "invoke:auction.close",
+			"spawn:sb_auction", "invoke:sb_auction.bid", "invoke:sb_auction.close", "invoke:sb_auction.process"},
+		at.signer.Identity())
+	require.NoError(t, err)
+	msg.BlockInterval = time.Second / 2
+	at.cl, _, err = byzcoin.NewLedger(msg, false)
+	require.NoError(t, err)
+	at.darcID = msg.GenesisDarc.GetBaseID()
+	return at
+}
+
+func (at *auditTest) Close() {
+	at.local.CloseAll()
+}
+
+// account creates a coin account holding mint coins.
+func (at *auditTest) account(t *testing.T, mint uint64) byzcoin.InstanceID {
+	sender := auctioncore.NewSender(at.cl, at.signer)
+	ctx, err := sender.Send(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(at.darcID),
+		Spawn:      &byzcoin.Spawn{ContractID: contracts.ContractCoinID},
+	})
+	require.NoError(t, err)
+	accInstID := ctx.Instructions[0].DeriveID("")
+	if mint > 0 {
+		_, err = sender.Send(byzcoin.Instruction{
+			InstanceID: accInstID,
+			Invoke: &byzcoin.Invoke{
+				ContractID: contracts.ContractCoinID,
+				Command:    "mint",
+				Args:       byzcoin.Arguments{{Name: "coins", Value: auctioncore.EncodeAmount(mint)}},
+			},
+		})
+		require.NoError(t, err)
+	}
+	return accInstID
+}
+
+// db returns the database of the first conode once it stored the latest
+// block.
+func (at *auditTest) db(t *testing.T) *bbolt.DB {
+	reply, err := at.cl.GetProof(at.darcID)
+	require.NoError(t, err)
+	bs := at.servers[0].Service(byzcoin.ServiceName).(*byzcoin.Service)
+	require.NoError(t, auctioncore.Poll(100*time.Millisecond, 10*time.Second, func() (bool, error) {
+		st, err := bs.GetReadOnlyStateTrie(at.cl.ID)
+		return err == nil && st.GetIndex() >= reply.Proof.Latest.Index, nil
+	}))
+	return at.servers[0].Service(skipchain.ServiceName).(*skipchain.Service).GetDB().DB
+}
+
+func TestVerify(t *testing.T) {
+	at := newAuditTest(t)
+	defer at.Close()
+
+	seller, deposits := at.account(t, 0), at.account(t, 0)
+	bidder, bidder2 := at.account(t, 100), at.account(t, 100)
+
+	// A forward auction won by bidder2, bidder being refunded
+	acl := auctions.NewClient(at.cl, at.signer)
+	auctInstID, err := acl.CreateAuction(at.darcID, auctions.AuctionData{
+		GoodDescription: "bananas",
+		SellerAccount:   seller,
+		State:           auctioncore.StateOpen,
+		ReservePrice:    auctioncore.CreateHash("pepper", 20),
+	})
+	require.NoError(t, err)
+	require.NoError(t, acl.Bid(auctInstID, auctions.BidData{BidderAccount: bidder}, 30))
+	require.NoError(t, acl.Bid(auctInstID, auctions.BidData{BidderAccount: bidder2}, 40))
+	require.NoError(t, acl.Close(auctInstID, auctions.CloseData{Salt: "pepper", ReservePrice: 20}))
+
+	// A sealed-bid auction won by bidder
+	scl := sb_auctions.NewClient(at.cl, at.signer)
+	sbInstID, err := scl.CreateAuction(at.darcID, sb_auctions.AuctionData{
+		GoodDescription: "apples",
+		SellerAccount:   seller,
+		ReservePrice:    20,
+		State:           sb_auctions.OPEN,
+		Deposits:        deposits,
+	})
+	require.NoError(t, err)
+	require.NoError(t, scl.Bid(sbInstID, bidder, 25))
+	require.NoError(t, scl.Bid(sbInstID, bidder2, 30))
+	require.NoError(t, scl.Bid(sbInstID, bidder, 50))
+	require.NoError(t, scl.Close(sbInstID))
+
+	db := at.db(t)
+	seg, err := Export(db, at.cl.ID, auctInstID)
+	require.NoError(t, err)
+	buf, err := seg.Encode()
+	require.NoError(t, err)
+	seg, err = DecodeSegment(buf)
+	require.NoError(t, err)
+
+	report, err := Verify(seg, at.cl.ID, auctInstID)
+	require.NoError(t, err)
+	require.True(t, report.Match, report.Mismatch)
+	require.Equal(t, auctioncore.OutcomeData{State: auctioncore.StateWClosed, Winner: bidder2, Price: 40}, report.Outcome)
+	require.Equal(t, uint64(40), report.Payment)
+	require.Equal(t, []auctioncore.PayoutData{{Account: bidder, Amount: 30}}, report.Refunds)
+
+	sbSeg, err := Export(db, at.cl.ID, sbInstID)
+	require.NoError(t, err)
+	report, err = Verify(sbSeg, at.cl.ID, sbInstID)
+	require.NoError(t, err)
+	require.True(t, report.Match, report.Mismatch)
+	require.Equal(t, bidder, report.Outcome.Winner)
+	require.Equal(t, uint64(50), report.Outcome.Price)
+	require.Equal(t, uint64(50), report.Payment)
+	require.Equal(t, []auctioncore.PayoutData{{Account: bidder2, Amount: 30}}, report.Refunds)
+
+	// The segment of an auction does not prove another one
+	_, err = Verify(seg, at.cl.ID, sbInstID)
+	require.Error(t, err)
+
+	// Neither does a segment of another ledger, or with a block missing
+	_, err = Verify(seg, skipchain.SkipBlockID(sbInstID.Slice()), auctInstID)
+	require.Error(t, err)
+	seg.Blocks = append(seg.Blocks[:1], seg.Blocks[2:]...)
+	_, err = Verify(seg, at.cl.ID, auctInstID)
+	require.Error(t, err)
+
+	// A block whose transactions were changed is refused
+	sbSeg.Blocks[0].Payload = append([]byte{}, sbSeg.Blocks[0].Payload[1:]...)
+	_, err = Verify(sbSeg, at.cl.ID, sbInstID)
+	require.Error(t, err)
+}
@@ -0,0 +1,286 @@
+package auction_audit
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/dedis/student_19_auctions/auctions"
+	"github.com/dedis/student_19_auctions/sb_auctions"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/byzcoin/trie"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/protobuf"
+)
+
+// ErrNoTrie is returned to the contracts asking for a proof of the state
+// trie, like the candle auctions drawing their end, as the trie of the
+// past blocks cannot be rebuilt offline.
+var ErrNoTrie = errors.New("the state trie of past blocks is not available offline")
+
+var errKeyNotSet = errors.New("key not set")
+
+// entry is an instance of the state.
+type entry struct {
+	value      []byte
+	version    uint64
+	contractID string
+	darcID     darc.ID
+}
+
+// base gives the instances the replay did not write, found is false for
+// an instance that does not exist.
+type base func(key []byte) (e entry, found bool, err error)
+
+// owned are the contracts whose instances only the auction being replayed
+// writes: the auction and its sealed bids. As the base is the state at the
+// end of the segment, their instances are absent until the replay writes
+// them.
+var owned = map[string]bool{
+	auctions.ContractAuctionID:      true,
+	sb_auctions.ContractSBAuctionID: true,
+	sb_auctions.ContractSBBidID:     true,
+}
+
+// replay runs the instructions of an auction on a state made of the
+// instances it wrote over the base.
+type replay struct {
+	base    base
+	written map[string]*entry
+	index   int
+	// payouts are the coins stored on the accounts by the auction.
+	payouts auctioncore.Payouts
+}
+
+func newReplay(b base) *replay {
+	return &replay{base: b, written: make(map[string]*entry)}
+}
+
+// GetValues implements byzcoin.ReadOnlyStateTrie.
+func (r *replay) GetValues(key []byte) ([]byte, uint64, string, darc.ID, error) {
+	e, found, err := r.get(key)
+	if err != nil {
+		return nil, 0, "", nil, err
+	}
+	if !found {
+		return nil, 0, "", nil, errKeyNotSet
+	}
+	return e.value, e.version, e.contractID, e.darcID, nil
+}
+
+// GetProof implements byzcoin.ReadOnlyStateTrie.
+func (r *replay) GetProof(key []byte) (*trie.Proof, error) {
+	return nil, ErrNoTrie
+}
+
+// GetIndex implements byzcoin.ReadOnlyStateTrie, it is the index of the
+// block before the one being replayed.
+func (r *replay) GetIndex() int {
+	return r.index
+}
+
+func (r *replay) get(key []byte) (entry, bool, error) {
+	if e, ok := r.written[string(key)]; ok {
+		if e == nil {
+			return entry{}, false, nil
+		}
+		return *e, true, nil
+	}
+	e, found, err := r.base(key)
+	if err != nil || !found || owned[e.contractID] {
+		return entry{}, false, err
+	}
+	return e, true, nil
+}
+
+// GetContractConstructor implements auctioncore.Contracts. The only
+// contract called by the auctions is the coin contract, to store their
+// payouts.
+func (r *replay) GetContractConstructor(contractID string) (byzcoin.ContractFn, bool) {
+	if contractID != contracts.ContractCoinID {
+		return nil, false
+	}
+	return r.coinFromBytes, true
+}
+
+// apply stores the state changes in the replayed state.
+func (r *replay) apply(scs []byzcoin.StateChange) error {
+	for _, sc := range scs {
+		old, found, err := r.get(sc.InstanceID)
+		if err != nil {
+			return err
+		}
+		key := string(sc.InstanceID)
+		switch sc.StateAction {
+		case byzcoin.Create:
+			if found {
+				return fmt.Errorf("tried to create existing instance %x", sc.InstanceID)
+			}
+			r.written[key] = &entry{value: sc.Value, contractID: sc.ContractID, darcID: sc.DarcID}
+		case byzcoin.Update:
+			if !found {
+				return fmt.Errorf("tried to update non-existing instance %x", sc.InstanceID)
+			}
+			r.written[key] = &entry{value: sc.Value, version: old.version + 1, contractID: sc.ContractID, darcID: sc.DarcID}
+		case byzcoin.Remove:
+			if !found {
+				return fmt.Errorf("tried to remove non-existing instance %x", sc.InstanceID)
+			}
+			r.written[key] = nil
+		}
+	}
+	return nil
+}
+
+// run replays the accepted instructions of the blocks on the auction. The
+// instructions of the same transactions are run as far as the coins they
+// pass on to the auction are concerned: the fetches of the coin contract.
+func (r *replay) run(blocks []skipchain.SkipBlock, auctInstID byzcoin.InstanceID) (contractID string, err error) {
+	for i := range blocks {
+		sb := &blocks[i]
+		var body byzcoin.DataBody
+		body, err = decodeBody(sb)
+		if err != nil {
+			return
+		}
+		r.index = sb.Index - 1
+		for _, tx := range body.TxResults {
+			if !tx.Accepted || !touches(tx.ClientTransaction, auctInstID) {
+				continue
+			}
+			var cin []byzcoin.Coin
+			for _, inst := range tx.ClientTransaction.Instructions {
+				switch {
+				case inst.Spawn != nil && inst.DeriveID("").Equal(auctInstID):
+					if contractID != "" {
+						return "", errors.New("the auction is spawned twice")
+					}
+					contractID = inst.Spawn.ContractID
+					cin, err = r.runAuction(contractID, nil, inst, cin)
+				case inst.InstanceID.Equal(auctInstID):
+					if contractID == "" {
+						return "", errors.New("instruction on the auction before its spawn")
+					}
+					var e entry
+					var found bool
+					e, found, err = r.get(auctInstID.Slice())
+					if err == nil && !found {
+						err = auctioncore.ErrUnknownInstanceID
+					}
+					if err == nil {
+						cin, err = r.runAuction(contractID, e.value, inst, cin)
+					}
+				default:
+					cin, err = r.passCoins(inst, cin)
+				}
+				if err != nil {
+					return "", fmt.Errorf("block %d: %s: %v", sb.Index, inst, err)
+				}
+			}
+		}
+	}
+	if contractID == "" {
+		return "", errors.New("the auction is not spawned in the segment")
+	}
+	return contractID, nil
+}
+
+func touches(ctx byzcoin.ClientTransaction, auctInstID byzcoin.InstanceID) bool {
+	for _, inst := range ctx.Instructions {
+		if inst.InstanceID.Equal(auctInstID) || (inst.Spawn != nil && inst.DeriveID("").Equal(auctInstID)) {
+			return true
+		}
+	}
+	return false
+}
+
+// runAuction runs the instruction with the contract of the auction. A
+// panic of the contract is an error, as it is for the ByzCoin service.
+func (r *replay) runAuction(contractID string, value []byte, inst byzcoin.Instruction, cin []byzcoin.Coin) (cout []byzcoin.Coin, err error) {
+	defer func() {
+		if re := recover(); re != nil {
+			err = fmt.Errorf("%s", re)
+		}
+	}()
+
+	var c byzcoin.Contract
+	switch contractID {
+	case auctions.ContractAuctionID:
+		c, err = auctions.NewContract(r, value)
+	case sb_auctions.ContractSBAuctionID:
+		c, err = sb_auctions.NewContract(r, value)
+	default:
+		return nil, errors.New("cannot replay auctions of contract " + contractID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var scs []byzcoin.StateChange
+	switch inst.GetType() {
+	case byzcoin.SpawnType:
+		scs, cout, err = c.Spawn(r, inst, cin)
+	case byzcoin.InvokeType:
+		scs, cout, err = c.Invoke(r, inst, cin)
+	case byzcoin.DeleteType:
+		scs, cout, err = c.Delete(r, inst, cin)
+	default:
+		err = errors.New("unexpected instruction type")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cout, r.apply(scs)
+}
+
+// passCoins runs an instruction on another instance of the transaction.
+// Only the coins fetched from an account matter to the auction, all the
+// other instructions pass the coins on unchanged.
+func (r *replay) passCoins(inst byzcoin.Instruction, cin []byzcoin.Coin) ([]byzcoin.Coin, error) {
+	if inst.Invoke == nil || inst.Invoke.ContractID != contracts.ContractCoinID || inst.Invoke.Command != "fetch" {
+		return cin, nil
+	}
+	coin, err := auctioncore.GetCoin(r, inst.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := auctioncore.DecodeAmount(inst.Invoke.Args.Search("coins"))
+	if err != nil {
+		return nil, err
+	}
+	return append(cin, byzcoin.Coin{Name: coin.Name, Value: amount}), nil
+}
+
+// offlineCoin is the part of the coin contract the auctions call: "store"
+// records a payout, without touching the account whose balance is not
+// known at the time of the replay.
+type offlineCoin struct {
+	byzcoin.BasicContract
+	byzcoin.Coin
+	r *replay
+}
+
+func (r *replay) coinFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &offlineCoin{r: r}
+	err := protobuf.Decode(in, &c.Coin)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *offlineCoin) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	if inst.Invoke.Command != "store" {
+		return nil, nil, errors.New("only store is replayed offline")
+	}
+	for _, co := range coins {
+		if c.Name.Equal(co.Name) {
+			c.r.payouts.Add(inst.InstanceID, co.Value)
+		} else {
+			cout = append(cout, co)
+		}
+	}
+	return nil, cout, nil
+}
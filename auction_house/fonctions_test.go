@@ -0,0 +1,115 @@
+package auction_house_test
+
+import (
+	"testing"
+
+	"github.com/dedis/student_19_auctions/auction_house"
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/dedis/student_19_auctions/auctioncore/bctest"
+	"github.com/dedis/student_19_auctions/auctions"
+	"github.com/dedis/student_19_auctions/sb_auctions"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/darc/expression"
+	"go.dedis.ch/protobuf"
+)
+
+// bcTest is used here to provide some simple test structure for different
+// tests.
+type bcTest struct {
+	*bctest.BCTest
+}
+
+func newBCTest(t *testing.T) *bcTest {
+	// The genesis darc has the right to create auction houses and to list
+	// auctions in them.
+	return &bcTest{bctest.New(t,
+		"spawn:auction_house", "spawn:auction", "invoke:auction.drop", "spawn:sb_auction",
+		"invoke:sb_auction.close")}
+}
+
+func (bct *bcTest) createHouse(t *testing.T, name string) byzcoin.InstanceID {
+	houseBuf, err := protobuf.Encode(&auction_house.HouseData{Name: name})
+	require.NoError(t, err)
+
+	ctx, err := bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(bct.GDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: auction_house.ContractHouseID,
+			Args:       byzcoin.Arguments{{Name: "house", Value: houseBuf}},
+		},
+	})
+	require.NoError(t, err)
+	return ctx.Instructions[0].DeriveID("")
+}
+
+// createDarc spawns a darc owned by the signer, giving it the rules.
+func (bct *bcTest) createDarc(t *testing.T, owner darc.Signer, rules ...string) *darc.Darc {
+	rs := darc.InitRules([]darc.Identity{owner.Identity()}, []darc.Identity{owner.Identity()})
+	for _, r := range rules {
+		require.NoError(t, rs.AddRule(darc.Action(r), expression.InitOrExpr(owner.Identity().String())))
+	}
+	d := darc.NewDarc(rs, []byte("darc"))
+	dBuf, err := d.ToProto()
+	require.NoError(t, err)
+
+	_, err = bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(bct.GDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: byzcoin.ContractDarcID,
+			Args:       byzcoin.Arguments{{Name: "darc", Value: dBuf}},
+		},
+	})
+	require.NoError(t, err)
+	return d
+}
+
+// createAuction spawns an open auction listed in the house.
+func (bct *bcTest) createAuction(t *testing.T, houseID byzcoin.InstanceID, seller byzcoin.InstanceID, category string) byzcoin.InstanceID {
+	auctionBuf, err := protobuf.Encode(&auctions.AuctionData{
+		GoodDescription: "good",
+		SellerAccount:   seller,
+		State:           auctioncore.StateOpen,
+		Registry:        houseID,
+		Category:        category,
+	})
+	require.NoError(t, err)
+	return bct.spawn(t, auctions.ContractAuctionID, auctionBuf)
+}
+
+// createSBAuction spawns a sealed-bid auction listed in the house.
+func (bct *bcTest) createSBAuction(t *testing.T, houseID byzcoin.InstanceID, seller byzcoin.InstanceID, category string) byzcoin.InstanceID {
+	auctionBuf, err := protobuf.Encode(&sb_auctions.AuctionData{
+		GoodDescription: "good",
+		SellerAccount:   seller,
+		State:           sb_auctions.OPEN,
+		Registry:        houseID,
+		Category:        category,
+	})
+	require.NoError(t, err)
+	return bct.spawn(t, sb_auctions.ContractSBAuctionID, auctionBuf)
+}
+
+func (bct *bcTest) spawn(t *testing.T, contractID string, auctionBuf []byte) byzcoin.InstanceID {
+	ctx, err := bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(bct.GDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contractID,
+			Args:       byzcoin.Arguments{{Name: "auction", Value: auctionBuf}},
+		},
+	})
+	require.NoError(t, err)
+	return ctx.Instructions[0].DeriveID("")
+}
+
+func (bct *bcTest) invoke(t *testing.T, contractID string, auctInstID byzcoin.InstanceID, command string) {
+	_, err := bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: auctInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: contractID,
+			Command:    command,
+		},
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,344 @@
+package auction_house
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+// ContractHouseID identifies an auction house contract. Only the auction
+// and sb_auction contracts register with a house: the clock, comb and
+// double auctions have no entries.
+var ContractHouseID = "auction_house"
+
+// ContractEntryID identifies the instances holding the auctions of a house.
+// They are only created and updated by the auction contracts, through
+// Register and UpdateState.
+var ContractEntryID = "auction_house_entry"
+
+// ContractListID identifies the instances counting the entries of a seller
+// or of a state, and ContractItemID the instances holding each of them.
+// They index the house so that List does not read every entry.
+var ContractListID = "auction_house_list"
+var ContractItemID = "auction_house_item"
+
+type contractHouse struct {
+	byzcoin.BasicContract
+	HouseData
+}
+
+func contractHouseFromBytes(in []byte) (byzcoin.Contract, error) {
+	cv := &contractHouse{}
+	err := protobuf.Decode(in, &cv.HouseData)
+	if err != nil {
+		return nil, err
+	}
+	return cv, nil
+}
+
+type contractEntry struct {
+	byzcoin.BasicContract
+	EntryData
+}
+
+func contractEntryFromBytes(in []byte) (byzcoin.Contract, error) {
+	cv := &contractEntry{}
+	err := protobuf.Decode(in, &cv.EntryData)
+	if err != nil {
+		return nil, err
+	}
+	return cv, nil
+}
+
+type contractList struct {
+	byzcoin.BasicContract
+	ListData
+}
+
+func contractListFromBytes(in []byte) (byzcoin.Contract, error) {
+	cv := &contractList{}
+	err := protobuf.Decode(in, &cv.ListData)
+	if err != nil {
+		return nil, err
+	}
+	return cv, nil
+}
+
+type contractItem struct {
+	byzcoin.BasicContract
+	ItemData
+}
+
+func contractItemFromBytes(in []byte) (byzcoin.Contract, error) {
+	cv := &contractItem{}
+	err := protobuf.Decode(in, &cv.ItemData)
+	if err != nil {
+		return nil, err
+	}
+	return cv, nil
+}
+
+// Spawn creates a new, empty, auction house.
+func (c *contractHouse) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	houseBuf := inst.Spawn.Args.Search("house")
+	if houseBuf == nil {
+		return nil, nil, errors.New("need an argument with name house")
+	}
+	house := HouseData{}
+	err = protobuf.Decode(houseBuf, &house)
+	if err != nil {
+		return nil, nil, errors.New("not an auction house")
+	}
+	if house.Count != 0 {
+		return nil, nil, errors.New("a new auction house must be empty")
+	}
+
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""), ContractHouseID, houseBuf, darcID),
+	}
+	return
+}
+
+// EntryID returns the instance holding the entry index of the house.
+func EntryID(houseID byzcoin.InstanceID, index uint64) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write([]byte(ContractEntryID))
+	h.Write(houseID.Slice())
+	binary.Write(h, binary.LittleEndian, index)
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
+
+// SellerList and StateList name the lists of the entries of a seller and
+// of the entries in a state.
+func SellerList(seller byzcoin.InstanceID) string {
+	return "seller:" + seller.String()
+}
+
+// StateList is described with SellerList.
+func StateList(state string) string {
+	return "state:" + state
+}
+
+// ListID returns the instance counting the entries of the list name.
+func ListID(houseID byzcoin.InstanceID, name string) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write([]byte(ContractListID))
+	h.Write(houseID.Slice())
+	h.Write([]byte(name))
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
+
+// ItemID returns the instance holding the item pos of the list name.
+func ItemID(houseID byzcoin.InstanceID, name string, pos uint64) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write([]byte(ContractItemID))
+	h.Write(houseID.Slice())
+	h.Write([]byte(name))
+	binary.Write(h, binary.LittleEndian, pos)
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
+
+// Register adds the entry of a new auction to the house. It is called by
+// the auction contracts when spawning an auction and returns the index of
+// the entry, to be kept by the auction for its updates. The signers of the
+// spawn must satisfy the sign rule of the darc of the house.
+func Register(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, houseID byzcoin.InstanceID, entry EntryData, darcID darc.ID) ([]byzcoin.StateChange, uint64, error) {
+	house, houseDarcID, err := getHouse(rst, houseID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = auctioncore.VerifyOwner(rst, inst, houseID); err != nil {
+		return nil, 0, errors.New("not allowed to list in the house: " + err.Error())
+	}
+	entry.Index = house.Count
+	house.Count++
+
+	sc, _, err := appendItem(rst, houseID, SellerList(entry.Seller), entry.Index, houseDarcID)
+	if err != nil {
+		return nil, 0, err
+	}
+	stateSC, pos, err := appendItem(rst, houseID, StateList(entry.State), entry.Index, houseDarcID)
+	if err != nil {
+		return nil, 0, err
+	}
+	sc = append(sc, stateSC...)
+	entry.StatePos = pos
+
+	entryBuf, err := protobuf.Encode(&entry)
+	if err != nil {
+		return nil, 0, errors.New("encode entry buf sc")
+	}
+	houseBuf, err := protobuf.Encode(&house)
+	if err != nil {
+		return nil, 0, errors.New("encode house buf sc")
+	}
+	return append(sc,
+		byzcoin.NewStateChange(byzcoin.Create, EntryID(houseID, entry.Index),
+			ContractEntryID, entryBuf, darcID),
+		byzcoin.NewStateChange(byzcoin.Update, houseID,
+			ContractHouseID, houseBuf, houseDarcID),
+	), entry.Index, nil
+}
+
+// UpdateState records the new state of the auction in its entry and moves
+// the entry to the list of its new state. Only the auction registered in
+// the entry can update it.
+func UpdateState(rst byzcoin.ReadOnlyStateTrie, houseID byzcoin.InstanceID, index uint64, auctInstID byzcoin.InstanceID, state string) ([]byzcoin.StateChange, error) {
+	entryID := EntryID(houseID, index)
+	entry, darcID, err := getEntry(rst, entryID)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Auction != auctInstID {
+		return nil, errors.New("entry belongs to another auction")
+	}
+
+	var sc []byzcoin.StateChange
+	if entry.State != state {
+		_, houseDarcID, err := getHouse(rst, houseID)
+		if err != nil {
+			return nil, err
+		}
+		sc, err = removeItem(rst, houseID, StateList(entry.State), entry.StatePos, index)
+		if err != nil {
+			return nil, err
+		}
+		stateSC, pos, err := appendItem(rst, houseID, StateList(state), index, houseDarcID)
+		if err != nil {
+			return nil, err
+		}
+		sc = append(sc, stateSC...)
+		entry.State = state
+		entry.StatePos = pos
+	}
+
+	entryBuf, err := protobuf.Encode(&entry)
+	if err != nil {
+		return nil, errors.New("encode entry buf sc")
+	}
+	return append(sc,
+		byzcoin.NewStateChange(byzcoin.Update, entryID, ContractEntryID, entryBuf, darcID),
+	), nil
+}
+
+// appendItem adds the entry index at the end of the list name and returns
+// its position.
+func appendItem(rst byzcoin.ReadOnlyStateTrie, houseID byzcoin.InstanceID, name string, index uint64, darcID darc.ID) ([]byzcoin.StateChange, uint64, error) {
+	list, found, err := getList(rst, ListID(houseID, name))
+	if err != nil {
+		return nil, 0, err
+	}
+	action := byzcoin.Update
+	if !found {
+		action = byzcoin.Create
+	}
+	pos := list.Count
+	list.Count++
+
+	listBuf, err := protobuf.Encode(&list)
+	if err != nil {
+		return nil, 0, errors.New("encode list buf sc")
+	}
+	itemBuf, err := protobuf.Encode(&ItemData{Entry: index})
+	if err != nil {
+		return nil, 0, errors.New("encode item buf sc")
+	}
+	return []byzcoin.StateChange{
+		byzcoin.NewStateChange(action, ListID(houseID, name), ContractListID, listBuf, darcID),
+		byzcoin.NewStateChange(byzcoin.Create, ItemID(houseID, name, pos), ContractItemID, itemBuf, darcID),
+	}, pos, nil
+}
+
+// removeItem removes the entry index at position pos of the list name. The
+// other items keep their positions, so that a listing in progress neither
+// skips nor repeats entries: the position stays empty and the list is not
+// shortened.
+func removeItem(rst byzcoin.ReadOnlyStateTrie, houseID byzcoin.InstanceID, name string, pos uint64, index uint64) ([]byzcoin.StateChange, error) {
+	list, found, err := getList(rst, ListID(houseID, name))
+	if err != nil {
+		return nil, err
+	}
+	if !found || pos >= list.Count {
+		return nil, errors.New("entry is not in the list of its state")
+	}
+	itemID := ItemID(houseID, name, pos)
+	item, darcID, err := getItem(rst, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if item.Entry != index {
+		return nil, errors.New("entry is not in the list of its state")
+	}
+	return []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Remove, itemID, ContractItemID, nil, darcID),
+	}, nil
+}
+
+func getHouse(rst byzcoin.ReadOnlyStateTrie, houseID byzcoin.InstanceID) (HouseData, darc.ID, error) {
+	house := HouseData{}
+	val, _, contractID, darcID, err := rst.GetValues(houseID.Slice())
+	if err != nil {
+		return house, nil, err
+	}
+	if contractID != ContractHouseID {
+		return house, nil, errors.New("instance is not an auction house")
+	}
+	err = protobuf.Decode(val, &house)
+	return house, darcID, err
+}
+
+func getEntry(rst byzcoin.ReadOnlyStateTrie, entryID byzcoin.InstanceID) (EntryData, darc.ID, error) {
+	entry := EntryData{}
+	val, _, contractID, darcID, err := rst.GetValues(entryID.Slice())
+	if err != nil {
+		return entry, nil, err
+	}
+	if contractID != ContractEntryID {
+		return entry, nil, errors.New("instance is not an auction house entry")
+	}
+	err = protobuf.Decode(val, &entry)
+	return entry, darcID, err
+}
+
+// getList returns the list, or an empty one if it has no entry yet.
+func getList(rst byzcoin.ReadOnlyStateTrie, listID byzcoin.InstanceID) (ListData, bool, error) {
+	list := ListData{}
+	val, _, contractID, _, err := rst.GetValues(listID.Slice())
+	if auctioncore.IsKeyNotSet(err) {
+		return list, false, nil
+	}
+	if err != nil {
+		return list, false, err
+	}
+	if contractID != ContractListID {
+		return list, false, errors.New("instance is not an auction house list")
+	}
+	err = protobuf.Decode(val, &list)
+	return list, true, err
+}
+
+func getItem(rst byzcoin.ReadOnlyStateTrie, itemID byzcoin.InstanceID) (ItemData, darc.ID, error) {
+	item := ItemData{}
+	val, _, contractID, darcID, err := rst.GetValues(itemID.Slice())
+	if err != nil {
+		return item, nil, err
+	}
+	if contractID != ContractItemID {
+		return item, nil, errors.New("instance is not an auction house item")
+	}
+	err = protobuf.Decode(val, &item)
+	return item, darcID, err
+}
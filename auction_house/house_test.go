@@ -0,0 +1,130 @@
+package auction_house
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/trie"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+func TestRegister(t *testing.T) {
+	owner := darc.NewSignerEd25519(nil, nil)
+	stranger := darc.NewSignerEd25519(nil, nil)
+	d := darc.NewDarc(darc.InitRules([]darc.Identity{owner.Identity()},
+		[]darc.Identity{owner.Identity()}), []byte("house"))
+	dBuf, err := d.ToProto()
+	require.NoError(t, err)
+
+	houseID := byzcoin.NewInstanceID([]byte("house"))
+	a := byzcoin.NewInstanceID([]byte("a"))
+	b := byzcoin.NewInstanceID([]byte("b"))
+	c := byzcoin.NewInstanceID([]byte("c"))
+	seller := byzcoin.NewInstanceID([]byte("seller"))
+	rst := testTrie{}
+	houseBuf, err := protobuf.Encode(&HouseData{Name: "house"})
+	require.NoError(t, err)
+	rst.apply(byzcoin.NewStateChange(byzcoin.Create, byzcoin.NewInstanceID(d.GetBaseID()), byzcoin.ContractDarcID, dBuf, d.GetBaseID()),
+		byzcoin.NewStateChange(byzcoin.Create, houseID, ContractHouseID, houseBuf, d.GetBaseID()))
+	inst := byzcoin.Instruction{SignerIdentities: []darc.Identity{owner.Identity()}}
+
+	// Only the owners of the house can list in it
+	_, _, err = Register(rst, byzcoin.Instruction{SignerIdentities: []darc.Identity{stranger.Identity()}},
+		houseID, EntryData{Auction: a, State: auctioncore.StateOpen}, darc.ID{})
+	require.Error(t, err)
+
+	for i, auctInstID := range []byzcoin.InstanceID{a, b, c} {
+		sc, index, err := Register(rst, inst, houseID, EntryData{Auction: auctInstID, Seller: seller, State: auctioncore.StateOpen}, darc.ID{})
+		require.NoError(t, err)
+		require.Equal(t, uint64(i), index)
+		rst.apply(sc...)
+	}
+	house, _, err := getHouse(rst, houseID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), house.Count)
+	requireList(t, rst, houseID, SellerList(seller), 0, 1, 2)
+	requireList(t, rst, houseID, StateList(auctioncore.StateOpen), 0, 1, 2)
+
+	// Only the auction of the entry can update it
+	_, err = UpdateState(rst, houseID, 0, b, auctioncore.StateClosed)
+	require.Error(t, err)
+	sc, err := UpdateState(rst, houseID, 0, a, auctioncore.StateClosed)
+	require.NoError(t, err)
+	rst.apply(sc...)
+
+	// The leaving entry empties its position, the others keep theirs
+	entry, _, err := getEntry(rst, EntryID(houseID, 0))
+	require.NoError(t, err)
+	require.Equal(t, EntryData{Index: 0, Auction: a, Seller: seller, State: auctioncore.StateClosed}, entry)
+	entry, _, err = getEntry(rst, EntryID(houseID, 2))
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), entry.StatePos)
+	requireList(t, rst, houseID, StateList(auctioncore.StateOpen), none, 1, 2)
+	requireList(t, rst, houseID, StateList(auctioncore.StateClosed), 0)
+	requireList(t, rst, houseID, SellerList(seller), 0, 1, 2)
+
+	sc, err = UpdateState(rst, houseID, 1, b, auctioncore.StateClosed)
+	require.NoError(t, err)
+	rst.apply(sc...)
+	requireList(t, rst, houseID, StateList(auctioncore.StateOpen), none, none, 2)
+	requireList(t, rst, houseID, StateList(auctioncore.StateClosed), 0, 1)
+
+	_, _, err = Register(rst, inst, a, EntryData{}, darc.ID{})
+	require.Error(t, err)
+	_, err = UpdateState(rst, houseID, 3, b, auctioncore.StateClosed)
+	require.Error(t, err)
+}
+
+// none marks an empty position in requireList.
+const none = ^uint64(0)
+
+// requireList checks the entries of the list name.
+func requireList(t *testing.T, rst testTrie, houseID byzcoin.InstanceID, name string, entries ...uint64) {
+	list, _, err := getList(rst, ListID(houseID, name))
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(entries)), list.Count)
+	for pos, index := range entries {
+		item, _, err := getItem(rst, ItemID(houseID, name, uint64(pos)))
+		if index == none {
+			require.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, index, item.Entry)
+	}
+	_, _, err = getItem(rst, ItemID(houseID, name, list.Count))
+	require.Error(t, err)
+}
+
+// testTrie is a ReadOnlyStateTrie holding a few instances.
+type testTrie map[byzcoin.InstanceID]byzcoin.StateChange
+
+func (tt testTrie) apply(scs ...byzcoin.StateChange) {
+	for _, sc := range scs {
+		if sc.StateAction == byzcoin.Remove {
+			delete(tt, byzcoin.NewInstanceID(sc.InstanceID))
+			continue
+		}
+		tt[byzcoin.NewInstanceID(sc.InstanceID)] = sc
+	}
+}
+
+func (tt testTrie) GetValues(key []byte) ([]byte, uint64, string, darc.ID, error) {
+	sc, ok := tt[byzcoin.NewInstanceID(key)]
+	if !ok {
+		return nil, 0, "", nil, errors.New("key not set")
+	}
+	return sc.Value, sc.Version, sc.ContractID, sc.DarcID, nil
+}
+
+func (tt testTrie) GetProof(key []byte) (*trie.Proof, error) {
+	return nil, errors.New("not supported")
+}
+
+func (tt testTrie) GetIndex() int {
+	return 0
+}
@@ -0,0 +1,90 @@
+package auction_house
+
+import (
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3/byzcoin"
+)
+
+// Filter selects the entries returned by List. The empty fields match all
+// the entries.
+type Filter struct {
+	State    string
+	Seller   byzcoin.InstanceID
+	Category string
+}
+
+func (f Filter) match(entry EntryData) bool {
+	return (f.State == "" || f.State == entry.State) &&
+		(f.Seller.Equal(byzcoin.InstanceID{}) || f.Seller == entry.Seller) &&
+		(f.Category == "" || f.Category == entry.Category)
+}
+
+// List returns at most limit entries of the house matching the filter,
+// starting from the position from. It walks the list of the seller if the
+// filter has one, else the list of the state if it has one, else all the
+// entries of the house; from and next are positions in that list. The list
+// of a seller and the entries of the house are in the order the auctions
+// were registered. The list of a state is not: an entry leaving the state
+// is replaced by the last one of the list. The listing continues with the
+// position next, which is the length of the list once it has been read.
+// Every entry is read with a proof verified against the ledger.
+func List(cl *byzcoin.Client, houseID byzcoin.InstanceID, filter Filter, from uint64, limit int) (entries []EntryData, next uint64, err error) {
+	name := ""
+	switch {
+	case !filter.Seller.Equal(byzcoin.InstanceID{}):
+		name = SellerList(filter.Seller)
+	case filter.State != "":
+		name = StateList(filter.State)
+	}
+
+	var count uint64
+	if name == "" {
+		house := HouseData{}
+		err = getVerified(cl, houseID, ContractHouseID, &house)
+		if err != nil {
+			return nil, 0, err
+		}
+		count = house.Count
+	} else {
+		list := ListData{}
+		_, err = auctioncore.ReadInstance(cl, ListID(houseID, name), ContractListID, &list)
+		if err != nil {
+			return nil, 0, err
+		}
+		count = list.Count
+	}
+
+	for next = from; next < count && len(entries) < limit; next++ {
+		index := next
+		if name != "" {
+			item := ItemData{}
+			var found bool
+			found, err = auctioncore.ReadInstance(cl, ItemID(houseID, name, next), ContractItemID, &item)
+			if err != nil {
+				return nil, 0, err
+			}
+			if !found {
+				continue
+			}
+			index = item.Entry
+		}
+		entry := EntryData{}
+		err = getVerified(cl, EntryID(houseID, index), ContractEntryID, &entry)
+		if err != nil {
+			return nil, 0, err
+		}
+		if filter.match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, next, nil
+}
+
+// getVerified reads an instance that must exist.
+func getVerified(cl *byzcoin.Client, instID byzcoin.InstanceID, contractID string, value interface{}) error {
+	found, err := auctioncore.ReadInstance(cl, instID, contractID, value)
+	if err == nil && !found {
+		err = auctioncore.ErrUnknownInstanceID
+	}
+	return err
+}
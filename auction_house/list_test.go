@@ -0,0 +1,110 @@
+package auction_house_test
+
+import (
+	"testing"
+
+	"github.com/dedis/student_19_auctions/auction_house"
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/dedis/student_19_auctions/auctions"
+	"github.com/dedis/student_19_auctions/sb_auctions"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+func TestContractHouse(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	sellerA := byzcoin.NewInstanceID([]byte("seller a"))
+	sellerB := byzcoin.NewInstanceID([]byte("seller b"))
+
+	houseID := bct.createHouse(t, "house")
+	a1 := bct.createAuction(t, houseID, sellerA, "fruit")
+	a2 := bct.createAuction(t, houseID, sellerB, "cars")
+	a3 := bct.createSBAuction(t, houseID, sellerA, "fruit")
+
+	// The registry follows the auctions
+	bct.invoke(t, auctions.ContractAuctionID, a1, "drop")
+	bct.invoke(t, sb_auctions.ContractSBAuctionID, a3, "close")
+
+	entries, next, err := auction_house.List(bct.Cl, houseID, auction_house.Filter{}, 0, 2)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), next)
+	require.Equal(t, []auction_house.EntryData{
+		{Index: 0, Auction: a1, ContractID: auctions.ContractAuctionID, Seller: sellerA, Category: "fruit", State: auctioncore.StateDropped},
+		{Index: 1, Auction: a2, ContractID: auctions.ContractAuctionID, Seller: sellerB, Category: "cars", State: auctioncore.StateOpen, StatePos: 1},
+	}, entries)
+	entries, next, err = auction_house.List(bct.Cl, houseID, auction_house.Filter{}, next, 2)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), next)
+	require.Equal(t, []auction_house.EntryData{
+		{Index: 2, Auction: a3, ContractID: sb_auctions.ContractSBAuctionID, Seller: sellerA, Category: "fruit", State: auctioncore.StateClosed},
+	}, entries)
+
+	entries, _, err = auction_house.List(bct.Cl, houseID, auction_house.Filter{State: auctioncore.StateOpen}, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, a2, entries[0].Auction)
+
+	// An entry leaving the state does not move the ones after it
+	a4 := bct.createAuction(t, houseID, sellerB, "cars")
+	entries, next, err = auction_house.List(bct.Cl, houseID, auction_house.Filter{State: auctioncore.StateOpen}, 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, a2, entries[0].Auction)
+	bct.invoke(t, auctions.ContractAuctionID, a2, "drop")
+	entries, _, err = auction_house.List(bct.Cl, houseID, auction_house.Filter{State: auctioncore.StateOpen}, next, 1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, a4, entries[0].Auction)
+
+	entries, _, err = auction_house.List(bct.Cl, houseID, auction_house.Filter{Seller: sellerA}, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, a1, entries[0].Auction)
+	require.Equal(t, a3, entries[1].Auction)
+
+	entries, next, err = auction_house.List(bct.Cl, houseID, auction_house.Filter{Seller: sellerA, State: auctioncore.StateClosed}, 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), next)
+	require.Equal(t, a3, entries[0].Auction)
+
+	entries, next, err = auction_house.List(bct.Cl, houseID, auction_house.Filter{State: auctioncore.StateClosed, Category: "cars"}, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), next)
+	require.Len(t, entries, 0)
+
+	// Only the owners of the house can list in it
+	stranger := darc.NewSignerEd25519(nil, nil)
+	strangerDarc := bct.createDarc(t, stranger, "spawn:"+auctions.ContractAuctionID)
+	auctionBuf, err := protobuf.Encode(&auctions.AuctionData{
+		GoodDescription: "good",
+		SellerAccount:   sellerB,
+		State:           auctioncore.StateOpen,
+		Registry:        houseID,
+		Category:        "cars",
+	})
+	require.NoError(t, err)
+	ctx := byzcoin.ClientTransaction{Instructions: []byzcoin.Instruction{{
+		InstanceID: byzcoin.NewInstanceID(strangerDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: auctions.ContractAuctionID,
+			Args:       byzcoin.Arguments{{Name: "auction", Value: auctionBuf}},
+		},
+		SignerCounter: []uint64{1},
+	}}}
+	require.NoError(t, ctx.FillSignersAndSignWith(stranger))
+	_, err = bct.Cl.AddTransactionAndWait(ctx, 10)
+	require.Error(t, err)
+
+	// The auctions remember their entry
+	reply, err := bct.Cl.GetProof(a2.Slice())
+	require.NoError(t, err)
+	_, val, _, _, err := reply.Proof.KeyValue()
+	require.NoError(t, err)
+	auction := auctions.AuctionData{}
+	require.NoError(t, protobuf.Decode(val, &auction))
+	require.Equal(t, houseID, auction.Registry)
+	require.Equal(t, uint64(1), auction.RegistryIndex)
+}
@@ -0,0 +1,43 @@
+package auction_house
+
+import "go.dedis.ch/cothority/v3/byzcoin"
+
+// PROTOSTART
+// package auction_house;
+// import "byzcoin.proto";
+//
+// option java_package = "ch.epfl.dedis.lib.proto";
+// option java_outer_classname = "AuctionHouse";
+
+// HouseData is the value of an auction house instance. The auctions are
+// registered in entry instances numbered from 0 to Count-1.
+type HouseData struct {
+	Name  string
+	Count uint64
+}
+
+// EntryData is the value of an entry instance. It is created when an
+// auction registers with the house and updated on every change of the
+// state of the auction.
+type EntryData struct {
+	Index      uint64
+	Auction    byzcoin.InstanceID
+	ContractID string // Contract of the auction: auction, sb_auction, ...
+	Seller     byzcoin.InstanceID
+	Category   string
+	State      string
+	EndIndex   uint64 // Last block accepting bids, 0 if the seller closes the auction
+	StatePos   uint64 `protobuf:"opt"` // Position of the entry in the list of its state
+}
+
+// ListData is the value of a list instance, indexing the entries of a
+// seller or of a state. Its items are numbered from 0 to Count-1, the items
+// of the entries that left a state are removed without renumbering.
+type ListData struct {
+	Count uint64
+}
+
+// ItemData is the value of an item instance, pointing to an entry.
+type ItemData struct {
+	Entry uint64
+}
@@ -0,0 +1,11 @@
+package auction_house
+
+import (
+	"testing"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m, 0)
+}
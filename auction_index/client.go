@@ -0,0 +1,198 @@
+package auction_index
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// Client queries the index of a ledger kept by one conode. Every conode
+// has its own index, so the client always talks to the same one.
+type Client struct {
+	*onet.Client
+	Node      *network.ServerIdentity
+	ByzCoinID skipchain.SkipBlockID
+}
+
+// NewClient returns a client for the index of the ledger bcID on the node.
+func NewClient(node *network.ServerIdentity, bcID skipchain.SkipBlockID) *Client {
+	return &Client{
+		Client:    onet.NewClient(cothority.Suite, ServiceName),
+		Node:      node,
+		ByzCoinID: bcID,
+	}
+}
+
+// Follow makes the conode index the ledger, from the genesis block again
+// if rebuild is set. It returns the number of blocks already indexed.
+func (c *Client) Follow(rebuild bool) (uint64, error) {
+	reply := &FollowReply{}
+	err := c.SendProtobuf(c.Node, &Follow{ByzCoinID: c.ByzCoinID, Rebuild: rebuild}, reply)
+	return reply.Indexed, err
+}
+
+// Query returns the auctions matching the query, its ByzCoinID is filled
+// by the client.
+func (c *Client) Query(q Query) ([]AuctionRecord, error) {
+	q.ByzCoinID = c.ByzCoinID
+	reply := &QueryReply{}
+	err := c.SendProtobuf(c.Node, &q, reply)
+	return reply.Auctions, err
+}
+
+// History returns the auction with its bids and transitions.
+func (c *Client) History(auctInstID byzcoin.InstanceID) (*HistoryReply, error) {
+	reply := &HistoryReply{}
+	err := c.SendProtobuf(c.Node, &History{ByzCoinID: c.ByzCoinID, AuctionID: auctInstID}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// WaitIndexed waits until the first n blocks of the ledger are indexed.
+func (c *Client) WaitIndexed(n uint64, timeout time.Duration) error {
+	return auctioncore.Poll(100*time.Millisecond, timeout, func() (bool, error) {
+		indexed, err := c.Follow(false)
+		return indexed >= n, err
+	})
+}
+
+// EventStream iterates over the events of a ledger:
+//
+//	stream, err := c.StreamEvents(nil, []byzcoin.InstanceID{account}, 0)
+//	for stream.Next() {
+//		ev := stream.Event()
+//		...
+//	}
+//	err = stream.Err()
+//
+// A lost connection is opened again from the cursor, as is a new stream
+// given the Cursor of an old one: no event is missed, but the events of
+// the block the stream stopped in may be seen twice.
+type EventStream struct {
+	c      *Client
+	req    StreamEvents
+	conn   onet.StreamingConn
+	events []Event
+	event  Event
+	next   uint64
+	err    error
+	// received tells if the connection got a reply.
+	received bool
+	// client is replaced by connect and closed by Close, maybe while Next
+	// is waiting.
+	mu     sync.Mutex
+	client *onet.Client
+	closed bool
+}
+
+// StreamEvents starts streaming the events of the auctions and of the
+// bidders, all the events if both are empty, from the block from on.
+func (c *Client) StreamEvents(auctions, bidders []byzcoin.InstanceID, from uint64) (*EventStream, error) {
+	es := &EventStream{
+		c: c,
+		req: StreamEvents{
+			ByzCoinID: c.ByzCoinID,
+			Auctions:  auctions,
+			Bidders:   bidders,
+		},
+		next: from,
+	}
+	err := es.connect()
+	if err != nil {
+		return nil, err
+	}
+	return es, nil
+}
+
+// Next waits for the next event and tells if there is one. It returns
+// false once the stream is closed or cannot be opened again.
+func (es *EventStream) Next() bool {
+	for len(es.events) == 0 {
+		reply := &StreamEventsReply{}
+		err := es.conn.ReadMessage(reply)
+		if err != nil {
+			// A connection failing before its first reply is not
+			// opened again.
+			if !es.received {
+				if !es.isClosed() {
+					es.err = err
+				}
+				return false
+			}
+			if err = es.connect(); err != nil {
+				if err != errStreamClosed {
+					es.err = err
+				}
+				return false
+			}
+			continue
+		}
+		es.received = true
+		es.events = reply.Events
+		es.next = reply.Cursor
+	}
+	es.event, es.events = es.events[0], es.events[1:]
+	return true
+}
+
+// Event returns the event found by Next.
+func (es *EventStream) Event() Event {
+	return es.event
+}
+
+// Cursor returns the block to stream from again without missing an event
+// not yet returned by Next.
+func (es *EventStream) Cursor() uint64 {
+	if len(es.events) > 0 {
+		return es.events[0].Index
+	}
+	return es.next
+}
+
+// Err returns the error that stopped the stream, nil if it was closed.
+func (es *EventStream) Err() error {
+	return es.err
+}
+
+// Close stops the stream, a Next waiting for an event returns false.
+func (es *EventStream) Close() error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.closed = true
+	return es.client.Close()
+}
+
+func (es *EventStream) isClosed() bool {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.closed
+}
+
+var errStreamClosed = errors.New("the stream is closed")
+
+// connect opens the stream from the cursor, on a connection of its own.
+func (es *EventStream) connect() error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if es.closed {
+		return errStreamClosed
+	}
+	if es.client != nil {
+		es.client.Close()
+	}
+	es.client = onet.NewClient(cothority.Suite, ServiceName)
+	es.received = false
+	es.req.From = es.Cursor()
+	var err error
+	es.conn, err = es.client.Stream(es.c.Node, &es.req)
+	return err
+}
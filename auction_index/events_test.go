@@ -0,0 +1,94 @@
+package auction_index
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/student_19_auctions/auctions"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+)
+
+// nextEvents reads n events from the stream.
+func nextEvents(t *testing.T, stream *EventStream, n int) []Event {
+	evs := make(chan Event)
+	go func() {
+		defer close(evs)
+		for i := 0; i < n && stream.Next(); i++ {
+			evs <- stream.Event()
+		}
+	}()
+	var got []Event
+	for i := 0; i < n; i++ {
+		select {
+		case ev, ok := <-evs:
+			require.True(t, ok, stream.Err())
+			got = append(got, ev)
+		case <-time.After(10 * time.Second):
+			require.Fail(t, "no event")
+		}
+	}
+	return got
+}
+
+func kinds(evs []Event) []string {
+	var ks []string
+	for _, ev := range evs {
+		ks = append(ks, ev.Kind)
+	}
+	return ks
+}
+
+func TestStreamEvents(t *testing.T) {
+	it := newIndexTest(t)
+	defer it.Close()
+
+	seller := it.account(t, 0)
+	bidder, bidder2 := it.account(t, 100), it.account(t, 100)
+	ic := NewClient(it.servers[0].ServerIdentity, it.cl.ID)
+	stream, err := ic.StreamEvents(nil, nil, 0)
+	require.NoError(t, err)
+
+	acl := auctions.NewClient(it.cl, it.signer)
+	auctInstID := it.createAuction(t, seller, "bananas")
+	require.NoError(t, acl.Bid(auctInstID, auctions.BidData{BidderAccount: bidder}, 30))
+	require.NoError(t, acl.Bid(auctInstID, auctions.BidData{BidderAccount: bidder2}, 40))
+
+	evs := nextEvents(t, stream, 4)
+	require.Equal(t, []string{EventAuctionCreated, EventBidPlaced, EventOutbid, EventBidPlaced}, kinds(evs))
+	require.Equal(t, seller, evs[0].Account)
+	require.Equal(t, Event{
+		Kind:      EventOutbid,
+		AuctionID: auctInstID,
+		Account:   bidder,
+		Amount:    40,
+		Index:     evs[2].Index,
+		Timestamp: evs[2].Timestamp,
+	}, evs[2])
+
+	// The events happening while disconnected are streamed from the cursor
+	cursor := stream.Cursor()
+	require.NoError(t, stream.Close())
+	require.False(t, stream.Next())
+	require.NoError(t, stream.Err())
+
+	require.NoError(t, acl.Close(auctInstID, auctions.CloseData{Salt: "pepper", ReservePrice: 20}))
+	dropInstID := it.createAuction(t, seller, "apples")
+	require.NoError(t, acl.Drop(dropInstID, "rotten"))
+
+	stream, err = ic.StreamEvents([]byzcoin.InstanceID{auctInstID, dropInstID}, nil, cursor)
+	require.NoError(t, err)
+	defer stream.Close()
+	evs = nextEvents(t, stream, 4)
+	require.Equal(t, []string{EventClosed, EventSettled, EventAuctionCreated, EventDropped}, kinds(evs))
+	require.Equal(t, bidder2, evs[1].Account)
+	require.Equal(t, uint64(40), evs[1].Amount)
+
+	// Only the events of the bidder, from genesis
+	bidderStream, err := ic.StreamEvents(nil, []byzcoin.InstanceID{bidder}, 0)
+	require.NoError(t, err)
+	defer bidderStream.Close()
+	evs = nextEvents(t, bidderStream, 2)
+	require.Equal(t, []string{EventBidPlaced, EventOutbid}, kinds(evs))
+	require.Equal(t, uint64(30), evs[0].Amount)
+}
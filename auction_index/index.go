@@ -0,0 +1,391 @@
+package auction_index
+
+import (
+	"errors"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/dedis/student_19_auctions/auctions"
+	"github.com/dedis/student_19_auctions/sb_auctions"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/protobuf"
+)
+
+// errNoStateChanges is returned for a block whose state changes are no
+// longer kept by the ByzCoin service.
+var errNoStateChanges = errors.New("the state changes of the block are not stored")
+
+// block is a block of the ledger reduced to what the index needs.
+type block struct {
+	index     uint64
+	timestamp int64
+	changes   []byzcoin.StateChange
+}
+
+// readBlock returns the block with its state changes. The blocks only hold
+// the transactions, so the state changes are read from the storage of the
+// ByzCoin service: those of any instance touched by the block lead to all
+// the state changes of the block.
+func readBlock(bs *byzcoin.Service, sb *skipchain.SkipBlock) (block, error) {
+	b := block{index: uint64(sb.Index)}
+	header := byzcoin.DataHeader{}
+	err := protobuf.Decode(sb.Data, &header)
+	if err != nil {
+		return b, err
+	}
+	b.timestamp = header.Timestamp
+	body := byzcoin.DataBody{}
+	err = protobuf.Decode(sb.Payload, &body)
+	if err != nil {
+		return b, err
+	}
+
+	var touched []byzcoin.InstanceID
+	for _, tx := range body.TxResults {
+		if !tx.Accepted {
+			continue
+		}
+		for _, inst := range tx.ClientTransaction.Instructions {
+			touched = append(touched, inst.InstanceID)
+			if inst.Spawn != nil {
+				touched = append(touched, inst.DeriveID(""))
+			}
+		}
+	}
+	if len(touched) == 0 {
+		return b, nil
+	}
+
+	bcID := sb.SkipChainID()
+	for _, instID := range touched {
+		versions, err := bs.GetAllInstanceVersion(&byzcoin.GetAllInstanceVersion{SkipChainID: bcID, InstanceID: instID})
+		if err != nil {
+			continue
+		}
+		for _, v := range versions.StateChanges {
+			if v.BlockIndex != sb.Index {
+				continue
+			}
+			reply, err := bs.CheckStateChangeValidity(&byzcoin.CheckStateChangeValidity{
+				SkipChainID: bcID,
+				InstanceID:  instID,
+				Version:     v.StateChange.Version,
+			})
+			if err != nil {
+				return b, err
+			}
+			b.changes = reply.StateChanges
+			return b, nil
+		}
+	}
+	return b, errNoStateChanges
+}
+
+// apply adds the state changes of the block to the index. The bids of
+// sb_auction go first, so that the price of an auction processed in the
+// same block is known.
+func (lt *ledgerTx) apply(b block) error {
+	for _, sc := range b.changes {
+		if sc.StateAction == byzcoin.Remove || sc.ContractID != sb_auctions.ContractSBBidID {
+			continue
+		}
+		if err := lt.applySBBid(b, sc); err != nil {
+			return err
+		}
+	}
+	for _, sc := range b.changes {
+		if sc.StateAction == byzcoin.Remove {
+			continue
+		}
+		var err error
+		switch sc.ContractID {
+		case auctions.ContractAuctionID:
+			err = lt.applyAuction(b, sc)
+		case sb_auctions.ContractSBAuctionID:
+			err = lt.applySBAuction(b, sc)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return lt.setIndexed(b.index + 1)
+}
+
+// applyAuction records a new version of an auction of the auction
+// contract. Every change of a leading bid, of the auction or of a lot, is
+// a bid.
+func (lt *ledgerTx) applyAuction(b block, sc byzcoin.StateChange) error {
+	auctInstID := byzcoin.NewInstanceID(sc.InstanceID)
+	auction, err := auctions.DecodeAuction(sc.Value)
+	if err != nil {
+		return err
+	}
+	var old auctions.AuctionData
+	if buf := lt.value(auctInstID); buf != nil {
+		old, err = auctions.DecodeAuction(buf)
+		if err != nil {
+			return err
+		}
+	}
+	rec, err := lt.record(b, sc.ContractID, auctInstID)
+	if err != nil {
+		return err
+	}
+	rec.Seller = auction.SellerAccount
+	rec.Good = auction.GoodDescription
+	rec.Category = auction.Category
+
+	leads, oldLeads := leaders(auction), leaders(old)
+	for i, lead := range leads {
+		if lead.Bidder.Equal(byzcoin.InstanceID{}) || (i < len(oldLeads) && lead == oldLeads[i]) {
+			continue
+		}
+		if i < len(oldLeads) && !oldLeads[i].Bidder.Equal(byzcoin.InstanceID{}) &&
+			!oldLeads[i].Bidder.Equal(lead.Bidder) {
+			err = lt.addEvent(Event{
+				Kind:      EventOutbid,
+				AuctionID: auctInstID,
+				Lot:       uint32(i),
+				Account:   oldLeads[i].Bidder,
+				Amount:    lead.Bid,
+				Index:     b.index,
+				Timestamp: b.timestamp,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		err = lt.addBid(BidRecord{
+			AuctionID: auctInstID,
+			Lot:       uint32(i),
+			Bidder:    lead.Bidder,
+			Amount:    lead.Bid,
+			Index:     b.index,
+			Timestamp: b.timestamp,
+		})
+		if err != nil {
+			return err
+		}
+		rec.addBidder(lead.Bidder)
+	}
+
+	err = lt.setState(&rec, b, auction.State)
+	if err != nil {
+		return err
+	}
+	closed := auction.State == auctioncore.StateClosed || auction.State == auctioncore.StateWClosed
+	if closed && !rec.Settlement.Settled {
+		outcome, _ := auction.Outcome()
+		err = lt.settle(&rec, b, outcome.Winner, outcome.Price)
+		if err != nil {
+			return err
+		}
+	}
+	err = lt.putValue(auctInstID, sc.Value)
+	if err != nil {
+		return err
+	}
+	return lt.putAuction(rec)
+}
+
+// leaders returns the leading bids of the auction then of its lots.
+func leaders(auction auctions.AuctionData) []auctions.LeaderData {
+	leads := []auctions.LeaderData{{Bidder: auction.HighestBidder, Bid: auction.HighestBid}}
+	for _, lot := range auction.Lots {
+		leads = append(leads, auctions.LeaderData{Bidder: lot.HighestBidder, Bid: lot.HighestBid})
+	}
+	return leads
+}
+
+// applySBAuction records a new version of a sealed-bid auction. The
+// auction is settled once processed, at the price of the last bid of the
+// winner.
+func (lt *ledgerTx) applySBAuction(b block, sc byzcoin.StateChange) error {
+	auctInstID := byzcoin.NewInstanceID(sc.InstanceID)
+	auction, err := sb_auctions.DecodeAuction(sc.Value)
+	if err != nil {
+		return err
+	}
+	rec, err := lt.record(b, sc.ContractID, auctInstID)
+	if err != nil {
+		return err
+	}
+	rec.Seller = auction.SellerAccount
+	rec.Good = auction.GoodDescription
+	rec.Category = auction.Category
+
+	err = lt.setState(&rec, b, auction.State.String())
+	if err != nil {
+		return err
+	}
+	if auction.Settled && !rec.Settlement.Settled {
+		bids, err := lt.bids(auctInstID)
+		if err != nil {
+			return err
+		}
+		var price uint64
+		for _, bid := range bids {
+			if bid.Bidder.Equal(auction.WinnerAccount) {
+				price = bid.Amount
+			}
+		}
+		err = lt.settle(&rec, b, auction.WinnerAccount, price)
+		if err != nil {
+			return err
+		}
+	}
+	err = lt.putValue(auctInstID, sc.Value)
+	if err != nil {
+		return err
+	}
+	return lt.putAuction(rec)
+}
+
+// applySBBid records a bid instance of a sealed-bid auction when its
+// amount changes. The leading bidder is outbid by a higher bid of another
+// account.
+func (lt *ledgerTx) applySBBid(b block, sc byzcoin.StateChange) error {
+	bidInstID := byzcoin.NewInstanceID(sc.InstanceID)
+	stored := sb_auctions.StoredBid{}
+	err := protobuf.Decode(sc.Value, &stored)
+	if err != nil {
+		return err
+	}
+	if buf := lt.value(bidInstID); buf != nil {
+		old := sb_auctions.StoredBid{}
+		err = protobuf.Decode(buf, &old)
+		if err != nil {
+			return err
+		}
+		if old.Bid == stored.Bid {
+			return lt.putValue(bidInstID, sc.Value)
+		}
+	}
+	bids, err := lt.bids(stored.Auction)
+	if err != nil {
+		return err
+	}
+	var leader BidRecord
+	for _, bid := range bids {
+		if bid.Amount > leader.Amount {
+			leader = bid
+		}
+	}
+	if stored.Bid > leader.Amount && leader.Amount > 0 && !leader.Bidder.Equal(stored.BidderAccount) {
+		err = lt.addEvent(Event{
+			Kind:      EventOutbid,
+			AuctionID: stored.Auction,
+			Account:   leader.Bidder,
+			Amount:    stored.Bid,
+			Index:     b.index,
+			Timestamp: b.timestamp,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	err = lt.addBid(BidRecord{
+		AuctionID: stored.Auction,
+		Bidder:    stored.BidderAccount,
+		Amount:    stored.Bid,
+		Index:     b.index,
+		Timestamp: b.timestamp,
+	})
+	if err != nil {
+		return err
+	}
+	rec, found, err := lt.auction(stored.Auction)
+	if err != nil {
+		return err
+	}
+	if found {
+		rec.addBidder(stored.BidderAccount)
+		err = lt.putAuction(rec)
+		if err != nil {
+			return err
+		}
+	}
+	return lt.putValue(bidInstID, sc.Value)
+}
+
+// record returns the record of the auction, a new one if the auction is
+// not indexed yet, updated by the block.
+func (lt *ledgerTx) record(b block, contractID string, auctInstID byzcoin.InstanceID) (AuctionRecord, error) {
+	rec, found, err := lt.auction(auctInstID)
+	if err != nil {
+		return rec, err
+	}
+	if !found {
+		rec = AuctionRecord{
+			AuctionID:  auctInstID,
+			ContractID: contractID,
+			Created:    b.index,
+			CreatedAt:  b.timestamp,
+		}
+	}
+	rec.Updated = b.index
+	rec.UpdatedAt = b.timestamp
+	return rec, nil
+}
+
+// setState records the transition if the state of the auction changes,
+// with its event.
+func (lt *ledgerTx) setState(rec *AuctionRecord, b block, state string) error {
+	if rec.State == state {
+		return nil
+	}
+	err := lt.addTransition(TransitionRecord{
+		AuctionID: rec.AuctionID,
+		From:      rec.State,
+		To:        state,
+		Index:     b.index,
+		Timestamp: b.timestamp,
+	})
+	if err != nil {
+		return err
+	}
+	ev := Event{AuctionID: rec.AuctionID, Index: b.index, Timestamp: b.timestamp}
+	switch {
+	case rec.State == "":
+		ev.Kind = EventAuctionCreated
+		ev.Account = rec.Seller
+	case state == auctioncore.StateClosed || state == auctioncore.StateWClosed:
+		ev.Kind = EventClosed
+	case state == auctioncore.StateDropped:
+		ev.Kind = EventDropped
+	}
+	rec.State = state
+	if ev.Kind == "" {
+		return nil
+	}
+	return lt.addEvent(ev)
+}
+
+// settle records the settlement of the auction, with its event.
+func (lt *ledgerTx) settle(rec *AuctionRecord, b block, winner byzcoin.InstanceID, price uint64) error {
+	rec.Settlement = SettlementRecord{
+		Settled:   true,
+		Winner:    winner,
+		Price:     price,
+		Index:     b.index,
+		Timestamp: b.timestamp,
+	}
+	return lt.addEvent(Event{
+		Kind:      EventSettled,
+		AuctionID: rec.AuctionID,
+		Account:   winner,
+		Amount:    price,
+		Index:     b.index,
+		Timestamp: b.timestamp,
+	})
+}
+
+// addBidder adds the account to the bidders of the auction.
+func (rec *AuctionRecord) addBidder(bidder byzcoin.InstanceID) {
+	for _, b := range rec.Bidders {
+		if b.Equal(bidder) {
+			return
+		}
+	}
+	rec.Bidders = append(rec.Bidders, bidder)
+}
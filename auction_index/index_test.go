@@ -0,0 +1,177 @@
+package auction_index
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/dedis/student_19_auctions/auctions"
+	"github.com/dedis/student_19_auctions/sb_auctions"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+)
+
+// indexTest is a ledger allowing the auction and sb_auction contracts.
+type indexTest struct {
+	local   *onet.LocalTest
+	servers []*onet.Server
+	cl      *byzcoin.Client
+	signer  darc.Signer
+	darcID  darc.ID
+}
+
+func newIndexTest(t *testing.T) *indexTest {
+	it := &indexTest{local: onet.NewTCPTest(cothority.Suite)}
+	var roster *onet.Roster
+	it.servers, roster, _ = it.local.GenTree(3, true)
+
+	it.signer = darc.NewSignerEd25519(nil, nil)
+	msg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:coin", "invoke:coin.mint", "invoke:coin.fetch",
+			"spawn:auction", "invoke:auction.bid", "invoke:auction.close", "invoke:auction.drop",
+			"spawn:sb_auction", "invoke:sb_auction.bid", "invoke:sb_auction.close", "invoke:sb_auction.process"},
+		it.signer.Identity())
+	require.NoError(t, err)
+	msg.BlockInterval = time.Second / 2
+	it.cl, _, err = byzcoin.NewLedger(msg, false)
+	require.NoError(t, err)
+	it.darcID = msg.GenesisDarc.GetBaseID()
+	return it
+}
+
+func (it *indexTest) Close() {
+	it.local.CloseAll()
+}
+
+// account creates a coin account holding mint coins.
+func (it *indexTest) account(t *testing.T, mint uint64) byzcoin.InstanceID {
+	sender := auctioncore.NewSender(it.cl, it.signer)
+	ctx, err := sender.Send(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(it.darcID),
+		Spawn:      &byzcoin.Spawn{ContractID: contracts.ContractCoinID},
+	})
+	require.NoError(t, err)
+	accInstID := ctx.Instructions[0].DeriveID("")
+	if mint > 0 {
+		_, err = sender.Send(byzcoin.Instruction{
+			InstanceID: accInstID,
+			Invoke: &byzcoin.Invoke{
+				ContractID: contracts.ContractCoinID,
+				Command:    "mint",
+				Args:       byzcoin.Arguments{{Name: "coins", Value: auctioncore.EncodeAmount(mint)}},
+			},
+		})
+		require.NoError(t, err)
+	}
+	return accInstID
+}
+
+// latest returns the number of blocks of the ledger.
+func (it *indexTest) latest(t *testing.T) uint64 {
+	st, err := it.servers[0].Service(byzcoin.ServiceName).(*byzcoin.Service).GetReadOnlyStateTrie(it.cl.ID)
+	require.NoError(t, err)
+	return uint64(st.GetIndex()) + 1
+}
+
+// createAuction creates a forward auction with a reserve price of 20.
+func (it *indexTest) createAuction(t *testing.T, seller byzcoin.InstanceID, good string) byzcoin.InstanceID {
+	auctInstID, err := auctions.NewClient(it.cl, it.signer).CreateAuction(it.darcID, auctions.AuctionData{
+		GoodDescription: good,
+		SellerAccount:   seller,
+		State:           auctioncore.StateOpen,
+		ReservePrice:    auctioncore.CreateHash("pepper", 20),
+	})
+	require.NoError(t, err)
+	return auctInstID
+}
+
+func TestIndex(t *testing.T) {
+	it := newIndexTest(t)
+	defer it.Close()
+
+	seller, deposits := it.account(t, 0), it.account(t, 0)
+	bidder, bidder2 := it.account(t, 100), it.account(t, 100)
+
+	// A forward auction won by bidder
+	acl := auctions.NewClient(it.cl, it.signer)
+	auctInstID := it.createAuction(t, seller, "bananas")
+	require.NoError(t, acl.Bid(auctInstID, auctions.BidData{BidderAccount: bidder}, 30))
+	require.NoError(t, acl.Close(auctInstID, auctions.CloseData{Salt: "pepper", ReservePrice: 20}))
+
+	// The index starts from genesis when the ledger is already running
+	ic := NewClient(it.servers[0].ServerIdentity, it.cl.ID)
+	_, err := ic.Follow(false)
+	require.NoError(t, err)
+
+	// A sealed-bid auction won by bidder2
+	scl := sb_auctions.NewClient(it.cl, it.signer)
+	sbInstID, err := scl.CreateAuction(it.darcID, sb_auctions.AuctionData{
+		GoodDescription: "apples",
+		SellerAccount:   seller,
+		ReservePrice:    20,
+		State:           sb_auctions.OPEN,
+		Deposits:        deposits,
+	})
+	require.NoError(t, err)
+	require.NoError(t, scl.Bid(sbInstID, bidder, 30))
+	require.NoError(t, scl.Bid(sbInstID, bidder2, 25))
+	require.NoError(t, scl.Bid(sbInstID, bidder2, 40))
+	require.NoError(t, scl.Close(sbInstID))
+
+	require.NoError(t, ic.WaitIndexed(it.latest(t), 10*time.Second))
+
+	check := func() {
+		recs, err := ic.Query(Query{Seller: seller})
+		require.NoError(t, err)
+		require.Len(t, recs, 2)
+		require.Equal(t, auctInstID, recs[0].AuctionID)
+		require.Equal(t, "WCLOSED", recs[0].State)
+		require.True(t, recs[0].Settlement.Settled)
+		require.Equal(t, bidder, recs[0].Settlement.Winner)
+		require.Equal(t, uint64(30), recs[0].Settlement.Price)
+		require.Equal(t, sbInstID, recs[1].AuctionID)
+		require.Equal(t, []byzcoin.InstanceID{bidder, bidder2}, recs[1].Bidders)
+
+		recs, err = ic.Query(Query{Bidder: bidder2})
+		require.NoError(t, err)
+		require.Len(t, recs, 1)
+		require.Equal(t, sbInstID, recs[0].AuctionID)
+
+		recs, err = ic.Query(Query{Bidder: bidder, State: "WCLOSED"})
+		require.NoError(t, err)
+		require.Len(t, recs, 1)
+		recs, err = ic.Query(Query{From: recs[0].CreatedAt + 1})
+		require.NoError(t, err)
+		require.Len(t, recs, 1)
+		require.Equal(t, "apples", recs[0].Good)
+		recs, err = ic.Query(Query{To: recs[0].CreatedAt - 1})
+		require.NoError(t, err)
+		require.Len(t, recs, 1)
+		require.Equal(t, "bananas", recs[0].Good)
+
+		h, err := ic.History(sbInstID)
+		require.NoError(t, err)
+		require.Len(t, h.Bids, 3)
+		require.Equal(t, uint64(25), h.Bids[1].Amount)
+		require.Equal(t, uint64(40), h.Bids[2].Amount)
+		require.Len(t, h.Transitions, 2)
+		require.Equal(t, "CLOSED", h.Transitions[1].To)
+		require.True(t, h.Auction.Settlement.Settled)
+		require.Equal(t, bidder2, h.Auction.Settlement.Winner)
+		require.Equal(t, uint64(40), h.Auction.Settlement.Price)
+	}
+	check()
+
+	// The index rebuilt from genesis is the same
+	_, err = ic.Follow(true)
+	require.NoError(t, err)
+	require.NoError(t, ic.WaitIndexed(it.latest(t), 10*time.Second))
+	check()
+
+	_, err = ic.History(seller)
+	require.Error(t, err)
+}
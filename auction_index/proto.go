@@ -0,0 +1,151 @@
+package auction_index
+
+import (
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+)
+
+// PROTOSTART
+// package auction_index;
+// import "byzcoin.proto";
+//
+// option java_package = "ch.epfl.dedis.lib.proto";
+// option java_outer_classname = "AuctionIndex";
+
+// AuctionRecord is the summary of an auction kept by the index. The block
+// indexes and the timestamps, in nanoseconds, are the ones of the blocks
+// holding the state changes.
+type AuctionRecord struct {
+	AuctionID  byzcoin.InstanceID
+	ContractID string
+	Seller     byzcoin.InstanceID
+	Good       string
+	Category   string
+	State      string
+	Created    uint64
+	CreatedAt  int64
+	Updated    uint64
+	UpdatedAt  int64
+	Bidders    []byzcoin.InstanceID
+	Settlement SettlementRecord
+}
+
+// SettlementRecord is the end of an auction: the winner, zero if there is
+// none, and the price paid.
+type SettlementRecord struct {
+	Settled   bool
+	Winner    byzcoin.InstanceID
+	Price     uint64
+	Index     uint64
+	Timestamp int64
+}
+
+// BidRecord is a bid seen on the ledger. For the auction contract it is a
+// change of the leading bid, of the whole auction when Lot is 0 and of the
+// lot Lot-1 otherwise. For sb_auction it is a bid instance being placed or
+// raised.
+type BidRecord struct {
+	AuctionID byzcoin.InstanceID
+	Lot       uint32
+	Bidder    byzcoin.InstanceID
+	Amount    uint64
+	Index     uint64
+	Timestamp int64
+}
+
+// TransitionRecord is a change of state of an auction, From is empty when
+// the auction is created.
+type TransitionRecord struct {
+	AuctionID byzcoin.InstanceID
+	From      string
+	To        string
+	Index     uint64
+	Timestamp int64
+}
+
+// Kinds of events.
+const (
+	EventAuctionCreated = "AuctionCreated"
+	EventBidPlaced      = "BidPlaced"
+	EventOutbid         = "Outbid"
+	EventClosed         = "Closed"
+	EventDropped        = "Dropped"
+	EventSettled        = "Settled"
+)
+
+// Event is something that happened to an auction. Account is the seller
+// of a created auction, the bidder of a bid placed or outbid and the
+// winner of a settled auction. Amount is the bid placed, the bid
+// outbidding the account, or the price paid.
+type Event struct {
+	Kind      string
+	AuctionID byzcoin.InstanceID
+	Lot       uint32
+	Account   byzcoin.InstanceID
+	Amount    uint64
+	Index     uint64
+	Timestamp int64
+}
+
+// Follow asks the conode to index the ledger. With Rebuild the index of
+// the ledger is dropped and built again from the genesis block.
+type Follow struct {
+	ByzCoinID skipchain.SkipBlockID
+	Rebuild   bool
+}
+
+// FollowReply gives the number of blocks already indexed.
+type FollowReply struct {
+	Indexed uint64
+}
+
+// Query asks for the auctions matching all the given criteria. A zero
+// Seller or Bidder, an empty State and a zero From or To match everything.
+// From and To bound the creation time of the auctions, in nanoseconds.
+type Query struct {
+	ByzCoinID skipchain.SkipBlockID
+	Seller    byzcoin.InstanceID
+	Bidder    byzcoin.InstanceID
+	State     string
+	From      int64
+	To        int64
+}
+
+// QueryReply holds the auctions found, by order of creation, and the
+// number of blocks indexed when answering.
+type QueryReply struct {
+	Auctions []AuctionRecord
+	Indexed  uint64
+}
+
+// History asks for everything the index knows about an auction.
+type History struct {
+	ByzCoinID skipchain.SkipBlockID
+	AuctionID byzcoin.InstanceID
+}
+
+// HistoryReply holds the auction with its bids and its transitions, in the
+// order they happened.
+type HistoryReply struct {
+	Auction     AuctionRecord
+	Bids        []BidRecord
+	Transitions []TransitionRecord
+}
+
+// StreamEvents asks for the events of the ledger from the block From on.
+// Only the events of the Auctions, or whose account is one of the
+// Bidders, are sent, all of them if both are empty. The ledger is followed
+// if it was not already.
+type StreamEvents struct {
+	ByzCoinID skipchain.SkipBlockID
+	From      uint64
+	Auctions  []byzcoin.InstanceID
+	Bidders   []byzcoin.InstanceID
+}
+
+// StreamEventsReply holds the events of the blocks up to Cursor, the block
+// to resume the stream from.
+type StreamEventsReply struct {
+	Events []Event
+	Cursor uint64
+}
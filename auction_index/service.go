@@ -0,0 +1,388 @@
+package auction_index
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// ServiceName is the name of the service, used by the clients.
+const ServiceName = "auction_index"
+
+// PollInterval is how often the ledgers are looked at without news from
+// the ByzCoin service. It lets the index catch up once the ledger is
+// loaded again after a restart, or after an error.
+var PollInterval = 5 * time.Second
+
+// The service follows the blocks of the ledgers it is asked to, and keeps
+// an index of the auction and sb_auction instances in its database. The
+// index is local to the conode, the answers are not proven: the auctions
+// found are to be read through the query services of their contracts.
+
+func init() {
+	_, err := onet.RegisterNewService(ServiceName, newService)
+	log.ErrFatal(err)
+	network.RegisterMessages(&Follow{}, &FollowReply{},
+		&Query{}, &QueryReply{},
+		&History{}, &HistoryReply{},
+		&StreamEvents{}, &StreamEventsReply{})
+}
+
+// Service indexes the auctions of the ledgers it follows.
+type Service struct {
+	// We need to embed the ServiceProcessor, so that incoming messages
+	// are correctly handled.
+	*onet.ServiceProcessor
+	store     *store
+	followers map[string]*follower
+	mu        sync.Mutex
+	closed    chan struct{}
+	closeOnce sync.Once
+	running   sync.WaitGroup
+}
+
+// follower indexes one ledger. It is locked while a block is indexed or
+// the index is dropped. The listeners are told about every block indexed.
+type follower struct {
+	sync.Mutex
+	bcID        skipchain.SkipBlockID
+	wake        chan struct{}
+	listenersMu sync.Mutex
+	listeners   map[chan struct{}]bool
+}
+
+func newService(c *onet.Context) (onet.Service, error) {
+	db, bucket := c.GetAdditionalBucket([]byte("index"))
+	s := &Service{
+		ServiceProcessor: onet.NewServiceProcessor(c),
+		store:            &store{db: db, bucket: bucket},
+		followers:        make(map[string]*follower),
+		closed:           make(chan struct{}),
+	}
+	err := s.RegisterHandlers(s.Follow, s.Query, s.History)
+	if err != nil {
+		return nil, err
+	}
+	err = s.RegisterStreamingHandlers(s.StreamEvents)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resume the ledgers followed before the conode stopped.
+	ids, err := s.store.ledgers()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		err = s.store.create(id, false)
+		if err != nil {
+			return nil, err
+		}
+		s.follow(id)
+	}
+	return s, nil
+}
+
+// Follow starts indexing the ledger, or rebuilds its index from the
+// genesis block.
+func (s *Service) Follow(req *Follow) (*FollowReply, error) {
+	if _, err := s.byzService().GetReadOnlyStateTrie(req.ByzCoinID); err != nil {
+		return nil, err
+	}
+	err := s.store.create(req.ByzCoinID, false)
+	if err != nil {
+		return nil, err
+	}
+	f := s.follow(req.ByzCoinID)
+	if req.Rebuild {
+		f.Lock()
+		err = s.store.create(req.ByzCoinID, true)
+		f.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		f.wakeUp()
+	}
+	n, err := s.store.indexed(req.ByzCoinID)
+	if err != nil {
+		return nil, err
+	}
+	return &FollowReply{Indexed: n}, nil
+}
+
+// Query returns the auctions matching the query.
+func (s *Service) Query(req *Query) (*QueryReply, error) {
+	reply := &QueryReply{}
+	err := s.store.view(req.ByzCoinID, func(lt *ledgerTx) error {
+		var err error
+		reply.Auctions, err = lt.query(req)
+		reply.Indexed = lt.indexed()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// History returns the auction with its bids and transitions.
+func (s *Service) History(req *History) (*HistoryReply, error) {
+	reply := &HistoryReply{}
+	err := s.store.view(req.ByzCoinID, func(lt *ledgerTx) error {
+		var found bool
+		var err error
+		reply.Auction, found, err = lt.auction(req.AuctionID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return auctioncore.ErrUnknownInstanceID
+		}
+		reply.Bids, err = lt.bids(req.AuctionID)
+		if err != nil {
+			return err
+		}
+		reply.Transitions, err = lt.transitions(req.AuctionID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// StreamEvents sends the events already indexed from the block req.From
+// on, then the new ones as the blocks are indexed. The first reply is sent
+// even without events, the next ones only with events. The stream ends
+// when the client goes away or the service closes.
+func (s *Service) StreamEvents(req *StreamEvents) (chan *StreamEventsReply, chan bool, error) {
+	_, err := s.Follow(&Follow{ByzCoinID: req.ByzCoinID})
+	if err != nil {
+		return nil, nil, err
+	}
+	f := s.follow(req.ByzCoinID)
+	blocks := f.listen()
+	out := make(chan *StreamEventsReply)
+	stop := make(chan bool)
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		defer close(out)
+		defer f.unlisten(blocks)
+		cursor := req.From
+		first := true
+		for {
+			reply := &StreamEventsReply{}
+			err := s.store.view(req.ByzCoinID, func(lt *ledgerTx) error {
+				var err error
+				reply.Cursor = lt.indexed()
+				reply.Events, err = lt.events(cursor, req)
+				return err
+			})
+			if err != nil {
+				log.Error(s.ServerIdentity(), "cannot read the events:", err)
+				return
+			}
+			if first || len(reply.Events) > 0 {
+				select {
+				case out <- reply:
+				case <-stop:
+					return
+				case <-s.closed:
+					return
+				}
+			}
+			first = false
+			cursor = reply.Cursor
+			select {
+			case <-blocks:
+			case <-stop:
+				return
+			case <-s.closed:
+				return
+			}
+		}
+	}()
+	return out, stop, nil
+}
+
+// TestClose stops following the ledgers.
+func (s *Service) TestClose() {
+	s.closeOnce.Do(func() { close(s.closed) })
+	s.running.Wait()
+}
+
+// follow returns the follower of the ledger, starting it if needed.
+func (s *Service) follow(bcID skipchain.SkipBlockID) *follower {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.followers[string(bcID)]; ok {
+		return f
+	}
+	f := &follower{
+		bcID:      bcID,
+		wake:      make(chan struct{}, 1),
+		listeners: make(map[chan struct{}]bool),
+	}
+	s.followers[string(bcID)] = f
+	s.running.Add(1)
+	go s.run(f)
+	return f
+}
+
+// subscribe wakes the follower up on every new block of the ledger.
+func (s *Service) subscribe(f *follower) {
+	defer s.running.Done()
+	blocks, stop, err := s.byzService().StreamTransactions(&byzcoin.StreamingRequest{ID: f.bcID})
+	if err != nil {
+		log.Error(s.ServerIdentity(), "cannot follow the blocks:", err)
+		return
+	}
+	for {
+		select {
+		case <-blocks:
+			f.wakeUp()
+		case <-s.closed:
+			// The ByzCoin service blocks until the listener reads the
+			// block, so the blocks are drained until the listener is
+			// stopped.
+			go func() { stop <- true }()
+			for range blocks {
+			}
+			return
+		}
+	}
+}
+
+// run indexes the blocks of the ledger as they come. When the conode
+// starts, it waits for the ByzCoin service to be instantiated.
+func (s *Service) run(f *follower) {
+	defer s.running.Done()
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+	for s.byzService() == nil {
+		select {
+		case <-ticker.C:
+		case <-s.closed:
+			return
+		}
+	}
+	s.running.Add(1)
+	go s.subscribe(f)
+
+	for {
+		err := s.catchUp(f)
+		if err != nil {
+			log.Lvl2(s.ServerIdentity(), "index of", f.bcID, "is behind:", err)
+		}
+		select {
+		case <-f.wake:
+		case <-ticker.C:
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// catchUp indexes the blocks of the ledger up to the last one applied to
+// the global state.
+func (s *Service) catchUp(f *follower) error {
+	f.Lock()
+	defer f.Unlock()
+	bs := s.byzService()
+	st, err := bs.GetReadOnlyStateTrie(f.bcID)
+	if err != nil {
+		return err
+	}
+	latest := st.GetIndex()
+	for {
+		select {
+		case <-s.closed:
+			return nil
+		default:
+		}
+		n, err := s.store.indexed(f.bcID)
+		if err != nil {
+			return err
+		}
+		if int(n) > latest {
+			return nil
+		}
+		reply, err := s.skService().GetSingleBlockByIndex(&skipchain.GetSingleBlockByIndex{
+			Genesis: f.bcID,
+			Index:   int(n),
+		})
+		if err != nil {
+			return err
+		}
+		// The state changes of the latest block might not be stored yet,
+		// those of an older block have been pruned.
+		b, err := readBlock(bs, reply.SkipBlock)
+		if err == errNoStateChanges && int(n) < latest {
+			log.Warn(s.ServerIdentity(), "block", n, "of", f.bcID, "is not indexed:", err)
+		} else if err != nil {
+			return err
+		}
+		err = s.store.update(f.bcID, func(lt *ledgerTx) error {
+			return lt.apply(b)
+		})
+		if err != nil {
+			return err
+		}
+		f.notify()
+	}
+}
+
+// wakeUp makes the follower look for new blocks.
+func (f *follower) wakeUp() {
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+// listen returns a channel told about the blocks indexed.
+func (f *follower) listen() chan struct{} {
+	f.listenersMu.Lock()
+	defer f.listenersMu.Unlock()
+	c := make(chan struct{}, 1)
+	f.listeners[c] = true
+	return c
+}
+
+func (f *follower) unlisten(c chan struct{}) {
+	f.listenersMu.Lock()
+	defer f.listenersMu.Unlock()
+	delete(f.listeners, c)
+}
+
+// notify tells the listeners that a block was indexed, without waiting
+// for the ones still busy with the previous one.
+func (f *follower) notify() {
+	f.listenersMu.Lock()
+	defer f.listenersMu.Unlock()
+	for c := range f.listeners {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// byzService returns the ByzCoin service holding the ledgers, nil while
+// the conode is starting.
+func (s *Service) byzService() *byzcoin.Service {
+	bs, _ := s.Service(byzcoin.ServiceName).(*byzcoin.Service)
+	return bs
+}
+
+// skService returns the skipchain service holding the blocks.
+func (s *Service) skService() *skipchain.Service {
+	return s.Service(skipchain.ServiceName).(*skipchain.Service)
+}
@@ -0,0 +1,11 @@
+package auction_index
+
+import (
+	"testing"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m, 0)
+}
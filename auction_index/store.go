@@ -0,0 +1,338 @@
+package auction_index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/protobuf"
+	bbolt "go.etcd.io/bbolt"
+)
+
+// The index of a ledger is a bucket, named after the ledger ID, of the
+// bucket of the service. It holds the number of blocks indexed and the
+// buckets below. The bids and the transitions are keyed by auction then
+// by sequence number, the sellers and the bidders by account then by
+// auction, with empty values. The events are keyed by block then by
+// sequence number.
+var (
+	keyIndexed        = []byte("indexed")
+	bucketAuctions    = []byte("auctions")
+	bucketValues      = []byte("values")
+	bucketBids        = []byte("bids")
+	bucketTransitions = []byte("transitions")
+	bucketSellers     = []byte("sellers")
+	bucketBidders     = []byte("bidders")
+	bucketEvents      = []byte("events")
+)
+
+// ErrNotFollowed is returned for a ledger the conode does not index.
+var ErrNotFollowed = errors.New("the ledger is not indexed by this conode")
+
+// store reads and writes the index in the service database.
+type store struct {
+	db     *bbolt.DB
+	bucket []byte
+}
+
+// ledgers returns the ledgers having an index.
+func (st *store) ledgers() ([]skipchain.SkipBlockID, error) {
+	var ids []skipchain.SkipBlockID
+	err := st.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(st.bucket).ForEach(func(k, v []byte) error {
+			if v == nil {
+				ids = append(ids, append(skipchain.SkipBlockID{}, k...))
+			}
+			return nil
+		})
+	})
+	return ids, err
+}
+
+// create makes an empty index for the ledger, dropping the previous one if
+// reset is set. An existing index is kept otherwise, and gets the buckets
+// it misses.
+func (st *store) create(bcID skipchain.SkipBlockID, reset bool) error {
+	return st.db.Update(func(tx *bbolt.Tx) error {
+		root := tx.Bucket(st.bucket)
+		if reset && root.Bucket(bcID) != nil {
+			if err := root.DeleteBucket(bcID); err != nil {
+				return err
+			}
+		}
+		b, err := root.CreateBucketIfNotExists(bcID)
+		if err != nil {
+			return err
+		}
+		for _, name := range [][]byte{bucketAuctions, bucketValues, bucketBids,
+			bucketTransitions, bucketSellers, bucketBidders, bucketEvents} {
+			if _, err = b.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if b.Get(keyIndexed) != nil {
+			return nil
+		}
+		return b.Put(keyIndexed, encodeUint64(0))
+	})
+}
+
+// indexed returns the number of blocks of the ledger already indexed.
+func (st *store) indexed(bcID skipchain.SkipBlockID) (n uint64, err error) {
+	err = st.view(bcID, func(lt *ledgerTx) error {
+		n = lt.indexed()
+		return nil
+	})
+	return
+}
+
+// view runs f on the index of the ledger in a read-only transaction.
+func (st *store) view(bcID skipchain.SkipBlockID, f func(*ledgerTx) error) error {
+	return st.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(st.bucket).Bucket(bcID)
+		if b == nil {
+			return ErrNotFollowed
+		}
+		return f(&ledgerTx{b})
+	})
+}
+
+// update runs f on the index of the ledger in a read-write transaction.
+func (st *store) update(bcID skipchain.SkipBlockID, f func(*ledgerTx) error) error {
+	return st.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(st.bucket).Bucket(bcID)
+		if b == nil {
+			return ErrNotFollowed
+		}
+		return f(&ledgerTx{b})
+	})
+}
+
+// ledgerTx accesses the index of a ledger inside a transaction.
+type ledgerTx struct {
+	b *bbolt.Bucket
+}
+
+func (lt *ledgerTx) indexed() uint64 {
+	return binary.BigEndian.Uint64(lt.b.Get(keyIndexed))
+}
+
+func (lt *ledgerTx) setIndexed(n uint64) error {
+	return lt.b.Put(keyIndexed, encodeUint64(n))
+}
+
+// auction returns the record of the auction, false if it is unknown.
+func (lt *ledgerTx) auction(auctInstID byzcoin.InstanceID) (AuctionRecord, bool, error) {
+	rec := AuctionRecord{}
+	buf := lt.b.Bucket(bucketAuctions).Get(auctInstID[:])
+	if buf == nil {
+		return rec, false, nil
+	}
+	return rec, true, protobuf.Decode(buf, &rec)
+}
+
+func (lt *ledgerTx) putAuction(rec AuctionRecord) error {
+	buf, err := protobuf.Encode(&rec)
+	if err != nil {
+		return err
+	}
+	err = lt.b.Bucket(bucketSellers).Put(pairKey(rec.Seller, rec.AuctionID), []byte{})
+	if err != nil {
+		return err
+	}
+	return lt.b.Bucket(bucketAuctions).Put(rec.AuctionID[:], buf)
+}
+
+// value returns the last value of the auction instance, nil if none was
+// seen yet.
+func (lt *ledgerTx) value(auctInstID byzcoin.InstanceID) []byte {
+	return lt.b.Bucket(bucketValues).Get(auctInstID[:])
+}
+
+func (lt *ledgerTx) putValue(auctInstID byzcoin.InstanceID, value []byte) error {
+	return lt.b.Bucket(bucketValues).Put(auctInstID[:], value)
+}
+
+func (lt *ledgerTx) addBid(bid BidRecord) error {
+	err := lt.b.Bucket(bucketBidders).Put(pairKey(bid.Bidder, bid.AuctionID), []byte{})
+	if err != nil {
+		return err
+	}
+	err = lt.addEvent(Event{
+		Kind:      EventBidPlaced,
+		AuctionID: bid.AuctionID,
+		Lot:       bid.Lot,
+		Account:   bid.Bidder,
+		Amount:    bid.Amount,
+		Index:     bid.Index,
+		Timestamp: bid.Timestamp,
+	})
+	if err != nil {
+		return err
+	}
+	return lt.append(bucketBids, bid.AuctionID[:], &bid)
+}
+
+func (lt *ledgerTx) addTransition(tr TransitionRecord) error {
+	return lt.append(bucketTransitions, tr.AuctionID[:], &tr)
+}
+
+func (lt *ledgerTx) addEvent(ev Event) error {
+	return lt.append(bucketEvents, encodeUint64(ev.Index), &ev)
+}
+
+// append stores the record after the other ones with the same prefix.
+func (lt *ledgerTx) append(name []byte, prefix []byte, rec interface{}) error {
+	b := lt.b.Bucket(name)
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	buf, err := protobuf.Encode(rec)
+	if err != nil {
+		return err
+	}
+	return b.Put(append(append([]byte{}, prefix...), encodeUint64(seq)...), buf)
+}
+
+// bids returns the bids of the auction in the order they were placed.
+func (lt *ledgerTx) bids(auctInstID byzcoin.InstanceID) ([]BidRecord, error) {
+	var bids []BidRecord
+	err := forPrefix(lt.b.Bucket(bucketBids), auctInstID[:], func(_, v []byte) error {
+		bid := BidRecord{}
+		err := protobuf.Decode(v, &bid)
+		bids = append(bids, bid)
+		return err
+	})
+	return bids, err
+}
+
+// transitions returns the transitions of the auction in the order they
+// happened.
+func (lt *ledgerTx) transitions(auctInstID byzcoin.InstanceID) ([]TransitionRecord, error) {
+	var trs []TransitionRecord
+	err := forPrefix(lt.b.Bucket(bucketTransitions), auctInstID[:], func(_, v []byte) error {
+		tr := TransitionRecord{}
+		err := protobuf.Decode(v, &tr)
+		trs = append(trs, tr)
+		return err
+	})
+	return trs, err
+}
+
+// events returns the events of the blocks from the block from on that
+// pass the filter of the request.
+func (lt *ledgerTx) events(from uint64, req *StreamEvents) ([]Event, error) {
+	var evs []Event
+	c := lt.b.Bucket(bucketEvents).Cursor()
+	for k, v := c.Seek(encodeUint64(from)); k != nil; k, v = c.Next() {
+		ev := Event{}
+		if err := protobuf.Decode(v, &ev); err != nil {
+			return nil, err
+		}
+		if req.wants(ev) {
+			evs = append(evs, ev)
+		}
+	}
+	return evs, nil
+}
+
+// wants tells if the event is one of the auctions or of the bidders of the
+// request.
+func (req *StreamEvents) wants(ev Event) bool {
+	if len(req.Auctions) == 0 && len(req.Bidders) == 0 {
+		return true
+	}
+	for _, id := range req.Auctions {
+		if id.Equal(ev.AuctionID) {
+			return true
+		}
+	}
+	for _, id := range req.Bidders {
+		if id.Equal(ev.Account) {
+			return true
+		}
+	}
+	return false
+}
+
+// query returns the auctions matching the query, by order of creation.
+func (lt *ledgerTx) query(q *Query) ([]AuctionRecord, error) {
+	var ids []byzcoin.InstanceID
+	collect := func(k, _ []byte) error {
+		ids = append(ids, byzcoin.NewInstanceID(k[len(k)-32:]))
+		return nil
+	}
+	var err error
+	switch {
+	case !q.Seller.Equal(byzcoin.InstanceID{}):
+		err = forPrefix(lt.b.Bucket(bucketSellers), q.Seller[:], collect)
+	case !q.Bidder.Equal(byzcoin.InstanceID{}):
+		err = forPrefix(lt.b.Bucket(bucketBidders), q.Bidder[:], collect)
+	default:
+		err = lt.b.Bucket(bucketAuctions).ForEach(func(k, _ []byte) error {
+			return collect(k, nil)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var recs []AuctionRecord
+	for _, id := range ids {
+		rec, found, err := lt.auction(id)
+		if err != nil {
+			return nil, err
+		}
+		if found && lt.matches(q, rec) {
+			recs = append(recs, rec)
+		}
+	}
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].Created < recs[j].Created })
+	return recs, nil
+}
+
+// matches tells if the auction passes all the criteria of the query.
+func (lt *ledgerTx) matches(q *Query, rec AuctionRecord) bool {
+	if !q.Seller.Equal(byzcoin.InstanceID{}) && !q.Seller.Equal(rec.Seller) {
+		return false
+	}
+	if !q.Bidder.Equal(byzcoin.InstanceID{}) &&
+		lt.b.Bucket(bucketBidders).Get(pairKey(q.Bidder, rec.AuctionID)) == nil {
+		return false
+	}
+	if q.State != "" && q.State != rec.State {
+		return false
+	}
+	if q.From != 0 && rec.CreatedAt < q.From {
+		return false
+	}
+	if q.To != 0 && rec.CreatedAt > q.To {
+		return false
+	}
+	return true
+}
+
+// forPrefix calls f on all the keys of the bucket starting with prefix.
+func forPrefix(b *bbolt.Bucket, prefix []byte, f func(k, v []byte) error) error {
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if err := f(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pairKey(a, b byzcoin.InstanceID) []byte {
+	return append(append([]byte{}, a[:]...), b[:]...)
+}
+
+func encodeUint64(n uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, n)
+	return buf
+}
@@ -0,0 +1,45 @@
+package auction_receipt
+
+import (
+	"errors"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+)
+
+// Client asks the conodes of the roster for receipts, which are verified
+// with the public keys of the roster before being returned.
+type Client struct {
+	*onet.Client
+	Roster    *onet.Roster
+	ByzCoinID skipchain.SkipBlockID
+}
+
+// NewClient returns a client for the ledger bcID run by the roster.
+func NewClient(roster *onet.Roster, bcID skipchain.SkipBlockID) *Client {
+	return &Client{
+		Client:    onet.NewClient(cothority.Suite, ServiceName),
+		Roster:    roster,
+		ByzCoinID: bcID,
+	}
+}
+
+// GetReceipt returns the verified receipt of the auction.
+func (c *Client) GetReceipt(auctInstID byzcoin.InstanceID) (*Receipt, error) {
+	reply := &GetReceiptReply{}
+	err := c.SendProtobuf(c.Roster.RandomServerIdentity(), &GetReceipt{ByzCoinID: c.ByzCoinID, AuctionID: auctInstID}, reply)
+	if err != nil {
+		return nil, err
+	}
+	r := &reply.Receipt
+	if !r.AuctionID.Equal(auctInstID) || !r.Latest.SkipChainID().Equal(c.ByzCoinID) {
+		return nil, errors.New("receipt of another auction")
+	}
+	err = Verify(r, c.Roster.ServicePublics(skipchain.ServiceName))
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,54 @@
+package auction_receipt
+
+import (
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/trie"
+	"go.dedis.ch/cothority/v3/skipchain"
+)
+
+// PROTOSTART
+// package auction_receipt;
+// import "byzcoin.proto";
+// import "skipchain.proto";
+// import "trie.proto";
+//
+// option java_package = "ch.epfl.dedis.lib.proto";
+// option java_outer_classname = "AuctionReceipt";
+
+// Receipt proves that an account won an auction. The fields at the top are
+// what the receipt states, the others prove them with the signatures of the
+// roster only:
+//   - SettlementBlock holds the accepted instruction settling the auction,
+//     "close" for an auction and "process" for an sb_auction, and
+//     SettlementLink is the forward link signed by the roster into it.
+//   - Proof is the auction in the state trie of the block Latest, which the
+//     roster signed in LatestLink. For an sb_auction, BidProof is the bid of
+//     the winner in the same trie, holding the price.
+//
+// The payload of Latest and the forward links of both blocks are not
+// hashed with the blocks, they are left out to keep the receipt small.
+type Receipt struct {
+	AuctionID       byzcoin.InstanceID
+	ContractID      string
+	MetadataHash    []byte
+	Winner          byzcoin.InstanceID
+	Price           uint64
+	Settlement      uint64
+	SettlementBlock skipchain.SkipBlock
+	SettlementLink  skipchain.ForwardLink
+	Proof           trie.Proof
+	BidProof        trie.Proof
+	Latest          skipchain.SkipBlock
+	LatestLink      skipchain.ForwardLink
+}
+
+// GetReceipt asks a conode for the receipt of an auction with a winner.
+type GetReceipt struct {
+	ByzCoinID skipchain.SkipBlockID
+	AuctionID byzcoin.InstanceID
+}
+
+// GetReceiptReply holds the receipt.
+type GetReceiptReply struct {
+	Receipt Receipt
+}
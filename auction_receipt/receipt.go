@@ -0,0 +1,206 @@
+package auction_receipt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/dedis/student_19_auctions/auctions"
+	"github.com/dedis/student_19_auctions/sb_auctions"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/trie"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+)
+
+// settleCommand is the instruction settling the auctions of a contract.
+var settleCommand = map[string]string{
+	auctions.ContractAuctionID:      "close",
+	sb_auctions.ContractSBAuctionID: "process",
+}
+
+// ErrNoWinner is returned for the receipt of an auction without a winner.
+var ErrNoWinner = errors.New("the auction has no winner")
+
+// Encode returns the receipt as a document to be handed out.
+func (r *Receipt) Encode() ([]byte, error) {
+	return protobuf.Encode(r)
+}
+
+// DecodeReceipt is the inverse of Encode.
+func DecodeReceipt(buf []byte) (*Receipt, error) {
+	r := &Receipt{}
+	err := protobuf.DecodeWithConstructors(buf, r, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Verify checks the receipt with the public keys of the roster, as given
+// by ServicePublics(skipchain.ServiceName), and nothing else: no conode
+// needs to be reached. The roster must be the one that signed the two
+// blocks of the receipt.
+func Verify(r *Receipt, publics []kyber.Point) error {
+	suite := pairing.NewSuiteBn256()
+
+	// The auction is in the trie of the block Latest
+	err := checkLink(&r.Latest, &r.LatestLink, suite, publics)
+	if err != nil {
+		return err
+	}
+	header := byzcoin.DataHeader{}
+	err = protobuf.Decode(r.Latest.Data, &header)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(r.Proof.GetRoot(), header.TrieRoot) {
+		return byzcoin.ErrorVerifyTrieRoot
+	}
+	if r.ContractID == sb_auctions.ContractSBAuctionID && !bytes.Equal(r.BidProof.GetRoot(), header.TrieRoot) {
+		return byzcoin.ErrorVerifyTrieRoot
+	}
+	value, err := valueFromProof(&r.Proof, r.AuctionID, r.ContractID)
+	if err != nil {
+		return err
+	}
+	stated := *r
+	err = stated.fill(value)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(stated.MetadataHash, r.MetadataHash) || !stated.Winner.Equal(r.Winner) || stated.Price != r.Price {
+		return errors.New("the receipt does not match the auction")
+	}
+
+	// The auction is settled in the block SettlementBlock
+	err = checkLink(&r.SettlementBlock, &r.SettlementLink, suite, publics)
+	if err != nil {
+		return err
+	}
+	if !r.SettlementBlock.SkipChainID().Equal(r.Latest.SkipChainID()) {
+		return errors.New("the blocks are of different ledgers")
+	}
+	if uint64(r.SettlementBlock.Index) != r.Settlement || r.SettlementBlock.Index > r.Latest.Index {
+		return errors.New("wrong settlement block")
+	}
+	settled, err := settles(&r.SettlementBlock, r.ContractID, r.AuctionID)
+	if err != nil {
+		return err
+	}
+	if !settled {
+		return errors.New("the auction is not settled in the settlement block")
+	}
+	return nil
+}
+
+// checkLink checks that the roster signed the forward link into the block.
+func checkLink(sb *skipchain.SkipBlock, link *skipchain.ForwardLink, suite *pairing.SuiteBn256, publics []kyber.Point) error {
+	if !sb.CalculateHash().Equal(link.To) {
+		return fmt.Errorf("the forward link does not point to block %d", sb.Index)
+	}
+	err := link.Verify(suite, publics)
+	if err != nil {
+		return fmt.Errorf("wrong signature of block %d: %v", sb.Index, err)
+	}
+	return nil
+}
+
+// fill sets what the receipt states from the auction.
+func (r *Receipt) fill(value []byte) error {
+	var item interface {
+		Hash() ([]byte, error)
+	}
+	switch r.ContractID {
+	case auctions.ContractAuctionID:
+		auction, err := auctions.DecodeAuction(value)
+		if err != nil {
+			return err
+		}
+		outcome, _ := auction.Outcome()
+		r.Winner, r.Price = outcome.Winner, outcome.Price
+		item = auction.Item()
+	case sb_auctions.ContractSBAuctionID:
+		auction, err := sb_auctions.DecodeAuction(value)
+		if err != nil {
+			return err
+		}
+		r.Winner = auction.WinnerAccount
+		if r.Winner.Equal(byzcoin.InstanceID{}) {
+			return ErrNoWinner
+		}
+		// The price is the bid of the winner, in an instance of its own
+		bidInstID := sb_auctions.BidInstanceID(r.AuctionID, r.Winner)
+		value, err := valueFromProof(&r.BidProof, bidInstID, sb_auctions.ContractSBBidID)
+		if err != nil {
+			return err
+		}
+		bid := sb_auctions.StoredBid{}
+		err = protobuf.Decode(value, &bid)
+		if err != nil {
+			return err
+		}
+		r.Price = bid.Bid
+		item = auction.Item()
+	default:
+		return errors.New("no receipt for contract " + r.ContractID)
+	}
+	if r.Winner.Equal(byzcoin.InstanceID{}) {
+		return ErrNoWinner
+	}
+	var err error
+	r.MetadataHash, err = item.Hash()
+	return err
+}
+
+// valueFromProof returns the value of the instance of the contract proven
+// by the trie proof.
+func valueFromProof(proof *trie.Proof, instID byzcoin.InstanceID, contractID string) ([]byte, error) {
+	if !proof.Match(instID.Slice()) {
+		return nil, fmt.Errorf("no proof of instance %x", instID.Slice())
+	}
+	body := byzcoin.StateChangeBody{}
+	err := protobuf.Decode(proof.Get(instID.Slice()), &body)
+	if err != nil {
+		return nil, err
+	}
+	if string(body.ContractID) != contractID {
+		return nil, errors.New("instance is not of contract " + contractID)
+	}
+	return body.Value, nil
+}
+
+// settles tells if the block holds an accepted instruction settling the
+// auction. The transactions, not hashed with the block, are checked
+// against the hash of its header.
+func settles(sb *skipchain.SkipBlock, contractID string, auctInstID byzcoin.InstanceID) (bool, error) {
+	header := byzcoin.DataHeader{}
+	err := protobuf.Decode(sb.Data, &header)
+	if err != nil {
+		return false, err
+	}
+	body := byzcoin.DataBody{}
+	err = protobuf.DecodeWithConstructors(sb.Payload, &body, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(header.ClientTransactionHash, body.TxResults.Hash()) {
+		return false, fmt.Errorf("wrong transactions in block %d", sb.Index)
+	}
+	for _, tx := range body.TxResults {
+		if !tx.Accepted {
+			continue
+		}
+		for _, inst := range tx.ClientTransaction.Instructions {
+			if inst.InstanceID.Equal(auctInstID) && inst.Invoke != nil &&
+				inst.Invoke.ContractID == contractID && inst.Invoke.Command == settleCommand[contractID] {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
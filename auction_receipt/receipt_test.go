@@ -0,0 +1,142 @@
+package auction_receipt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/dedis/student_19_auctions/auctions"
+	"github.com/dedis/student_19_auctions/sb_auctions"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/util/random"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m, 0)
+}
+
+func TestReceipt(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+	_, roster, _ := local.GenTree(3, true)
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	msg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:coin", "invoke:coin.mint", "invoke:coin.fetch",
+			"spawn:auction", "invoke:auction.bid", "invoke:auction.close",
+			"spawn:sb_auction", "invoke:sb_auction.bid", "invoke:sb_auction.close", "invoke:sb_auction.process"},
+		signer.Identity())
+	require.NoError(t, err)
+	msg.BlockInterval = time.Second / 2
+	cl, _, err := byzcoin.NewLedger(msg, false)
+	require.NoError(t, err)
+	darcID := msg.GenesisDarc.GetBaseID()
+
+	sender := auctioncore.NewSender(cl, signer)
+	account := func(mint uint64) byzcoin.InstanceID {
+		ctx, err := sender.Send(byzcoin.Instruction{
+			InstanceID: byzcoin.NewInstanceID(darcID),
+			Spawn:      &byzcoin.Spawn{ContractID: contracts.ContractCoinID},
+		})
+		require.NoError(t, err)
+		accInstID := ctx.Instructions[0].DeriveID("")
+		if mint > 0 {
+			_, err = sender.Send(byzcoin.Instruction{
+				InstanceID: accInstID,
+				Invoke: &byzcoin.Invoke{
+					ContractID: contracts.ContractCoinID,
+					Command:    "mint",
+					Args:       byzcoin.Arguments{{Name: "coins", Value: auctioncore.EncodeAmount(mint)}},
+				},
+			})
+			require.NoError(t, err)
+		}
+		return accInstID
+	}
+	seller, deposits := account(0), account(0)
+	bidder, bidder2 := account(100), account(100)
+
+	acl := auctions.NewClient(cl, signer)
+	auctInstID, err := acl.CreateAuction(darcID, auctions.AuctionData{
+		GoodDescription: "bananas",
+		SellerAccount:   seller,
+		State:           auctioncore.StateOpen,
+		ReservePrice:    auctioncore.CreateHash("pepper", 20),
+	})
+	require.NoError(t, err)
+	require.NoError(t, acl.Bid(auctInstID, auctions.BidData{BidderAccount: bidder}, 30))
+	require.NoError(t, acl.Bid(auctInstID, auctions.BidData{BidderAccount: bidder2}, 40))
+
+	rcl := NewClient(roster, cl.ID)
+
+	// No receipt before the auction is settled
+	_, err = rcl.GetReceipt(auctInstID)
+	require.Error(t, err)
+
+	require.NoError(t, acl.Close(auctInstID, auctions.CloseData{Salt: "pepper", ReservePrice: 20}))
+	r, err := rcl.GetReceipt(auctInstID)
+	require.NoError(t, err)
+	require.Equal(t, bidder2, r.Winner)
+	require.Equal(t, uint64(40), r.Price)
+	item := auctioncore.ItemMetadata{Title: "bananas", Quantity: 1}
+	hash, err := item.Hash()
+	require.NoError(t, err)
+	require.Equal(t, hash, r.MetadataHash)
+
+	// The receipt is a document verified offline with the roster only
+	buf, err := r.Encode()
+	require.NoError(t, err)
+	r, err = DecodeReceipt(buf)
+	require.NoError(t, err)
+	publics := roster.ServicePublics(skipchain.ServiceName)
+	require.NoError(t, Verify(r, publics))
+
+	others := make([]kyber.Point, len(publics))
+	for i := range others {
+		others[i] = pairing.NewSuiteBn256().G2().Point().Pick(random.New())
+	}
+	require.Error(t, Verify(r, others))
+
+	tampered := *r
+	tampered.Price = 30
+	require.Error(t, Verify(&tampered, publics))
+	tampered = *r
+	tampered.Winner = bidder
+	require.Error(t, Verify(&tampered, publics))
+	tampered = *r
+	tampered.Settlement--
+	require.Error(t, Verify(&tampered, publics))
+
+	// A sealed-bid auction, whose price is proven by the winning bid
+	scl := sb_auctions.NewClient(cl, signer)
+	sbInstID, err := scl.CreateAuction(darcID, sb_auctions.AuctionData{
+		GoodDescription: "apples",
+		SellerAccount:   seller,
+		ReservePrice:    20,
+		State:           sb_auctions.OPEN,
+		Deposits:        deposits,
+	})
+	require.NoError(t, err)
+	require.NoError(t, scl.Bid(sbInstID, bidder, 25))
+	require.NoError(t, scl.Bid(sbInstID, bidder2, 30))
+	require.NoError(t, scl.Close(sbInstID))
+
+	r, err = rcl.GetReceipt(sbInstID)
+	require.NoError(t, err)
+	require.Equal(t, bidder2, r.Winner)
+	require.Equal(t, uint64(30), r.Price)
+
+	// The proof of the winning bid cannot be left out
+	tampered = *r
+	tampered.BidProof = r.Proof
+	require.Error(t, Verify(&tampered, publics))
+}
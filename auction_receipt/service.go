@@ -0,0 +1,165 @@
+package auction_receipt
+
+import (
+	"errors"
+
+	"github.com/dedis/student_19_auctions/sb_auctions"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// ServiceName is the name of the service, used by the clients.
+const ServiceName = "auction_receipt"
+
+// proofAttempts is how many times the proofs of an sb_auction and of its
+// winning bid are asked for until they are of the same block.
+const proofAttempts = 5
+
+// The service hands out the receipts of the auctions of the ledgers of
+// the conode. It only gathers what the roster already signed: the receipt
+// is trusted through its signatures, not through the conode.
+
+func init() {
+	_, err := onet.RegisterNewService(ServiceName, newService)
+	log.ErrFatal(err)
+	network.RegisterMessages(&GetReceipt{}, &GetReceiptReply{})
+}
+
+// Service builds the receipts.
+type Service struct {
+	// We need to embed the ServiceProcessor, so that incoming messages
+	// are correctly handled.
+	*onet.ServiceProcessor
+}
+
+func newService(c *onet.Context) (onet.Service, error) {
+	s := &Service{
+		ServiceProcessor: onet.NewServiceProcessor(c),
+	}
+	err := s.RegisterHandlers(s.GetReceipt)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetReceipt returns the receipt of a settled auction with a winner.
+func (s *Service) GetReceipt(req *GetReceipt) (*GetReceiptReply, error) {
+	r, err := s.prove(req.ByzCoinID, req.AuctionID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.settlement(r)
+	if err != nil {
+		return nil, err
+	}
+	return &GetReceiptReply{Receipt: *r}, nil
+}
+
+// prove fills the receipt from the latest state of the auction, with the
+// proofs of the instances read.
+func (s *Service) prove(bcID skipchain.SkipBlockID, auctInstID byzcoin.InstanceID) (*Receipt, error) {
+	for i := 0; i < proofAttempts; i++ {
+		proof, err := s.getProof(bcID, auctInstID)
+		if err != nil {
+			return nil, err
+		}
+		_, _, contractID, _, err := proof.KeyValue()
+		if err != nil {
+			return nil, err
+		}
+		r := &Receipt{
+			AuctionID:  auctInstID,
+			ContractID: contractID,
+			Proof:      proof.InclusionProof,
+			Latest:     proof.Latest,
+			LatestLink: proof.Links[len(proof.Links)-1],
+		}
+		value, err := valueFromProof(&r.Proof, auctInstID, contractID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Without a proof of the winning bid, fill fails on an
+		// sb_auction with a winner: the bid is proven then.
+		err = r.fill(value)
+		if err == nil || err == ErrNoWinner {
+			return r, err
+		}
+		if contractID != sb_auctions.ContractSBAuctionID {
+			return nil, err
+		}
+		auction, err := sb_auctions.DecodeAuction(value)
+		if err != nil {
+			return nil, err
+		}
+		bidProof, err := s.getProof(bcID, sb_auctions.BidInstanceID(auctInstID, auction.WinnerAccount))
+		if err != nil {
+			return nil, err
+		}
+		if !bidProof.Latest.Hash.Equal(proof.Latest.Hash) {
+			// A block was added in between
+			continue
+		}
+		r.BidProof = bidProof.InclusionProof
+		return r, r.fill(value)
+	}
+	return nil, errors.New("the ledger moved on while proving the auction")
+}
+
+// settlement walks back from the block Latest of the receipt to the block
+// settling the auction, and strips the blocks of what is not needed.
+func (s *Service) settlement(r *Receipt) error {
+	db := s.skService().GetDB()
+	sb := db.GetByID(r.Latest.Hash)
+	if sb == nil {
+		return errors.New("the latest block is not stored")
+	}
+	for sb.Index > 0 {
+		prev := db.GetByID(sb.BackLinkIDs[0])
+		if prev == nil || len(prev.ForwardLink) == 0 {
+			return errors.New("missing the block before block " + sb.Hash.Short())
+		}
+		settled, err := settles(sb, r.ContractID, r.AuctionID)
+		if err != nil {
+			return err
+		}
+		if settled {
+			r.Settlement = uint64(sb.Index)
+			r.SettlementBlock = *sb.Copy()
+			r.SettlementBlock.ForwardLink = nil
+			r.SettlementLink = *prev.ForwardLink[0]
+			r.Latest.Payload = nil
+			r.Latest.ForwardLink = nil
+			return nil
+		}
+		sb = prev
+	}
+	return errors.New("the auction is not settled")
+}
+
+func (s *Service) getProof(bcID skipchain.SkipBlockID, instID byzcoin.InstanceID) (*byzcoin.Proof, error) {
+	reply, err := s.byzService().GetProof(&byzcoin.GetProof{
+		Version: byzcoin.CurrentVersion,
+		Key:     instID.Slice(),
+		ID:      bcID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(reply.Proof.Links) == 0 {
+		return nil, errors.New("the proof has no links")
+	}
+	return &reply.Proof, nil
+}
+
+func (s *Service) byzService() *byzcoin.Service {
+	return s.Service(byzcoin.ServiceName).(*byzcoin.Service)
+}
+
+func (s *Service) skService() *skipchain.Service {
+	return s.Service(skipchain.ServiceName).(*skipchain.Service)
+}
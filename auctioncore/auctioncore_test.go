@@ -0,0 +1,150 @@
+package auctioncore
+
+import (
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/byzcoin/trie"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+func TestAmount(t *testing.T) {
+	buf := EncodeAmount(258)
+	// The coin contract reads an uint64 in little endian
+	require.Equal(t, []byte{2, 1, 0, 0, 0, 0, 0, 0}, buf)
+
+	amount, err := DecodeAmount(buf)
+	require.NoError(t, err)
+	require.Equal(t, uint64(258), amount)
+
+	_, err = DecodeAmount(buf[:4])
+	require.Equal(t, ErrAmountLength, err)
+}
+
+func TestReserve(t *testing.T) {
+	hash := CreateHash("testsalt", 100)
+	require.True(t, VerifyReserve(hash, CloseData{Salt: "testsalt", ReservePrice: 100}))
+	require.False(t, VerifyReserve(hash, CloseData{Salt: "testsalt", ReservePrice: 99}))
+	require.False(t, VerifyReserve(hash, CloseData{Salt: "othersalt", ReservePrice: 100}))
+}
+
+func TestCollectCoins(t *testing.T) {
+	account := byzcoin.NewInstanceID([]byte("account"))
+	other := byzcoin.NewInstanceID([]byte("other coin"))
+	coinBuf, err := protobuf.Encode(&byzcoin.Coin{Name: contracts.CoinName, Value: 10})
+	require.NoError(t, err)
+	rst := testTrie{account: byzcoin.NewStateChange(byzcoin.Create, account,
+		contracts.ContractCoinID, coinBuf, darc.ID{})}
+
+	amount, cout, err := CollectCoins(rst, account, []byzcoin.Coin{
+		{Name: contracts.CoinName, Value: 3},
+		{Name: other, Value: 5},
+		{Name: contracts.CoinName, Value: 4},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), amount)
+	require.Equal(t, []byzcoin.Coin{{Name: other, Value: 5}}, cout)
+
+	_, _, err = CollectCoins(rst, other, nil)
+	require.Error(t, err)
+}
+
+func TestPayouts(t *testing.T) {
+	a := byzcoin.NewInstanceID([]byte("a"))
+	b := byzcoin.NewInstanceID([]byte("b"))
+
+	p := Payouts{}
+	p.Add(a, 10)
+	p.Add(b, 0)
+	p.Add(b, 5)
+	p.Add(a, 20)
+	require.Equal(t, uint64(30), p.Amount(a))
+	require.Equal(t, uint64(5), p.Amount(b))
+	require.Equal(t, []byzcoin.InstanceID{a, b}, p.accounts)
+}
+
+func TestBlockIndex(t *testing.T) {
+	index, err := BlockIndex(testTrie{})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), index)
+
+	_, err = BlockIndex(stagingTrie{})
+	require.Equal(t, ErrNoBlockIndex, err)
+}
+
+// stagingTrie behaves like the staging trie of older ledgers, which cannot
+// give the index.
+type stagingTrie struct {
+	testTrie
+}
+
+func (stagingTrie) GetIndex() int {
+	panic("cannot get index in stagingStateTrie")
+}
+
+// testTrie is a ReadOnlyStateTrie holding a few instances.
+type testTrie map[byzcoin.InstanceID]byzcoin.StateChange
+
+func (tt testTrie) GetValues(key []byte) ([]byte, uint64, string, darc.ID, error) {
+	sc, ok := tt[byzcoin.NewInstanceID(key)]
+	if !ok {
+		return nil, 0, "", nil, errors.New("key not set")
+	}
+	return sc.Value, sc.Version, sc.ContractID, sc.DarcID, nil
+}
+
+func (tt testTrie) GetProof(key []byte) (*trie.Proof, error) {
+	return nil, errors.New("not supported")
+}
+
+func (tt testTrie) GetIndex() int {
+	return 0
+}
+
+func TestItemMetadata(t *testing.T) {
+	hash := sha256.Sum256([]byte("photo"))
+	m := ItemMetadata{Version: MetadataVersion, Title: "chair", Category: "furniture", Quantity: 2,
+		Attributes:  []AttributeData{{Key: "wood", Value: "oak"}},
+		Attachments: []AttachmentData{{Name: "photo.jpg", Hash: hash[:]}}}
+	require.NoError(t, m.Validate())
+	wood, ok := m.Attribute("wood")
+	require.True(t, ok)
+	require.Equal(t, "oak", wood)
+	_, ok = m.Attribute("color")
+	require.False(t, ok)
+
+	desc, category, err := CheckMetadata(m, "", "")
+	require.NoError(t, err)
+	require.Equal(t, "chair", desc)
+	require.Equal(t, "furniture", category)
+
+	bad := m
+	bad.Quantity = 0
+	require.Error(t, bad.Validate())
+	bad = m
+	bad.Version = MetadataVersion + 1
+	require.Error(t, bad.Validate())
+	bad = m
+	bad.Attributes = append(bad.Attributes, AttributeData{Key: "wood"})
+	require.Error(t, bad.Validate())
+	bad = m
+	bad.Attachments = []AttachmentData{{Name: "photo.jpg", Hash: hash[:4]}}
+	require.Error(t, bad.Validate())
+	bad = m
+	bad.Title = strings.Repeat("a", MaxTitleLength+1)
+	_, _, err = CheckMetadata(bad, "", "")
+	require.Error(t, err)
+
+	// Auctions without metadata keep their description
+	desc, category, err = CheckMetadata(ItemMetadata{}, "old chair", "")
+	require.NoError(t, err)
+	require.Equal(t, "old chair", desc)
+	require.Equal(t, ItemMetadata{Title: "old chair", Quantity: 1}, Describe(ItemMetadata{}, "old chair"))
+	require.Equal(t, m, Describe(m, "old chair"))
+}
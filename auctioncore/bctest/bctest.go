@@ -0,0 +1,114 @@
+// Package bctest runs the ledgers the tests of the auction contracts use.
+package bctest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/protobuf"
+)
+
+// BCTest is a ledger on three local nodes. Its genesis darc gives the
+// rules of the test to Signer, whose next counter is Ct.
+type BCTest struct {
+	Local   *onet.LocalTest
+	Signer  darc.Signer
+	Servers []*onet.Server
+	Roster  *onet.Roster
+	Cl      *byzcoin.Client
+	GMsg    *byzcoin.CreateGenesisBlock
+	GDarc   *darc.Darc
+	Ct      uint64
+}
+
+// New creates a new ledger with the genesis darc having the rules.
+func New(t *testing.T, rules ...string) (out *BCTest) {
+	out = &BCTest{}
+	// First create a local test environment with three nodes.
+	out.Local = onet.NewTCPTest(cothority.Suite)
+
+	out.Signer = darc.NewSignerEd25519(nil, nil)
+	out.Servers, out.Roster, _ = out.Local.GenTree(3, true)
+
+	var err error
+	out.GMsg, err = byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, out.Roster, rules, out.Signer.Identity())
+	require.Nil(t, err)
+	out.GDarc = &out.GMsg.GenesisDarc
+
+	// This BlockInterval is good for testing, but in real world applications this
+	// should be more like 5 seconds.
+	out.GMsg.BlockInterval = time.Second / 2
+
+	out.Cl, _, err = byzcoin.NewLedger(out.GMsg, false)
+	require.Nil(t, err)
+	out.Ct = 1
+
+	return out
+}
+
+// Close stops the nodes of the ledger.
+func (bct *BCTest) Close() {
+	bct.Local.CloseAll()
+}
+
+// SendInstructions signs the instructions with consecutive counters and
+// waits for them to be included.
+func (bct *BCTest) SendInstructions(t *testing.T, instrs ...byzcoin.Instruction) (byzcoin.ClientTransaction, error) {
+	for i := range instrs {
+		instrs[i].SignerCounter = []uint64{bct.Ct + uint64(i)}
+	}
+	ctx := byzcoin.ClientTransaction{Instructions: instrs}
+	require.NoError(t, ctx.FillSignersAndSignWith(bct.Signer))
+
+	_, err := bct.Cl.AddTransactionAndWait(ctx, 10)
+	if err == nil {
+		bct.Ct += uint64(len(instrs))
+	}
+	return ctx, err
+}
+
+// CreateAccount spawns an account for the coin type coinName, controlled by
+// the genesis darc, and mints amount coins in it.
+func (bct *BCTest) CreateAccount(t *testing.T, coinName byzcoin.InstanceID, amount uint64) byzcoin.InstanceID {
+	ctx, err := bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(bct.GDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ContractCoinID,
+			Args:       byzcoin.Arguments{{Name: "type", Value: coinName.Slice()}},
+		},
+	})
+	require.NoError(t, err)
+	accInstID := ctx.Instructions[0].DeriveID("")
+
+	if amount > 0 {
+		_, err = bct.SendInstructions(t, byzcoin.Instruction{
+			InstanceID: accInstID,
+			Invoke: &byzcoin.Invoke{
+				ContractID: contracts.ContractCoinID,
+				Command:    "mint",
+				Args:       byzcoin.Arguments{{Name: "coins", Value: auctioncore.EncodeAmount(amount)}},
+			},
+		})
+		require.NoError(t, err)
+	}
+	return accInstID
+}
+
+// CoinBalance returns the coins stored in an account.
+func (bct *BCTest) CoinBalance(t *testing.T, accInstID byzcoin.InstanceID) uint64 {
+	reply, err := bct.Cl.GetProof(accInstID.Slice())
+	require.Nil(t, err)
+	_, val, _, _, err := reply.Proof.KeyValue()
+	require.Nil(t, err)
+
+	coin := byzcoin.Coin{}
+	require.Nil(t, protobuf.Decode(val, &coin))
+	return coin.Value
+}
@@ -0,0 +1,30 @@
+package auctioncore
+
+import (
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/protobuf"
+)
+
+// ReadInstance gets the instance from the ledger with a proof verified
+// against the chain, checks its contract and decodes its value. It returns
+// false if the instance does not exist.
+func ReadInstance(cl *byzcoin.Client, instID byzcoin.InstanceID, contractID string, value interface{}) (bool, error) {
+	val, found, err := ReadValue(cl, instID, contractID)
+	if err != nil || !found {
+		return false, err
+	}
+	return true, protobuf.Decode(val, value)
+}
+
+// ReadValue is ReadInstance for the values that need their own decoding.
+func ReadValue(cl *byzcoin.Client, instID byzcoin.InstanceID, contractID string) ([]byte, bool, error) {
+	reply, err := cl.GetProof(instID.Slice())
+	if err != nil {
+		return nil, false, err
+	}
+	val, err := ValueFromProof(reply.Proof, cl.ID, instID, contractID)
+	if err == ErrUnknownInstanceID {
+		return nil, false, nil
+	}
+	return val, err == nil, err
+}
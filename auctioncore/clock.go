@@ -0,0 +1,19 @@
+package auctioncore
+
+import "go.dedis.ch/cothority/v3/byzcoin"
+
+// BlockIndex returns the index of the block the instruction being executed
+// will be part of. Older ledgers do not give the index to the contracts and
+// panic, which is reported as ErrNoBlockIndex.
+func BlockIndex(rst byzcoin.ReadOnlyStateTrie) (index uint64, err error) {
+	defer func() {
+		if recover() != nil {
+			err = ErrNoBlockIndex
+		}
+	}()
+	latest := rst.GetIndex()
+	if latest < 0 {
+		return 0, ErrNoBlockIndex
+	}
+	return uint64(latest) + 1, nil
+}
@@ -0,0 +1,153 @@
+package auctioncore
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/protobuf"
+)
+
+// EncodeAmount returns the representation of an amount expected by the
+// "coins" argument of the coin contract: an uint64 in little endian.
+func EncodeAmount(amount uint64) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, amount)
+	return buf
+}
+
+// DecodeAmount is the inverse of EncodeAmount.
+func DecodeAmount(buf []byte) (uint64, error) {
+	if len(buf) != 8 {
+		return 0, ErrAmountLength
+	}
+	return binary.LittleEndian.Uint64(buf), nil
+}
+
+// GetCoin returns the coin stored in the account instance.
+func GetCoin(rst byzcoin.ReadOnlyStateTrie, account byzcoin.InstanceID) (byzcoin.Coin, error) {
+	coin := byzcoin.Coin{}
+	val, _, contractID, _, err := rst.GetValues(account.Slice())
+	if err != nil {
+		return coin, err
+	}
+	if contractID != contracts.ContractCoinID {
+		return coin, errors.New("account is not a coin instance")
+	}
+	err = protobuf.Decode(val, &coin)
+	return coin, err
+}
+
+// CollectCoins takes the coins of the account's type out of the coins
+// given to the instruction, usually by a "fetch" on the same account. It
+// returns the escrowed amount and the coins of other types.
+func CollectCoins(rst byzcoin.ReadOnlyStateTrie, account byzcoin.InstanceID, cin []byzcoin.Coin) (amount uint64, cout []byzcoin.Coin, err error) {
+	coin, err := GetCoin(rst, account)
+	if err != nil {
+		return
+	}
+	for _, c := range cin {
+		if c.Name.Equal(coin.Name) {
+			amount += c.Value
+		} else {
+			cout = append(cout, c)
+		}
+	}
+	return
+}
+
+// Contracts gives the constructors of the contracts. It is the ByzCoin
+// service in a conode, and a stand-in when the auctions are replayed away
+// from the ledger.
+type Contracts interface {
+	GetContractConstructor(contractID string) (byzcoin.ContractFn, bool)
+}
+
+// StoreCoin credits the account with amount coins of its own type. The
+// coins come out of the escrow of the calling contract and are stored
+// through the coin contract.
+func StoreCoin(bs Contracts, rst byzcoin.ReadOnlyStateTrie, amount uint64, account byzcoin.InstanceID) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cFact, found := bs.GetContractConstructor(contracts.ContractCoinID)
+	if !found {
+		err = ErrCoinNotFound
+		return
+	}
+
+	in, _, _, _, err := rst.GetValues(account.Slice())
+	if err != nil {
+		err = errors.New("cfactory getValues failed")
+		return
+	}
+
+	cCoin, err := cFact(in)
+	if err != nil {
+		err = errors.New("coin factory failed")
+		return
+	}
+
+	coin := byzcoin.Coin{}
+	err = protobuf.Decode(in, &coin)
+	if err != nil {
+		return
+	}
+
+	instruct := byzcoin.Instruction{
+		InstanceID: account,
+		Invoke: &byzcoin.Invoke{
+			ContractID: contracts.ContractCoinID,
+			Command:    "store",
+		},
+	}
+	return cCoin.Invoke(rst, instruct, []byzcoin.Coin{{Name: coin.Name, Value: amount}})
+}
+
+// Payouts gathers the coins an instruction credits to accounts. An account
+// paid several times in the same instruction must get a single state
+// change, as every store starts from the value in the trie.
+type Payouts struct {
+	accounts []byzcoin.InstanceID
+	amounts  map[byzcoin.InstanceID]uint64
+}
+
+// Add credits amount to account. Zero amounts are ignored.
+func (p *Payouts) Add(account byzcoin.InstanceID, amount uint64) {
+	if amount == 0 {
+		return
+	}
+	if p.amounts == nil {
+		p.amounts = make(map[byzcoin.InstanceID]uint64)
+	}
+	if _, ok := p.amounts[account]; !ok {
+		p.accounts = append(p.accounts, account)
+	}
+	p.amounts[account] += amount
+}
+
+// Amount returns what has been credited to account so far.
+func (p *Payouts) Amount(account byzcoin.InstanceID) uint64 {
+	return p.amounts[account]
+}
+
+// List returns the payouts in the order the accounts were first credited.
+func (p *Payouts) List() []PayoutData {
+	var list []PayoutData
+	for _, account := range p.accounts {
+		list = append(list, PayoutData{Account: account, Amount: p.amounts[account]})
+	}
+	return list
+}
+
+// StoreCoins returns the state changes storing all the payouts, in the
+// order the accounts were first credited.
+func (p *Payouts) StoreCoins(bs Contracts, rst byzcoin.ReadOnlyStateTrie) ([]byzcoin.StateChange, error) {
+	var sc []byzcoin.StateChange
+	for _, account := range p.accounts {
+		scs, _, err := StoreCoin(bs, rst, p.amounts[account], account)
+		if err != nil {
+			return nil, err
+		}
+		sc = append(sc, scs...)
+	}
+	return sc, nil
+}
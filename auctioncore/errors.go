@@ -0,0 +1,37 @@
+package auctioncore
+
+import "errors"
+
+// Errors returned by the auction contracts.
+var (
+	ErrNotAuction        = errors.New("not an auction")
+	ErrNotBid            = errors.New("not a bid")
+	ErrNotClose          = errors.New("not a close struct")
+	ErrMissingAuction    = errors.New("need an argument with name auction")
+	ErrMissingBid        = errors.New("need an argument with name bid")
+	ErrMissingClose      = errors.New("need an argument with name close")
+	ErrAuctionClosed     = errors.New("auction is closed or dropped, cannot bid")
+	ErrAuctionOpen       = errors.New("auction is still open")
+	ErrSellerBid         = errors.New("seller can not bid")
+	ErrZeroBid           = errors.New("can not bid 0 or less")
+	ErrBidTooLow         = errors.New("cannot bid less than current highest bid")
+	ErrBidTooHigh        = errors.New("cannot bid more than current lowest bid or budget")
+	ErrReserveVerify     = errors.New("Verification of reserve price failed")
+	ErrNoBids            = errors.New("no bids in auction")
+	ErrEscrowMismatch    = errors.New("escrowed coins do not match the bid")
+	ErrUnbackedBid       = errors.New("the bid is the escrowed coins, it cannot state an amount")
+	ErrCoinNotFound      = errors.New("coin contract not found")
+	ErrAmountLength      = errors.New("amount is wrong length")
+	ErrAlreadySettled    = errors.New("auction is already settled")
+	ErrUnknownInstanceID = errors.New("instance does not exist")
+	ErrNoBlockIndex      = errors.New("the ledger does not give the block index to contracts")
+	ErrNotAllowed        = errors.New("signers are not on the allow-list of the auction")
+	ErrTimeout           = errors.New("timeout while waiting for the auction")
+)
+
+// IsKeyNotSet tells if err is the error of the state trie for an instance
+// that does not exist. byzcoin does not export it, only its message can be
+// compared.
+func IsKeyNotSet(err error) bool {
+	return err != nil && err.Error() == "key not set"
+}
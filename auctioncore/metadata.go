@@ -0,0 +1,116 @@
+package auctioncore
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"go.dedis.ch/protobuf"
+)
+
+// MetadataVersion is the version of ItemMetadata written by this code.
+const MetadataVersion = 1
+
+// Size limits of the item metadata, to keep the auctions small in the
+// global state.
+const (
+	MaxTitleLength     = 200
+	MaxTextLength      = 1000
+	MaxAttributes      = 50
+	MaxAttachments     = 20
+	MaxAttachmentsName = 200
+)
+
+// HasMetadata returns true if the auction was spawned with metadata.
+func (m ItemMetadata) HasMetadata() bool {
+	return m.Version != 0
+}
+
+// Validate checks the metadata of a new auction: a title and a quantity are
+// required, attribute keys must be unique and attachments must be sha256
+// hashes.
+func (m ItemMetadata) Validate() error {
+	if m.Version != MetadataVersion {
+		return fmt.Errorf("unknown metadata version %d", m.Version)
+	}
+	if m.Title == "" || len(m.Title) > MaxTitleLength {
+		return fmt.Errorf("the title must have between 1 and %d bytes", MaxTitleLength)
+	}
+	if m.Quantity == 0 {
+		return errors.New("the quantity must be at least 1")
+	}
+	if len(m.Category) > MaxTitleLength || len(m.Condition) > MaxTitleLength {
+		return fmt.Errorf("category and condition must have at most %d bytes", MaxTitleLength)
+	}
+	if len(m.Attributes) > MaxAttributes {
+		return fmt.Errorf("at most %d attributes", MaxAttributes)
+	}
+	keys := make(map[string]bool)
+	for _, a := range m.Attributes {
+		if a.Key == "" || len(a.Key) > MaxTitleLength || len(a.Value) > MaxTextLength {
+			return fmt.Errorf("attribute %q is empty or too long", a.Key)
+		}
+		if keys[a.Key] {
+			return fmt.Errorf("attribute %q is repeated", a.Key)
+		}
+		keys[a.Key] = true
+	}
+	if len(m.Attachments) > MaxAttachments {
+		return fmt.Errorf("at most %d attachments", MaxAttachments)
+	}
+	for _, a := range m.Attachments {
+		if len(a.Name) > MaxAttachmentsName || len(a.Hash) != sha256.Size {
+			return fmt.Errorf("attachment %q needs a short name and a sha256 hash", a.Name)
+		}
+	}
+	return nil
+}
+
+// Attribute returns the value of the attribute key.
+func (m ItemMetadata) Attribute(key string) (string, bool) {
+	for _, a := range m.Attributes {
+		if a.Key == key {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// Describe returns the metadata of an auction, or for an auction with only
+// a GoodDescription, metadata holding it as the title of a single item.
+func Describe(m ItemMetadata, goodDescription string) ItemMetadata {
+	if m.HasMetadata() {
+		return m
+	}
+	return ItemMetadata{Title: goodDescription, Quantity: 1}
+}
+
+// Hash returns the sha256 hash of the encoded metadata, binding a document
+// to the item sold.
+func (m ItemMetadata) Hash() ([]byte, error) {
+	buf, err := protobuf.Encode(&m)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(buf)
+	return h[:], nil
+}
+
+// CheckMetadata validates the metadata of a new auction, if any. It returns
+// the description and category to store in the auction, taken from the
+// metadata when they are empty.
+func CheckMetadata(m ItemMetadata, goodDescription, category string) (string, string, error) {
+	if !m.HasMetadata() {
+		return goodDescription, category, nil
+	}
+	if err := m.Validate(); err != nil {
+		return "", "", err
+	}
+	if goodDescription == "" {
+		goodDescription = m.Title
+	}
+	if category == "" {
+		category = m.Category
+	}
+	return goodDescription, category, nil
+}
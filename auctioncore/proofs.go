@@ -0,0 +1,65 @@
+package auctioncore
+
+import (
+	"bytes"
+	"errors"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/protobuf"
+)
+
+// ProveInstance returns the proof of the instance from the ByzCoin service
+// of the conode, for the services answering with verifiable data.
+func ProveInstance(bs *byzcoin.Service, bcID skipchain.SkipBlockID, instID byzcoin.InstanceID) (byzcoin.Proof, error) {
+	reply, err := bs.GetProof(&byzcoin.GetProof{
+		Version: byzcoin.CurrentVersion,
+		Key:     instID.Slice(),
+		ID:      bcID,
+	})
+	if err != nil {
+		return byzcoin.Proof{}, err
+	}
+	return reply.Proof, nil
+}
+
+// ValueFromProof verifies the proof against the ledger bcID and returns the
+// value of the instance, which must be of the contract. It returns
+// ErrUnknownInstanceID for a proof of absence.
+func ValueFromProof(proof byzcoin.Proof, bcID skipchain.SkipBlockID, instID byzcoin.InstanceID, contractID string) ([]byte, error) {
+	err := proof.Verify(bcID)
+	if err != nil {
+		return nil, err
+	}
+	if !proof.InclusionProof.Match(instID.Slice()) {
+		return nil, ErrUnknownInstanceID
+	}
+	key, val, cid, _, err := proof.KeyValue()
+	if err != nil {
+		return nil, err
+	}
+	if !byzcoin.NewInstanceID(key).Equal(instID) {
+		return nil, errors.New("proof of another instance")
+	}
+	if cid != contractID {
+		return nil, errors.New("instance is not of contract " + contractID)
+	}
+	return val, nil
+}
+
+// CheckReply checks that the data sent by a conode is the one decoded from
+// the proofs of its reply.
+func CheckReply(proven, sent interface{}) error {
+	provenBuf, err := protobuf.Encode(proven)
+	if err != nil {
+		return err
+	}
+	sentBuf, err := protobuf.Encode(sent)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(provenBuf, sentBuf) {
+		return errors.New("the reply does not match its proofs")
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package auctioncore
+
+import "go.dedis.ch/cothority/v3/byzcoin"
+
+// PROTOSTART
+// package auctioncore;
+// import "byzcoin.proto";
+//
+// option java_package = "ch.epfl.dedis.lib.proto";
+// option java_outer_classname = "AuctionCore";
+
+// States of an auction, as stored by the auction contracts.
+const (
+	StateOpen    = "OPEN"
+	StateClosed  = "CLOSED"
+	StateWClosed = "WCLOSED" // closed with a winner
+	StateDropped = "DROPPED"
+)
+
+// BidData is the argument of a "bid" instruction.
+type BidData struct {
+	BidderAccount byzcoin.InstanceID // The place to refund if this bid is not accepted or debit if accepted.
+	BidderPubKey  string             `protobuf:"opt"`
+	Bid           uint64
+	Lot           uint32 `protobuf:"opt"` // index of the lot of a multi-lot auction
+}
+
+// ItemMetadata describes the good sold by an auction. Version is
+// MetadataVersion, the auctions without metadata leave it at 0 and only
+// have their GoodDescription.
+type ItemMetadata struct {
+	Version     uint32
+	Title       string
+	Category    string
+	Condition   string
+	Quantity    uint64
+	Attributes  []AttributeData
+	Attachments []AttachmentData
+}
+
+// AttributeData is a key/value attribute of an item.
+type AttributeData struct {
+	Key   string
+	Value string
+}
+
+// AttachmentData points to an off-chain attachment, such as a photo, by the
+// sha256 hash of its content.
+type AttachmentData struct {
+	Name string
+	Hash []byte
+}
+
+// PayoutData is a payment made by an auction out of its escrow.
+type PayoutData struct {
+	Account byzcoin.InstanceID
+	Amount  uint64
+}
+
+// OutcomeData is the result of an auction as returned by the query
+// services. Winner and Price are only set once the auction has a winner.
+type OutcomeData struct {
+	State  string
+	Winner byzcoin.InstanceID
+	Price  uint64
+}
+
+// CloseData reveals the reserve price hidden behind a hash created with
+// CreateHash.
+type CloseData struct {
+	Salt         string
+	ReservePrice uint64
+}
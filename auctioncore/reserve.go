@@ -0,0 +1,21 @@
+package auctioncore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// CreateHash hides a reserve price behind a salted sha256 hash. The seller
+// stores the hash in the auction and reveals salt and price on close.
+func CreateHash(salt string, reservePrice uint64) string {
+	h := sha256.New()
+	h.Write([]byte(salt + strconv.FormatUint(reservePrice, 10)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// VerifyReserve checks that the revealed close data matches the hash
+// stored in the auction.
+func VerifyReserve(hash string, cd CloseData) bool {
+	return CreateHash(cd.Salt, cd.ReservePrice) == hash
+}
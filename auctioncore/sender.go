@@ -0,0 +1,78 @@
+package auctioncore
+
+import (
+	"errors"
+	"time"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/darc"
+)
+
+// Sender signs and sends the transactions of a signer. The signer counters
+// are read from the ledger before every transaction, so that several
+// senders can share the same signer as long as they do not send at the
+// same time.
+type Sender struct {
+	Client *byzcoin.Client
+	Signer darc.Signer
+	// Wait is the number of blocks to wait for the transaction to be
+	// included.
+	Wait int
+}
+
+// NewSender returns a sender waiting 10 blocks for its transactions.
+func NewSender(cl *byzcoin.Client, signer darc.Signer) *Sender {
+	return &Sender{Client: cl, Signer: signer, Wait: 10}
+}
+
+// Send fills the counters of the instructions, signs them and waits for the
+// transaction to be accepted.
+func (s *Sender) Send(instrs ...byzcoin.Instruction) (byzcoin.ClientTransaction, error) {
+	reply, err := s.Client.GetSignerCounters(s.Signer.Identity().String())
+	if err != nil {
+		return byzcoin.ClientTransaction{}, err
+	}
+	if len(reply.Counters) != 1 {
+		return byzcoin.ClientTransaction{}, errors.New("no counter for the signer")
+	}
+	for i := range instrs {
+		instrs[i].SignerCounter = []uint64{reply.Counters[0] + 1 + uint64(i)}
+	}
+	ctx := byzcoin.ClientTransaction{Instructions: instrs}
+	err = ctx.FillSignersAndSignWith(s.Signer)
+	if err != nil {
+		return ctx, err
+	}
+	_, err = s.Client.AddTransactionAndWait(ctx, s.Wait)
+	return ctx, err
+}
+
+// FetchCoins returns the instruction taking amount coins from the account,
+// to be sent right before the instruction escrowing them.
+func FetchCoins(account byzcoin.InstanceID, amount uint64) byzcoin.Instruction {
+	return byzcoin.Instruction{
+		InstanceID: account,
+		Invoke: &byzcoin.Invoke{
+			ContractID: contracts.ContractCoinID,
+			Command:    "fetch",
+			Args:       byzcoin.Arguments{{Name: "coins", Value: EncodeAmount(amount)}},
+		},
+	}
+}
+
+// Poll calls done every interval until it returns true or an error. It
+// returns ErrTimeout once the timeout is over.
+func Poll(interval, timeout time.Duration, done func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := done()
+		if err != nil || ok {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return ErrTimeout
+		}
+		time.Sleep(interval)
+	}
+}
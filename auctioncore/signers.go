@@ -0,0 +1,109 @@
+package auctioncore
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+)
+
+// VerifySignatures checks that every signer of the instruction signed the
+// transaction hash. Contracts that let anybody invoke them use it before
+// trusting inst.SignerIdentities.
+func VerifySignatures(inst byzcoin.Instruction, ctxHash []byte) error {
+	if len(inst.SignerIdentities) != len(inst.Signatures) {
+		return errors.New("length of identities does not match the length of signatures")
+	}
+	if len(inst.Signatures) == 0 {
+		return errors.New("no signatures - nothing to verify")
+	}
+	for i := range inst.Signatures {
+		if err := inst.SignerIdentities[i].Verify(ctxHash, inst.Signatures[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SignedBy returns true if identity, as a darc identity string, is one of
+// the signers of the instruction.
+func SignedBy(inst byzcoin.Instruction, identity string) bool {
+	for _, id := range inst.GetIdentityStrings() {
+		if id == identity {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyOwner checks that the signers of the instruction satisfy the sign
+// rule of the darc controlling the instance, usually a coin account. The
+// signatures must have been checked with VerifySignatures.
+func VerifyOwner(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, instID byzcoin.InstanceID) error {
+	_, _, _, darcID, err := rst.GetValues(instID.Slice())
+	if err != nil {
+		return err
+	}
+	return verifySign(rst, inst, darcID)
+}
+
+// VerifyAllowList checks that the signers of the instruction satisfy the
+// sign rule of the allow-list darc. An empty allow-list lets everybody in.
+// The signatures must have been checked with VerifySignatures.
+func VerifyAllowList(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, allowList darc.ID) error {
+	if len(allowList) == 0 {
+		return nil
+	}
+	if err := verifySign(rst, inst, allowList); err != nil {
+		return ErrNotAllowed
+	}
+	return nil
+}
+
+// CheckAllowList checks that the allow-list of a new auction, if any, is a
+// darc of the ledger.
+func CheckAllowList(rst byzcoin.ReadOnlyStateTrie, allowList darc.ID) error {
+	if len(allowList) == 0 {
+		return nil
+	}
+	if _, err := LoadDarc(rst, allowList); err != nil {
+		return errors.New("allow-list is not a darc: " + err.Error())
+	}
+	return nil
+}
+
+// LoadDarc reads the darc stored at darcID. It only accepts instances of the
+// darc contract, which every ledger has.
+func LoadDarc(rst byzcoin.ReadOnlyStateTrie, darcID darc.ID) (*darc.Darc, error) {
+	darcBuf, _, contractID, _, err := rst.GetValues(darcID)
+	if err != nil {
+		return nil, err
+	}
+	if contractID != byzcoin.ContractDarcID {
+		return nil, errors.New("instance is not a darc")
+	}
+	return darc.NewFromProtobuf(darcBuf)
+}
+
+func verifySign(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, darcID darc.ID) error {
+	d, err := LoadDarc(rst, darcID)
+	if err != nil {
+		return err
+	}
+	getDarc := func(str string, latest bool) *darc.Darc {
+		if len(str) < 5 || string(str[0:5]) != "darc:" {
+			return nil
+		}
+		id, err := hex.DecodeString(str[5:])
+		if err != nil {
+			return nil
+		}
+		d, err := LoadDarc(rst, id)
+		if err != nil {
+			return nil
+		}
+		return d
+	}
+	return darc.EvalExpr(d.Rules.GetSignExpr(), getDarc, inst.GetIdentityStrings()...)
+}
@@ -0,0 +1,123 @@
+package auctions
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/calypso"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/darc/expression"
+)
+
+// custodyDarc returns the darc holding the asset of the auction. It has no
+// rules, so nobody can touch the asset while the auction holds it: only the
+// auction hands it over when it ends.
+func custodyDarc(auctInstID byzcoin.InstanceID) *darc.Darc {
+	return darc.NewDarc(darc.NewRules(), []byte("custody of the asset of auction "+hex.EncodeToString(auctInstID.Slice())))
+}
+
+// takeCustody moves the asset of a new auction under its custody darc. The
+// spawn instruction must be signed by the owners of the asset.
+func takeCustody(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, auction *AuctionData, auctInstID byzcoin.InstanceID) ([]byzcoin.StateChange, error) {
+	if auction.Mode == ModeReverse || len(auction.Lots) > 0 {
+		return nil, errors.New("only single good auctions can sell an asset")
+	}
+	value, _, contractID, darcID, err := rst.GetValues(auction.Asset.Slice())
+	if err != nil {
+		return nil, errors.New("unknown asset: " + err.Error())
+	}
+	if contractID == byzcoin.ContractDarcID || contractID == byzcoin.ContractConfigID {
+		return nil, errors.New("cannot sell a " + contractID + " instance")
+	}
+	err = auctioncore.VerifyOwner(rst, inst, auction.Asset)
+	if err != nil {
+		return nil, errors.New("spawn not signed by the owner of the asset: " + err.Error())
+	}
+
+	custody := custodyDarc(auctInstID)
+	custodyBuf, err := custody.ToProto()
+	if err != nil {
+		return nil, err
+	}
+	auction.AssetDarc = darcID
+	auction.Custody = custody.GetBaseID()
+	return []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, byzcoin.NewInstanceID(auction.Custody),
+			byzcoin.ContractDarcID, custodyBuf, auction.Custody),
+		byzcoin.NewStateChange(byzcoin.Update, auction.Asset, contractID, value, auction.Custody),
+	}, nil
+}
+
+// deliveryDarc returns the darc of a secret sold by the auction once it is
+// won: only the signers of the darc of the winner's account can spawn a
+// read of it, to get the key re-encrypted by the roster.
+func deliveryDarc(auctInstID byzcoin.InstanceID, winnerDarc darc.ID) (*darc.Darc, error) {
+	rules := darc.NewRules()
+	err := rules.AddRule(darc.Action("spawn:"+calypso.ContractReadID), expression.Expr(darc.NewIdentityDarc(winnerDarc).String()))
+	if err != nil {
+		return nil, err
+	}
+	return darc.NewDarc(rules, []byte("delivery of the secret of auction "+hex.EncodeToString(auctInstID.Slice()))), nil
+}
+
+// releaseAsset hands the asset of an ended auction over to the darc of the
+// winner's account, or back to its previous owner if there is no winner,
+// and removes the custody darc. A secret, a calypso write, is handled by
+// releaseSecret.
+func releaseAsset(rst byzcoin.ReadOnlyStateTrie, auction AuctionData, auctInstID byzcoin.InstanceID) ([]byzcoin.StateChange, error) {
+	value, _, contractID, _, err := rst.GetValues(auction.Asset.Slice())
+	if err != nil {
+		return nil, err
+	}
+	if contractID == calypso.ContractWriteID {
+		return releaseSecret(rst, auction, auctInstID, value)
+	}
+	owner := auction.AssetDarc
+	if auction.State == auctioncore.StateWClosed {
+		_, _, _, winnerDarc, err := rst.GetValues(auction.HighestBidder.Slice())
+		if err != nil {
+			return nil, err
+		}
+		owner = winnerDarc
+	}
+	return []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Update, auction.Asset, contractID, value, owner),
+		byzcoin.NewStateChange(byzcoin.Remove, byzcoin.NewInstanceID(auction.Custody),
+			byzcoin.ContractDarcID, nil, auction.Custody),
+	}, nil
+}
+
+// releaseSecret moves the calypso write sold by a won auction under its
+// delivery darc. Without a winner, the write stays under the custody darc,
+// which has no rules: nobody can read the secret, not even the seller.
+func releaseSecret(rst byzcoin.ReadOnlyStateTrie, auction AuctionData, auctInstID byzcoin.InstanceID, value []byte) ([]byzcoin.StateChange, error) {
+	if auction.State != auctioncore.StateWClosed {
+		return nil, nil
+	}
+	_, _, _, winnerDarc, err := rst.GetValues(auction.HighestBidder.Slice())
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := deliveryDarc(auctInstID, winnerDarc)
+	if err != nil {
+		return nil, err
+	}
+	deliveryBuf, err := delivery.ToProto()
+	if err != nil {
+		return nil, err
+	}
+	var sc []byzcoin.StateChange
+	// Anybody can spawn the same darc first, it has no rules to evolve it
+	_, _, _, _, err = rst.GetValues(delivery.GetBaseID())
+	if err != nil {
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Create, byzcoin.NewInstanceID(delivery.GetBaseID()),
+			byzcoin.ContractDarcID, deliveryBuf, delivery.GetBaseID()))
+	}
+	return append(sc,
+		byzcoin.NewStateChange(byzcoin.Update, auction.Asset, calypso.ContractWriteID, value, delivery.GetBaseID()),
+		byzcoin.NewStateChange(byzcoin.Remove, byzcoin.NewInstanceID(auction.Custody),
+			byzcoin.ContractDarcID, nil, auction.Custody),
+	), nil
+}
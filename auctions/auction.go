@@ -1,38 +1,41 @@
 package auctions
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"bytes"
 	"errors"
+
+	"github.com/dedis/student_19_auctions/auction_house"
+	"github.com/dedis/student_19_auctions/auctioncore"
 	"go.dedis.ch/cothority/v3/byzcoin"
-	"go.dedis.ch/cothority/v3/byzcoin/contracts"
 	"go.dedis.ch/cothority/v3/darc"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/protobuf"
-	"strconv"
 )
 
 // ContractAuctionID identifies an auction contract
 var ContractAuctionID = "auction"
 
-type ContractCoin struct {
-	byzcoin.BasicContract
-	byzcoin.Coin
-}
-
 type contractAuction struct {
 	byzcoin.BasicContract
 	AuctionData
-	s *Service
+	contracts auctioncore.Contracts
 }
 
 func (s *Service) contractAuctionFromBytes(in []byte) (byzcoin.Contract, error) {
+	return NewContract(s.byzService(), in)
+}
+
+// NewContract returns the auction contract of an instance holding in. The
+// coins it pays out are stored through the coin contract of contracts,
+// which is the ByzCoin service unless the auction is replayed offline.
+func NewContract(contracts auctioncore.Contracts, in []byte) (byzcoin.Contract, error) {
 	cv := &contractAuction{}
-	err := protobuf.Decode(in, &cv.AuctionData)
+	var err error
+	cv.AuctionData, err = DecodeAuction(in)
 	if err != nil {
 		return nil, err
 	}
-	cv.s = s
+	cv.contracts = contracts
 	return cv, nil
 }
 
@@ -59,7 +62,7 @@ func (c *contractAuction) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Inst
 	// auctionBuf store the value of the argument with name auction
 	auctionBuf := inst.Spawn.Args.Search("auction")
 	if auctionBuf == nil {
-		return nil, nil, errors.New("need an argument with name auction")
+		return nil, nil, auctioncore.ErrMissingAuction
 	}
 
 	//Verify that it's an auction
@@ -69,6 +72,55 @@ func (c *contractAuction) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Inst
 		//return nil, nil, errors.New("Error: not an auction")
 		return
 	}
+	if auction.Version > AuctionVersion {
+		return nil, nil, errors.New("unknown auction version")
+	}
+	auction.Version = AuctionVersion
+	auction.GoodDescription, auction.Category, err = auctioncore.CheckMetadata(auction.Metadata,
+		auction.GoodDescription, auction.Category)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	//The buyer of a reverse auction escrows the budget when spawning it,
+	//a candle auction records the block its bidding window starts at
+	switch auction.Mode {
+	case ModeForward:
+	case ModeReverse:
+		cout, err = escrowBudget(rst, auction, coins)
+		if err != nil {
+			return nil, nil, err
+		}
+	case ModeCandle:
+		err = startCandle(rst, &auction)
+		if err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, errors.New("unknown auction mode")
+	}
+	if auction.Bond > 0 || auction.CancelPenalty > 0 {
+		cout, err = collectBond(rst, auction, cout)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if auction.RetractWindow > 0 {
+		err = startRetractable(rst, &auction)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(auction.Lots) > 0 {
+		err = startLots(auction)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	err = auctioncore.CheckAllowList(rst, auction.AllowList)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// Create the auction instance in the global state thanks to
 	// a StateChange request with the data of the instance. The
@@ -76,15 +128,68 @@ func (c *contractAuction) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Inst
 	// to create multiple instanceIDs out of a given instruction in a pseudo-
 	// random way that will be the same for all nodes.
 	auctInstID := inst.DeriveID("")
-	sc = []byzcoin.StateChange{
-		byzcoin.NewStateChange(byzcoin.Create, auctInstID, ContractAuctionID, auctionBuf, darcID),
+
+	//List the auction in its auction house
+	if !auction.Registry.Equal(byzcoin.InstanceID{}) {
+		sc, auction.RegistryIndex, err = auction_house.Register(rst, inst, auction.Registry, auction_house.EntryData{
+			Auction:    auctInstID,
+			ContractID: ContractAuctionID,
+			Seller:     auction.SellerAccount,
+			Category:   auction.Category,
+			State:      auction.State,
+			EndIndex:   auction.EndIndex,
+		}, darcID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	//The auction holds the asset it sells until it ends
+	if !auction.Asset.Equal(byzcoin.InstanceID{}) {
+		var assetSC []byzcoin.StateChange
+		assetSC, err = takeCustody(rst, inst, &auction, auctInstID)
+		if err != nil {
+			return nil, nil, err
+		}
+		sc = append(sc, assetSC...)
 	}
+
+	auctionBuf, err = protobuf.Encode(&auction)
+	if err != nil {
+		return nil, nil, errors.New("encode auction buf sc")
+	}
+	sc = append(sc, byzcoin.NewStateChange(byzcoin.Create, auctInstID, ContractAuctionID, auctionBuf, darcID))
 	return
 }
 
 // Override of function VerifyInstruction because
 // The auction instance need to allow any user in the system to invoke “bid” on it. The default behaviour of the VerifyInstruction (see cothority/byzcoin/conrtacts.go line 58) is to try to find some signers in the instruction that satisfy the DARC that controls access to the instance. We need to override this behaviour to accept all bidders.
+// Spawning an auction selling an asset, bids on an auction with an
+// allow-list, offers to a reverse auction and retractions must be signed,
+// the signers are checked by Spawn and Invoke. Closing, dropping and
+// migrating the auction move coins or assets on behalf of the seller, they
+// are reserved to the darc of the auction, as is releasing an asset left in
+// custody.
 func (c *contractAuction) VerifyInstruction(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, ctxHash []byte) error {
+	if inst.GetType() == byzcoin.SpawnType {
+		auction := AuctionData{}
+		if protobuf.Decode(inst.Spawn.Args.Search("auction"), &auction) == nil &&
+			!auction.Asset.Equal(byzcoin.InstanceID{}) {
+			return auctioncore.VerifySignatures(inst, ctxHash)
+		}
+		return nil
+	}
+	if inst.GetType() != byzcoin.InvokeType {
+		return nil
+	}
+	switch inst.Invoke.Command {
+	case "close", "drop", "forceclose", "migrate":
+		return c.BasicContract.VerifyInstruction(rst, inst, ctxHash)
+	}
+	if (len(c.AllowList) != 0 && inst.Invoke.Command == "bid") || inst.Invoke.Command == "retract" ||
+		(c.Mode == ModeReverse && inst.Invoke.Command == "bid") {
+		return auctioncore.VerifySignatures(inst, ctxHash)
+	}
 	return nil
 }
 
@@ -93,7 +198,46 @@ func (c *contractAuction) VerifyInstruction(rst byzcoin.ReadOnlyStateTrie, inst
 //  - close: ends an auction
 // You can only delete a contractAuction instance after the auction is closed.
 
+// Invoke runs the command and, when the auction is listed in an auction
+// house, makes its entry follow the changes of state. The asset of an
+// auction is released when the auction ends. If that fails, the auction
+// does not end.
 func (c *contractAuction) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, cin []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	sc, cout, err = c.invoke(rst, inst, cin)
+	if err != nil || (c.Registry.Equal(byzcoin.InstanceID{}) && c.Asset.Equal(byzcoin.InstanceID{})) {
+		return
+	}
+	for _, s := range sc {
+		if !bytes.Equal(s.InstanceID, inst.InstanceID.Slice()) {
+			continue
+		}
+		auction := AuctionData{}
+		err = protobuf.Decode(s.Value, &auction)
+		if err != nil {
+			return nil, nil, err
+		}
+		if auction.State != c.State && !c.Registry.Equal(byzcoin.InstanceID{}) {
+			var entrySC []byzcoin.StateChange
+			entrySC, err = auction_house.UpdateState(rst, c.Registry, c.RegistryIndex, inst.InstanceID, auction.State)
+			if err != nil {
+				return nil, nil, err
+			}
+			sc = append(sc, entrySC...)
+		}
+		if auction.State != c.State && !c.Asset.Equal(byzcoin.InstanceID{}) {
+			var assetSC []byzcoin.StateChange
+			assetSC, err = releaseAsset(rst, auction, inst.InstanceID)
+			if err != nil {
+				return nil, nil, err
+			}
+			sc = append(sc, assetSC...)
+		}
+		return
+	}
+	return
+}
+
+func (c *contractAuction) invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, cin []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
 	var darcID darc.ID
 	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
 	if err != nil {
@@ -103,22 +247,57 @@ func (c *contractAuction) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Ins
 	if inst.Invoke.Command == "bid" {
 		bidBuf := inst.Invoke.Args.Search("bid")
 		if bidBuf == nil {
-			err = errors.New("need an argument with name bid")
+			err = auctioncore.ErrMissingBid
 			return
 		}
 	}
 
 	var auctionBuf []byte
 	auctionBuf, _, _, _, err = rst.GetValues(inst.InstanceID.Slice())
-	auction := AuctionData{}
-	err = protobuf.Decode(auctionBuf, &auction)
+	if err != nil {
+		return
+	}
+	var auction AuctionData
+	auction, err = DecodeAuction(auctionBuf)
 	if err != nil {
 		return
 	}
 
-	if auction.State == "CLOSED" || auction.State == "DROPPED" {
-		err = errors.New("auction is closed or dropped, cannot bid")
-		return nil, nil, err
+	//Rewrites the auction in the newest layout, in any state
+	if inst.Invoke.Command == "migrate" {
+		auctionBuf, err = protobuf.Encode(&auction)
+		if err != nil {
+			return nil, nil, errors.New("encode auction buf sc: migrate")
+		}
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+			ContractAuctionID, auctionBuf, darcID))
+		return
+	}
+
+	//An auction closed with a winner is settled: dropping it or closing it
+	//again would pay its escrow out a second time, such as the budget of a
+	//reverse auction refunded to the buyer after paying the supplier.
+	if auction.State == auctioncore.StateClosed || auction.State == auctioncore.StateWClosed || auction.State == auctioncore.StateDropped {
+		return nil, nil, auctioncore.ErrAuctionClosed
+	}
+	if inst.Invoke.Command == "bid" {
+		err = auctioncore.VerifyAllowList(rst, inst, auction.AllowList)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(auction.Lots) > 0 {
+		return c.invokeLots(rst, inst, cin, auction, darcID)
+	}
+	if auction.RetractWindow > 0 {
+		return c.invokeRetractable(rst, inst, cin, auction, darcID)
+	}
+	switch auction.Mode {
+	case ModeReverse:
+		return c.invokeReverse(rst, inst, cin, auction, darcID)
+	case ModeCandle:
+		return c.invokeCandle(rst, inst, cin, auction, darcID)
 	}
 
 	//// Invoke provides two methods "bid" or "close"
@@ -129,7 +308,7 @@ func (c *contractAuction) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Ins
 		//bidBuf store the value of the argument with name bid
 		bidBuf := inst.Invoke.Args.Search("bid")
 		if bidBuf == nil {
-			err = errors.New("need an argument with name bid")
+			err = auctioncore.ErrMissingBid
 			return
 		}
 
@@ -137,37 +316,24 @@ func (c *contractAuction) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Ins
 		bid := BidData{}
 		err = protobuf.Decode(bidBuf, &bid)
 		if err != nil {
-			err = errors.New("not a bid")
+			err = auctioncore.ErrNotBid
 			return
 		}
 
 		//If seller bids -> forbidden
 		if bid.BidderAccount == auction.SellerAccount {
-			err = errors.New("seller can not bid")
+			err = auctioncore.ErrSellerBid
 			return
 		}
 
-		//Check the coin name
-		val, _, _, _, _ := rst.GetValues(bid.BidderAccount.Slice())
-		coinS := ContractCoin{} //need this struct
-		//var coinS struct{}
-		err = protobuf.Decode(val, &coinS)
+		//The escrowed coins are the bid
+		cout, err = escrowBid(rst, &bid, cin)
 		if err != nil {
 			return
 		}
-		//log.LLvl4("Coin name:", coinS.Name)
-
-		for i := 0; i < len(cin); i++ {
-			//log.LLvl4(cin[i].Name)
-			if cin[i].Name == coinS.Name {
-				bid.Bid = bid.Bid + cin[i].Value
-			}
-		}
-
-		//log.LLvl4(bid.Bid)
 
 		if bid.Bid <= 0 { //can not bid 0 or less
-			err = errors.New("can not bid 0 or less")
+			err = auctioncore.ErrZeroBid
 			return
 
 		} else {
@@ -198,7 +364,7 @@ func (c *contractAuction) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Ins
 					ContractAuctionID, auctionBuf, darcID))
 
 			} else {
-				err = errors.New("cannot bid less than current highest bid")
+				err = auctioncore.ErrBidTooLow
 				return
 			}
 		}
@@ -209,7 +375,7 @@ func (c *contractAuction) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Ins
 
 			closeBuf := inst.Invoke.Args.Search("close")
 			if closeBuf == nil {
-				err = errors.New("need an argument with name close")
+				err = auctioncore.ErrMissingClose
 				return
 			}
 
@@ -217,29 +383,21 @@ func (c *contractAuction) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Ins
 			closedata := CloseData{}
 			err = protobuf.Decode(closeBuf, &closedata)
 			if err != nil {
-				err = errors.New("not a close struct")
+				err = auctioncore.ErrNotClose
 				return
 			}
-			salt := closedata.Salt
 			reservePrice := closedata.ReservePrice
 
-			strReservePrice := strconv.Itoa(int(reservePrice))
-
-			h := sha256.New()
-			h.Write([]byte(salt + strReservePrice))
-			hashed := h.Sum(nil)
-			hash := hex.EncodeToString(hashed)
-
-			if hash == auction.ReservePrice {
+			if auctioncore.VerifyReserve(auction.ReservePrice, closedata) {
 
 				if auction.HighestBid > 0 {
 
 					if auction.HighestBid > reservePrice {
-						sc, cout, err = c.storeCoin(rst, auction.HighestBid, auction.SellerAccount)
+						sc, cout, err = c.storeCoin(rst, auction.HighestBid+auction.Bond, auction.SellerAccount)
 						if err != nil {
 							return
 						}
-						auction.State = "WCLOSED"
+						auction.State = auctioncore.StateWClosed
 
 					} else {
 						//sc, cout, err = c.storeCoin(rst, auction.HighestBid, auction.HighestBidder)
@@ -262,15 +420,15 @@ func (c *contractAuction) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Ins
 					ContractAuctionID, auctionBuf, darcID))
 
 			} else {
-				return nil, nil, errors.New("Verification of reserve price failed")
+				return nil, nil, auctioncore.ErrReserveVerify
 			}
 		} else {
 			if auction.HighestBid > 0 {
-				sc, cout, err = c.storeCoin(rst, auction.HighestBid, auction.SellerAccount)
+				sc, cout, err = c.storeCoin(rst, auction.HighestBid+auction.Bond, auction.SellerAccount)
 				if err != nil {
 					return
 				}
-				auction.State = "WCLOSED"
+				auction.State = auctioncore.StateWClosed
 
 			} else {
 				log.LLvl4("Asked closing with no bids...")
@@ -287,12 +445,16 @@ func (c *contractAuction) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Ins
 
 	case "drop":
 
-		auction.State = "DROPPED"
-		if auction.HighestBid > 0 {
-			sc, cout, err = c.storeCoin(rst, auction.HighestBid, auction.HighestBidder)
-			if err != nil {
-				return
-			}
+		auction.State = auctioncore.StateDropped
+		payouts := auctioncore.Payouts{}
+		payouts.Add(auction.HighestBidder, auction.HighestBid)
+		err = auction.cancel(rst, inst, &payouts)
+		if err != nil {
+			return nil, nil, err
+		}
+		sc, err = payouts.StoreCoins(c.contracts, rst)
+		if err != nil {
+			return
 		}
 
 		auctionBuf, err = protobuf.Encode(&auction)
@@ -306,12 +468,16 @@ func (c *contractAuction) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Ins
 	case "forceclose":
 
 		log.LLvl4("Force auction close...")
-		auction.State = "CLOSED"
-		if auction.HighestBid > 0 {
-			sc, cout, err = c.storeCoin(rst, auction.HighestBid, auction.HighestBidder)
-			if err != nil {
-				return
-			}
+		auction.State = auctioncore.StateClosed
+		payouts := auctioncore.Payouts{}
+		payouts.Add(auction.HighestBidder, auction.HighestBid)
+		err = auction.cancel(rst, inst, &payouts)
+		if err != nil {
+			return nil, nil, err
+		}
+		sc, err = payouts.StoreCoins(c.contracts, rst)
+		if err != nil {
+			return
 		}
 
 		auctionBuf, err = protobuf.Encode(&auction)
@@ -329,43 +495,28 @@ func (c *contractAuction) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Ins
 	return
 }
 
-func (c *contractAuction) storeCoin(rst byzcoin.ReadOnlyStateTrie, amount uint64, creditAccount byzcoin.InstanceID) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
-	instruct := byzcoin.Instruction{
-		InstanceID: creditAccount,
-		Invoke: &byzcoin.Invoke{
-			ContractID: contracts.ContractCoinID,
-			Command:    "store",
-			Args:       nil,
-		},
-	}
-
-	b := c.s.Service(byzcoin.ServiceName).(*byzcoin.Service)
-	cFact, found := b.GetContractConstructor(contracts.ContractCoinID)
-	if !found {
-		err = errors.New("Not found")
-		return
+// escrowBid sets the bid to the coins of the bidder's type taken from cin,
+// which the auction keeps in escrow, and returns the other coins. A bid
+// stating an amount of its own is refused, as it would not be backed.
+func escrowBid(rst byzcoin.ReadOnlyStateTrie, bid *BidData, cin []byzcoin.Coin) ([]byzcoin.Coin, error) {
+	if bid.Bid != 0 {
+		return nil, auctioncore.ErrUnbackedBid
 	}
-
-	in, _, _, _, err := rst.GetValues(creditAccount.Slice())
-	if err != nil {
-		err = errors.New("cfactory getValues failed")
-		return
-	}
-
-	cCoin, err := cFact(in)
-	if err != nil {
-		err = errors.New("coin factory failed")
-		return
-	}
-
-	coinS := ContractCoin{} //need this struct
-	err = protobuf.Decode(in, &coinS)
+	escrowed, cout, err := auctioncore.CollectCoins(rst, bid.BidderAccount, cin)
 	if err != nil {
-		return
+		return nil, err
 	}
+	bid.Bid = escrowed
+	return cout, nil
+}
 
-	c1 := byzcoin.Coin{Name: coinS.Name, Value: amount}
-	//log.LLvl4("c1 name", c1.Name)
+// storeCoin credits the account with amount coins held in escrow by the
+// auction.
+func (c *contractAuction) storeCoin(rst byzcoin.ReadOnlyStateTrie, amount uint64, creditAccount byzcoin.InstanceID) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	return auctioncore.StoreCoin(c.contracts, rst, amount, creditAccount)
+}
 
-	return cCoin.Invoke(rst, instruct, []byzcoin.Coin{c1})
+// Item returns the description of the good sold by the auction.
+func (a *AuctionData) Item() auctioncore.ItemMetadata {
+	return auctioncore.Describe(a.Metadata, a.GoodDescription)
 }
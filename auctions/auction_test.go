@@ -3,9 +3,15 @@ package auctions
 import (
 	"testing"
 
+	"github.com/dedis/student_19_auctions/auctioncore"
 	"github.com/stretchr/testify/require"
 
+	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/calypso"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
 )
 
 func TestContractAuction_Spawn(t *testing.T) {
@@ -142,3 +148,383 @@ func TestContractAuction_Invoke3(t *testing.T) {
 	printAuction(auctS)
 
 }
+
+func TestContractAuction_Reverse(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	buyAccInstID := bct.createBidderAccount(t, 200)
+	supAccInstID := bct.createBidderAccount(t, 0)
+	supAccInstID2 := bct.createBidderAccount(t, 0)
+
+	//The budget must be escrowed in full
+	_, err := bct.createReverseAuction(t, buyAccInstID, "bananas", 300, 80)
+	require.Error(t, err)
+
+	auctInstID, err := bct.createReverseAuction(t, buyAccInstID, "bananas", 100, 80)
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), bct.coinBalance(t, buyAccInstID))
+
+	//Only the owner of a supplier account can offer for it
+	outsider := darc.NewSignerEd25519(nil, nil)
+	outsiderCt := uint64(1)
+	bidBuf, err := protobuf.Encode(&BidData{BidderAccount: supAccInstID, Bid: 1})
+	require.NoError(t, err)
+	_, err = bct.sendAs(t, outsider, &outsiderCt, byzcoin.Instruction{
+		InstanceID: auctInstID,
+		Invoke: &byzcoin.Invoke{ContractID: ContractAuctionID, Command: "bid",
+			Args: byzcoin.Arguments{{Name: "bid", Value: bidBuf}}},
+	})
+	require.Error(t, err)
+
+	//Offers must go down and stay within the budget
+	require.Error(t, bct.addOffer(t, auctInstID, supAccInstID, 120))
+	require.NoError(t, bct.addOffer(t, auctInstID, supAccInstID, 90))
+	require.Error(t, bct.addOffer(t, auctInstID, supAccInstID2, 90))
+	require.NoError(t, bct.addOffer(t, auctInstID, supAccInstID2, 70))
+	require.Error(t, bct.addOffer(t, auctInstID, buyAccInstID, 60))
+
+	//The ceiling must be revealed correctly
+	require.Error(t, bct.closeAuctionWithReserve(t, auctInstID, 75))
+	require.NoError(t, bct.closeAuctionWithReserve(t, auctInstID, 80))
+
+	auctS := bct.proofAndDecodeAuction(t, auctInstID)
+	require.Equal(t, auctioncore.StateWClosed, auctS.State)
+	require.Equal(t, supAccInstID2, auctS.HighestBidder)
+	require.Equal(t, uint64(70), bct.coinBalance(t, supAccInstID2))
+	require.Equal(t, uint64(0), bct.coinBalance(t, supAccInstID))
+	require.Equal(t, uint64(130), bct.coinBalance(t, buyAccInstID))
+
+	require.Error(t, bct.addOffer(t, auctInstID, supAccInstID, 60))
+
+	//A settled auction cannot pay its budget out again
+	require.Error(t, bct.invokeAuction(t, auctInstID, "drop", nil))
+	require.Error(t, bct.closeAuctionWithReserve(t, auctInstID, 80))
+	require.Equal(t, uint64(70), bct.coinBalance(t, supAccInstID2))
+	require.Equal(t, uint64(130), bct.coinBalance(t, buyAccInstID))
+}
+
+func TestContractAuction_ReverseDrop(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	buyAccInstID := bct.createBidderAccount(t, 200)
+	supAccInstID := bct.createBidderAccount(t, 0)
+
+	auctInstID, err := bct.createReverseAuction(t, buyAccInstID, "bananas", 100, 50)
+	require.NoError(t, err)
+	require.NoError(t, bct.addOffer(t, auctInstID, supAccInstID, 60))
+
+	//No offer under the ceiling: the budget stays in escrow until dropped
+	require.NoError(t, bct.closeAuctionWithReserve(t, auctInstID, 50))
+	require.Equal(t, uint64(100), bct.coinBalance(t, buyAccInstID))
+
+	require.NoError(t, bct.invokeAuction(t, auctInstID, "drop", nil))
+	auctS := bct.proofAndDecodeAuction(t, auctInstID)
+	require.Equal(t, auctioncore.StateDropped, auctS.State)
+	require.Equal(t, uint64(200), bct.coinBalance(t, buyAccInstID))
+	require.Equal(t, uint64(0), bct.coinBalance(t, supAccInstID))
+}
+
+func TestContractAuction_AllowList(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	sellAccInstID := bct.createSellerAccount(t)
+	bidAccInstID := bct.createBidderAccount(t, 100)
+
+	vetted := darc.NewSignerEd25519(nil, nil)
+	allowList := bct.createAllowList(t, vetted.Identity())
+	auctInstID := bct.createAuctionWithAllowList(t, sellAccInstID, allowList.GetBaseID())
+
+	//The signer of the test is not vetted yet
+	_, err := bct.addBid(t, auctInstID, bidAccInstID, 20)
+	require.Error(t, err)
+
+	//The seller vets it without touching the auction
+	bct.evolveAllowList(t, allowList, vetted.Identity(), bct.signer.Identity())
+	bid, err := bct.addBid(t, auctInstID, bidAccInstID, 20)
+	require.NoError(t, err)
+	bid.Bid = 20
+	bct.verifAddBid(t, auctInstID, AuctionData{}, bid)
+	require.Equal(t, uint64(80), bct.coinBalance(t, bidAccInstID))
+}
+
+func TestContractAuction_Cancel(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	sellAccInstID := bct.createBidderAccount(t, 100)
+	bidAccInstID := bct.createBidderAccount(t, 100)
+
+	_, err := bct.createAuctionWithBond(t, sellAccInstID, 30, 40)
+	require.Error(t, err)
+
+	//Free before the first bid
+	auctInstID, err := bct.createAuctionWithBond(t, sellAccInstID, 30, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(70), bct.coinBalance(t, sellAccInstID))
+	require.NoError(t, bct.invokeAuction(t, auctInstID, "drop", nil))
+	require.Equal(t, uint64(100), bct.coinBalance(t, sellAccInstID))
+
+	//The leading bidder gets the penalty
+	auctInstID, err = bct.createAuctionWithBond(t, sellAccInstID, 30, 10)
+	require.NoError(t, err)
+	_, err = bct.addBid(t, auctInstID, bidAccInstID, 20)
+	require.NoError(t, err)
+
+	//Only the darc of the auction can end it
+	outsider := darc.NewSignerEd25519(nil, nil)
+	outsiderCt := uint64(1)
+	for _, command := range []string{"drop", "forceclose", "close"} {
+		_, err = bct.sendAs(t, outsider, &outsiderCt, byzcoin.Instruction{
+			InstanceID: auctInstID,
+			Invoke:     &byzcoin.Invoke{ContractID: ContractAuctionID, Command: command},
+		})
+		require.Error(t, err)
+	}
+	require.Equal(t, uint64(70), bct.coinBalance(t, sellAccInstID))
+
+	cancelBuf, err := protobuf.Encode(&CancelData{Reason: "sold elsewhere"})
+	require.NoError(t, err)
+	require.NoError(t, bct.invokeAuction(t, auctInstID, "drop", byzcoin.Arguments{{Name: "cancel", Value: cancelBuf}}))
+
+	auctS := bct.proofAndDecodeAuction(t, auctInstID)
+	require.Equal(t, auctioncore.StateDropped, auctS.State)
+	require.Equal(t, CancellationData{Reason: "sold elsewhere", Payouts: []auctioncore.PayoutData{
+		{Account: bidAccInstID, Amount: 30}, {Account: sellAccInstID, Amount: 20}}}, auctS.Cancellation)
+	require.Equal(t, uint64(90), bct.coinBalance(t, sellAccInstID))
+	require.Equal(t, uint64(110), bct.coinBalance(t, bidAccInstID))
+
+	//Force closing does not escape the penalty
+	auctInstID, err = bct.createAuctionWithBond(t, sellAccInstID, 30, 10)
+	require.NoError(t, err)
+	_, err = bct.addBid(t, auctInstID, bidAccInstID, 20)
+	require.NoError(t, err)
+	require.NoError(t, bct.invokeAuction(t, auctInstID, "forceclose", nil))
+	auctS = bct.proofAndDecodeAuction(t, auctInstID)
+	require.Equal(t, auctioncore.StateClosed, auctS.State)
+	require.Equal(t, CancellationData{Payouts: []auctioncore.PayoutData{
+		{Account: bidAccInstID, Amount: 30}, {Account: sellAccInstID, Amount: 20}}}, auctS.Cancellation)
+	require.Equal(t, uint64(80), bct.coinBalance(t, sellAccInstID))
+	require.Equal(t, uint64(120), bct.coinBalance(t, bidAccInstID))
+
+	//Closing gives the bond back
+	auctInstID, err = bct.createAuctionWithBond(t, sellAccInstID, 30, 10)
+	require.NoError(t, err)
+	_, err = bct.addBid(t, auctInstID, bidAccInstID, 20)
+	require.NoError(t, err)
+	require.NoError(t, bct.closeAuction(t, auctInstID))
+	require.Equal(t, uint64(100), bct.coinBalance(t, sellAccInstID))
+	require.Equal(t, uint64(100), bct.coinBalance(t, bidAccInstID))
+}
+
+func TestContractAuction_Lots(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	sellAccInstID := bct.createSellerAccount(t)
+	bidAccInstID := bct.createBidderAccount(t, 100)
+	bidAccInstID2 := bct.createBidderAccount(t, 100)
+
+	auctInstID := bct.createLotsAuction(t, sellAccInstID, 0, 50, 0)
+
+	require.NoError(t, bct.addLotBid(t, auctInstID, bidAccInstID, 0, 10))
+	require.NoError(t, bct.addLotBid(t, auctInstID, bidAccInstID2, 0, 15))
+	require.NoError(t, bct.addLotBid(t, auctInstID, bidAccInstID, 1, 30))
+	require.Error(t, bct.addLotBid(t, auctInstID, bidAccInstID2, 1, 30))
+	require.Error(t, bct.addLotBid(t, auctInstID, bidAccInstID2, 3, 30))
+	require.Equal(t, uint64(70), bct.coinBalance(t, bidAccInstID))
+	require.Equal(t, uint64(85), bct.coinBalance(t, bidAccInstID2))
+
+	require.Error(t, bct.closeLots(t, auctInstID, 0, 49, 0))
+	require.NoError(t, bct.closeLots(t, auctInstID, 0, 50, 0))
+
+	auctS := bct.proofAndDecodeAuction(t, auctInstID)
+	require.Equal(t, auctioncore.StateWClosed, auctS.State)
+	require.Equal(t, auctioncore.StateWClosed, auctS.Lots[0].State)
+	require.Equal(t, bidAccInstID2, auctS.Lots[0].HighestBidder)
+	require.Equal(t, auctioncore.StateClosed, auctS.Lots[1].State)
+	require.Equal(t, auctioncore.StateClosed, auctS.Lots[2].State)
+	require.Equal(t, uint64(15), bct.coinBalance(t, sellAccInstID))
+	require.Equal(t, uint64(100), bct.coinBalance(t, bidAccInstID))
+	require.Equal(t, uint64(85), bct.coinBalance(t, bidAccInstID2))
+}
+
+func TestAuctionData_Item(t *testing.T) {
+	// Auctions encoded before the metadata keep decoding
+	type legacyAuctionData struct {
+		GoodDescription string
+		SellerAccount   byzcoin.InstanceID
+		ReservePrice    string `protobuf:"opt"`
+		HighestBid      uint64
+		HighestBidder   byzcoin.InstanceID
+		State           string
+		WinProof        string
+	}
+	buf, err := protobuf.Encode(&legacyAuctionData{GoodDescription: "bananas", State: auctioncore.StateOpen})
+	require.NoError(t, err)
+	auction := AuctionData{}
+	require.NoError(t, protobuf.Decode(buf, &auction))
+	require.Equal(t, "bananas", auction.Item().Title)
+	require.Equal(t, uint64(1), auction.Item().Quantity)
+
+	auction.Metadata = auctioncore.ItemMetadata{Version: auctioncore.MetadataVersion, Title: "yellow bananas", Quantity: 12}
+	buf, err = protobuf.Encode(&auction)
+	require.NoError(t, err)
+	decoded := AuctionData{}
+	require.NoError(t, protobuf.Decode(buf, &decoded))
+	require.Equal(t, auction.Metadata, decoded.Item())
+}
+
+func TestContractAuction_Asset(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	sellAccInstID := bct.createSellerAccount(t)
+	owner := darc.NewSignerEd25519(nil, nil)
+	ownerCt := uint64(1)
+	bidAccInstID, bidDarcID := bct.createOwnedAccount(t, owner, &ownerCt, 100)
+
+	//The auction holds the asset
+	asset := bct.createAsset(t, "painting")
+	auctInstID, err := bct.createAuctionWithAsset(t, sellAccInstID, asset)
+	require.NoError(t, err)
+	auctS := bct.proofAndDecodeAuction(t, auctInstID)
+	require.Equal(t, auctS.Custody, bct.instanceDarc(t, asset))
+	require.Error(t, bct.updateAsset(t, bct.signer, &bct.ct, asset, "fake"))
+
+	//Paying and delivering happen in the same instruction
+	require.NoError(t, bct.bidAs(t, owner, &ownerCt, auctInstID, bidAccInstID, 30))
+	require.NoError(t, bct.closeAuction(t, auctInstID))
+	require.Equal(t, uint64(30), bct.coinBalance(t, sellAccInstID))
+	require.Equal(t, bidDarcID, bct.instanceDarc(t, asset))
+	require.NoError(t, bct.updateAsset(t, owner, &ownerCt, asset, "painting, framed"))
+
+	//The seller does not own it anymore
+	_, err = bct.createAuctionWithAsset(t, sellAccInstID, asset)
+	require.Error(t, err)
+
+	//A dropped auction gives the asset back
+	asset = bct.createAsset(t, "vase")
+	auctInstID, err = bct.createAuctionWithAsset(t, sellAccInstID, asset)
+	require.NoError(t, err)
+	require.NoError(t, bct.invokeAuction(t, auctInstID, "drop", nil))
+	require.Equal(t, bct.gDarc.GetBaseID(), bct.instanceDarc(t, asset))
+	require.NoError(t, bct.updateAsset(t, bct.signer, &bct.ct, asset, "vase, restored"))
+
+	//A winner whose account is gone cannot receive the asset, so the
+	//auction does not close and the seller is not paid
+	leaver := darc.NewSignerEd25519(nil, nil)
+	leaverCt := uint64(1)
+	leaveAccInstID, _ := bct.createOwnedAccount(t, leaver, &leaverCt, 10)
+	asset = bct.createAsset(t, "lamp")
+	auctInstID, err = bct.createAuctionWithAsset(t, sellAccInstID, asset)
+	require.NoError(t, err)
+	require.NoError(t, bct.bidAs(t, leaver, &leaverCt, auctInstID, leaveAccInstID, 10))
+	_, err = bct.sendAs(t, leaver, &leaverCt, byzcoin.Instruction{
+		InstanceID: leaveAccInstID,
+		Delete:     &byzcoin.Delete{ContractID: contracts.ContractCoinID},
+	})
+	require.NoError(t, err)
+	require.Error(t, bct.closeAuction(t, auctInstID))
+	require.Equal(t, uint64(30), bct.coinBalance(t, sellAccInstID))
+	auctS = bct.proofAndDecodeAuction(t, auctInstID)
+	require.Equal(t, auctioncore.StateOpen, auctS.State)
+	require.Equal(t, auctS.Custody, bct.instanceDarc(t, asset))
+}
+
+func TestContractAuction_UnbackedBid(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	sellAccInstID := bct.createSellerAccount(t)
+	bidAccInstID := bct.createBidderAccount(t, 100)
+	auctInstID, _ := bct.createAuction(t, sellAccInstID, "bananas")
+
+	//Escrowing one coin cannot bid 50
+	bidBuf, err := protobuf.Encode(&BidData{BidderAccount: bidAccInstID, Bid: 50})
+	require.NoError(t, err)
+	_, err = bct.sendAs(t, bct.signer, &bct.ct, auctioncore.FetchCoins(bidAccInstID, 1), byzcoin.Instruction{
+		InstanceID: auctInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractAuctionID,
+			Command:    "bid",
+			Args:       byzcoin.Arguments{{Name: "bid", Value: bidBuf}},
+		},
+	})
+	require.Error(t, err)
+	require.Equal(t, uint64(100), bct.coinBalance(t, bidAccInstID))
+	require.Equal(t, uint64(0), bct.proofAndDecodeAuction(t, auctInstID).HighestBid)
+}
+
+func TestContractAuction_Secret(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	sellAccInstID := bct.createSellerAccount(t)
+	lts := bct.createLTS(t)
+	winner, loser := darc.NewSignerEd25519(nil, nil), darc.NewSignerEd25519(nil, nil)
+	winnerCt, loserCt := uint64(1), uint64(1)
+	winAccInstID, winDarcID := bct.createOwnedAccount(t, winner, &winnerCt, 100)
+	loseAccInstID, _ := bct.createOwnedAccount(t, loser, &loserCt, 100)
+
+	// The clients read the counters from the ledger, bct.ct is stale from
+	// here on.
+	seller := NewClient(bct.cl, bct.signer)
+	winnerCl, loserCl := NewClient(bct.cl, winner), NewClient(bct.cl, loser)
+	secretAuction := func(key []byte) (byzcoin.InstanceID, byzcoin.InstanceID) {
+		write := calypso.NewWrite(cothority.Suite, lts.InstanceID, bct.gDarc.GetBaseID(), lts.X, key)
+		auctInstID, writeInstID, err := seller.CreateSecretAuction(bct.gDarc.GetBaseID(), AuctionData{
+			GoodDescription: "license key",
+			SellerAccount:   sellAccInstID,
+			State:           auctioncore.StateOpen,
+			ReservePrice:    auctioncore.CreateHash("testsalt", 0),
+		}, write)
+		require.NoError(t, err)
+		return auctInstID, writeInstID
+	}
+
+	//Nobody reads the secret while the auction holds it, not even the seller
+	key := []byte("ABCD-1234")
+	auctInstID, writeInstID := secretAuction(key)
+	_, err := seller.ReadSecret(writeInstID)
+	require.Error(t, err)
+	require.NoError(t, loserCl.Bid(auctInstID, BidData{BidderAccount: loseAccInstID}, 30))
+	require.NoError(t, winnerCl.Bid(auctInstID, BidData{BidderAccount: winAccInstID}, 40))
+	_, err = winnerCl.ReadSecret(writeInstID)
+	require.Error(t, err)
+
+	//Spawning the delivery darc first does not keep the key from the winner
+	delivery, err := deliveryDarc(auctInstID, winDarcID)
+	require.NoError(t, err)
+	deliveryBuf, err := delivery.ToProto()
+	require.NoError(t, err)
+	_, err = seller.Send(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(bct.gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: byzcoin.ContractDarcID,
+			Args:       byzcoin.Arguments{{Name: "darc", Value: deliveryBuf}},
+		},
+	})
+	require.NoError(t, err)
+
+	//Once closed, only the winner gets the key
+	require.NoError(t, seller.Close(auctInstID, CloseData{Salt: "testsalt", ReservePrice: 0}))
+	_, err = loserCl.ReadSecret(writeInstID)
+	require.Error(t, err)
+	_, err = seller.ReadSecret(writeInstID)
+	require.Error(t, err)
+	got, err := winnerCl.ReadSecret(writeInstID)
+	require.NoError(t, err)
+	require.Equal(t, key, got)
+
+	//A dropped auction keeps its secret from everybody
+	auctInstID, writeInstID = secretAuction([]byte("EFGH-5678"))
+	require.NoError(t, winnerCl.Bid(auctInstID, BidData{BidderAccount: winAccInstID}, 20))
+	require.NoError(t, seller.Drop(auctInstID, ""))
+	_, err = winnerCl.ReadSecret(writeInstID)
+	require.Error(t, err)
+	_, err = seller.ReadSecret(writeInstID)
+	require.Error(t, err)
+}
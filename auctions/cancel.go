@@ -0,0 +1,74 @@
+package auctions
+
+import (
+	"errors"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/protobuf"
+)
+
+// collectBond checks the cancellation policy of a new auction and takes the
+// listing bond out of the coins given to the spawn instruction, fetched from
+// the seller's account.
+func collectBond(rst byzcoin.ReadOnlyStateTrie, auction AuctionData, cin []byzcoin.Coin) (cout []byzcoin.Coin, err error) {
+	if auction.Mode == ModeReverse {
+		return nil, errors.New("the buyer of a reverse auction escrows a budget, not a bond")
+	}
+	if auction.CancelPenalty > auction.Bond {
+		return nil, errors.New("the cancellation penalty must be covered by the bond")
+	}
+	var escrowed uint64
+	escrowed, cout, err = auctioncore.CollectCoins(rst, auction.SellerAccount, cin)
+	if err != nil {
+		return nil, err
+	}
+	if escrowed != auction.Bond {
+		return nil, auctioncore.ErrEscrowMismatch
+	}
+	return cout, nil
+}
+
+// cancel applies the cancellation policy when the seller drops or force
+// closes the auction.
+// Dropping is free before the first bid, after it CancelPenalty is taken
+// from the bond and paid to the leading bidder. No auction can be dropped
+// past its EndIndex, once its bids are final. The reason given in the "cancel"
+// argument and all the payouts, including the refunds already added by the
+// caller, are recorded in the auction.
+func (a *AuctionData) cancel(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, payouts *auctioncore.Payouts) error {
+	cancel := CancelData{}
+	if cancelBuf := inst.Invoke.Args.Search("cancel"); cancelBuf != nil {
+		if err := protobuf.Decode(cancelBuf, &cancel); err != nil {
+			return errors.New("not a cancel struct")
+		}
+	}
+
+	if a.EndIndex != 0 {
+		index, err := auctioncore.BlockIndex(rst)
+		if err != nil {
+			return err
+		}
+		if index > a.EndIndex {
+			return errors.New("the auction is past its end and cannot be cancelled")
+		}
+	}
+
+	if a.Bond > 0 {
+		var penalty uint64
+		if a.HighestBid > 0 {
+			penalty = a.CancelPenalty
+			payouts.Add(a.HighestBidder, penalty)
+		}
+		payouts.Add(a.SellerAccount, a.Bond-penalty)
+	}
+
+	a.Cancellation = CancellationData{Reason: cancel.Reason, Payouts: payouts.List()}
+	return nil
+}
+
+// releaseBond gives the bond back to the seller once the auction is over
+// without being cancelled.
+func (a *AuctionData) releaseBond(payouts *auctioncore.Payouts) {
+	payouts.Add(a.SellerAccount, a.Bond)
+}
@@ -0,0 +1,44 @@
+package auctions
+
+import (
+	"testing"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+)
+
+func TestAuctionData_Cancel(t *testing.T) {
+	seller := byzcoin.NewInstanceID([]byte("seller"))
+	bidder := byzcoin.NewInstanceID([]byte("bidder"))
+	drop := byzcoin.Instruction{Invoke: &byzcoin.Invoke{Command: "drop"}}
+	rst := &candleTrie{index: 9}
+
+	auction := AuctionData{SellerAccount: seller, Bond: 30, CancelPenalty: 10, EndIndex: 10}
+	payouts := auctioncore.Payouts{}
+	require.NoError(t, auction.cancel(rst, drop, &payouts))
+	require.Equal(t, []auctioncore.PayoutData{{Account: seller, Amount: 30}}, auction.Cancellation.Payouts)
+
+	auction.HighestBid = 5
+	auction.HighestBidder = bidder
+	payouts = auctioncore.Payouts{}
+	payouts.Add(bidder, 5)
+	require.NoError(t, auction.cancel(rst, drop, &payouts))
+	require.Equal(t, []auctioncore.PayoutData{{Account: bidder, Amount: 15}, {Account: seller, Amount: 20}},
+		auction.Cancellation.Payouts)
+
+	// Past the end
+	rst.index = 10
+	require.Error(t, auction.cancel(rst, drop, &auctioncore.Payouts{}))
+
+	// Neither without a bond
+	auction.Bond, auction.CancelPenalty = 0, 0
+	require.Error(t, auction.cancel(rst, drop, &auctioncore.Payouts{}))
+
+	// Before the end it only refunds the bids
+	rst.index = 9
+	payouts = auctioncore.Payouts{}
+	payouts.Add(bidder, 5)
+	require.NoError(t, auction.cancel(rst, drop, &payouts))
+	require.Equal(t, []auctioncore.PayoutData{{Account: bidder, Amount: 5}}, auction.Cancellation.Payouts)
+}
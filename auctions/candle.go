@@ -0,0 +1,243 @@
+package auctions
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+)
+
+// startCandle checks a new candle auction and records the block its bidding
+// window starts at.
+func startCandle(rst byzcoin.ReadOnlyStateTrie, auction *AuctionData) error {
+	if auction.State != auctioncore.StateOpen || auction.HighestBid != 0 || len(auction.Leaders) != 0 {
+		return errors.New("a new auction must be open and without bids")
+	}
+	index, err := auctioncore.BlockIndex(rst)
+	if err != nil {
+		return err
+	}
+	if auction.EndIndex < index {
+		return errors.New("the bidding window is already over")
+	}
+	if len(auction.ByzCoinID) == 0 {
+		return errors.New("a candle auction must give its ledger")
+	}
+	auction.StartIndex = index
+	auction.CandleEnd = 0
+	return nil
+}
+
+// invokeCandle handles the commands of a candle auction. Bids are taken
+// until EndIndex, and every leading bid is kept in escrow with the block it
+// led at. Once the window is over, close draws the real end block between
+// StartIndex and EndIndex from the hash of the block right after the window,
+// see CandleSeedData, and the leader at that block wins.
+//   - bid: takes a bid higher than the current leader
+//   - close: draws the end block, pays the seller and refunds the others
+//   - drop, forceclose: refund all the leaders and apply the cancellation
+//     policy
+func (c *contractAuction) invokeCandle(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, cin []byzcoin.Coin, auction AuctionData, darcID darc.ID) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = cin
+	payouts := auctioncore.Payouts{}
+
+	var index uint64
+	index, err = auctioncore.BlockIndex(rst)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch inst.Invoke.Command {
+	case "bid":
+		if index > auction.EndIndex {
+			return nil, nil, auctioncore.ErrAuctionClosed
+		}
+		bidBuf := inst.Invoke.Args.Search("bid")
+		if bidBuf == nil {
+			return nil, nil, auctioncore.ErrMissingBid
+		}
+		bid := BidData{}
+		err = protobuf.Decode(bidBuf, &bid)
+		if err != nil {
+			return nil, nil, auctioncore.ErrNotBid
+		}
+		if bid.BidderAccount == auction.SellerAccount {
+			return nil, nil, auctioncore.ErrSellerBid
+		}
+
+		//The escrowed coins are the bid
+		cout, err = escrowBid(rst, &bid, cin)
+		if err != nil {
+			return nil, nil, err
+		}
+		if bid.Bid == 0 {
+			return nil, nil, auctioncore.ErrZeroBid
+		}
+		if bid.Bid <= auction.HighestBid {
+			return nil, nil, auctioncore.ErrBidTooLow
+		}
+
+		//A leader replaced in the same block never led at the end of a
+		//block, so it cannot win and is refunded right away
+		leader := LeaderData{Index: index, Bidder: bid.BidderAccount, Bid: bid.Bid, WinProof: bid.BidderPubKey}
+		last := len(auction.Leaders) - 1
+		if last >= 0 && auction.Leaders[last].Index == index {
+			sc, _, err = c.storeCoin(rst, auction.Leaders[last].Bid, auction.Leaders[last].Bidder)
+			if err != nil {
+				return nil, nil, err
+			}
+			auction.Leaders[last] = leader
+		} else {
+			auction.Leaders = append(auction.Leaders, leader)
+		}
+		auction.HighestBid = bid.Bid
+		auction.HighestBidder = bid.BidderAccount
+		auction.WinProof = bid.BidderPubKey
+
+	case "close":
+		if index <= auction.EndIndex {
+			return nil, nil, auctioncore.ErrAuctionOpen
+		}
+		var reservePrice uint64
+		if auction.ReservePrice != "" {
+			closeBuf := inst.Invoke.Args.Search("close")
+			if closeBuf == nil {
+				return nil, nil, auctioncore.ErrMissingClose
+			}
+			closedata := CloseData{}
+			err = protobuf.Decode(closeBuf, &closedata)
+			if err != nil {
+				return nil, nil, auctioncore.ErrNotClose
+			}
+			if !auctioncore.VerifyReserve(auction.ReservePrice, closedata) {
+				return nil, nil, auctioncore.ErrReserveVerify
+			}
+			reservePrice = closedata.ReservePrice
+		}
+
+		var seed []byte
+		seed, err = candleSeed(rst, inst, auction)
+		if err != nil {
+			return nil, nil, err
+		}
+		auction.CandleEnd = candleEnd(seed, auction.StartIndex, auction.EndIndex)
+		winner, found := leaderAt(auction.Leaders, auction.CandleEnd)
+		if found && winner.Bid <= reservePrice {
+			found = false
+		}
+
+		for _, l := range auction.Leaders {
+			if found && l == winner {
+				payouts.Add(auction.SellerAccount, l.Bid)
+			} else {
+				payouts.Add(l.Bidder, l.Bid)
+			}
+		}
+		auction.HighestBid = 0
+		auction.HighestBidder = byzcoin.InstanceID{}
+		auction.WinProof = ""
+		auction.State = auctioncore.StateClosed
+		if found {
+			auction.HighestBid = winner.Bid
+			auction.HighestBidder = winner.Bidder
+			auction.WinProof = winner.WinProof
+			auction.State = auctioncore.StateWClosed
+		}
+		auction.releaseBond(&payouts)
+
+	case "drop", "forceclose":
+		for _, l := range auction.Leaders {
+			payouts.Add(l.Bidder, l.Bid)
+		}
+		err = auction.cancel(rst, inst, &payouts)
+		if err != nil {
+			return nil, nil, err
+		}
+		auction.State = auctioncore.StateDropped
+		if inst.Invoke.Command == "forceclose" {
+			auction.State = auctioncore.StateClosed
+		}
+
+	default:
+		return nil, nil, errors.New("Auction contract can only bid close forceclose or drop")
+	}
+
+	var payoutsSC []byzcoin.StateChange
+	payoutsSC, err = payouts.StoreCoins(c.contracts, rst)
+	if err != nil {
+		return nil, nil, err
+	}
+	sc = append(sc, payoutsSC...)
+
+	var auctionBuf []byte
+	auctionBuf, err = protobuf.Encode(&auction)
+	if err != nil {
+		return nil, nil, errors.New("encode auction buf sc: " + inst.Invoke.Command)
+	}
+	sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+		ContractAuctionID, auctionBuf, darcID))
+	return
+}
+
+// candleSeed derives the randomness of the end block from the hash of the
+// block of the ledger right after the bidding window, given by the argument
+// "seed". The block is checked against the roster of the ledger, which must
+// not have changed since.
+func candleSeed(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, auction AuctionData) ([]byte, error) {
+	seedBuf := inst.Invoke.Args.Search("seed")
+	if seedBuf == nil {
+		return nil, errors.New("missing the block drawing the end")
+	}
+	seed := CandleSeedData{}
+	err := protobuf.DecodeWithConstructors(seedBuf, &seed, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, errors.New("the seed is not a block")
+	}
+	block := seed.Block
+	if block.SkipBlockFix == nil || block.Index < 0 || uint64(block.Index) != auction.EndIndex+1 {
+		return nil, errors.New("the seed is not the block after the bidding window")
+	}
+	if !block.SkipChainID().Equal(auction.ByzCoinID) {
+		return nil, errors.New("the seed is a block of another ledger")
+	}
+	hash := block.CalculateHash()
+	if !seed.Link.From.Equal(hash) {
+		return nil, errors.New("the forward link does not leave the seed block")
+	}
+	config, err := byzcoin.LoadConfigFromTrie(rst)
+	if err != nil {
+		return nil, err
+	}
+	err = seed.Link.Verify(pairing.NewSuiteBn256(), config.Roster.ServicePublics(skipchain.ServiceName))
+	if err != nil {
+		return nil, errors.New("the seed block is not signed by the roster: " + err.Error())
+	}
+	h := sha256.New()
+	h.Write(hash)
+	h.Write(inst.InstanceID.Slice())
+	return h.Sum(nil), nil
+}
+
+// candleEnd draws a block between start and end, both included.
+func candleEnd(seed []byte, start, end uint64) uint64 {
+	return start + binary.LittleEndian.Uint64(seed[:8])%(end-start+1)
+}
+
+// leaderAt returns the leader at the end of the block index. It returns
+// false if nobody had bid yet.
+func leaderAt(leaders []LeaderData, index uint64) (LeaderData, bool) {
+	for i := len(leaders) - 1; i >= 0; i-- {
+		if leaders[i].Index <= index {
+			return leaders[i], true
+		}
+	}
+	return LeaderData{}, false
+}
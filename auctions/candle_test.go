@@ -0,0 +1,243 @@
+package auctions
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/byzcoin/trie"
+	"go.dedis.ch/cothority/v3/byzcoinx"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/sign/bls"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+)
+
+func TestCandleEnd(t *testing.T) {
+	seen := make(map[uint64]bool)
+	for i := byte(0); i < 100; i++ {
+		seed := make([]byte, 32)
+		seed[0], seed[3] = i, i*7
+		end := candleEnd(seed, 10, 14)
+		require.True(t, end >= 10 && end <= 14)
+		require.Equal(t, end, candleEnd(seed, 10, 14))
+		seen[end] = true
+	}
+	require.Len(t, seen, 5)
+	require.Equal(t, uint64(7), candleEnd(make([]byte, 32), 7, 7))
+}
+
+func TestLeaderAt(t *testing.T) {
+	a := byzcoin.NewInstanceID([]byte("a"))
+	b := byzcoin.NewInstanceID([]byte("b"))
+	leaders := []LeaderData{
+		{Index: 3, Bidder: a, Bid: 10},
+		{Index: 5, Bidder: b, Bid: 20},
+		{Index: 8, Bidder: a, Bid: 30},
+	}
+
+	_, found := leaderAt(leaders, 2)
+	require.False(t, found)
+	for index, bid := range map[uint64]uint64{3: 10, 4: 10, 5: 20, 7: 20, 8: 30, 12: 30} {
+		l, found := leaderAt(leaders, index)
+		require.True(t, found)
+		require.Equal(t, bid, l.Bid)
+	}
+}
+
+func TestStartCandle(t *testing.T) {
+	rst := &candleTrie{index: 4}
+	auction := AuctionData{State: auctioncore.StateOpen, Mode: ModeCandle, EndIndex: 9}
+
+	// The ledger drawing the end must be given
+	require.Error(t, startCandle(rst, &auction))
+	auction.ByzCoinID = skipchain.SkipBlockID("ledger")
+	require.NoError(t, startCandle(rst, &auction))
+	require.Equal(t, uint64(5), auction.StartIndex)
+
+	auction.EndIndex = 4
+	require.Error(t, startCandle(rst, &auction))
+
+	auction.EndIndex = 9
+	auction.Leaders = []LeaderData{{Index: 5, Bid: 1}}
+	require.Error(t, startCandle(rst, &auction))
+}
+
+func TestCandleSeed(t *testing.T) {
+	suite := pairing.NewSuiteBn256()
+	private := suite.Scalar().Pick(suite.RandomStream())
+	si := network.NewServerIdentity(cothority.Suite.Point().Pick(cothority.Suite.RandomStream()), network.NewAddress(network.PlainTCP, "127.0.0.1:7770"))
+	si.ServiceIdentities = []network.ServiceIdentity{
+		network.NewServiceIdentity(skipchain.ServiceName, suite, suite.Point().Mul(private, nil), nil),
+	}
+	roster := onet.NewRoster([]*network.ServerIdentity{si})
+	rst := &candleTrie{index: 14}
+	rst.setConfig(t, roster)
+	ledger := skipchain.SkipBlockID("ledger")
+	auction := AuctionData{State: auctioncore.StateOpen, Mode: ModeCandle, StartIndex: 5, EndIndex: 10, ByzCoinID: ledger}
+	c := &contractAuction{}
+
+	// The block after the window draws the end, whoever closes and when
+	seed := signedBlock(t, ledger, 11, roster, private)
+	sc, _, err := c.invokeCandle(rst, closeInstruction(t, seed), nil, auction, nil)
+	require.NoError(t, err)
+	closed, err := DecodeAuction(sc[len(sc)-1].Value)
+	require.NoError(t, err)
+	rst.index = 30
+	require.NoError(t, rst.set([]byte("later"), []byte("change")))
+	sc, _, err = c.invokeCandle(rst, closeInstruction(t, seed), nil, auction, nil)
+	require.NoError(t, err)
+	again, err := DecodeAuction(sc[len(sc)-1].Value)
+	require.NoError(t, err)
+	require.Equal(t, closed.CandleEnd, again.CandleEnd)
+
+	// The closer cannot pick another block
+	for _, other := range []CandleSeedData{
+		signedBlock(t, ledger, 12, roster, private),
+		signedBlock(t, skipchain.SkipBlockID("other"), 11, roster, private),
+		signedBlock(t, ledger, 11, roster, suite.Scalar().Pick(suite.RandomStream())),
+	} {
+		_, _, err = c.invokeCandle(rst, closeInstruction(t, other), nil, auction, nil)
+		require.Error(t, err)
+	}
+	tampered := seed
+	fix := *seed.Block.SkipBlockFix
+	fix.Data = []byte("other")
+	tampered.Block.SkipBlockFix = &fix
+	_, _, err = c.invokeCandle(rst, closeInstruction(t, tampered), nil, auction, nil)
+	require.Error(t, err)
+	_, _, err = c.invokeCandle(rst, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID([]byte("auction")),
+		Invoke:     &byzcoin.Invoke{ContractID: ContractAuctionID, Command: "close"},
+	}, nil, auction, nil)
+	require.Error(t, err)
+}
+
+// signedBlock returns the block of the ledger at the index, with the
+// forward link out of it signed by the key.
+func signedBlock(t *testing.T, ledger skipchain.SkipBlockID, index int, roster *onet.Roster, private kyber.Scalar) CandleSeedData {
+	sb := skipchain.NewSkipBlock()
+	sb.Index = index
+	sb.GenesisID = ledger
+	sb.Roster = roster
+	sb.Data = []byte("block")
+	sb.Hash = sb.CalculateHash()
+	link := skipchain.ForwardLink{From: sb.Hash, To: skipchain.SkipBlockID("next")}
+	msg := link.Hash()
+	sig, err := bls.Sign(pairing.NewSuiteBn256(), private, msg)
+	require.NoError(t, err)
+	link.Signature = byzcoinx.FinalSignature{Msg: msg, Sig: sig}
+	return CandleSeedData{Block: *sb, Link: link}
+}
+
+// closeInstruction returns the instruction closing a candle auction with
+// the seed.
+func closeInstruction(t *testing.T, seed CandleSeedData) byzcoin.Instruction {
+	seedBuf, err := protobuf.Encode(&seed)
+	require.NoError(t, err)
+	return byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID([]byte("auction")),
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractAuctionID,
+			Command:    "close",
+			Args:       byzcoin.Arguments{{Name: "seed", Value: seedBuf}},
+		},
+	}
+}
+
+func TestInvokeCandle_UnbackedBid(t *testing.T) {
+	bidder := byzcoin.NewInstanceID([]byte("bidder"))
+	rst := &candleTrie{index: 4}
+	rst.setCoin(bidder)
+	auction := AuctionData{State: auctioncore.StateOpen, Mode: ModeCandle, StartIndex: 5, EndIndex: 9}
+	c := &contractAuction{}
+	coins := []byzcoin.Coin{{Name: contracts.CoinName, Value: 1}}
+
+	// Escrowing one coin cannot bid 50
+	_, _, err := c.invokeCandle(rst, bidInstruction(t, BidData{BidderAccount: bidder, Bid: 50}), coins, auction, nil)
+	require.Equal(t, auctioncore.ErrUnbackedBid, err)
+
+	sc, cout, err := c.invokeCandle(rst, bidInstruction(t, BidData{BidderAccount: bidder}), coins, auction, nil)
+	require.NoError(t, err)
+	require.Empty(t, cout)
+	auction, err = DecodeAuction(sc[len(sc)-1].Value)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), auction.HighestBid)
+	require.Equal(t, bidder, auction.HighestBidder)
+}
+
+// bidInstruction returns the instruction placing the bid on an auction.
+func bidInstruction(t *testing.T, bid BidData) byzcoin.Instruction {
+	bidBuf, err := protobuf.Encode(&bid)
+	require.NoError(t, err)
+	return byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID([]byte("auction")),
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractAuctionID,
+			Command:    "bid",
+			Args:       byzcoin.Arguments{{Name: "bid", Value: bidBuf}},
+		},
+	}
+}
+
+// candleTrie is a ReadOnlyStateTrie with a block index, a real trie to get
+// the root from, coin accounts and the configuration of the ledger.
+type candleTrie struct {
+	index  int
+	t      *trie.Trie
+	coins  map[string]byzcoin.Coin
+	config []byte
+}
+
+// setCoin adds an empty account of the default coin.
+func (ct *candleTrie) setCoin(account byzcoin.InstanceID) {
+	if ct.coins == nil {
+		ct.coins = make(map[string]byzcoin.Coin)
+	}
+	ct.coins[string(account.Slice())] = byzcoin.Coin{Name: contracts.CoinName}
+}
+
+func (ct *candleTrie) set(key, value []byte) (err error) {
+	if ct.t == nil {
+		ct.t, err = trie.NewTrie(trie.NewMemDB(), []byte("nonce"))
+		if err != nil {
+			return
+		}
+	}
+	return ct.t.Set(key, value)
+}
+
+// setConfig adds the configuration of the ledger with the roster.
+func (ct *candleTrie) setConfig(t *testing.T, roster *onet.Roster) {
+	var err error
+	ct.config, err = protobuf.Encode(&byzcoin.ChainConfig{Roster: *roster})
+	require.NoError(t, err)
+}
+
+func (ct *candleTrie) GetValues(key []byte) ([]byte, uint64, string, darc.ID, error) {
+	if ct.config != nil && byzcoin.ConfigInstanceID.Equal(byzcoin.NewInstanceID(key)) {
+		return ct.config, 0, byzcoin.ContractConfigID, nil, nil
+	}
+	coin, ok := ct.coins[string(key)]
+	if !ok {
+		return nil, 0, "", nil, errors.New("key not set")
+	}
+	buf, err := protobuf.Encode(&coin)
+	return buf, 0, contracts.ContractCoinID, nil, err
+}
+
+func (ct *candleTrie) GetProof(key []byte) (*trie.Proof, error) {
+	return ct.t.GetProof(key)
+}
+
+func (ct *candleTrie) GetIndex() int {
+	return ct.index
+}
@@ -0,0 +1,249 @@
+package auctions
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/calypso"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/protobuf"
+)
+
+// Client sends the instructions of the auction contract on behalf of a
+// signer. It pairs every escrow with the coin fetch paying for it and reads
+// the signer counter from the ledger, the signer must be allowed by the
+// darcs of the accounts it spends from.
+type Client struct {
+	*auctioncore.Sender
+}
+
+// NewClient returns a client sending as signer.
+func NewClient(cl *byzcoin.Client, signer darc.Signer) *Client {
+	return &Client{auctioncore.NewSender(cl, signer)}
+}
+
+// CreateAuction spawns the auction under the darc and returns its instance.
+// The escrow of the auction, the budget of a reverse auction or the bond of
+// the seller, is fetched from the seller account. A candle auction is bound
+// to the ledger of the client.
+func (c *Client) CreateAuction(darcID darc.ID, auction AuctionData) (byzcoin.InstanceID, error) {
+	if auction.Mode == ModeCandle {
+		auction.ByzCoinID = c.Client.ID
+	}
+	auctionBuf, err := protobuf.Encode(&auction)
+	if err != nil {
+		return byzcoin.InstanceID{}, err
+	}
+	var instrs []byzcoin.Instruction
+	escrow := auction.Bond
+	if auction.Mode == ModeReverse {
+		escrow = auction.Budget
+	}
+	if escrow > 0 {
+		instrs = append(instrs, auctioncore.FetchCoins(auction.SellerAccount, escrow))
+	}
+	instrs = append(instrs, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(darcID),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractAuctionID,
+			Args:       byzcoin.Arguments{{Name: "auction", Value: auctionBuf}},
+		},
+	})
+	ctx, err := c.Send(instrs...)
+	if err != nil {
+		return byzcoin.InstanceID{}, err
+	}
+	return ctx.Instructions[len(instrs)-1].DeriveID(""), nil
+}
+
+// CreateSecretAuction posts the secret, a calypso write made for the darc
+// with calypso.NewWrite, and spawns the auction selling it. Both are spawned
+// under the darc, which needs the spawn:calypsoWrite rule. Once the auction
+// holds the write, nobody can read the secret until a winner is known, and
+// nobody ever can if there is none.
+func (c *Client) CreateSecretAuction(darcID darc.ID, auction AuctionData, write *calypso.Write) (byzcoin.InstanceID, byzcoin.InstanceID, error) {
+	writeBuf, err := protobuf.Encode(write)
+	if err != nil {
+		return byzcoin.InstanceID{}, byzcoin.InstanceID{}, err
+	}
+	ctx, err := c.Send(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(darcID),
+		Spawn: &byzcoin.Spawn{
+			ContractID: calypso.ContractWriteID,
+			Args:       byzcoin.Arguments{{Name: "write", Value: writeBuf}},
+		},
+	})
+	if err != nil {
+		return byzcoin.InstanceID{}, byzcoin.InstanceID{}, err
+	}
+	auction.Asset = ctx.Instructions[0].DeriveID("")
+	auctInstID, err := c.CreateAuction(darcID, auction)
+	return auctInstID, auction.Asset, err
+}
+
+// ReadSecret returns the key of the secret sold by a won auction,
+// re-encrypted by the roster to the signer, which must be an Ed25519
+// signer allowed by the darc of the winner's account.
+func (c *Client) ReadSecret(writeInstID byzcoin.InstanceID) ([]byte, error) {
+	if c.Signer.Ed25519 == nil {
+		return nil, errors.New("the signer needs an Ed25519 key to read a secret")
+	}
+	readBuf, err := protobuf.Encode(&calypso.Read{Write: writeInstID, Xc: c.Signer.Ed25519.Point})
+	if err != nil {
+		return nil, err
+	}
+	ctx, err := c.Send(byzcoin.Instruction{
+		InstanceID: writeInstID,
+		Spawn: &byzcoin.Spawn{
+			ContractID: calypso.ContractReadID,
+			Args:       byzcoin.Arguments{{Name: "read", Value: readBuf}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	readProof, err := c.Client.WaitProof(ctx.Instructions[0].DeriveID(""), time.Second, nil)
+	if err != nil {
+		return nil, err
+	}
+	writeReply, err := c.Client.GetProof(writeInstID.Slice())
+	if err != nil {
+		return nil, err
+	}
+	reply, err := calypso.NewClient(c.Client).DecryptKey(&calypso.DecryptKey{Read: *readProof, Write: writeReply.Proof})
+	if err != nil {
+		return nil, err
+	}
+	return reply.RecoverKey(c.Signer.Ed25519.Secret)
+}
+
+// Bid sends the bid to the auction, with the escrow fetched from the bidder
+// account. The escrow is the bid: bid.Bid must be left at 0, except for an
+// offer to a reverse auction, which states bid.Bid and escrows nothing. A candle auction bound to another
+// ledger is refused, its seller could pick the end.
+func (c *Client) Bid(auctInstID byzcoin.InstanceID, bid BidData, escrow uint64) error {
+	auction, err := c.GetAuction(auctInstID)
+	if err != nil {
+		return err
+	}
+	if auction.Mode == ModeCandle && !auction.ByzCoinID.Equal(c.Client.ID) {
+		return errors.New("the end of the candle auction would be drawn from another ledger")
+	}
+	bidBuf, err := protobuf.Encode(&bid)
+	if err != nil {
+		return err
+	}
+	var instrs []byzcoin.Instruction
+	if escrow > 0 {
+		instrs = append(instrs, auctioncore.FetchCoins(bid.BidderAccount, escrow))
+	}
+	instrs = append(instrs, c.invoke(auctInstID, "bid", byzcoin.Arguments{{Name: "bid", Value: bidBuf}}))
+	_, err = c.Send(instrs...)
+	return err
+}
+
+// Close closes the auction, revealing the reserve price with its salt. A
+// multi-lot auction is closed with CloseLots, a candle auction with
+// CloseCandle.
+func (c *Client) Close(auctInstID byzcoin.InstanceID, reserve CloseData) error {
+	closeBuf, err := protobuf.Encode(&reserve)
+	if err != nil {
+		return err
+	}
+	_, err = c.Send(c.invoke(auctInstID, "close", byzcoin.Arguments{{Name: "close", Value: closeBuf}}))
+	return err
+}
+
+// CloseCandle closes a candle auction, revealing the reserve price with its
+// salt. The block after the bidding window must have a forward link, so the
+// ledger must be two blocks past EndIndex.
+func (c *Client) CloseCandle(auctInstID byzcoin.InstanceID, reserve CloseData) error {
+	auction, err := c.GetAuction(auctInstID)
+	if err != nil {
+		return err
+	}
+	reply, err := skipchain.NewClient().GetSingleBlockByIndex(&c.Client.Roster, c.Client.ID, int(auction.EndIndex+1))
+	if err != nil {
+		return err
+	}
+	if len(reply.SkipBlock.ForwardLink) == 0 {
+		return errors.New("the block after the bidding window has no forward link yet")
+	}
+	seedBuf, err := protobuf.Encode(&CandleSeedData{Block: *reply.SkipBlock, Link: *reply.SkipBlock.ForwardLink[0]})
+	if err != nil {
+		return err
+	}
+	closeBuf, err := protobuf.Encode(&reserve)
+	if err != nil {
+		return err
+	}
+	_, err = c.Send(c.invoke(auctInstID, "close", byzcoin.Arguments{
+		{Name: "close", Value: closeBuf},
+		{Name: "seed", Value: seedBuf},
+	}))
+	return err
+}
+
+// CloseLots closes a multi-lot auction, with the reserve of every lot.
+func (c *Client) CloseLots(auctInstID byzcoin.InstanceID, reserves CloseLotsData) error {
+	closeBuf, err := protobuf.Encode(&reserves)
+	if err != nil {
+		return err
+	}
+	_, err = c.Send(c.invoke(auctInstID, "close", byzcoin.Arguments{{Name: "close", Value: closeBuf}}))
+	return err
+}
+
+// Drop cancels the auction and refunds the bidders. The reason is recorded
+// with the cancellation, it can be empty.
+func (c *Client) Drop(auctInstID byzcoin.InstanceID, reason string) error {
+	var args byzcoin.Arguments
+	if reason != "" {
+		cancelBuf, err := protobuf.Encode(&CancelData{Reason: reason})
+		if err != nil {
+			return err
+		}
+		args = byzcoin.Arguments{{Name: "cancel", Value: cancelBuf}}
+	}
+	_, err := c.Send(c.invoke(auctInstID, "drop", args))
+	return err
+}
+
+// GetAuction reads the auction with a proof verified against the ledger.
+func (c *Client) GetAuction(auctInstID byzcoin.InstanceID) (AuctionData, error) {
+	auction := AuctionData{}
+	found, err := auctioncore.ReadInstance(c.Client, auctInstID, ContractAuctionID, &auction)
+	if err != nil {
+		return auction, err
+	}
+	if !found {
+		return auction, auctioncore.ErrUnknownInstanceID
+	}
+	return auction, auction.upgrade()
+}
+
+// WaitForState reads the auction until it is in the state, and returns it.
+// It fails with ErrTimeout if the state is not reached in time.
+func (c *Client) WaitForState(auctInstID byzcoin.InstanceID, state string, timeout time.Duration) (AuctionData, error) {
+	var auction AuctionData
+	err := auctioncore.Poll(100*time.Millisecond, timeout, func() (bool, error) {
+		var err error
+		auction, err = c.GetAuction(auctInstID)
+		return err == nil && auction.State == state, err
+	})
+	return auction, err
+}
+
+func (c *Client) invoke(auctInstID byzcoin.InstanceID, command string, args byzcoin.Arguments) byzcoin.Instruction {
+	return byzcoin.Instruction{
+		InstanceID: auctInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractAuctionID,
+			Command:    command,
+			Args:       args,
+		},
+	}
+}
@@ -0,0 +1,64 @@
+package auctions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	sellAccInstID := bct.createSellerAccount(t)
+	bidAccInstID := bct.createBidderAccount(t, 100)
+	bid2AccInstID := bct.createBidderAccount(t, 100)
+
+	// The client reads the counters from the ledger, bct.ct is stale from
+	// here on.
+	cl := NewClient(bct.cl, bct.signer)
+	auctInstID, err := cl.CreateAuction(bct.gDarc.GetBaseID(), AuctionData{
+		GoodDescription: "bananas",
+		SellerAccount:   sellAccInstID,
+		State:           auctioncore.StateOpen,
+		ReservePrice:    auctioncore.CreateHash("salt", 20),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, cl.Bid(auctInstID, BidData{BidderAccount: bidAccInstID}, 30))
+	require.Error(t, cl.Bid(auctInstID, BidData{BidderAccount: bid2AccInstID}, 30))
+	require.NoError(t, cl.Bid(auctInstID, BidData{BidderAccount: bid2AccInstID}, 40))
+
+	auction, err := cl.GetAuction(auctInstID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(40), auction.HighestBid)
+	require.Equal(t, bid2AccInstID, auction.HighestBidder)
+
+	require.Error(t, cl.Close(auctInstID, CloseData{Salt: "salt", ReservePrice: 10}))
+	require.NoError(t, cl.Close(auctInstID, CloseData{Salt: "salt", ReservePrice: 20}))
+	auction, err = cl.WaitForState(auctInstID, auctioncore.StateWClosed, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, uint64(40), bct.coinBalance(t, sellAccInstID))
+	require.Equal(t, uint64(100), bct.coinBalance(t, bidAccInstID))
+	require.Equal(t, uint64(60), bct.coinBalance(t, bid2AccInstID))
+
+	_, err = cl.WaitForState(auctInstID, auctioncore.StateDropped, time.Second)
+	require.Equal(t, auctioncore.ErrTimeout, err)
+
+	// Drop refunds and records the reason
+	auctInstID, err = cl.CreateAuction(bct.gDarc.GetBaseID(), AuctionData{
+		GoodDescription: "apples",
+		SellerAccount:   sellAccInstID,
+		State:           auctioncore.StateOpen,
+	})
+	require.NoError(t, err)
+	require.NoError(t, cl.Bid(auctInstID, BidData{BidderAccount: bidAccInstID}, 10))
+	require.NoError(t, cl.Drop(auctInstID, "out of stock"))
+	auction, err = cl.GetAuction(auctInstID)
+	require.NoError(t, err)
+	require.Equal(t, auctioncore.StateDropped, auction.State)
+	require.Equal(t, "out of stock", auction.Cancellation.Reason)
+	require.Equal(t, uint64(100), bct.coinBalance(t, bidAccInstID))
+}
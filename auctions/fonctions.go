@@ -1,19 +1,18 @@
 package auctions
 
 import (
-	"crypto/sha256"
-	"encoding/binary"
-	"encoding/hex"
 	"fmt"
-	"strconv"
 	"testing"
 	"time"
 
+	"github.com/dedis/student_19_auctions/auctioncore"
 	"github.com/stretchr/testify/require"
 	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/cothority/v3/byzcoin"
 	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/calypso"
 	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/darc/expression"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/protobuf"
 )
@@ -43,7 +42,9 @@ func newBCTest(t *testing.T) (out *bcTest) {
 	// to create and update keyValue contracts.
 	var err error
 	out.gMsg, err = byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, out.roster,
-		[]string{"spawn:auction", "invoke:auction.bid", "invoke:auction.close", "spawn:coin", "invoke:coin.mint", "invoke:coin.fetch"}, out.signer.Identity())
+		[]string{"spawn:auction", "invoke:auction.bid", "invoke:auction.close", "invoke:auction.drop", "invoke:auction.forceclose", "spawn:coin", "invoke:coin.mint", "invoke:coin.fetch",
+			"spawn:value", "invoke:value.update", "invoke:auction.migrate",
+			"spawn:longTermSecret", "spawn:calypsoWrite", "spawn:calypsoRead"}, out.signer.Identity())
 	require.Nil(t, err)
 	out.gDarc = &out.gMsg.GenesisDarc
 
@@ -152,8 +153,7 @@ func (bct *bcTest) createBidderAccount(t *testing.T, amount uint64) byzcoin.Inst
 
 	bidAccInstID := ctx.Instructions[0].DeriveID("")
 
-	credit := make([]byte, 8)
-	binary.LittleEndian.PutUint64(credit, amount)
+	credit := auctioncore.EncodeAmount(amount)
 
 	inst = byzcoin.Instruction{
 		InstanceID: bidAccInstID,
@@ -188,7 +188,7 @@ func (bct *bcTest) createAuction(t *testing.T, sellAccInstID byzcoin.InstanceID,
 		HighestBid:      0,
 		HighestBidder:   instID,
 		State:           "OPEN",
-		ReservePrice:    createHash("testsalt", 0),
+		ReservePrice:    auctioncore.CreateHash("testsalt", 0),
 	}
 
 	auctionBuf, err := protobuf.Encode(&auction)
@@ -225,8 +225,7 @@ func (bct *bcTest) addBid(t *testing.T, auctInstID byzcoin.InstanceID, bidAccIns
 		},
 	}
 
-	amount := make([]byte, 8)
-	binary.LittleEndian.PutUint64(amount, bid)
+	amount := auctioncore.EncodeAmount(bid)
 
 	inst := byzcoin.Instruction{
 		InstanceID: bidAccInstID,
@@ -282,8 +281,7 @@ func (bct *bcTest) addBidWithDiffCoinName(t *testing.T, auctInstID byzcoin.Insta
 		},
 	}
 
-	amount := make([]byte, 8)
-	binary.LittleEndian.PutUint64(amount, bid)
+	amount := auctioncore.EncodeAmount(bid)
 
 	inst := byzcoin.Instruction{
 		InstanceID: bidAccInstID,
@@ -323,10 +321,16 @@ func (bct *bcTest) addBidWithDiffCoinName(t *testing.T, auctInstID byzcoin.Insta
 }
 
 func (bct *bcTest) closeAuction(t *testing.T, auctInstID byzcoin.InstanceID) error {
+	return bct.closeAuctionWithReserve(t, auctInstID, 0)
+}
+
+// closeAuctionWithReserve closes the auction, revealing the reserve price
+// hashed with the salt used by the test auctions.
+func (bct *bcTest) closeAuctionWithReserve(t *testing.T, auctInstID byzcoin.InstanceID, reservePrice uint64) error {
 
 	closedata := CloseData{
 		Salt:         "testsalt",
-		ReservePrice: 0,
+		ReservePrice: reservePrice,
 	}
 
 	closeBuf, err := protobuf.Encode(&closedata)
@@ -357,6 +361,389 @@ func (bct *bcTest) closeAuction(t *testing.T, auctInstID byzcoin.InstanceID) err
 	return err
 }
 
+// createReverseAuction spawns a reverse auction, fetching the budget from
+// the buyer's account in the same transaction.
+func (bct *bcTest) createReverseAuction(t *testing.T, buyAccInstID byzcoin.InstanceID, good string, budget uint64, ceiling uint64) (byzcoin.InstanceID, error) {
+	auction := AuctionData{
+		GoodDescription: good,
+		SellerAccount:   buyAccInstID,
+		State:           auctioncore.StateOpen,
+		ReservePrice:    auctioncore.CreateHash("testsalt", ceiling),
+		Mode:            ModeReverse,
+		Budget:          budget,
+	}
+	auctionBuf, err := protobuf.Encode(&auction)
+	require.Nil(t, err)
+
+	ctx := byzcoin.ClientTransaction{
+		Instructions: []byzcoin.Instruction{{
+			InstanceID: buyAccInstID,
+			Invoke: &byzcoin.Invoke{
+				ContractID: contracts.ContractCoinID,
+				Command:    "fetch",
+				Args:       byzcoin.Arguments{{Name: "coins", Value: auctioncore.EncodeAmount(budget)}},
+			},
+			SignerCounter: []uint64{bct.ct},
+		}, {
+			InstanceID: byzcoin.NewInstanceID(bct.gDarc.GetBaseID()),
+			Spawn: &byzcoin.Spawn{
+				ContractID: ContractAuctionID,
+				Args:       byzcoin.Arguments{{Name: "auction", Value: auctionBuf}},
+			},
+			SignerCounter: []uint64{bct.ct + 1},
+		}},
+	}
+	require.Nil(t, ctx.FillSignersAndSignWith(bct.signer))
+	_, err = bct.cl.AddTransactionAndWait(ctx, 10)
+	if err == nil {
+		bct.ct += 2
+	}
+	return ctx.Instructions[1].DeriveID(""), err
+}
+
+// createAuctionWithBond spawns a forward auction with a cancellation
+// policy, fetching the bond from the seller's account in the same
+// transaction.
+func (bct *bcTest) createAuctionWithBond(t *testing.T, sellAccInstID byzcoin.InstanceID, bond uint64, penalty uint64) (byzcoin.InstanceID, error) {
+	auction := AuctionData{
+		GoodDescription: "good",
+		SellerAccount:   sellAccInstID,
+		State:           auctioncore.StateOpen,
+		ReservePrice:    auctioncore.CreateHash("testsalt", 0),
+		Bond:            bond,
+		CancelPenalty:   penalty,
+	}
+	auctionBuf, err := protobuf.Encode(&auction)
+	require.Nil(t, err)
+
+	ctx := byzcoin.ClientTransaction{
+		Instructions: []byzcoin.Instruction{{
+			InstanceID: sellAccInstID,
+			Invoke: &byzcoin.Invoke{
+				ContractID: contracts.ContractCoinID,
+				Command:    "fetch",
+				Args:       byzcoin.Arguments{{Name: "coins", Value: auctioncore.EncodeAmount(bond)}},
+			},
+			SignerCounter: []uint64{bct.ct},
+		}, {
+			InstanceID: byzcoin.NewInstanceID(bct.gDarc.GetBaseID()),
+			Spawn: &byzcoin.Spawn{
+				ContractID: ContractAuctionID,
+				Args:       byzcoin.Arguments{{Name: "auction", Value: auctionBuf}},
+			},
+			SignerCounter: []uint64{bct.ct + 1},
+		}},
+	}
+	require.Nil(t, ctx.FillSignersAndSignWith(bct.signer))
+	_, err = bct.cl.AddTransactionAndWait(ctx, 10)
+	if err == nil {
+		bct.ct += 2
+	}
+	return ctx.Instructions[1].DeriveID(""), err
+}
+
+// createLotsAuction spawns a multi-lot auction, the reserve price of every
+// lot is hashed with the salt used by the test auctions.
+func (bct *bcTest) createLotsAuction(t *testing.T, sellAccInstID byzcoin.InstanceID, reserves ...uint64) byzcoin.InstanceID {
+	auction := AuctionData{
+		GoodDescription: "estate",
+		SellerAccount:   sellAccInstID,
+		State:           auctioncore.StateOpen,
+	}
+	for i, reserve := range reserves {
+		auction.Lots = append(auction.Lots, LotData{
+			GoodDescription: fmt.Sprintf("lot %d", i),
+			ReservePrice:    auctioncore.CreateHash("testsalt", reserve),
+			State:           auctioncore.StateOpen,
+		})
+	}
+	auctionBuf, err := protobuf.Encode(&auction)
+	require.Nil(t, err)
+	return bct.createInstance(t, byzcoin.Arguments{{Name: "auction", Value: auctionBuf}})
+}
+
+// addLotBid fetches the bid from the bidder's account and places it on the
+// lot.
+func (bct *bcTest) addLotBid(t *testing.T, auctInstID byzcoin.InstanceID, bidAccInstID byzcoin.InstanceID, lot uint32, bid uint64) error {
+	bidBuf, err := protobuf.Encode(&BidData{BidderAccount: bidAccInstID, Lot: lot})
+	require.Nil(t, err)
+
+	ctx := byzcoin.ClientTransaction{
+		Instructions: []byzcoin.Instruction{{
+			InstanceID: bidAccInstID,
+			Invoke: &byzcoin.Invoke{
+				ContractID: contracts.ContractCoinID,
+				Command:    "fetch",
+				Args:       byzcoin.Arguments{{Name: "coins", Value: auctioncore.EncodeAmount(bid)}},
+			},
+			SignerCounter: []uint64{bct.ct},
+		}, {
+			InstanceID: auctInstID,
+			Invoke: &byzcoin.Invoke{
+				ContractID: ContractAuctionID,
+				Command:    "bid",
+				Args:       byzcoin.Arguments{{Name: "bid", Value: bidBuf}},
+			},
+			SignerCounter: []uint64{bct.ct + 1},
+		}},
+	}
+	require.Nil(t, ctx.FillSignersAndSignWith(bct.signer))
+	_, err = bct.cl.AddTransactionAndWait(ctx, 10)
+	if err == nil {
+		bct.ct += 2
+	}
+	return err
+}
+
+// closeLots closes a multi-lot auction, revealing the reserve prices.
+func (bct *bcTest) closeLots(t *testing.T, auctInstID byzcoin.InstanceID, reserves ...uint64) error {
+	closeLots := CloseLotsData{}
+	for _, reserve := range reserves {
+		closeLots.Lots = append(closeLots.Lots, CloseData{Salt: "testsalt", ReservePrice: reserve})
+	}
+	closeBuf, err := protobuf.Encode(&closeLots)
+	require.Nil(t, err)
+	return bct.invokeAuction(t, auctInstID, "close", byzcoin.Arguments{{Name: "close", Value: closeBuf}})
+}
+
+// sendAs signs the instructions with another signer, whose counter is
+// kept by the caller, and waits for them to be included.
+func (bct *bcTest) sendAs(t *testing.T, signer darc.Signer, ct *uint64, instrs ...byzcoin.Instruction) (byzcoin.ClientTransaction, error) {
+	for i := range instrs {
+		instrs[i].SignerCounter = []uint64{*ct + uint64(i)}
+	}
+	ctx := byzcoin.ClientTransaction{Instructions: instrs}
+	require.Nil(t, ctx.FillSignersAndSignWith(signer))
+	_, err := bct.cl.AddTransactionAndWait(ctx, 10)
+	if err == nil {
+		*ct += uint64(len(instrs))
+	}
+	return ctx, err
+}
+
+// createAsset spawns a value instance owned by the genesis darc.
+func (bct *bcTest) createAsset(t *testing.T, value string) byzcoin.InstanceID {
+	ctx, err := bct.sendAs(t, bct.signer, &bct.ct, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(bct.gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ContractValueID,
+			Args:       byzcoin.Arguments{{Name: "value", Value: []byte(value)}},
+		},
+	})
+	require.Nil(t, err)
+	return ctx.Instructions[0].DeriveID("")
+}
+
+// updateAsset changes the value of the asset, signed by signer.
+func (bct *bcTest) updateAsset(t *testing.T, signer darc.Signer, ct *uint64, asset byzcoin.InstanceID, value string) error {
+	_, err := bct.sendAs(t, signer, ct, byzcoin.Instruction{
+		InstanceID: asset,
+		Invoke: &byzcoin.Invoke{
+			ContractID: contracts.ContractValueID,
+			Command:    "update",
+			Args:       byzcoin.Arguments{{Name: "value", Value: []byte(value)}},
+		},
+	})
+	return err
+}
+
+// instanceDarc returns the darc controlling the instance.
+func (bct *bcTest) instanceDarc(t *testing.T, instID byzcoin.InstanceID) darc.ID {
+	reply, err := bct.cl.GetProof(instID.Slice())
+	require.Nil(t, err)
+	_, _, _, darcID, err := reply.Proof.KeyValue()
+	require.Nil(t, err)
+	return darcID
+}
+
+// createOwnedAccount spawns a darc owned by owner and a coin account with
+// amount coins under it. The counter of owner starts at 1.
+func (bct *bcTest) createOwnedAccount(t *testing.T, owner darc.Signer, ct *uint64, amount uint64) (byzcoin.InstanceID, darc.ID) {
+	rules := darc.InitRules([]darc.Identity{owner.Identity()}, []darc.Identity{owner.Identity()})
+	ownerExpr := expression.Expr(owner.Identity().String())
+	for _, action := range []string{"spawn:coin", "invoke:coin.mint", "invoke:coin.fetch", "delete:coin", "invoke:value.update"} {
+		require.Nil(t, rules.AddRule(darc.Action(action), ownerExpr))
+	}
+	d := darc.NewDarc(rules, []byte("account of "+owner.Identity().String()))
+	darcBuf, err := d.ToProto()
+	require.Nil(t, err)
+	_, err = bct.sendAs(t, bct.signer, &bct.ct, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(bct.gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: byzcoin.ContractDarcID,
+			Args:       byzcoin.Arguments{{Name: "darc", Value: darcBuf}},
+		},
+	})
+	require.Nil(t, err)
+
+	ctx, err := bct.sendAs(t, owner, ct, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(d.GetBaseID()),
+		Spawn:      &byzcoin.Spawn{ContractID: contracts.ContractCoinID},
+	})
+	require.Nil(t, err)
+	accInstID := ctx.Instructions[0].DeriveID("")
+	_, err = bct.sendAs(t, owner, ct, byzcoin.Instruction{
+		InstanceID: accInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: contracts.ContractCoinID,
+			Command:    "mint",
+			Args:       byzcoin.Arguments{{Name: "coins", Value: auctioncore.EncodeAmount(amount)}},
+		},
+	})
+	require.Nil(t, err)
+	return accInstID, d.GetBaseID()
+}
+
+// createAuctionWithAsset spawns a forward auction selling the asset, signed
+// by the signer of the test.
+func (bct *bcTest) createAuctionWithAsset(t *testing.T, sellAccInstID byzcoin.InstanceID, asset byzcoin.InstanceID) (byzcoin.InstanceID, error) {
+	auctionBuf, err := protobuf.Encode(&AuctionData{
+		GoodDescription: "asset",
+		SellerAccount:   sellAccInstID,
+		State:           auctioncore.StateOpen,
+		ReservePrice:    auctioncore.CreateHash("testsalt", 0),
+		Asset:           asset,
+	})
+	require.Nil(t, err)
+	ctx, err := bct.sendAs(t, bct.signer, &bct.ct, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(bct.gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractAuctionID,
+			Args:       byzcoin.Arguments{{Name: "auction", Value: auctionBuf}},
+		},
+	})
+	return ctx.Instructions[0].DeriveID(""), err
+}
+
+// bidAs places a bid fetched from an account owned by owner.
+func (bct *bcTest) bidAs(t *testing.T, owner darc.Signer, ct *uint64, auctInstID byzcoin.InstanceID, bidAccInstID byzcoin.InstanceID, bid uint64) error {
+	bidBuf, err := protobuf.Encode(&BidData{BidderAccount: bidAccInstID})
+	require.Nil(t, err)
+	_, err = bct.sendAs(t, owner, ct, byzcoin.Instruction{
+		InstanceID: bidAccInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: contracts.ContractCoinID,
+			Command:    "fetch",
+			Args:       byzcoin.Arguments{{Name: "coins", Value: auctioncore.EncodeAmount(bid)}},
+		},
+	}, byzcoin.Instruction{
+		InstanceID: auctInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractAuctionID,
+			Command:    "bid",
+			Args:       byzcoin.Arguments{{Name: "bid", Value: bidBuf}},
+		},
+	})
+	return err
+}
+
+// addOffer places the bid of a supplier in a reverse auction. No coins are
+// fetched from the supplier.
+func (bct *bcTest) addOffer(t *testing.T, auctInstID byzcoin.InstanceID, supAccInstID byzcoin.InstanceID, offer uint64) error {
+	bidBuf, err := protobuf.Encode(&BidData{BidderAccount: supAccInstID, Bid: offer})
+	require.Nil(t, err)
+	return bct.invokeAuction(t, auctInstID, "bid", byzcoin.Arguments{{Name: "bid", Value: bidBuf}})
+}
+
+// invokeAuction sends a single command to the auction.
+func (bct *bcTest) invokeAuction(t *testing.T, auctInstID byzcoin.InstanceID, command string, args byzcoin.Arguments) error {
+	ctx := byzcoin.ClientTransaction{
+		Instructions: []byzcoin.Instruction{{
+			InstanceID: auctInstID,
+			Invoke: &byzcoin.Invoke{
+				ContractID: ContractAuctionID,
+				Command:    command,
+				Args:       args,
+			},
+			SignerCounter: []uint64{bct.ct},
+		}},
+	}
+	require.Nil(t, ctx.FillSignersAndSignWith(bct.signer))
+	_, err := bct.cl.AddTransactionAndWait(ctx, 10)
+	if err == nil {
+		bct.ct++
+	}
+	return err
+}
+
+// createAllowList spawns a darc whose sign rule lets the identities bid,
+// the signer of the test can evolve it.
+func (bct *bcTest) createAllowList(t *testing.T, ids ...darc.Identity) *darc.Darc {
+	rules := darc.InitRules([]darc.Identity{bct.signer.Identity()}, ids)
+	require.Nil(t, rules.AddRule("invoke:"+byzcoin.ContractDarcID+".evolve", expression.Expr(bct.signer.Identity().String())))
+	d := darc.NewDarc(rules, []byte("allow-list"))
+	darcBuf, err := d.ToProto()
+	require.Nil(t, err)
+
+	ctx := byzcoin.ClientTransaction{
+		Instructions: []byzcoin.Instruction{{
+			InstanceID: byzcoin.NewInstanceID(bct.gDarc.GetBaseID()),
+			Spawn: &byzcoin.Spawn{
+				ContractID: byzcoin.ContractDarcID,
+				Args:       byzcoin.Arguments{{Name: "darc", Value: darcBuf}},
+			},
+			SignerCounter: []uint64{bct.ct},
+		}},
+	}
+	require.Nil(t, ctx.FillSignersAndSignWith(bct.signer))
+	_, err = bct.cl.AddTransactionAndWait(ctx, 10)
+	require.Nil(t, err)
+	bct.ct++
+	return d
+}
+
+// evolveAllowList replaces the identities allowed to bid.
+func (bct *bcTest) evolveAllowList(t *testing.T, d *darc.Darc, ids ...darc.Identity) *darc.Darc {
+	newD := d.Copy()
+	require.Nil(t, newD.EvolveFrom(d))
+	require.Nil(t, newD.Rules.UpdateSign(darc.InitRules(nil, ids).GetSignExpr()))
+	darcBuf, err := newD.ToProto()
+	require.Nil(t, err)
+
+	ctx := byzcoin.ClientTransaction{
+		Instructions: []byzcoin.Instruction{{
+			InstanceID: byzcoin.NewInstanceID(d.GetBaseID()),
+			Invoke: &byzcoin.Invoke{
+				ContractID: byzcoin.ContractDarcID,
+				Command:    "evolve",
+				Args:       byzcoin.Arguments{{Name: "darc", Value: darcBuf}},
+			},
+			SignerCounter: []uint64{bct.ct},
+		}},
+	}
+	require.Nil(t, ctx.FillSignersAndSignWith(bct.signer))
+	_, err = bct.cl.AddTransactionAndWait(ctx, 10)
+	require.Nil(t, err)
+	bct.ct++
+	return newD
+}
+
+// createAuctionWithAllowList spawns a forward auction restricted to the
+// bidders of the allow-list.
+func (bct *bcTest) createAuctionWithAllowList(t *testing.T, sellAccInstID byzcoin.InstanceID, allowList darc.ID) byzcoin.InstanceID {
+	auctionBuf, err := protobuf.Encode(&AuctionData{
+		GoodDescription: "good",
+		SellerAccount:   sellAccInstID,
+		State:           auctioncore.StateOpen,
+		ReservePrice:    auctioncore.CreateHash("testsalt", 0),
+		AllowList:       allowList,
+	})
+	require.Nil(t, err)
+	return bct.createInstance(t, byzcoin.Arguments{{Name: "auction", Value: auctionBuf}})
+}
+
+// coinBalance returns the coins stored in an account.
+func (bct *bcTest) coinBalance(t *testing.T, accInstID byzcoin.InstanceID) uint64 {
+	reply, err := bct.cl.GetProof(accInstID.Slice())
+	require.Nil(t, err)
+	_, val, _, _, err := reply.Proof.KeyValue()
+	require.Nil(t, err)
+
+	coin := byzcoin.Coin{}
+	require.Nil(t, protobuf.Decode(val, &coin))
+	return coin.Value
+}
+
 func (bct *bcTest) verifCreateAuction(t *testing.T, auctInstID byzcoin.InstanceID, auction AuctionData) AuctionData {
 
 	auctS := bct.proofAndDecodeAuction(t, auctInstID)
@@ -423,11 +810,15 @@ func printAuction(auction AuctionData) {
 	fmt.Println("Highest bidder: ", auction.HighestBidder, " with ", auction.HighestBid, "coins")
 }
 
-func createHash(salt string, reservP uint64) string {
-	strReservePrice := strconv.Itoa(int(reservP))
-	h := sha256.New()
-	h.Write([]byte(salt + strReservePrice))
-	hashed := h.Sum(nil)
-	hash := hex.EncodeToString(hashed)
-	return hash
+// createLTS sets up a long-term secret shared by the roster, for the secrets
+// sold by the auctions.
+func (bct *bcTest) createLTS(t *testing.T) *calypso.CreateLTSReply {
+	cc := calypso.NewClient(bct.cl)
+	for _, si := range bct.roster.List {
+		require.Nil(t, cc.Authorise(si, bct.cl.ID))
+	}
+	reply, err := cc.CreateLTS(bct.roster, bct.gDarc.GetBaseID(), []darc.Signer{bct.signer}, []uint64{bct.ct})
+	require.Nil(t, err)
+	bct.ct++
+	return reply
 }
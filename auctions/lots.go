@@ -0,0 +1,140 @@
+package auctions
+
+import (
+	"errors"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+// startLots checks a new multi-lot auction. The lots carry their own bids,
+// so the auction itself is a plain forward auction without bids.
+func startLots(auction AuctionData) error {
+	if auction.Mode != ModeForward || auction.RetractWindow > 0 || auction.Bond > 0 {
+		return errors.New("multi-lot auctions are forward auctions without retraction or bond")
+	}
+	if auction.State != auctioncore.StateOpen || auction.HighestBid != 0 {
+		return errors.New("a new auction must be open and without bids")
+	}
+	for _, lot := range auction.Lots {
+		if lot.State != auctioncore.StateOpen || lot.HighestBid != 0 {
+			return errors.New("a new lot must be open and without bids")
+		}
+	}
+	return nil
+}
+
+// invokeLots handles the commands of a multi-lot auction. Each lot works as
+// a forward auction, the leading bid of a lot is kept in escrow and the
+// previous leader refunded.
+//   - bid: takes a bid on the lot given in BidData.Lot
+//   - close: settles every lot at once, the lots over their reserve price
+//     pay the seller and the others refund their leader
+//   - drop, forceclose: refund the leaders of all the lots and record the
+//     cancellation
+func (c *contractAuction) invokeLots(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, cin []byzcoin.Coin, auction AuctionData, darcID darc.ID) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = cin
+	payouts := auctioncore.Payouts{}
+
+	switch inst.Invoke.Command {
+	case "bid":
+		var bid BidData
+		bid, err = decodeBid(inst)
+		if err != nil {
+			return nil, nil, err
+		}
+		if int(bid.Lot) >= len(auction.Lots) {
+			return nil, nil, errors.New("no such lot")
+		}
+		lot := &auction.Lots[bid.Lot]
+		if lot.State != auctioncore.StateOpen {
+			return nil, nil, auctioncore.ErrAuctionClosed
+		}
+		if bid.BidderAccount == auction.SellerAccount {
+			return nil, nil, auctioncore.ErrSellerBid
+		}
+
+		cout, err = escrowBid(rst, &bid, cin)
+		if err != nil {
+			return nil, nil, err
+		}
+		if bid.Bid == 0 {
+			return nil, nil, auctioncore.ErrZeroBid
+		}
+		if bid.Bid <= lot.HighestBid {
+			return nil, nil, auctioncore.ErrBidTooLow
+		}
+		payouts.Add(lot.HighestBidder, lot.HighestBid)
+		lot.HighestBid = bid.Bid
+		lot.HighestBidder = bid.BidderAccount
+		lot.WinProof = bid.BidderPubKey
+
+	case "close":
+		closeLots := CloseLotsData{}
+		if closeBuf := inst.Invoke.Args.Search("close"); closeBuf != nil {
+			err = protobuf.Decode(closeBuf, &closeLots)
+			if err != nil {
+				return nil, nil, auctioncore.ErrNotClose
+			}
+		}
+
+		auction.State = auctioncore.StateClosed
+		for i := range auction.Lots {
+			lot := &auction.Lots[i]
+			var reservePrice uint64
+			if lot.ReservePrice != "" {
+				if i >= len(closeLots.Lots) {
+					return nil, nil, auctioncore.ErrMissingClose
+				}
+				if !auctioncore.VerifyReserve(lot.ReservePrice, closeLots.Lots[i]) {
+					return nil, nil, auctioncore.ErrReserveVerify
+				}
+				reservePrice = closeLots.Lots[i].ReservePrice
+			}
+			if lot.HighestBid > reservePrice {
+				payouts.Add(auction.SellerAccount, lot.HighestBid)
+				lot.State = auctioncore.StateWClosed
+				auction.State = auctioncore.StateWClosed
+			} else {
+				payouts.Add(lot.HighestBidder, lot.HighestBid)
+				lot.State = auctioncore.StateClosed
+			}
+		}
+
+	case "drop", "forceclose":
+		state := auctioncore.StateDropped
+		if inst.Invoke.Command == "forceclose" {
+			state = auctioncore.StateClosed
+		}
+		for i := range auction.Lots {
+			payouts.Add(auction.Lots[i].HighestBidder, auction.Lots[i].HighestBid)
+			auction.Lots[i].State = state
+		}
+		auction.State = state
+		err = auction.cancel(rst, inst, &payouts)
+		if err != nil {
+			return nil, nil, err
+		}
+
+	default:
+		return nil, nil, errors.New("Auction contract can only bid close forceclose or drop")
+	}
+
+	var payoutsSC []byzcoin.StateChange
+	payoutsSC, err = payouts.StoreCoins(c.contracts, rst)
+	if err != nil {
+		return nil, nil, err
+	}
+	sc = append(sc, payoutsSC...)
+
+	var auctionBuf []byte
+	auctionBuf, err = protobuf.Encode(&auction)
+	if err != nil {
+		return nil, nil, errors.New("encode auction buf sc: " + inst.Invoke.Command)
+	}
+	sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+		ContractAuctionID, auctionBuf, darcID))
+	return
+}
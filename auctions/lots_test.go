@@ -0,0 +1,34 @@
+package auctions
+
+import (
+	"testing"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+)
+
+func TestInvokeLots_UnbackedBid(t *testing.T) {
+	bidder := byzcoin.NewInstanceID([]byte("bidder"))
+	rst := &candleTrie{}
+	rst.setCoin(bidder)
+	auction := AuctionData{State: auctioncore.StateOpen, Lots: []LotData{
+		{State: auctioncore.StateOpen}, {State: auctioncore.StateOpen}}}
+	c := &contractAuction{}
+	coins := []byzcoin.Coin{{Name: contracts.CoinName, Value: 1}}
+
+	// Escrowing one coin cannot bid 50, on any lot
+	for lot := uint32(0); lot < 2; lot++ {
+		_, _, err := c.invokeLots(rst, bidInstruction(t, BidData{BidderAccount: bidder, Lot: lot, Bid: 50}), coins, auction, nil)
+		require.Equal(t, auctioncore.ErrUnbackedBid, err)
+	}
+
+	sc, cout, err := c.invokeLots(rst, bidInstruction(t, BidData{BidderAccount: bidder, Lot: 1}), coins, auction, nil)
+	require.NoError(t, err)
+	require.Empty(t, cout)
+	auction, err = DecodeAuction(sc[len(sc)-1].Value)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), auction.Lots[1].HighestBid)
+	require.Equal(t, uint64(0), auction.Lots[0].HighestBid)
+}
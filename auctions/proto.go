@@ -1,7 +1,10 @@
 package auctions
 
 import (
+	"github.com/dedis/student_19_auctions/auctioncore"
 	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
 )
 
 // PROTOSTART
@@ -11,6 +14,16 @@ import (
 // option java_package = "ch.epfl.dedis.lib.proto";
 // option java_outer_classname = "Auctions";
 
+// Modes of an auction. A forward auction sells a good to the highest
+// bidder. A reverse auction buys from the supplier asking the least, the
+// SellerAccount is then the account of the buyer. A candle auction sells to
+// whoever led at an end block picked at random after the bidding window.
+const (
+	ModeForward = ""
+	ModeReverse = "REVERSE"
+	ModeCandle  = "CANDLE"
+)
+
 // Auction struct
 
 type AuctionData struct {
@@ -21,15 +34,108 @@ type AuctionData struct {
 	HighestBidder   byzcoin.InstanceID
 	State           string
 	WinProof        string
+	Mode            string                   `protobuf:"opt"`
+	Budget          uint64                   `protobuf:"opt"` // escrowed by the buyer of a reverse auction
+	StartIndex      uint64                   `protobuf:"opt"` // block the auction was spawned in
+	EndIndex        uint64                   `protobuf:"opt"` // last block accepting bids
+	Leaders         []LeaderData             `protobuf:"opt"`
+	CandleEnd       uint64                   `protobuf:"opt"` // end block drawn when closing a candle auction
+	ByzCoinID       skipchain.SkipBlockID    `protobuf:"opt"` // ledger of a candle auction, whose blocks draw the end
+	Registry        byzcoin.InstanceID       `protobuf:"opt"` // auction house the auction is listed in, if any
+	RegistryIndex   uint64                   `protobuf:"opt"`
+	Category        string                   `protobuf:"opt"`
+	AllowList       darc.ID                  `protobuf:"opt"` // darc whose sign rule the bidders must satisfy, if any
+	RetractWindow   uint64                   `protobuf:"opt"` // blocks a leading bid can be retracted for, 0 if it cannot
+	RetractPenalty  uint64                   `protobuf:"opt"` // paid to the seller out of a retracted bid
+	History         []LeaderData             `protobuf:"opt"` // leading bids still in escrow, the last one leads
+	Bond            uint64                   `protobuf:"opt"` // escrowed by the seller, the cancellation penalty is taken from it
+	CancelPenalty   uint64                   `protobuf:"opt"` // paid to the leading bidder when the seller cancels
+	Cancellation    CancellationData         `protobuf:"opt"`
+	Lots            []LotData                `protobuf:"opt"` // lots of a multi-lot auction, sold in one instance
+	Metadata        auctioncore.ItemMetadata `protobuf:"opt"` // structured description of the good, if any
+	Asset           byzcoin.InstanceID       `protobuf:"opt"` // instance sold by the auction, held in custody until it ends
+	AssetDarc       darc.ID                  `protobuf:"opt"` // darc owning the asset before the auction
+	Custody         darc.ID                  `protobuf:"opt"` // darc holding the asset during the auction
+	Version         uint32                   `protobuf:"opt"` // layout of the data, see AuctionVersion
+}
+
+// LeaderData is the leading bid of a candle auction at the end of a block,
+// or a leading bid of an auction with a retraction window. Its coins stay in
+// escrow until the auction is closed, as it might win.
+type LeaderData struct {
+	Index    uint64
+	Bidder   byzcoin.InstanceID
+	Bid      uint64
+	WinProof string
+}
+
+// CandleSeedData is the argument "seed" of the close of a candle auction.
+// It is the block right after the bidding window and the forward link out of
+// it, signed by the roster of the ledger. The hash of the block draws the
+// end block: it was fixed by the roster after the bids, and it is the same
+// whoever closes the auction, whenever.
+type CandleSeedData struct {
+	Block skipchain.SkipBlock
+	Link  skipchain.ForwardLink
+}
+
+// LotData is a lot of a multi-lot auction. Each lot has its own reserve,
+// leading bid and state, and the lots are settled together by close.
+type LotData struct {
+	GoodDescription string
+	ReservePrice    string `protobuf:"opt"`
+	HighestBid      uint64
+	HighestBidder   byzcoin.InstanceID
+	State           string
+	WinProof        string
+}
+
+// CloseLotsData is the argument "close" of a multi-lot auction. It reveals
+// the reserve price of every lot, in the order of the lots. The entries of
+// the lots without reserve price are ignored.
+type CloseLotsData struct {
+	Lots []CloseData
+}
+
+// CancelData is the optional argument "cancel" of a "drop" instruction.
+type CancelData struct {
+	Reason string
+}
+
+// CancellationData records why the seller dropped the auction and what was
+// paid out of its escrow.
+type CancellationData struct {
+	Reason  string
+	Payouts []auctioncore.PayoutData
 }
 
-type BidData struct {
-	BidderAccount byzcoin.InstanceID
-	BidderPubKey  string
-	Bid           uint64
+// GetAuction asks a conode for an auction of the ledger ByzCoinID.
+type GetAuction struct {
+	ByzCoinID skipchain.SkipBlockID
+	AuctionID byzcoin.InstanceID
 }
 
-type CloseData struct {
-	Salt         string
-	ReservePrice uint64
+// GetAuctionReply holds the auction with the proof of its instance.
+type GetAuctionReply struct {
+	Proof   byzcoin.Proof
+	Auction AuctionData
 }
+
+// GetOutcome asks a conode for the result of an auction.
+type GetOutcome struct {
+	ByzCoinID skipchain.SkipBlockID
+	AuctionID byzcoin.InstanceID
+}
+
+// GetOutcomeReply holds the result of the auction, and of each of its lots
+// for a multi-lot auction, with the proof of the auction they are read from.
+type GetOutcomeReply struct {
+	Proof   byzcoin.Proof
+	Outcome auctioncore.OutcomeData
+	Lots    []auctioncore.OutcomeData
+}
+
+// BidData and CloseData are shared with the other auction contracts.
+type BidData = auctioncore.BidData
+
+type CloseData = auctioncore.CloseData
@@ -0,0 +1,128 @@
+package auctions
+
+import (
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+)
+
+// GetAuction returns the auction with the proof of its instance.
+func (s *Service) GetAuction(req *GetAuction) (*GetAuctionReply, error) {
+	proof, err := auctioncore.ProveInstance(s.byzService(), req.ByzCoinID, req.AuctionID)
+	if err != nil {
+		return nil, err
+	}
+	auction, err := auctionFromProof(proof, req.ByzCoinID, req.AuctionID)
+	if err != nil {
+		return nil, err
+	}
+	return &GetAuctionReply{Proof: proof, Auction: auction}, nil
+}
+
+// GetOutcome returns the result of the auction with the proof of its
+// instance.
+func (s *Service) GetOutcome(req *GetOutcome) (*GetOutcomeReply, error) {
+	proof, err := auctioncore.ProveInstance(s.byzService(), req.ByzCoinID, req.AuctionID)
+	if err != nil {
+		return nil, err
+	}
+	auction, err := auctionFromProof(proof, req.ByzCoinID, req.AuctionID)
+	if err != nil {
+		return nil, err
+	}
+	reply := &GetOutcomeReply{Proof: proof}
+	reply.Outcome, reply.Lots = auction.Outcome()
+	return reply, nil
+}
+
+// auctionFromProof verifies the proof and decodes the auction it holds.
+func auctionFromProof(proof byzcoin.Proof, bcID skipchain.SkipBlockID, auctInstID byzcoin.InstanceID) (AuctionData, error) {
+	val, err := auctioncore.ValueFromProof(proof, bcID, auctInstID, ContractAuctionID)
+	if err != nil {
+		return AuctionData{}, err
+	}
+	return DecodeAuction(val)
+}
+
+// Outcome returns the result of the auction and, for a multi-lot auction,
+// of every lot. In a reverse auction the winner is the supplier and the
+// price what the buyer pays.
+func (a *AuctionData) Outcome() (auctioncore.OutcomeData, []auctioncore.OutcomeData) {
+	outcome := auctioncore.OutcomeData{State: a.State}
+	if a.State == auctioncore.StateWClosed {
+		outcome.Winner = a.HighestBidder
+		outcome.Price = a.HighestBid
+	}
+	var lots []auctioncore.OutcomeData
+	for _, lot := range a.Lots {
+		lotOutcome := auctioncore.OutcomeData{State: lot.State}
+		if lot.State == auctioncore.StateWClosed {
+			lotOutcome.Winner = lot.HighestBidder
+			lotOutcome.Price = lot.HighestBid
+		}
+		lots = append(lots, lotOutcome)
+	}
+	return outcome, lots
+}
+
+// QueryClient reads the auctions through the auctions service of the
+// conodes. The replies are only trusted once their proof is verified
+// against the ledger.
+type QueryClient struct {
+	*onet.Client
+	Roster    *onet.Roster
+	ByzCoinID skipchain.SkipBlockID
+}
+
+// NewQueryClient returns a client for the ledger bcID run by the roster.
+func NewQueryClient(roster *onet.Roster, bcID skipchain.SkipBlockID) *QueryClient {
+	return &QueryClient{
+		Client:    onet.NewClient(cothority.Suite, ServiceName),
+		Roster:    roster,
+		ByzCoinID: bcID,
+	}
+}
+
+// GetAuction returns the auction with the proof it was read from.
+func (c *QueryClient) GetAuction(auctInstID byzcoin.InstanceID) (AuctionData, byzcoin.Proof, error) {
+	reply := &GetAuctionReply{}
+	err := c.SendProtobuf(c.Roster.RandomServerIdentity(), &GetAuction{ByzCoinID: c.ByzCoinID, AuctionID: auctInstID}, reply)
+	if err != nil {
+		return AuctionData{}, byzcoin.Proof{}, err
+	}
+	auction, err := auctionFromProof(reply.Proof, c.ByzCoinID, auctInstID)
+	if err != nil {
+		return AuctionData{}, byzcoin.Proof{}, err
+	}
+	err = auctioncore.CheckReply(&auction, &reply.Auction)
+	if err != nil {
+		return AuctionData{}, byzcoin.Proof{}, err
+	}
+	return auction, reply.Proof, nil
+}
+
+// GetOutcome returns the result of the auction and of its lots, with the
+// proof of the auction they were read from.
+func (c *QueryClient) GetOutcome(auctInstID byzcoin.InstanceID) (auctioncore.OutcomeData, []auctioncore.OutcomeData, byzcoin.Proof, error) {
+	reply := &GetOutcomeReply{}
+	err := c.SendProtobuf(c.Roster.RandomServerIdentity(), &GetOutcome{ByzCoinID: c.ByzCoinID, AuctionID: auctInstID}, reply)
+	if err != nil {
+		return auctioncore.OutcomeData{}, nil, byzcoin.Proof{}, err
+	}
+	auction, err := auctionFromProof(reply.Proof, c.ByzCoinID, auctInstID)
+	if err != nil {
+		return auctioncore.OutcomeData{}, nil, byzcoin.Proof{}, err
+	}
+	outcome, lots := auction.Outcome()
+	type outcomes struct {
+		Outcome auctioncore.OutcomeData
+		Lots    []auctioncore.OutcomeData
+	}
+	err = auctioncore.CheckReply(&outcomes{outcome, lots}, &outcomes{reply.Outcome, reply.Lots})
+	if err != nil {
+		return auctioncore.OutcomeData{}, nil, byzcoin.Proof{}, err
+	}
+	return outcome, lots, reply.Proof, nil
+}
@@ -0,0 +1,43 @@
+package auctions
+
+import (
+	"testing"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+)
+
+func TestQueryClient(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	sellAccInstID := bct.createSellerAccount(t)
+	bidAccInstID := bct.createBidderAccount(t, 100)
+	auctInstID, _ := bct.createAuction(t, sellAccInstID, "bananas")
+	_, err := bct.addBid(t, auctInstID, bidAccInstID, 30)
+	require.NoError(t, err)
+
+	qc := NewQueryClient(bct.roster, bct.cl.ID)
+	auction, proof, err := qc.GetAuction(auctInstID)
+	require.NoError(t, err)
+	require.Equal(t, bct.proofAndDecodeAuction(t, auctInstID).GoodDescription, auction.GoodDescription)
+	require.Equal(t, uint64(30), auction.HighestBid)
+	require.NoError(t, proof.Verify(bct.cl.ID))
+
+	outcome, lots, _, err := qc.GetOutcome(auctInstID)
+	require.NoError(t, err)
+	require.Equal(t, auctioncore.OutcomeData{State: auctioncore.StateOpen}, outcome)
+	require.Empty(t, lots)
+
+	require.NoError(t, bct.closeAuction(t, auctInstID))
+	outcome, _, _, err = qc.GetOutcome(auctInstID)
+	require.NoError(t, err)
+	require.Equal(t, auctioncore.OutcomeData{State: auctioncore.StateWClosed, Winner: bidAccInstID, Price: 30}, outcome)
+
+	// A proof only vouches for its own instance
+	_, err = auctionFromProof(proof, bct.cl.ID, sellAccInstID)
+	require.Error(t, err)
+	_, _, err = qc.GetAuction(byzcoin.NewInstanceID([]byte("nothing")))
+	require.Error(t, err)
+}
@@ -0,0 +1,211 @@
+package auctions
+
+import (
+	"errors"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+// startRetractable checks a new auction with a retraction window. Such an
+// auction needs an end to know when it is too late to retract.
+func startRetractable(rst byzcoin.ReadOnlyStateTrie, auction *AuctionData) error {
+	if auction.Mode != ModeForward {
+		return errors.New("only forward auctions can have a retraction window")
+	}
+	if auction.State != auctioncore.StateOpen || auction.HighestBid != 0 || len(auction.History) != 0 {
+		return errors.New("a new auction must be open and without bids")
+	}
+	index, err := auctioncore.BlockIndex(rst)
+	if err != nil {
+		return err
+	}
+	if auction.EndIndex < index {
+		return errors.New("the bidding window is already over")
+	}
+	auction.StartIndex = index
+	return nil
+}
+
+// invokeRetractable handles the commands of a forward auction with a
+// retraction window. Every leading bid stays in escrow in History until the
+// auction is closed, so that the previous leader can be restored when the
+// leading bid is retracted. Bids are taken until EndIndex.
+//   - bid: takes a bid higher than the current leader
+//   - retract: removes the leading bid, signed by the owner of its account,
+//     within RetractWindow blocks of the bid and at least RetractWindow
+//     blocks before EndIndex. RetractPenalty goes to the seller.
+//   - close: pays the seller and refunds the others
+//   - drop, forceclose: refund all the bids and apply the cancellation
+//     policy
+func (c *contractAuction) invokeRetractable(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, cin []byzcoin.Coin, auction AuctionData, darcID darc.ID) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = cin
+	payouts := auctioncore.Payouts{}
+
+	var index uint64
+	index, err = auctioncore.BlockIndex(rst)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch inst.Invoke.Command {
+	case "bid":
+		if index > auction.EndIndex {
+			return nil, nil, auctioncore.ErrAuctionClosed
+		}
+		var bid BidData
+		bid, err = decodeBid(inst)
+		if err != nil {
+			return nil, nil, err
+		}
+		if bid.BidderAccount == auction.SellerAccount {
+			return nil, nil, auctioncore.ErrSellerBid
+		}
+
+		cout, err = escrowBid(rst, &bid, cin)
+		if err != nil {
+			return nil, nil, err
+		}
+		if bid.Bid == 0 {
+			return nil, nil, auctioncore.ErrZeroBid
+		}
+		if bid.Bid <= auction.HighestBid {
+			return nil, nil, auctioncore.ErrBidTooLow
+		}
+		auction.History = append(auction.History,
+			LeaderData{Index: index, Bidder: bid.BidderAccount, Bid: bid.Bid, WinProof: bid.BidderPubKey})
+		auction.restoreLeader()
+
+	case "retract":
+		var bid BidData
+		bid, err = decodeBid(inst)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = auctioncore.VerifyOwner(rst, inst, bid.BidderAccount)
+		if err != nil {
+			return nil, nil, errors.New("retraction not signed by the owner of the bidder account: " + err.Error())
+		}
+		err = auction.retract(index, bid.BidderAccount, &payouts)
+		if err != nil {
+			return nil, nil, err
+		}
+
+	case "close":
+		var reservePrice uint64
+		if auction.ReservePrice != "" {
+			closeBuf := inst.Invoke.Args.Search("close")
+			if closeBuf == nil {
+				return nil, nil, auctioncore.ErrMissingClose
+			}
+			closedata := CloseData{}
+			err = protobuf.Decode(closeBuf, &closedata)
+			if err != nil {
+				return nil, nil, auctioncore.ErrNotClose
+			}
+			if !auctioncore.VerifyReserve(auction.ReservePrice, closedata) {
+				return nil, nil, auctioncore.ErrReserveVerify
+			}
+			reservePrice = closedata.ReservePrice
+		}
+
+		won := auction.HighestBid > reservePrice
+		last := len(auction.History) - 1
+		for i, l := range auction.History {
+			if won && i == last {
+				payouts.Add(auction.SellerAccount, l.Bid)
+			} else {
+				payouts.Add(l.Bidder, l.Bid)
+			}
+		}
+		auction.State = auctioncore.StateClosed
+		if won {
+			auction.State = auctioncore.StateWClosed
+		}
+		auction.releaseBond(&payouts)
+
+	case "drop", "forceclose":
+		for _, l := range auction.History {
+			payouts.Add(l.Bidder, l.Bid)
+		}
+		err = auction.cancel(rst, inst, &payouts)
+		if err != nil {
+			return nil, nil, err
+		}
+		auction.State = auctioncore.StateDropped
+		if inst.Invoke.Command == "forceclose" {
+			auction.State = auctioncore.StateClosed
+		}
+
+	default:
+		return nil, nil, errors.New("Auction contract can only bid retract close forceclose or drop")
+	}
+
+	var payoutsSC []byzcoin.StateChange
+	payoutsSC, err = payouts.StoreCoins(c.contracts, rst)
+	if err != nil {
+		return nil, nil, err
+	}
+	sc = append(sc, payoutsSC...)
+
+	var auctionBuf []byte
+	auctionBuf, err = protobuf.Encode(&auction)
+	if err != nil {
+		return nil, nil, errors.New("encode auction buf sc: " + inst.Invoke.Command)
+	}
+	sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+		ContractAuctionID, auctionBuf, darcID))
+	return
+}
+
+// retract removes the leading bid of bidder at the block index, pays the
+// penalty to the seller and refunds the rest of the bid.
+func (a *AuctionData) retract(index uint64, bidder byzcoin.InstanceID, payouts *auctioncore.Payouts) error {
+	last := len(a.History) - 1
+	if last < 0 || a.History[last].Bidder != bidder {
+		return errors.New("only the leading bid can be retracted")
+	}
+	leader := a.History[last]
+	if index > leader.Index+a.RetractWindow {
+		return errors.New("the retraction window of the bid is over")
+	}
+	if index+a.RetractWindow > a.EndIndex {
+		return errors.New("the auction is too close to its end to retract")
+	}
+
+	penalty := a.RetractPenalty
+	if penalty > leader.Bid {
+		penalty = leader.Bid
+	}
+	payouts.Add(a.SellerAccount, penalty)
+	payouts.Add(bidder, leader.Bid-penalty)
+	a.History = a.History[:last]
+	a.restoreLeader()
+	return nil
+}
+
+// restoreLeader makes the last bid of the history the leading bid.
+func (a *AuctionData) restoreLeader() {
+	a.HighestBid = 0
+	a.HighestBidder = byzcoin.InstanceID{}
+	a.WinProof = ""
+	if last := len(a.History) - 1; last >= 0 {
+		a.HighestBid = a.History[last].Bid
+		a.HighestBidder = a.History[last].Bidder
+		a.WinProof = a.History[last].WinProof
+	}
+}
+
+func decodeBid(inst byzcoin.Instruction) (BidData, error) {
+	bid := BidData{}
+	bidBuf := inst.Invoke.Args.Search("bid")
+	if bidBuf == nil {
+		return bid, auctioncore.ErrMissingBid
+	}
+	if protobuf.Decode(bidBuf, &bid) != nil {
+		return bid, auctioncore.ErrNotBid
+	}
+	return bid, nil
+}
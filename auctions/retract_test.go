@@ -0,0 +1,80 @@
+package auctions
+
+import (
+	"testing"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+)
+
+func TestStartRetractable(t *testing.T) {
+	rst := &candleTrie{index: 4}
+	auction := AuctionData{State: auctioncore.StateOpen, RetractWindow: 2, EndIndex: 9}
+
+	require.NoError(t, startRetractable(rst, &auction))
+	require.Equal(t, uint64(5), auction.StartIndex)
+
+	auction.Mode = ModeCandle
+	require.Error(t, startRetractable(rst, &auction))
+
+	auction.Mode = ModeForward
+	auction.EndIndex = 4
+	require.Error(t, startRetractable(rst, &auction))
+}
+
+func TestAuctionData_Retract(t *testing.T) {
+	seller := byzcoin.NewInstanceID([]byte("seller"))
+	a := byzcoin.NewInstanceID([]byte("a"))
+	b := byzcoin.NewInstanceID([]byte("b"))
+	auction := AuctionData{SellerAccount: seller, RetractWindow: 2, RetractPenalty: 3, EndIndex: 20,
+		History: []LeaderData{{Index: 5, Bidder: a, Bid: 10}, {Index: 6, Bidder: b, Bid: 100, WinProof: "b"}}}
+	auction.restoreLeader()
+	require.Equal(t, b, auction.HighestBidder)
+
+	payouts := auctioncore.Payouts{}
+	require.Error(t, auction.retract(7, a, &payouts))
+	require.Error(t, auction.retract(9, b, &payouts))
+
+	// Too close to the end
+	late := auction
+	late.EndIndex = 9
+	require.Error(t, late.retract(8, b, &payouts))
+
+	require.NoError(t, auction.retract(8, b, &payouts))
+	require.Equal(t, uint64(3), payouts.Amount(seller))
+	require.Equal(t, uint64(97), payouts.Amount(b))
+	require.Equal(t, a, auction.HighestBidder)
+	require.Equal(t, uint64(10), auction.HighestBid)
+	require.Equal(t, "", auction.WinProof)
+
+	// The penalty cannot be more than the bid
+	auction.RetractPenalty = 50
+	require.NoError(t, auction.retract(7, a, &payouts))
+	require.Equal(t, uint64(13), payouts.Amount(seller))
+	require.Equal(t, uint64(0), payouts.Amount(a))
+	require.Equal(t, byzcoin.InstanceID{}, auction.HighestBidder)
+	require.Equal(t, uint64(0), auction.HighestBid)
+	require.Error(t, auction.retract(7, a, &payouts))
+}
+
+func TestInvokeRetractable_UnbackedBid(t *testing.T) {
+	bidder := byzcoin.NewInstanceID([]byte("bidder"))
+	rst := &candleTrie{index: 4}
+	rst.setCoin(bidder)
+	auction := AuctionData{State: auctioncore.StateOpen, RetractWindow: 2, StartIndex: 5, EndIndex: 9}
+	c := &contractAuction{}
+	coins := []byzcoin.Coin{{Name: contracts.CoinName, Value: 1}}
+
+	// Escrowing one coin cannot bid 50, to be refunded on retraction
+	_, _, err := c.invokeRetractable(rst, bidInstruction(t, BidData{BidderAccount: bidder, Bid: 50}), coins, auction, nil)
+	require.Equal(t, auctioncore.ErrUnbackedBid, err)
+
+	sc, cout, err := c.invokeRetractable(rst, bidInstruction(t, BidData{BidderAccount: bidder}), coins, auction, nil)
+	require.NoError(t, err)
+	require.Empty(t, cout)
+	auction, err = DecodeAuction(sc[len(sc)-1].Value)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), auction.HighestBid)
+}
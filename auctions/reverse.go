@@ -0,0 +1,165 @@
+package auctions
+
+import (
+	"errors"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+)
+
+// escrowBudget checks a new reverse auction and takes its budget out of the
+// coins given to the spawn instruction, fetched from the buyer's account.
+func escrowBudget(rst byzcoin.ReadOnlyStateTrie, auction AuctionData, cin []byzcoin.Coin) (cout []byzcoin.Coin, err error) {
+	if auction.Budget == 0 {
+		return nil, errors.New("a reverse auction needs a budget")
+	}
+	if auction.State != auctioncore.StateOpen || auction.HighestBid != 0 {
+		return nil, errors.New("a new auction must be open and without bids")
+	}
+	var escrowed uint64
+	escrowed, cout, err = auctioncore.CollectCoins(rst, auction.SellerAccount, cin)
+	if err != nil {
+		return nil, err
+	}
+	if escrowed != auction.Budget {
+		return nil, auctioncore.ErrEscrowMismatch
+	}
+	return cout, nil
+}
+
+// invokeReverse handles the commands of a reverse auction. It has the same
+// lifecycle as the forward auction, but the suppliers bid down and do not
+// escrow anything, so an offer must be signed by the owner of the supplier
+// account: HighestBid and HighestBidder hold the lowest bid, and
+// ReservePrice hides the ceiling the buyer is willing to pay.
+//   - bid: takes a supplier's bid, lower than the current one and the budget
+//   - close: pays the winner its bid if it is at or below the ceiling, and
+//     the rest of the budget back to the buyer
+//   - drop, forceclose: refund the whole budget to the buyer and record the
+//     cancellation
+func (c *contractAuction) invokeReverse(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, cin []byzcoin.Coin, auction AuctionData, darcID darc.ID) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = cin
+	payouts := auctioncore.Payouts{}
+
+	switch inst.Invoke.Command {
+	case "bid":
+		bidBuf := inst.Invoke.Args.Search("bid")
+		if bidBuf == nil {
+			return nil, nil, auctioncore.ErrMissingBid
+		}
+		bid := BidData{}
+		err = protobuf.Decode(bidBuf, &bid)
+		if err != nil {
+			return nil, nil, auctioncore.ErrNotBid
+		}
+		if bid.BidderAccount == auction.SellerAccount {
+			return nil, nil, auctioncore.ErrSellerBid
+		}
+		err = auctioncore.VerifyOwner(rst, inst, bid.BidderAccount)
+		if err != nil {
+			return nil, nil, errors.New("offer not signed by the owner of the supplier account: " + err.Error())
+		}
+		if bid.Bid == 0 {
+			return nil, nil, auctioncore.ErrZeroBid
+		}
+		if bid.Bid > auction.Budget || (auction.HighestBid > 0 && bid.Bid >= auction.HighestBid) {
+			return nil, nil, auctioncore.ErrBidTooHigh
+		}
+
+		//The supplier is paid in the coins of the budget, and does not
+		//escrow anything
+		err = checkSameCoin(rst, auction.SellerAccount, bid.BidderAccount)
+		if err != nil {
+			return nil, nil, err
+		}
+		var escrowed uint64
+		escrowed, cout, err = auctioncore.CollectCoins(rst, bid.BidderAccount, cin)
+		if err != nil {
+			return nil, nil, err
+		}
+		if escrowed != 0 {
+			return nil, nil, auctioncore.ErrEscrowMismatch
+		}
+
+		auction.HighestBid = bid.Bid
+		auction.HighestBidder = bid.BidderAccount
+		auction.WinProof = bid.BidderPubKey
+
+	case "close":
+		ceiling := auction.Budget
+		if auction.ReservePrice != "" {
+			closeBuf := inst.Invoke.Args.Search("close")
+			if closeBuf == nil {
+				return nil, nil, auctioncore.ErrMissingClose
+			}
+			closedata := CloseData{}
+			err = protobuf.Decode(closeBuf, &closedata)
+			if err != nil {
+				return nil, nil, auctioncore.ErrNotClose
+			}
+			if !auctioncore.VerifyReserve(auction.ReservePrice, closedata) {
+				return nil, nil, auctioncore.ErrReserveVerify
+			}
+			if closedata.ReservePrice < ceiling {
+				ceiling = closedata.ReservePrice
+			}
+		}
+
+		if auction.HighestBid > 0 && auction.HighestBid <= ceiling {
+			payouts.Add(auction.HighestBidder, auction.HighestBid)
+			payouts.Add(auction.SellerAccount, auction.Budget-auction.HighestBid)
+			auction.State = auctioncore.StateWClosed
+		} else {
+			//As for the forward auction, the budget stays in escrow
+			//until the auction is dropped
+			log.LLvl4("Asked closing without a bid under the ceiling...")
+		}
+
+	case "drop", "forceclose":
+		payouts.Add(auction.SellerAccount, auction.Budget)
+		err = auction.cancel(rst, inst, &payouts)
+		if err != nil {
+			return nil, nil, err
+		}
+		auction.State = auctioncore.StateDropped
+		if inst.Invoke.Command == "forceclose" {
+			auction.State = auctioncore.StateClosed
+		}
+
+	default:
+		return nil, nil, errors.New("Auction contract can only bid close forceclose or drop")
+	}
+
+	sc, err = payouts.StoreCoins(c.contracts, rst)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var auctionBuf []byte
+	auctionBuf, err = protobuf.Encode(&auction)
+	if err != nil {
+		return nil, nil, errors.New("encode auction buf sc: " + inst.Invoke.Command)
+	}
+	sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+		ContractAuctionID, auctionBuf, darcID))
+	return
+}
+
+// checkSameCoin verifies that both accounts hold the same type of coin.
+func checkSameCoin(rst byzcoin.ReadOnlyStateTrie, a, b byzcoin.InstanceID) error {
+	coinA, err := auctioncore.GetCoin(rst, a)
+	if err != nil {
+		return err
+	}
+	coinB, err := auctioncore.GetCoin(rst, b)
+	if err != nil {
+		return err
+	}
+	if !coinA.Name.Equal(coinB.Name) {
+		return errors.New("accounts hold different coins")
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package auctions
+
+import (
+	"errors"
+
+	"go.dedis.ch/protobuf"
+)
+
+// AuctionVersion is the layout of AuctionData written by this code.
+// Version 0 are the auctions stored before the field was added, they only
+// lack optional fields and decode as they are.
+const AuctionVersion = 1
+
+// DecodeAuction decodes an auction stored in any layout and upgrades it to
+// the newest one. The "migrate" command stores the upgraded auction.
+func DecodeAuction(buf []byte) (AuctionData, error) {
+	auction := AuctionData{}
+	err := protobuf.Decode(buf, &auction)
+	if err != nil {
+		return auction, err
+	}
+	return auction, auction.upgrade()
+}
+
+// upgrade brings a decoded auction to the newest layout.
+func (a *AuctionData) upgrade() error {
+	if a.Version > AuctionVersion {
+		return errors.New("unknown auction version")
+	}
+	a.Version = AuctionVersion
+	return nil
+}
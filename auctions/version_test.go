@@ -0,0 +1,84 @@
+package auctions
+
+import (
+	"testing"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/protobuf"
+)
+
+// baselineAuctionData is the layout of the first auctions, before any
+// optional field was added.
+type baselineAuctionData struct {
+	GoodDescription string
+	SellerAccount   byzcoin.InstanceID
+	ReservePrice    string `protobuf:"opt"`
+	HighestBid      uint64
+	HighestBidder   byzcoin.InstanceID
+	State           string
+	WinProof        string
+}
+
+func TestDecodeAuction(t *testing.T) {
+	// First format, without the optional fields
+	seller := byzcoin.NewInstanceID([]byte("seller"))
+	bidder := byzcoin.NewInstanceID([]byte("bidder"))
+	baseline := baselineAuctionData{GoodDescription: "bananas", SellerAccount: seller, ReservePrice: "hash",
+		HighestBid: 30, HighestBidder: bidder, State: auctioncore.StateWClosed, WinProof: "proof"}
+	buf, err := protobuf.Encode(&baseline)
+	require.NoError(t, err)
+	auction, err := DecodeAuction(buf)
+	require.NoError(t, err)
+	require.Equal(t, "bananas", auction.GoodDescription)
+	require.Equal(t, seller, auction.SellerAccount)
+	require.Equal(t, "hash", auction.ReservePrice)
+	require.Equal(t, uint64(30), auction.HighestBid)
+	require.Equal(t, bidder, auction.HighestBidder)
+	require.Equal(t, auctioncore.StateWClosed, auction.State)
+	require.Equal(t, "proof", auction.WinProof)
+	require.Equal(t, uint32(AuctionVersion), auction.Version)
+
+	// Current format, stored before the version
+	stored := AuctionData{GoodDescription: "bananas", SellerAccount: byzcoin.NewInstanceID([]byte("seller")),
+		State: auctioncore.StateOpen, Mode: ModeCandle, EndIndex: 12,
+		AllowList: darc.ID{}, AssetDarc: darc.ID{}, Custody: darc.ID{}, ByzCoinID: skipchain.SkipBlockID{},
+		Leaders: []LeaderData{{Index: 3, Bid: 10}}}
+	buf, err = protobuf.Encode(&stored)
+	require.NoError(t, err)
+	auction, err = DecodeAuction(buf)
+	require.NoError(t, err)
+	stored.Version = AuctionVersion
+	require.Equal(t, stored, auction)
+
+	stored.Version = AuctionVersion + 1
+	buf, err = protobuf.Encode(&stored)
+	require.NoError(t, err)
+	_, err = DecodeAuction(buf)
+	require.Error(t, err)
+}
+
+func TestContractAuction_Migrate(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	sellAccInstID := bct.createSellerAccount(t)
+	auctInstID, _ := bct.createAuction(t, sellAccInstID, "bananas")
+	require.Equal(t, uint32(AuctionVersion), bct.proofAndDecodeAuction(t, auctInstID).Version)
+
+	// Only the darc of the auction can migrate it
+	other := darc.NewSignerEd25519(nil, nil)
+	otherCt := uint64(1)
+	_, err := bct.sendAs(t, other, &otherCt, byzcoin.Instruction{
+		InstanceID: auctInstID,
+		Invoke:     &byzcoin.Invoke{ContractID: ContractAuctionID, Command: "migrate"},
+	})
+	require.Error(t, err)
+
+	require.NoError(t, bct.invokeAuction(t, auctInstID, "migrate", nil))
+	require.NoError(t, bct.closeAuction(t, auctInstID))
+	require.NoError(t, bct.invokeAuction(t, auctInstID, "migrate", nil))
+}
@@ -0,0 +1,296 @@
+package clock_auctions
+
+import (
+	"errors"
+	"math/bits"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+// ContractClockAuctionID identifies an ascending clock auction contract
+var ContractClockAuctionID = "clock_auction"
+
+type contractClockAuction struct {
+	byzcoin.BasicContract
+	AuctionData
+	s *Service
+}
+
+func (s *Service) contractClockAuctionFromBytes(in []byte) (byzcoin.Contract, error) {
+	cv := &contractClockAuction{}
+	err := protobuf.Decode(in, &cv.AuctionData)
+	if err != nil {
+		return nil, err
+	}
+	cv.s = s
+	return cv, nil
+}
+
+// Spawn creates a new clock auction. The clock starts with the block the
+// instruction is part of.
+func (c *contractClockAuction) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	auctionBuf := inst.Spawn.Args.Search("auction")
+	if auctionBuf == nil {
+		return nil, nil, auctioncore.ErrMissingAuction
+	}
+	auction := AuctionData{}
+	err = protobuf.Decode(auctionBuf, &auction)
+	if err != nil {
+		return nil, nil, auctioncore.ErrNotAuction
+	}
+	if auction.Step == 0 || auction.RoundBlocks == 0 {
+		return nil, nil, errors.New("the clock needs a step and a round length")
+	}
+	if auction.State != auctioncore.StateOpen || len(auction.Bidders) != 0 {
+		return nil, nil, errors.New("a new auction must be open and without bidders")
+	}
+	auction.StartIndex, err = auctioncore.BlockIndex(rst)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	auctionBuf, err = protobuf.Encode(&auction)
+	if err != nil {
+		return nil, nil, errors.New("encode auction buf sc")
+	}
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""), ContractClockAuctionID, auctionBuf, darcID),
+	}
+	return
+}
+
+// VerifyInstruction lets anybody join or stay, the owner of the bidder
+// account is checked when the instruction is invoked. The other commands
+// need the signature of the darc controlling the auction.
+func (c *contractClockAuction) VerifyInstruction(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, ctxHash []byte) error {
+	if inst.GetType() == byzcoin.InvokeType && (inst.Invoke.Command == "join" || inst.Invoke.Command == "stay") {
+		return auctioncore.VerifySignatures(inst, ctxHash)
+	}
+	return c.BasicContract.VerifyInstruction(rst, inst, ctxHash)
+}
+
+// The following methods are available:
+//   - join: enters the auction during the first round, escrowing the start price
+//   - stay: remains in for the current round, topping up the escrow to its price
+//   - close: once one or zero bidders are left, pays the seller and refunds
+//   - drop: cancels the auction and refunds all the bidders
+//
+// A bidder who does not stay during a round is out. When the last bidders
+// all leave in the same round, the first of them to have joined wins at the
+// price of the round before.
+func (c *contractClockAuction) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var auctionBuf []byte
+	var darcID darc.ID
+	auctionBuf, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+	auction := AuctionData{}
+	err = protobuf.Decode(auctionBuf, &auction)
+	if err != nil {
+		return
+	}
+	if auction.State != auctioncore.StateOpen {
+		return nil, nil, auctioncore.ErrAuctionClosed
+	}
+
+	var index uint64
+	index, err = auctioncore.BlockIndex(rst)
+	if err != nil {
+		return nil, nil, err
+	}
+	round := auction.round(index)
+	winner, over := auction.outcome(round)
+
+	switch inst.Invoke.Command {
+	case "join", "stay":
+		if over {
+			return nil, nil, auctioncore.ErrAuctionClosed
+		}
+		var bid BidData
+		bid, err = decodeBid(inst)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = auctioncore.VerifyOwner(rst, inst, bid.BidderAccount)
+		if err != nil {
+			return nil, nil, errors.New("bid not signed by the owner of the bidder account: " + err.Error())
+		}
+		var price uint64
+		price, err = auction.price(round)
+		if err != nil {
+			return nil, nil, err
+		}
+		var escrowed uint64
+		escrowed, cout, err = auctioncore.CollectCoins(rst, bid.BidderAccount, coins)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		i := auction.find(bid.BidderAccount)
+		if inst.Invoke.Command == "join" {
+			if round != 0 {
+				return nil, nil, errors.New("can only join during the first round")
+			}
+			if bid.BidderAccount == auction.SellerAccount {
+				return nil, nil, auctioncore.ErrSellerBid
+			}
+			if i != -1 {
+				return nil, nil, errors.New("already in the auction")
+			}
+			if escrowed != price {
+				return nil, nil, auctioncore.ErrEscrowMismatch
+			}
+			auction.Bidders = append(auction.Bidders, BidderData{Account: bid.BidderAccount, Escrow: price})
+		} else {
+			if round == 0 {
+				return nil, nil, errors.New("joining is staying for the first round")
+			}
+			if i == -1 || auction.Bidders[i].Round != round-1 {
+				return nil, nil, errors.New("bidder is not in the auction anymore")
+			}
+			if escrowed != price-auction.Bidders[i].Escrow {
+				return nil, nil, auctioncore.ErrEscrowMismatch
+			}
+			auction.Bidders[i].Escrow = price
+			auction.Bidders[i].Round = round
+		}
+
+	case "close":
+		if !over {
+			return nil, nil, auctioncore.ErrAuctionOpen
+		}
+		payouts := auctioncore.Payouts{}
+		for i, b := range auction.Bidders {
+			if i == winner.index {
+				payouts.Add(auction.SellerAccount, winner.price)
+				payouts.Add(b.Account, b.Escrow-winner.price)
+			} else {
+				payouts.Add(b.Account, b.Escrow)
+			}
+		}
+		sc, err = payouts.StoreCoins(c.s.byzService(), rst)
+		if err != nil {
+			return nil, nil, err
+		}
+		auction.State = auctioncore.StateClosed
+		if winner.index != -1 {
+			auction.State = auctioncore.StateWClosed
+			auction.WinnerAccount = auction.Bidders[winner.index].Account
+			auction.Price = winner.price
+		}
+
+	case "drop":
+		payouts := auctioncore.Payouts{}
+		for _, b := range auction.Bidders {
+			payouts.Add(b.Account, b.Escrow)
+		}
+		sc, err = payouts.StoreCoins(c.s.byzService(), rst)
+		if err != nil {
+			return nil, nil, err
+		}
+		auction.State = auctioncore.StateDropped
+
+	default:
+		return nil, nil, errors.New("Clock auction contract can only join, stay, close or drop")
+	}
+
+	auctionBuf, err = protobuf.Encode(&auction)
+	if err != nil {
+		return nil, nil, errors.New("encode auction buf sc: " + inst.Invoke.Command)
+	}
+	sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+		ContractClockAuctionID, auctionBuf, darcID))
+	return
+}
+
+// round returns the round of the clock at the block index.
+func (a *AuctionData) round(index uint64) uint64 {
+	return (index - a.StartIndex) / a.RoundBlocks
+}
+
+// price returns the price of the clock during the round.
+func (a *AuctionData) price(round uint64) (uint64, error) {
+	hi, step := bits.Mul64(round, a.Step)
+	price, carry := bits.Add64(a.StartPrice, step, 0)
+	if hi != 0 || carry != 0 {
+		return 0, errors.New("clock price overflows")
+	}
+	return price, nil
+}
+
+// winnerData is the outcome of a clock auction. index is -1 if there is no
+// winner.
+type winnerData struct {
+	index int
+	price uint64
+}
+
+// outcome looks at the rounds before current, which are over, for the first
+// one that ended with one or zero bidders. It returns false if there is
+// none and the auction goes on.
+func (a *AuctionData) outcome(current uint64) (winnerData, bool) {
+	for r := uint64(0); r < current; r++ {
+		in := -1
+		count := 0
+		for i, b := range a.Bidders {
+			if b.Round >= r {
+				count++
+				in = i
+			}
+		}
+		switch {
+		case count == 1:
+			price, _ := a.price(r)
+			return winnerData{index: in, price: price}, true
+		case count == 0 && r == 0:
+			return winnerData{index: -1}, true
+		case count == 0:
+			// Everybody left at once: the first to have joined among
+			// those still in the round before wins at its price.
+			for i, b := range a.Bidders {
+				if b.Round == r-1 {
+					price, _ := a.price(r - 1)
+					return winnerData{index: i, price: price}, true
+				}
+			}
+		}
+	}
+	return winnerData{index: -1}, false
+}
+
+// find returns the index of the bidder, or -1.
+func (a *AuctionData) find(account byzcoin.InstanceID) int {
+	for i, b := range a.Bidders {
+		if b.Account == account {
+			return i
+		}
+	}
+	return -1
+}
+
+func decodeBid(inst byzcoin.Instruction) (BidData, error) {
+	bid := BidData{}
+	bidBuf := inst.Invoke.Args.Search("bid")
+	if bidBuf == nil {
+		return bid, auctioncore.ErrMissingBid
+	}
+	err := protobuf.Decode(bidBuf, &bid)
+	if err != nil {
+		return bid, auctioncore.ErrNotBid
+	}
+	return bid, nil
+}
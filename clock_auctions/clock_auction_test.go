@@ -0,0 +1,215 @@
+package clock_auctions
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/byzcoin/trie"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+func TestAuctionData_Outcome(t *testing.T) {
+	a := byzcoin.NewInstanceID([]byte("a"))
+	b := byzcoin.NewInstanceID([]byte("b"))
+	c := byzcoin.NewInstanceID([]byte("c"))
+	auction := AuctionData{StartPrice: 10, Step: 5, RoundBlocks: 2, StartIndex: 7}
+	require.Equal(t, uint64(0), auction.round(8))
+	require.Equal(t, uint64(1), auction.round(9))
+
+	// Nobody joined
+	w, over := auction.outcome(0)
+	require.False(t, over)
+	w, over = auction.outcome(1)
+	require.True(t, over)
+	require.Equal(t, -1, w.index)
+
+	// a stays longer than b and c
+	auction.Bidders = []BidderData{{Account: a, Round: 3}, {Account: b, Round: 1}, {Account: c, Round: 2}}
+	_, over = auction.outcome(3)
+	require.False(t, over)
+	w, over = auction.outcome(4)
+	require.True(t, over)
+	require.Equal(t, winnerData{index: 0, price: 25}, w)
+	w, _ = auction.outcome(10)
+	require.Equal(t, winnerData{index: 0, price: 25}, w)
+
+	// b and c leave together, b joined first
+	auction.Bidders = []BidderData{{Account: a, Round: 0}, {Account: b, Round: 2}, {Account: c, Round: 2}}
+	_, over = auction.outcome(3)
+	require.False(t, over)
+	w, over = auction.outcome(4)
+	require.True(t, over)
+	require.Equal(t, winnerData{index: 1, price: 20}, w)
+}
+
+func TestAuctionData_Price(t *testing.T) {
+	auction := AuctionData{StartPrice: 10, Step: 5}
+	price, err := auction.price(3)
+	require.NoError(t, err)
+	require.Equal(t, uint64(25), price)
+
+	auction.Step = 1 << 63
+	_, err = auction.price(2)
+	require.Error(t, err)
+	auction.Step = 1<<64 - 10
+	_, err = auction.price(1)
+	require.Error(t, err)
+}
+
+func TestContractClockAuction_JoinStay(t *testing.T) {
+	auctInstID := byzcoin.NewInstanceID([]byte("auction"))
+	seller := byzcoin.NewInstanceID([]byte("seller"))
+	a := byzcoin.NewInstanceID([]byte("a"))
+	b := byzcoin.NewInstanceID([]byte("b"))
+	owner := darc.NewSignerEd25519(nil, nil)
+	d := darc.NewDarc(darc.InitRules([]darc.Identity{owner.Identity()},
+		[]darc.Identity{owner.Identity()}), []byte("bidders"))
+	dBuf, err := d.ToProto()
+	require.NoError(t, err)
+
+	rst := newMemTrie()
+	rst.apply(byzcoin.NewStateChange(byzcoin.Create, byzcoin.NewInstanceID(d.GetBaseID()), byzcoin.ContractDarcID, dBuf, d.GetBaseID()))
+	for _, acc := range []byzcoin.InstanceID{seller, a, b} {
+		coinBuf, err := protobuf.Encode(&byzcoin.Coin{Name: contracts.CoinName})
+		require.NoError(t, err)
+		rst.apply(byzcoin.NewStateChange(byzcoin.Create, acc, contracts.ContractCoinID, coinBuf, d.GetBaseID()))
+	}
+	auctionBuf, err := protobuf.Encode(&AuctionData{SellerAccount: seller, StartPrice: 10, Step: 5,
+		RoundBlocks: 2, StartIndex: 5, State: auctioncore.StateOpen})
+	require.NoError(t, err)
+	rst.apply(byzcoin.NewStateChange(byzcoin.Create, auctInstID, ContractClockAuctionID, auctionBuf, darc.ID{}))
+
+	sendAs := func(signer darc.Signer, command string, bidder byzcoin.InstanceID, escrow uint64) error {
+		bidBuf, err := protobuf.Encode(&BidData{BidderAccount: bidder})
+		require.NoError(t, err)
+		c := &contractClockAuction{}
+		sc, _, err := c.Invoke(rst, byzcoin.Instruction{
+			InstanceID: auctInstID,
+			Invoke: &byzcoin.Invoke{
+				ContractID: ContractClockAuctionID,
+				Command:    command,
+				Args:       byzcoin.Arguments{{Name: "bid", Value: bidBuf}},
+			},
+			SignerIdentities: []darc.Identity{signer.Identity()},
+		}, []byzcoin.Coin{{Name: contracts.CoinName, Value: escrow}})
+		if err == nil {
+			rst.apply(sc...)
+		}
+		return err
+	}
+	send := func(command string, bidder byzcoin.InstanceID, escrow uint64) error {
+		return sendAs(owner, command, bidder, escrow)
+	}
+
+	// Round 0, blocks 5 and 6
+	rst.index = 4
+	require.Error(t, sendAs(darc.NewSignerEd25519(nil, nil), "join", a, 10))
+	require.Error(t, send("join", a, 5))
+	require.Error(t, send("join", seller, 10))
+	require.NoError(t, send("join", a, 10))
+	require.Error(t, send("join", a, 10))
+	require.Error(t, send("stay", a, 5))
+	rst.index = 5
+	require.NoError(t, send("join", b, 10))
+
+	// Round 1: a stays, joining is over
+	rst.index = 6
+	require.Error(t, send("join", byzcoin.NewInstanceID([]byte("late")), 15))
+	require.Error(t, send("stay", a, 15))
+	require.Error(t, sendAs(darc.NewSignerEd25519(nil, nil), "stay", a, 5))
+	require.NoError(t, send("stay", a, 5))
+	require.Error(t, send("stay", a, 5))
+
+	// Round 2: b left in round 1, so a has won
+	rst.index = 8
+	require.Error(t, send("stay", b, 10))
+	require.Equal(t, auctioncore.ErrAuctionClosed, send("stay", a, 5))
+
+	val, _, _, _, err := rst.GetValues(auctInstID.Slice())
+	require.NoError(t, err)
+	auction := AuctionData{}
+	require.NoError(t, protobuf.Decode(val, &auction))
+	require.Equal(t, []BidderData{{Account: a, Escrow: 15, Round: 1}, {Account: b, Escrow: 10, Round: 0}}, auction.Bidders)
+	w, over := auction.outcome(2)
+	require.True(t, over)
+	require.Equal(t, winnerData{index: 0, price: 15}, w)
+}
+
+func TestContractClockAuction(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	if !bct.hasBlockIndex(t) {
+		t.Skip(auctioncore.ErrNoBlockIndex.Error())
+	}
+
+	sellAccInstID := bct.CreateAccount(t, contracts.CoinName, 0)
+	bidAccInstID := bct.CreateAccount(t, contracts.CoinName, 100)
+	bidAccInstID2 := bct.CreateAccount(t, contracts.CoinName, 100)
+
+	auctInstID, err := bct.createAuction(t, sellAccInstID, 20, 10, 3)
+	require.NoError(t, err)
+
+	// Both bidders join in the first round
+	_, err = bct.SendInstructions(t, append(
+		bidInstructions(t, auctInstID, "join", bidAccInstID, 20),
+		bidInstructions(t, auctInstID, "join", bidAccInstID2, 20)...)...)
+	require.NoError(t, err)
+	require.Error(t, bct.invokeAuction(t, auctInstID, "close"))
+
+	// Only the first bidder stays in the second round
+	bct.untilRound(t, auctInstID, 1)
+	_, err = bct.SendInstructions(t, bidInstructions(t, auctInstID, "stay", bidAccInstID, 10)...)
+	require.NoError(t, err)
+
+	bct.untilRound(t, auctInstID, 2)
+	_, err = bct.SendInstructions(t, bidInstructions(t, auctInstID, "stay", bidAccInstID2, 20)...)
+	require.Error(t, err)
+	require.NoError(t, bct.invokeAuction(t, auctInstID, "close"))
+
+	auction := bct.proofAndDecodeAuction(t, auctInstID)
+	require.Equal(t, auctioncore.StateWClosed, auction.State)
+	require.Equal(t, bidAccInstID, auction.WinnerAccount)
+	require.Equal(t, uint64(30), auction.Price)
+	require.Equal(t, uint64(30), bct.CoinBalance(t, sellAccInstID))
+	require.Equal(t, uint64(70), bct.CoinBalance(t, bidAccInstID))
+	require.Equal(t, uint64(100), bct.CoinBalance(t, bidAccInstID2))
+}
+
+// memTrie is a ReadOnlyStateTrie kept in memory, with a block index set by
+// the test.
+type memTrie struct {
+	values map[string]byzcoin.StateChange
+	index  int
+}
+
+func newMemTrie() *memTrie {
+	return &memTrie{values: make(map[string]byzcoin.StateChange)}
+}
+
+func (m *memTrie) apply(scs ...byzcoin.StateChange) {
+	for _, sc := range scs {
+		m.values[string(sc.InstanceID)] = sc
+	}
+}
+
+func (m *memTrie) GetValues(key []byte) ([]byte, uint64, string, darc.ID, error) {
+	sc, ok := m.values[string(key)]
+	if !ok {
+		return nil, 0, "", nil, errors.New("key not set")
+	}
+	return sc.Value, sc.Version, sc.ContractID, sc.DarcID, nil
+}
+
+func (m *memTrie) GetProof(key []byte) (*trie.Proof, error) {
+	return nil, errors.New("not supported")
+}
+
+func (m *memTrie) GetIndex() int {
+	return m.index
+}
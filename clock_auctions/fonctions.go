@@ -0,0 +1,136 @@
+package clock_auctions
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/dedis/student_19_auctions/auctioncore/bctest"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/protobuf"
+)
+
+// bcTest is used here to provide some simple test structure for different
+// tests.
+type bcTest struct {
+	*bctest.BCTest
+}
+
+func newBCTest(t *testing.T) *bcTest {
+	// The genesis darc has the right to create and update the auction and
+	// coin contracts.
+	return &bcTest{bctest.New(t,
+		"spawn:clock_auction", "invoke:clock_auction.join", "invoke:clock_auction.stay",
+		"invoke:clock_auction.close", "invoke:clock_auction.drop", "spawn:coin", "invoke:coin.mint",
+		"invoke:coin.fetch")}
+}
+
+// hasBlockIndex tells if the contracts of the ledger can read the block
+// index, by asking a node for the staging trie given to the contracts.
+func (bct *bcTest) hasBlockIndex(t *testing.T) bool {
+	bs := bct.Servers[0].Service(byzcoin.ServiceName).(*byzcoin.Service)
+	st, err := bs.GetReadOnlyStateTrie(bct.Cl.ID)
+	require.NoError(t, err)
+	staging := reflect.ValueOf(st).MethodByName("MakeStagingStateTrie")
+	if !staging.IsValid() {
+		return false
+	}
+	rst, ok := staging.Call(nil)[0].Interface().(byzcoin.ReadOnlyStateTrie)
+	if !ok {
+		return false
+	}
+	_, err = auctioncore.BlockIndex(rst)
+	return err == nil
+}
+
+func (bct *bcTest) createAuction(t *testing.T, sellAccInstID byzcoin.InstanceID, startPrice, step, roundBlocks uint64) (byzcoin.InstanceID, error) {
+	auctionBuf, err := protobuf.Encode(&AuctionData{
+		GoodDescription: "bananas",
+		SellerAccount:   sellAccInstID,
+		StartPrice:      startPrice,
+		Step:            step,
+		RoundBlocks:     roundBlocks,
+		State:           auctioncore.StateOpen,
+	})
+	require.NoError(t, err)
+
+	ctx, err := bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(bct.GDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractClockAuctionID,
+			Args:       byzcoin.Arguments{{Name: "auction", Value: auctionBuf}},
+		},
+	})
+	return ctx.Instructions[0].DeriveID(""), err
+}
+
+// bidInstructions fetches the escrow from the bidder account and sends the
+// join or stay command with it.
+func bidInstructions(t *testing.T, auctInstID byzcoin.InstanceID, command string, bidAccInstID byzcoin.InstanceID, escrow uint64) []byzcoin.Instruction {
+	bidBuf, err := protobuf.Encode(&BidData{BidderAccount: bidAccInstID})
+	require.NoError(t, err)
+
+	return []byzcoin.Instruction{{
+		InstanceID: bidAccInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: contracts.ContractCoinID,
+			Command:    "fetch",
+			Args:       byzcoin.Arguments{{Name: "coins", Value: auctioncore.EncodeAmount(escrow)}},
+		},
+	}, {
+		InstanceID: auctInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractClockAuctionID,
+			Command:    command,
+			Args:       byzcoin.Arguments{{Name: "bid", Value: bidBuf}},
+		},
+	}}
+}
+
+// untilRound sends instructions to add blocks to the ledger until the clock
+// of the auction reaches the round.
+func (bct *bcTest) untilRound(t *testing.T, auctInstID byzcoin.InstanceID, round uint64) {
+	auction := bct.proofAndDecodeAuction(t, auctInstID)
+	for {
+		reply, err := bct.Cl.GetProof(auctInstID.Slice())
+		require.NoError(t, err)
+		// The next instruction goes in the block after the latest one.
+		if auction.round(uint64(reply.Proof.Latest.Index)+1) >= round {
+			return
+		}
+		bct.CreateAccount(t, contracts.CoinName, 0)
+	}
+}
+
+func (bct *bcTest) invokeAuction(t *testing.T, auctInstID byzcoin.InstanceID, command string) error {
+	_, err := bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: auctInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractClockAuctionID,
+			Command:    command,
+		},
+	})
+	return err
+}
+
+func (bct *bcTest) proofAndDecodeAuction(t *testing.T, auctInstID byzcoin.InstanceID) AuctionData {
+	//Get the proof from byzcoin
+	reply, err := bct.Cl.GetProof(auctInstID.Slice())
+	require.Nil(t, err)
+	// Make sure the proof is a matching proof and not a proof of absence.
+	proof := reply.Proof
+	require.True(t, proof.InclusionProof.Match(auctInstID.Slice()))
+
+	// Get the raw values of the proof.
+	_, val, _, _, err := proof.KeyValue()
+	require.Nil(t, err)
+
+	// And decode the buffer to a AuctionData
+	auctS := AuctionData{}
+	err = protobuf.Decode(val, &auctS)
+	require.Nil(t, err)
+
+	return auctS
+}
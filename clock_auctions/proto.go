@@ -0,0 +1,39 @@
+package clock_auctions
+
+import "go.dedis.ch/cothority/v3/byzcoin"
+
+// PROTOSTART
+// package clock_auctions;
+// import "byzcoin.proto";
+//
+// option java_package = "ch.epfl.dedis.lib.proto";
+// option java_outer_classname = "ClockAuctions";
+
+// AuctionData is the value of a clock auction instance. The price starts at
+// StartPrice and rises by Step every RoundBlocks blocks, counted from the
+// block the auction was spawned in.
+type AuctionData struct {
+	GoodDescription string
+	SellerAccount   byzcoin.InstanceID // The place to credit the payment when the auction is over
+	StartPrice      uint64
+	Step            uint64
+	RoundBlocks     uint64
+	StartIndex      uint64 // Set by the contract on spawn
+	State           string
+	Bidders         []BidderData
+	WinnerAccount   byzcoin.InstanceID `protobuf:"opt"`
+	Price           uint64             `protobuf:"opt"` // Paid by the winner
+}
+
+// BidderData is a participant of a clock auction. Escrow covers the price
+// of the last round the bidder stayed in.
+type BidderData struct {
+	Account byzcoin.InstanceID
+	Escrow  uint64
+	Round   uint64
+}
+
+// BidData is the argument of the "join" and "stay" instructions.
+type BidData struct {
+	BidderAccount byzcoin.InstanceID
+}
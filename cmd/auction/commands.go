@@ -0,0 +1,353 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"time"
+
+	"github.com/dedis/student_19_auctions/auction_audit"
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/dedis/student_19_auctions/auctions"
+	"github.com/dedis/student_19_auctions/sb_auctions"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	bbolt "go.etcd.io/bbolt"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+func accountCreate(c *cli.Context) error {
+	l, err := loadLedger(c)
+	if err != nil {
+		return err
+	}
+	sender := auctioncore.NewSender(l.cl, l.signer)
+	ctx, err := sender.Send(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(l.darcID),
+		Spawn:      &byzcoin.Spawn{ContractID: contracts.ContractCoinID},
+	})
+	if err != nil {
+		return err
+	}
+	account := ctx.Instructions[0].DeriveID("")
+	if mint := c.Uint64("mint"); mint > 0 {
+		_, err = sender.Send(byzcoin.Instruction{
+			InstanceID: account,
+			Invoke: &byzcoin.Invoke{
+				ContractID: contracts.ContractCoinID,
+				Command:    "mint",
+				Args:       byzcoin.Arguments{{Name: "coins", Value: auctioncore.EncodeAmount(mint)}},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return output(c, result{"account": account})
+}
+
+func accountShow(c *cli.Context) error {
+	if c.NArg() < 1 {
+		return errors.New("please give the account as argument")
+	}
+	account, err := parseID(c.Args().First())
+	if err != nil {
+		return err
+	}
+	l, err := loadLedger(c)
+	if err != nil {
+		return err
+	}
+	coin := byzcoin.Coin{}
+	found, err := auctioncore.ReadInstance(l.cl, account, contracts.ContractCoinID, &coin)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return auctioncore.ErrUnknownInstanceID
+	}
+	return output(c, result{"account": account, "balance": coin.Value})
+}
+
+func create(c *cli.Context) error {
+	seller, err := idFlag(c, "seller")
+	if err != nil {
+		return err
+	}
+	sb, err := sbContract(c)
+	if err != nil {
+		return err
+	}
+	l, err := loadLedger(c)
+	if err != nil {
+		return err
+	}
+
+	var auctInstID byzcoin.InstanceID
+	if sb {
+		var deposits byzcoin.InstanceID
+		deposits, err = idFlag(c, "deposits")
+		if err != nil {
+			return err
+		}
+		auctInstID, err = sb_auctions.NewClient(l.cl, l.signer).CreateAuction(l.darcID, sb_auctions.AuctionData{
+			GoodDescription: c.String("good"),
+			SellerAccount:   seller,
+			ReservePrice:    c.Uint64("reserve"),
+			State:           sb_auctions.OPEN,
+			Deposits:        deposits,
+			Category:        c.String("category"),
+		})
+	} else {
+		if c.String("salt") == "" {
+			return errors.New("--salt flag is required to hash the reserve price")
+		}
+		auctInstID, err = auctions.NewClient(l.cl, l.signer).CreateAuction(l.darcID, auctions.AuctionData{
+			GoodDescription: c.String("good"),
+			SellerAccount:   seller,
+			State:           auctioncore.StateOpen,
+			ReservePrice:    auctioncore.CreateHash(c.String("salt"), c.Uint64("reserve")),
+			Category:        c.String("category"),
+		})
+	}
+	if err != nil {
+		return err
+	}
+	return output(c, result{"auction": auctInstID})
+}
+
+func bid(c *cli.Context) error {
+	auctInstID, err := auctionArg(c)
+	if err != nil {
+		return err
+	}
+	account, err := idFlag(c, "account")
+	if err != nil {
+		return err
+	}
+	amount := c.Uint64("amount")
+	if amount == 0 {
+		return errors.New("--amount flag is required")
+	}
+	sb, err := sbContract(c)
+	if err != nil {
+		return err
+	}
+	l, err := loadLedger(c)
+	if err != nil {
+		return err
+	}
+
+	if sb {
+		err = sb_auctions.NewClient(l.cl, l.signer).Bid(auctInstID, account, amount)
+	} else {
+		err = auctions.NewClient(l.cl, l.signer).Bid(auctInstID, auctions.BidData{BidderAccount: account}, amount)
+	}
+	if err != nil {
+		return err
+	}
+	return output(c, result{"auction": auctInstID, "account": account, "bid": amount})
+}
+
+func closeAuction(c *cli.Context) error {
+	auctInstID, err := auctionArg(c)
+	if err != nil {
+		return err
+	}
+	sb, err := sbContract(c)
+	if err != nil {
+		return err
+	}
+	l, err := loadLedger(c)
+	if err != nil {
+		return err
+	}
+
+	if sb {
+		err = sb_auctions.NewClient(l.cl, l.signer).Close(auctInstID)
+	} else {
+		err = auctions.NewClient(l.cl, l.signer).Close(auctInstID,
+			auctions.CloseData{Salt: c.String("salt"), ReservePrice: c.Uint64("reserve")})
+	}
+	if err != nil {
+		return err
+	}
+	return show(c)
+}
+
+func drop(c *cli.Context) error {
+	auctInstID, err := auctionArg(c)
+	if err != nil {
+		return err
+	}
+	sb, err := sbContract(c)
+	if err != nil {
+		return err
+	}
+	if sb {
+		return errors.New("an sb_auction cannot be dropped")
+	}
+	l, err := loadLedger(c)
+	if err != nil {
+		return err
+	}
+	err = auctions.NewClient(l.cl, l.signer).Drop(auctInstID, c.String("reason"))
+	if err != nil {
+		return err
+	}
+	return show(c)
+}
+
+// show prints the auction with the index of the block its proof was
+// verified against.
+func show(c *cli.Context) error {
+	auctInstID, err := auctionArg(c)
+	if err != nil {
+		return err
+	}
+	sb, err := sbContract(c)
+	if err != nil {
+		return err
+	}
+	l, err := loadLedger(c)
+	if err != nil {
+		return err
+	}
+
+	reply, err := l.cl.GetProof(auctInstID.Slice())
+	if err != nil {
+		return err
+	}
+	proof := reply.Proof
+	err = proof.Verify(l.cl.ID)
+	if err != nil {
+		return err
+	}
+	if !proof.InclusionProof.Match(auctInstID.Slice()) {
+		return auctioncore.ErrUnknownInstanceID
+	}
+	_, val, contractID, _, err := proof.KeyValue()
+	if err != nil {
+		return err
+	}
+	if contractID != c.GlobalString("contract") {
+		return errors.New("instance is not of contract " + c.GlobalString("contract"))
+	}
+
+	var auction interface{}
+	if sb {
+		var a sb_auctions.AuctionData
+		a, err = sb_auctions.DecodeAuction(val)
+		auction = a
+	} else {
+		var a auctions.AuctionData
+		a, err = auctions.DecodeAuction(val)
+		auction = a
+	}
+	if err != nil {
+		return err
+	}
+	return output(c, result{
+		"auction":  auctInstID,
+		"contract": contractID,
+		"block":    proof.Latest.Index,
+		"state":    auction,
+	})
+}
+
+// export saves the segment of the auction, to be checked with verify.
+func export(c *cli.Context) error {
+	auctInstID, err := auctionArg(c)
+	if err != nil {
+		return err
+	}
+	if c.String("out") == "" {
+		return errors.New("--out flag is required")
+	}
+	seg, err := exportSegment(c, auctInstID)
+	if err != nil {
+		return err
+	}
+	buf, err := seg.Encode()
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(c.String("out"), buf, 0644)
+	if err != nil {
+		return err
+	}
+	return output(c, result{
+		"auction": auctInstID,
+		"blocks":  len(seg.Blocks),
+		"proofs":  len(seg.Proofs),
+	})
+}
+
+// exportSegment reads the segment of the auction from the database given
+// with --db.
+func exportSegment(c *cli.Context, auctInstID byzcoin.InstanceID) (*auction_audit.Segment, error) {
+	if c.String("db") == "" {
+		return nil, errors.New("--db flag is required")
+	}
+	bcID, err := ledgerID(c)
+	if err != nil {
+		return nil, err
+	}
+	db, err := bbolt.Open(c.String("db"), 0600, &bbolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return nil, errors.New("couldn't open the database, the conode must be stopped: " + err.Error())
+	}
+	defer db.Close()
+	return auction_audit.Export(db, bcID, auctInstID)
+}
+
+// verify replays the auction of a segment, or of a database, and fails if
+// the result differs from the ledger.
+func verify(c *cli.Context) error {
+	auctInstID, err := auctionArg(c)
+	if err != nil {
+		return err
+	}
+	bcID, err := ledgerID(c)
+	if err != nil {
+		return err
+	}
+	var seg *auction_audit.Segment
+	if fn := c.String("segment"); fn != "" {
+		var buf []byte
+		buf, err = ioutil.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+		seg, err = auction_audit.DecodeSegment(buf)
+	} else {
+		seg, err = exportSegment(c, auctInstID)
+	}
+	if err != nil {
+		return err
+	}
+
+	report, err := auction_audit.Verify(seg, bcID, auctInstID)
+	if err != nil {
+		return err
+	}
+	err = output(c, result{
+		"auction":  report.AuctionID,
+		"contract": report.ContractID,
+		"spawned":  report.Spawned,
+		"block":    report.Latest,
+		"outcome":  report.Outcome,
+		"lots":     report.Lots,
+		"seller":   report.Seller,
+		"payment":  report.Payment,
+		"refunds":  report.Refunds,
+		"match":    report.Match,
+		"mismatch": report.Mismatch,
+	})
+	if err != nil {
+		return err
+	}
+	if !report.Match {
+		return errors.New("the auction on the ledger does not match its replay")
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+// Command auction runs auctions on a ByzCoin ledger created by bcadmin. It
+// reads the ledger from a bc-xxx.cfg file and signs with a key-xxx.cfg
+// file, by default the key of the admin of the ledger.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+
+	"github.com/dedis/student_19_auctions/auctions"
+	"github.com/dedis/student_19_auctions/sb_auctions"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3/cfgpath"
+	"go.dedis.ch/onet/v3/log"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var cmds = cli.Commands{
+	{
+		Name:  "account",
+		Usage: "manage the coin accounts used by the auctions",
+		Subcommands: cli.Commands{
+			{
+				Name:   "create",
+				Usage:  "spawn a coin account, owned by the darc",
+				Action: accountCreate,
+				Flags: []cli.Flag{
+					cli.Uint64Flag{
+						Name:  "mint",
+						Usage: "coins to mint on the new account, needs invoke:coin.mint",
+					},
+				},
+			},
+			{
+				Name:      "show",
+				Usage:     "show the balance of an account",
+				ArgsUsage: "account",
+				Action:    accountShow,
+			},
+		},
+	},
+	{
+		Name:   "create",
+		Usage:  "list a new auction",
+		Action: create,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "seller",
+				Usage: "account paid at the end of the auction",
+			},
+			cli.StringFlag{
+				Name:  "good",
+				Usage: "description of the good",
+			},
+			cli.Uint64Flag{
+				Name:  "reserve",
+				Usage: "reserve price, hashed with the salt for an auction contract",
+			},
+			cli.StringFlag{
+				Name:  "salt",
+				Usage: "salt of the hashed reserve price, to be given again to close",
+			},
+			cli.StringFlag{
+				Name:  "category",
+				Usage: "category of the good",
+			},
+			cli.StringFlag{
+				Name:  "deposits",
+				Usage: "account holding the escrow of an sb_auction",
+			},
+		},
+	},
+	{
+		Name:      "bid",
+		Usage:     "bid on an auction, the amount is fetched from the account",
+		ArgsUsage: "auction",
+		Action:    bid,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "account",
+				Usage: "account paying the bid, the signer must own it",
+			},
+			cli.Uint64Flag{
+				Name:  "amount",
+				Usage: "bid, for an sb_auction the total of the bids of the account",
+			},
+		},
+	},
+	{
+		Name:      "close",
+		Usage:     "close an auction and pay out its escrow",
+		ArgsUsage: "auction",
+		Action:    closeAuction,
+		Flags: []cli.Flag{
+			cli.Uint64Flag{
+				Name:  "reserve",
+				Usage: "reserve price given at creation",
+			},
+			cli.StringFlag{
+				Name:  "salt",
+				Usage: "salt given at creation",
+			},
+		},
+	},
+	{
+		Name:      "drop",
+		Usage:     "cancel an auction and refund the bidders, auction contract only",
+		ArgsUsage: "auction",
+		Action:    drop,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "reason",
+				Usage: "reason recorded with the cancellation",
+			},
+		},
+	},
+	{
+		Name:      "show",
+		Usage:     "show the state of an auction, read with a verified proof",
+		ArgsUsage: "auction",
+		Action:    show,
+	},
+	{
+		Name:      "export",
+		Usage:     "save the blocks and proofs replaying an auction, from the database of a stopped conode",
+		ArgsUsage: "auction",
+		Action:    export,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "db",
+				Usage: "database file of the conode",
+			},
+			cli.StringFlag{
+				Name:  "out",
+				Usage: "file the segment is saved to",
+			},
+		},
+	},
+	{
+		Name:      "verify",
+		Usage:     "replay an auction offline and check its result on the ledger",
+		ArgsUsage: "auction",
+		Action:    verify,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "segment",
+				Usage: "segment saved by export",
+			},
+			cli.StringFlag{
+				Name:  "db",
+				Usage: "database file of a stopped conode, instead of a segment",
+			},
+		},
+	},
+}
+
+var cliApp = cli.NewApp()
+
+func init() {
+	cliApp.Name = "auction"
+	cliApp.Usage = "Run auctions on a ByzCoin ledger."
+	cliApp.Commands = cmds
+	cliApp.Flags = []cli.Flag{
+		cli.IntFlag{
+			Name:  "debug, d",
+			Value: 0,
+			Usage: "debug-level: 1 for terse, 5 for maximal",
+		},
+		cli.StringFlag{
+			Name:   "config, c",
+			EnvVar: "BC_CONFIG",
+			Value:  cfgpath.GetDataPath("bcadmin"),
+			Usage:  "path to the configuration-directory of bcadmin, holding the keys",
+		},
+		cli.StringFlag{
+			Name:   "bc",
+			EnvVar: "BC",
+			Usage:  "the ByzCoin config to use",
+		},
+		cli.StringFlag{
+			Name:  "sign",
+			Usage: "key file of the signer, the admin key of the ledger by default",
+		},
+		cli.StringFlag{
+			Name:  "darc",
+			Usage: "darc of the new instances, the admin darc by default",
+		},
+		cli.StringFlag{
+			Name:  "contract",
+			Value: auctions.ContractAuctionID,
+			Usage: "contract of the auctions: " + auctions.ContractAuctionID + " or " + sb_auctions.ContractSBAuctionID,
+		},
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "print the results as JSON",
+		},
+	}
+	cliApp.Before = func(c *cli.Context) error {
+		log.SetDebugVisible(c.Int("debug"))
+		lib.ConfigPath = c.GlobalString("config")
+		return nil
+	}
+}
+
+func main() {
+	err := cliApp.Run(os.Args)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ledger is what the commands need to talk to the ledger.
+type ledger struct {
+	cfg    lib.Config
+	cl     *byzcoin.Client
+	signer darc.Signer
+	darcID darc.ID
+}
+
+func loadLedger(c *cli.Context) (l ledger, err error) {
+	bcArg := c.GlobalString("bc")
+	if bcArg == "" {
+		return l, errors.New("--bc flag is required")
+	}
+	l.cfg, l.cl, err = lib.LoadConfig(bcArg)
+	if err != nil {
+		return l, errors.New("couldn't load config file: " + err.Error())
+	}
+
+	var signer *darc.Signer
+	if fn := c.GlobalString("sign"); fn != "" {
+		signer, err = lib.LoadSigner(fn)
+	} else {
+		signer, err = lib.LoadKey(l.cfg.AdminIdentity)
+	}
+	if err != nil {
+		return l, errors.New("couldn't load the key of the signer: " + err.Error())
+	}
+	l.signer = *signer
+
+	l.darcID = l.cfg.AdminDarc.GetBaseID()
+	if d := c.GlobalString("darc"); d != "" {
+		l.darcID, err = hex.DecodeString(d)
+		if err != nil {
+			return l, errors.New("couldn't decode the darc: " + err.Error())
+		}
+	}
+	return l, nil
+}
+
+// ledgerID returns the ID of the ledger of the ByzCoin config, without
+// contacting it.
+func ledgerID(c *cli.Context) (skipchain.SkipBlockID, error) {
+	bcArg := c.GlobalString("bc")
+	if bcArg == "" {
+		return nil, errors.New("--bc flag is required")
+	}
+	cfg, _, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return nil, errors.New("couldn't load config file: " + err.Error())
+	}
+	return cfg.ByzCoinID, nil
+}
+
+// sbContract tells which contract the auctions are run with.
+func sbContract(c *cli.Context) (bool, error) {
+	switch c.GlobalString("contract") {
+	case auctions.ContractAuctionID:
+		return false, nil
+	case sb_auctions.ContractSBAuctionID:
+		return true, nil
+	}
+	return false, errors.New("unknown contract " + c.GlobalString("contract"))
+}
+
+// parseID decodes an instance ID given in hex.
+func parseID(s string) (byzcoin.InstanceID, error) {
+	buf, err := hex.DecodeString(s)
+	if err != nil || len(buf) != len(byzcoin.InstanceID{}) {
+		return byzcoin.InstanceID{}, errors.New("not an instance ID: " + s)
+	}
+	return byzcoin.NewInstanceID(buf), nil
+}
+
+// auctionArg returns the auction given as the first argument.
+func auctionArg(c *cli.Context) (byzcoin.InstanceID, error) {
+	if c.NArg() < 1 {
+		return byzcoin.InstanceID{}, errors.New("please give the auction as argument")
+	}
+	return parseID(c.Args().First())
+}
+
+// idFlag returns the instance ID given in the flag, which is required.
+func idFlag(c *cli.Context, name string) (byzcoin.InstanceID, error) {
+	if c.String(name) == "" {
+		return byzcoin.InstanceID{}, errors.New("--" + name + " flag is required")
+	}
+	return parseID(c.String(name))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dedis/student_19_auctions/auction_audit"
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m, 0)
+}
+
+type cliTest struct {
+	dir string
+	bc  string
+}
+
+// run runs the command and decodes its JSON output.
+func (ct cliTest) run(t *testing.T, args ...string) (map[string]interface{}, error) {
+	b := &bytes.Buffer{}
+	cliApp.Writer = b
+	cliApp.ErrWriter = b
+	err := cliApp.Run(append([]string{"auction", "--config", ct.dir, "--bc", ct.bc, "--json"}, args...))
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]interface{})
+	require.NoError(t, json.Unmarshal(b.Bytes(), &out))
+	return out, nil
+}
+
+func TestCli(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auction-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	lib.ConfigPath = dir
+
+	l := onet.NewTCPTest(cothority.Suite)
+	servers, roster, _ := l.GenTree(3, true)
+	defer l.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	msg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:auction", "invoke:auction.bid", "invoke:auction.close", "spawn:coin", "invoke:coin.mint", "invoke:coin.fetch"}, signer.Identity())
+	require.NoError(t, err)
+	msg.BlockInterval = time.Second / 2
+	cl, _, err := byzcoin.NewLedger(msg, false)
+	require.NoError(t, err)
+	bc, err := lib.SaveConfig(lib.Config{
+		Roster:        *roster,
+		ByzCoinID:     cl.ID,
+		AdminDarc:     msg.GenesisDarc,
+		AdminIdentity: signer.Identity(),
+	})
+	require.NoError(t, err)
+	require.NoError(t, lib.SaveKey(signer))
+	ct := cliTest{dir: dir, bc: bc}
+
+	out, err := ct.run(t, "account", "create")
+	require.NoError(t, err)
+	seller := out["account"].(string)
+	out, err = ct.run(t, "account", "create", "--mint", "100")
+	require.NoError(t, err)
+	bidder := out["account"].(string)
+
+	out, err = ct.run(t, "create", "--seller", seller, "--good", "bananas", "--reserve", "20", "--salt", "pepper")
+	require.NoError(t, err)
+	auction := out["auction"].(string)
+
+	_, err = ct.run(t, "bid", auction, "--account", bidder, "--amount", "30")
+	require.NoError(t, err)
+	_, err = ct.run(t, "bid", auction, "--account", bidder)
+	require.Error(t, err)
+
+	out, err = ct.run(t, "show", auction)
+	require.NoError(t, err)
+	state := out["state"].(map[string]interface{})
+	require.Equal(t, "bananas", state["GoodDescription"])
+	require.Equal(t, bidder, state["HighestBidder"])
+	require.Equal(t, float64(30), state["HighestBid"])
+
+	_, err = ct.run(t, "close", auction, "--salt", "pepper", "--reserve", "10")
+	require.Error(t, err)
+	out, err = ct.run(t, "close", auction, "--salt", "pepper", "--reserve", "20")
+	require.NoError(t, err)
+	require.Equal(t, "WCLOSED", out["state"].(map[string]interface{})["State"])
+
+	out, err = ct.run(t, "account", "show", seller)
+	require.NoError(t, err)
+	require.Equal(t, float64(30), out["balance"])
+
+	_, err = ct.run(t, "--contract", "sb_auction", "show", auction)
+	require.Error(t, err)
+
+	// The database of the running conode is locked, its segment is saved
+	// with the library
+	auctInstID, err := parseID(auction)
+	require.NoError(t, err)
+	bs := servers[0].Service(byzcoin.ServiceName).(*byzcoin.Service)
+	reply, err := cl.GetProof(auctInstID.Slice())
+	require.NoError(t, err)
+	require.NoError(t, auctioncore.Poll(100*time.Millisecond, 10*time.Second, func() (bool, error) {
+		st, err := bs.GetReadOnlyStateTrie(cl.ID)
+		return err == nil && st.GetIndex() >= reply.Proof.Latest.Index, nil
+	}))
+	seg, err := auction_audit.Export(servers[0].Service(skipchain.ServiceName).(*skipchain.Service).GetDB().DB, cl.ID, auctInstID)
+	require.NoError(t, err)
+	buf, err := seg.Encode()
+	require.NoError(t, err)
+	segment := filepath.Join(dir, "segment")
+	require.NoError(t, ioutil.WriteFile(segment, buf, 0644))
+
+	out, err = ct.run(t, "verify", auction, "--segment", segment)
+	require.NoError(t, err)
+	require.Equal(t, true, out["match"])
+	require.Equal(t, float64(30), out["payment"])
+	require.Equal(t, bidder, out["outcome"].(map[string]interface{})["Winner"])
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// result is printed by the commands, as JSON with --json or as indented
+// "key: value" lines.
+type result map[string]interface{}
+
+func output(c *cli.Context, r result) error {
+	v := view(reflect.ValueOf(r))
+	if c.GlobalBool("json") {
+		buf, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(c.App.Writer, string(buf))
+		return err
+	}
+	printText(c.App.Writer, v, "")
+	return nil
+}
+
+// view converts the value to maps, slices and scalars. The IDs and other
+// byte strings are shown in hex, the types with a String method, like the
+// states, as their string.
+func view(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() != reflect.Struct && v.CanInterface() {
+		if s, ok := v.Interface().(fmt.Stringer); ok {
+			if v.Kind() == reflect.Ptr && v.IsNil() {
+				return nil
+			}
+			return s.String()
+		}
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return view(v.Elem())
+	case reflect.Struct:
+		m := make(map[string]interface{})
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				m[v.Type().Field(i).Name] = view(v.Field(i))
+			}
+		}
+		return m
+	case reflect.Map:
+		m := make(map[string]interface{})
+		for _, k := range v.MapKeys() {
+			m[fmt.Sprint(k.Interface())] = view(v.MapIndex(k))
+		}
+		return m
+	case reflect.Array, reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			buf := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(buf), v)
+			return fmt.Sprintf("%x", buf)
+		}
+		l := make([]interface{}, v.Len())
+		for i := range l {
+			l[i] = view(v.Index(i))
+		}
+		return l
+	}
+	return v.Interface()
+}
+
+func printText(w io.Writer, v interface{}, indent string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if isScalar(v[k]) {
+				fmt.Fprintf(w, "%s%s: %v\n", indent, k, v[k])
+			} else {
+				fmt.Fprintf(w, "%s%s:\n", indent, k)
+				printText(w, v[k], indent+"  ")
+			}
+		}
+	case []interface{}:
+		for i, e := range v {
+			if isScalar(e) {
+				fmt.Fprintf(w, "%s- %v\n", indent, e)
+			} else {
+				fmt.Fprintf(w, "%s- %d\n", indent, i)
+				printText(w, e, indent+"  ")
+			}
+		}
+	default:
+		fmt.Fprintf(w, "%s%v\n", indent, v)
+	}
+}
+
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,193 @@
+// Conode runs a cothority server with ByzCoin and all the auction services.
+// Next to the setup and server commands of the cothority conode, it starts
+// a local roster for development:
+//
+//	./conode local 3 --genesis
+//
+// keeps 3 conodes running on localhost, writes their roster to public.toml
+// and creates a ledger giving all the auction rules. Its bc-xxx.cfg and
+// key-xxx.cfg are written next to the roster, ready for bcadmin and
+// auction.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"strconv"
+	"time"
+
+	_ "github.com/dedis/student_19_auctions/auction_house"
+	_ "github.com/dedis/student_19_auctions/auction_index"
+	_ "github.com/dedis/student_19_auctions/auction_receipt"
+	_ "github.com/dedis/student_19_auctions/auctions"
+	_ "github.com/dedis/student_19_auctions/centrilized_auctions"
+	_ "github.com/dedis/student_19_auctions/clock_auctions"
+	_ "github.com/dedis/student_19_auctions/comb_auctions"
+	_ "github.com/dedis/student_19_auctions/double_auctions"
+	_ "github.com/dedis/student_19_auctions/reputation"
+	_ "github.com/dedis/student_19_auctions/sb_auctions"
+	"go.dedis.ch/cothority/v3"
+	_ "go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	_ "go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/app"
+	"go.dedis.ch/onet/v3/cfgpath"
+	"go.dedis.ch/onet/v3/log"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// DefaultName is the name of the binary and of its configuration directory.
+const DefaultName = "conode"
+
+var cliApp = cli.NewApp()
+
+func init() {
+	cliApp.Name = DefaultName
+	cliApp.Usage = "run a cothority server with the auction services"
+	cliApp.Commands = cli.Commands{
+		{
+			Name:    "setup",
+			Aliases: []string{"s"},
+			Usage:   "Setup server configuration (interactive)",
+			Action:  setup,
+		},
+		{
+			Name:   "server",
+			Usage:  "Start cothority server",
+			Action: runServer,
+		},
+		{
+			Name:      "local",
+			Usage:     "Start a roster of conodes on localhost until interrupted",
+			ArgsUsage: "number of conodes, 3 by default",
+			Action:    local,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "dir",
+					Value: ".",
+					Usage: "directory of the roster and of the ledger config",
+				},
+				cli.BoolFlag{
+					Name:  "genesis",
+					Usage: "create a ledger with all the auction rules",
+				},
+				cli.DurationFlag{
+					Name:  "interval, i",
+					Value: time.Second,
+					Usage: "the block interval of the ledger",
+				},
+			},
+		},
+		{
+			Name:      "genesis",
+			Usage:     "Create a ledger whose genesis darc gives all the auction rules",
+			ArgsUsage: "roster.toml",
+			Action:    genesis,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "dir",
+					Value: ".",
+					Usage: "directory of the ledger config and key",
+				},
+				cli.DurationFlag{
+					Name:  "interval, i",
+					Value: 5 * time.Second,
+					Usage: "the block interval of the ledger",
+				},
+			},
+		},
+	}
+	cliApp.Flags = []cli.Flag{
+		cli.IntFlag{
+			Name:  "debug, d",
+			Value: 0,
+			Usage: "debug-level: 1 for terse, 5 for maximal",
+		},
+		cli.StringFlag{
+			Name:  "config, c",
+			Value: path.Join(cfgpath.GetConfigPath(DefaultName), app.DefaultServerConfig),
+			Usage: "Configuration file of the server",
+		},
+	}
+	cliApp.Before = func(c *cli.Context) error {
+		log.SetDebugVisible(c.Int("debug"))
+		return nil
+	}
+}
+
+func main() {
+	err := cliApp.Run(os.Args)
+	log.ErrFatal(err)
+}
+
+func setup(c *cli.Context) error {
+	app.InteractiveConfig(cothority.Suite, DefaultName)
+	return nil
+}
+
+func runServer(c *cli.Context) error {
+	app.RunServer(c.GlobalString("config"))
+	return nil
+}
+
+func local(c *cli.Context) error {
+	n := 3
+	if c.NArg() > 0 {
+		var err error
+		n, err = strconv.Atoi(c.Args().First())
+		if err != nil || n < 1 {
+			return errors.New("the number of conodes must be a positive integer")
+		}
+	}
+
+	l := onet.NewTCPTest(cothority.Suite)
+	defer l.CloseAll()
+	_, roster, _ := l.GenTree(n, true)
+
+	fn := path.Join(c.String("dir"), "public.toml")
+	err := (&app.Group{Roster: roster}).Save(cothority.Suite, fn)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.Writer, "Roster of", n, "conodes written to", fn)
+
+	if c.Bool("genesis") {
+		lib.ConfigPath = c.String("dir")
+		var bc string
+		bc, err = createGenesis(roster, c.Duration("interval"))
+		if err != nil {
+			return err
+		}
+		c.App.Metadata["BC"] = bc
+		fmt.Fprintln(c.App.Writer, "Created ByzCoin, its config is in", bc)
+		fmt.Fprintf(c.App.Writer, "export BC=\"%s\"\n", bc)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	<-sig
+	return nil
+}
+
+func genesis(c *cli.Context) error {
+	if c.NArg() < 1 {
+		return errors.New("please give the roster as argument")
+	}
+	roster, err := lib.ReadRoster(c.Args().First())
+	if err != nil {
+		return err
+	}
+	lib.ConfigPath = c.String("dir")
+	bc, err := createGenesis(roster, c.Duration("interval"))
+	if err != nil {
+		return err
+	}
+	c.App.Metadata["BC"] = bc
+	fmt.Fprintln(c.App.Writer, "Created ByzCoin, its config is in", bc)
+	fmt.Fprintf(c.App.Writer, "export BC=\"%s\"\n", bc)
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/dedis/student_19_auctions/auctions"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/app"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m, 0)
+}
+
+func TestGenesis(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conode-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	l := onet.NewTCPTest(cothority.Suite)
+	_, roster, _ := l.GenTree(3, true)
+	defer l.CloseAll()
+	rf := path.Join(dir, "public.toml")
+	require.NoError(t, (&app.Group{Roster: roster}).Save(cothority.Suite, rf))
+
+	b := &bytes.Buffer{}
+	cliApp.Writer = b
+	require.NoError(t, cliApp.Run([]string{"conode", "genesis", "--dir", dir, "--interval", "500ms", rf}))
+	require.Contains(t, b.String(), "export BC=")
+
+	lib.ConfigPath = dir
+	cfg, cl, err := lib.LoadConfig(cliApp.Metadata["BC"].(string))
+	require.NoError(t, err)
+	for _, rule := range auctionRules() {
+		require.True(t, cfg.AdminDarc.Rules.Contains(darc.Action(rule)), rule)
+	}
+
+	// The admin can run the auctions on the new ledger
+	signer, err := lib.LoadKey(cfg.AdminIdentity)
+	require.NoError(t, err)
+	_, err = auctions.NewClient(cl, *signer).CreateAuction(cfg.AdminDarc.GetBaseID(), auctions.AuctionData{
+		GoodDescription: "bananas",
+		State:           "OPEN",
+	})
+	require.NoError(t, err)
+}
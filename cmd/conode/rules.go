@@ -0,0 +1,79 @@
+package main
+
+import (
+	"time"
+
+	"github.com/dedis/student_19_auctions/auction_house"
+	"github.com/dedis/student_19_auctions/auctions"
+	"github.com/dedis/student_19_auctions/clock_auctions"
+	"github.com/dedis/student_19_auctions/comb_auctions"
+	"github.com/dedis/student_19_auctions/double_auctions"
+	"github.com/dedis/student_19_auctions/reputation"
+	"github.com/dedis/student_19_auctions/sb_auctions"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/calypso"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+)
+
+// contractCommands lists the contracts spawned by the users of the
+// auctions, with the commands they can invoke. The instances created by
+// the contracts themselves, like the bids of sb_auction, are left out.
+var contractCommands = []struct {
+	contractID string
+	commands   []string
+}{
+	{contracts.ContractCoinID, []string{"mint", "fetch", "transfer", "store"}},
+	{contracts.ContractValueID, []string{"update"}},
+	{auctions.ContractAuctionID, []string{"bid", "close", "drop", "forceclose", "retract", "migrate"}},
+	{sb_auctions.ContractSBAuctionID, []string{"bid", "close", "process", "migrate"}},
+	{clock_auctions.ContractClockAuctionID, []string{"join", "stay", "close", "drop"}},
+	{comb_auctions.ContractCombAuctionID, []string{"bid", "close", "drop"}},
+	{double_auctions.ContractDoubleAuctionID, []string{"ask", "bid", "cancel"}},
+	{auction_house.ContractHouseID, nil},
+	{reputation.ContractReputationID, []string{"rate", "dispute", "resolve"}},
+	{calypso.ContractLongTermSecretID, []string{"reshare"}},
+	{calypso.ContractWriteID, nil},
+}
+
+// auctionRules returns the spawn and invoke rules of all the contracts.
+func auctionRules() []string {
+	var rules []string
+	for _, c := range contractCommands {
+		rules = append(rules, "spawn:"+c.contractID)
+		for _, cmd := range c.commands {
+			rules = append(rules, "invoke:"+c.contractID+"."+cmd)
+		}
+	}
+	return rules
+}
+
+// createGenesis creates a ledger whose genesis darc, owned by a new signer,
+// gives all the auction rules. The config and the key are saved in
+// lib.ConfigPath, to be used by bcadmin and auction, and the config file
+// is returned.
+func createGenesis(roster *onet.Roster, interval time.Duration) (string, error) {
+	owner := darc.NewSignerEd25519(nil, nil)
+	msg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster, auctionRules(), owner.Identity())
+	if err != nil {
+		return "", err
+	}
+	msg.BlockInterval = interval
+
+	_, resp, err := byzcoin.NewLedger(msg, false)
+	if err != nil {
+		return "", err
+	}
+	fn, err := lib.SaveConfig(lib.Config{
+		ByzCoinID:     resp.Skipblock.SkipChainID(),
+		Roster:        *roster,
+		AdminDarc:     msg.GenesisDarc,
+		AdminIdentity: owner.Identity(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return fn, lib.SaveKey(owner)
+}
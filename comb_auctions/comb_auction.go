@@ -0,0 +1,402 @@
+package comb_auctions
+
+import (
+	"crypto/sha256"
+	"errors"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+// ContractCombAuctionID identifies a combinatorial auction contract
+var ContractCombAuctionID = "comb_auction"
+
+// ContractCombBidID identifies the instances holding the bids of a
+// combinatorial auction. They are only created and updated by the
+// comb_auction contract.
+var ContractCombBidID = "comb_auction_bid"
+
+// Items are kept as a bitmask during the winner determination.
+const maxItems = 64
+
+// maxBundles is the number of exclusive bundles a bidder can bid on.
+const maxBundles = 16
+
+// MaxAuctionBidders bounds the bidders of an auction. Closing it runs the
+// winner determination once for the allocation and once more for every
+// winner, over all the bids.
+const MaxAuctionBidders = 256
+
+type contractCombAuction struct {
+	byzcoin.BasicContract
+	AuctionData
+	contracts auctioncore.Contracts
+}
+
+func (s *Service) contractCombAuctionFromBytes(in []byte) (byzcoin.Contract, error) {
+	return NewContract(s.byzService(), in)
+}
+
+// NewContract returns the combinatorial auction contract of an instance
+// holding in. The coins it pays out are stored through the coin contract
+// of contracts, which is the ByzCoin service unless the auction is
+// replayed offline.
+func NewContract(contracts auctioncore.Contracts, in []byte) (byzcoin.Contract, error) {
+	cv := &contractCombAuction{}
+	err := protobuf.Decode(in, &cv.AuctionData)
+	if err != nil {
+		return nil, err
+	}
+	cv.contracts = contracts
+	return cv, nil
+}
+
+type contractCombBid struct {
+	byzcoin.BasicContract
+	StoredBid
+}
+
+func contractCombBidFromBytes(in []byte) (byzcoin.Contract, error) {
+	cv := &contractCombBid{}
+	err := protobuf.Decode(in, &cv.StoredBid)
+	if err != nil {
+		return nil, err
+	}
+	return cv, nil
+}
+
+// Spawn creates a new combinatorial auction instance with the items listed
+// in the auction argument.
+func (c *contractCombAuction) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	auctionBuf := inst.Spawn.Args.Search("auction")
+	if auctionBuf == nil {
+		return nil, nil, auctioncore.ErrMissingAuction
+	}
+
+	auction := AuctionData{}
+	err = protobuf.Decode(auctionBuf, &auction)
+	if err != nil {
+		return nil, nil, auctioncore.ErrNotAuction
+	}
+	if len(auction.Items) == 0 || len(auction.Items) > maxItems {
+		return nil, nil, errors.New("an auction needs between 1 and 64 items")
+	}
+	if auction.State != auctioncore.StateOpen || auction.BidCount != 0 || len(auction.Winners) != 0 {
+		return nil, nil, errors.New("a new auction must be open and without bids")
+	}
+	if auction.MaxBidders > MaxAuctionBidders {
+		return nil, nil, errors.New("the auction cannot take that many bidders")
+	}
+
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""), ContractCombAuctionID, auctionBuf, darcID),
+	}
+	return
+}
+
+// VerifyInstruction lets anybody bid, the owner of the bidder account is
+// checked when the bid is invoked. The other commands need the signature of
+// the darc controlling the auction.
+func (c *contractCombAuction) VerifyInstruction(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, ctxHash []byte) error {
+	if inst.GetType() == byzcoin.InvokeType && inst.Invoke.Command == "bid" {
+		return auctioncore.VerifySignatures(inst, ctxHash)
+	}
+	return c.BasicContract.VerifyInstruction(rst, inst, ctxHash)
+}
+
+// The following methods are available:
+//   - bid: takes the bundles of a bidder and the coins to escrow
+//   - close: runs the winner determination, pays the seller and refunds
+//   - drop: cancels the auction and refunds all the bidders
+func (c *contractCombAuction) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var auctionBuf []byte
+	var darcID darc.ID
+	auctionBuf, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+	auction := AuctionData{}
+	err = protobuf.Decode(auctionBuf, &auction)
+	if err != nil {
+		return
+	}
+
+	if auction.State != auctioncore.StateOpen {
+		return nil, nil, auctioncore.ErrAuctionClosed
+	}
+
+	switch inst.Invoke.Command {
+	case "bid":
+		bidBuf := inst.Invoke.Args.Search("bid")
+		if bidBuf == nil {
+			return nil, nil, auctioncore.ErrMissingBid
+		}
+		bid := BidData{}
+		err = protobuf.Decode(bidBuf, &bid)
+		if err != nil {
+			return nil, nil, auctioncore.ErrNotBid
+		}
+		if bid.BidderAccount == auction.SellerAccount {
+			return nil, nil, auctioncore.ErrSellerBid
+		}
+		err = auctioncore.VerifyOwner(rst, inst, bid.BidderAccount)
+		if err != nil {
+			return nil, nil, errors.New("bid not signed by the owner of the bidder account: " + err.Error())
+		}
+		var maxPrice uint64
+		maxPrice, err = checkBundles(auction, bid.Bundles)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var escrowed uint64
+		escrowed, cout, err = auctioncore.CollectCoins(rst, bid.BidderAccount, coins)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		bidInstID := bidInstanceID(inst.InstanceID, bid.BidderAccount)
+		var stored StoredBid
+		var found bool
+		stored, found, err = getStoredBid(rst, bidInstID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !found && auction.BidCount >= auction.maxBidders() {
+			return nil, nil, errors.New("the auction takes no more bidders")
+		}
+
+		// The escrow must cover the most expensive bundle. It never
+		// shrinks before the auction is over.
+		needed := uint64(0)
+		if maxPrice > stored.Escrow {
+			needed = maxPrice - stored.Escrow
+		}
+		if escrowed != needed {
+			return nil, nil, auctioncore.ErrEscrowMismatch
+		}
+		stored.Escrow += needed
+		if stored.Escrow < maxPrice {
+			return nil, nil, auctioncore.ErrEscrowMismatch
+		}
+		stored.Bundles = bid.Bundles
+
+		action := byzcoin.Update
+		if !found {
+			action = byzcoin.Create
+			stored.Auction = inst.InstanceID
+			stored.BidderAccount = bid.BidderAccount
+			stored.Next = auction.BidsRoot
+			auction.BidCount++
+			auction.BidsRoot = bidInstID
+		}
+
+		var storedBuf []byte
+		storedBuf, err = protobuf.Encode(&stored)
+		if err != nil {
+			return nil, nil, errors.New("encode stored bid buf sc")
+		}
+		sc = append(sc, byzcoin.NewStateChange(action, bidInstID,
+			ContractCombBidID, storedBuf, darcID))
+
+		if !found {
+			auctionBuf, err = protobuf.Encode(&auction)
+			if err != nil {
+				return nil, nil, errors.New("encode auction buf sc")
+			}
+			sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+				ContractCombAuctionID, auctionBuf, darcID))
+		}
+
+	case "close":
+		var bids []StoredBid
+		bids, err = getBids(rst, auction)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		bidders := make([][]bundle, len(bids))
+		for i, bid := range bids {
+			for _, b := range bid.Bundles {
+				bidders[i] = append(bidders[i], bundle{mask: itemsMask(b.Items), price: b.Price})
+			}
+		}
+		alloc := determineWinners(bidders, -1)
+		payments := vcgPayments(bidders, alloc)
+
+		// The winners pay their VCG price to the seller, the rest of the
+		// escrow goes back to the bidders.
+		payouts := auctioncore.Payouts{}
+		auction.Winners = nil
+		for i, bid := range bids {
+			payouts.Add(auction.SellerAccount, payments[i])
+			payouts.Add(bid.BidderAccount, bid.Escrow-payments[i])
+			if alloc.choice[i] == -1 {
+				continue
+			}
+			won := bid.Bundles[alloc.choice[i]]
+			auction.Winners = append(auction.Winners, WinnerData{
+				BidderAccount: bid.BidderAccount,
+				Items:         won.Items,
+				Bid:           won.Price,
+				Payment:       payments[i],
+			})
+		}
+		sc, err = payouts.StoreCoins(c.contracts, rst)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		auction.Welfare = alloc.welfare
+		auction.Exact = alloc.exact
+		auction.State = auctioncore.StateClosed
+		if len(auction.Winners) > 0 {
+			auction.State = auctioncore.StateWClosed
+		}
+
+		auctionBuf, err = protobuf.Encode(&auction)
+		if err != nil {
+			return nil, nil, errors.New("encode auction buf sc: close")
+		}
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+			ContractCombAuctionID, auctionBuf, darcID))
+
+	case "drop":
+		var bids []StoredBid
+		if auction.BidCount > 0 {
+			bids, err = getBids(rst, auction)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		payouts := auctioncore.Payouts{}
+		for _, bid := range bids {
+			payouts.Add(bid.BidderAccount, bid.Escrow)
+		}
+		sc, err = payouts.StoreCoins(c.contracts, rst)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		auction.State = auctioncore.StateDropped
+		auctionBuf, err = protobuf.Encode(&auction)
+		if err != nil {
+			return nil, nil, errors.New("encode auction buf sc: drop")
+		}
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+			ContractCombAuctionID, auctionBuf, darcID))
+
+	default:
+		err = errors.New("Combinatorial auction contract can only bid, close or drop")
+	}
+
+	return
+}
+
+// maxBidders returns the number of bidders the auction accepts.
+func (a *AuctionData) maxBidders() uint32 {
+	if a.MaxBidders == 0 {
+		return MaxAuctionBidders
+	}
+	return a.MaxBidders
+}
+
+// checkBundles verifies the bundles of a bid and returns the highest price.
+func checkBundles(auction AuctionData, bundles []BundleBid) (uint64, error) {
+	if len(bundles) == 0 || len(bundles) > maxBundles {
+		return 0, errors.New("a bid needs between 1 and 16 bundles")
+	}
+	var maxPrice uint64
+	for _, b := range bundles {
+		if b.Price == 0 {
+			return 0, auctioncore.ErrZeroBid
+		}
+		if len(b.Items) == 0 {
+			return 0, errors.New("empty bundle")
+		}
+		var mask uint64
+		for _, item := range b.Items {
+			if item >= uint32(len(auction.Items)) {
+				return 0, errors.New("unknown item in bundle")
+			}
+			if mask&(1<<item) != 0 {
+				return 0, errors.New("item twice in bundle")
+			}
+			mask |= 1 << item
+		}
+		if b.Price > maxPrice {
+			maxPrice = b.Price
+		}
+	}
+	return maxPrice, nil
+}
+
+func itemsMask(items []uint32) uint64 {
+	var mask uint64
+	for _, item := range items {
+		mask |= 1 << item
+	}
+	return mask
+}
+
+// getBids walks the bid instances of the auction, starting from BidsRoot,
+// and returns them in the order they were first placed.
+func getBids(rst byzcoin.ReadOnlyStateTrie, auction AuctionData) ([]StoredBid, error) {
+	bids := make([]StoredBid, auction.BidCount)
+	next := auction.BidsRoot
+	for i := len(bids) - 1; i >= 0; i-- {
+		stored, found, err := getStoredBid(rst, next)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, errors.New("missing bid instance")
+		}
+		bids[i] = stored
+		next = stored.Next
+	}
+	return bids, nil
+}
+
+// bidInstanceID returns the instance holding the bid of bidAcc in the
+// auction auctInstID.
+func bidInstanceID(auctInstID byzcoin.InstanceID, bidAcc byzcoin.InstanceID) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write([]byte(ContractCombBidID))
+	h.Write(auctInstID.Slice())
+	h.Write(bidAcc.Slice())
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
+
+// getStoredBid reads a bid instance. It returns false if the instance does
+// not exist yet.
+func getStoredBid(rst byzcoin.ReadOnlyStateTrie, bidInstID byzcoin.InstanceID) (StoredBid, bool, error) {
+	stored := StoredBid{}
+	val, _, contractID, _, err := rst.GetValues(bidInstID.Slice())
+	if auctioncore.IsKeyNotSet(err) {
+		return stored, false, nil
+	}
+	if err != nil {
+		return stored, false, err
+	}
+	if contractID != ContractCombBidID {
+		return stored, false, errors.New("instance is not a bid")
+	}
+	err = protobuf.Decode(val, &stored)
+	if err != nil {
+		return stored, false, err
+	}
+	return stored, true, nil
+}
@@ -0,0 +1,143 @@
+package comb_auctions
+
+import (
+	"testing"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+func TestContractCombAuction_Invoke(t *testing.T) {
+	// Create a new ledger and prepare for proper closing
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	//Creating seller and bidder accounts
+	amount := uint64(100)
+	sellAccInstID := bct.CreateAccount(t, contracts.CoinName, 0)
+	bidAcc1 := bct.CreateAccount(t, contracts.CoinName, amount)
+	bidAcc2 := bct.CreateAccount(t, contracts.CoinName, amount)
+	bidAcc3 := bct.CreateAccount(t, contracts.CoinName, amount)
+
+	auctInstID := bct.createAuction(t, sellAccInstID, "table", "chairs")
+
+	//Bidder 1 wants both items together
+	err := bct.addBid(t, auctInstID, bidAcc1, 50, BundleBid{Items: []uint32{0, 1}, Price: 50})
+	require.NoError(t, err)
+
+	//Escrow must cover the most expensive bundle
+	err = bct.addBid(t, auctInstID, bidAcc2, 10, BundleBid{Items: []uint32{0}, Price: 30})
+	require.Error(t, err)
+	err = bct.addBid(t, auctInstID, bidAcc2, 30, BundleBid{Items: []uint32{0}, Price: 30})
+	require.NoError(t, err)
+
+	//Unknown item
+	err = bct.addBid(t, auctInstID, bidAcc3, 30, BundleBid{Items: []uint32{2}, Price: 30})
+	require.Error(t, err)
+	err = bct.addBid(t, auctInstID, bidAcc3, 35, BundleBid{Items: []uint32{1}, Price: 35})
+	require.NoError(t, err)
+
+	//Seller can not bid
+	err = bct.addBid(t, auctInstID, sellAccInstID, 0, BundleBid{Items: []uint32{1}, Price: 35})
+	require.Error(t, err)
+
+	//Only the owner of the account can replace its bundles
+	intruder := darc.NewSignerEd25519(nil, nil)
+	bidBuf, err := protobuf.Encode(&BidData{BidderAccount: bidAcc1, Bundles: []BundleBid{{Items: []uint32{0}, Price: 1}}})
+	require.NoError(t, err)
+	ctx := byzcoin.ClientTransaction{Instructions: byzcoin.Instructions{{
+		InstanceID: auctInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractCombAuctionID,
+			Command:    "bid",
+			Args:       byzcoin.Arguments{{Name: "bid", Value: bidBuf}},
+		},
+		SignerCounter: []uint64{1},
+	}}}
+	require.NoError(t, ctx.FillSignersAndSignWith(intruder))
+	_, err = bct.Cl.AddTransactionAndWait(ctx, 10)
+	require.Error(t, err)
+
+	auctS := bct.proofAndDecodeAuction(t, auctInstID)
+	require.Equal(t, uint32(3), auctS.BidCount)
+
+	require.NoError(t, bct.invokeAuction(t, auctInstID, "close"))
+
+	//Bidders 2 and 3 win with 65 against 50. Each pays what it takes
+	//from the others: 50 - 35 = 15 and 50 - 30 = 20.
+	auctS = bct.proofAndDecodeAuction(t, auctInstID)
+	require.Equal(t, auctioncore.StateWClosed, auctS.State)
+	require.True(t, auctS.Exact)
+	require.Equal(t, uint64(65), auctS.Welfare)
+	require.Equal(t, []WinnerData{
+		{BidderAccount: bidAcc2, Items: []uint32{0}, Bid: 30, Payment: 15},
+		{BidderAccount: bidAcc3, Items: []uint32{1}, Bid: 35, Payment: 20},
+	}, auctS.Winners)
+
+	require.Equal(t, uint64(35), bct.CoinBalance(t, sellAccInstID))
+	require.Equal(t, amount, bct.CoinBalance(t, bidAcc1))
+	require.Equal(t, amount-15, bct.CoinBalance(t, bidAcc2))
+	require.Equal(t, amount-20, bct.CoinBalance(t, bidAcc3))
+
+	//No more bids once closed
+	err = bct.addBid(t, auctInstID, bidAcc1, 0, BundleBid{Items: []uint32{0, 1}, Price: 50})
+	require.Error(t, err)
+}
+
+func TestContractCombAuction_Drop(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	amount := uint64(100)
+	sellAccInstID := bct.CreateAccount(t, contracts.CoinName, 0)
+	bidAcc := bct.CreateAccount(t, contracts.CoinName, amount)
+
+	auctInstID := bct.createAuction(t, sellAccInstID, "table", "chairs")
+
+	//Raising the bid only escrows the difference
+	err := bct.addBid(t, auctInstID, bidAcc, 20, BundleBid{Items: []uint32{0}, Price: 20})
+	require.NoError(t, err)
+	err = bct.addBid(t, auctInstID, bidAcc, 20, BundleBid{Items: []uint32{0}, Price: 20},
+		BundleBid{Items: []uint32{0, 1}, Price: 40})
+	require.NoError(t, err)
+	require.Equal(t, amount-40, bct.CoinBalance(t, bidAcc))
+
+	require.NoError(t, bct.invokeAuction(t, auctInstID, "drop"))
+
+	auctS := bct.proofAndDecodeAuction(t, auctInstID)
+	require.Equal(t, auctioncore.StateDropped, auctS.State)
+	require.Equal(t, amount, bct.CoinBalance(t, bidAcc))
+	require.Equal(t, uint64(0), bct.CoinBalance(t, sellAccInstID))
+}
+
+func TestContractCombAuction_MaxBidders(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	sellAccInstID := bct.CreateAccount(t, contracts.CoinName, 0)
+	bidAcc1 := bct.CreateAccount(t, contracts.CoinName, 100)
+	bidAcc2 := bct.CreateAccount(t, contracts.CoinName, 100)
+	auction := AuctionData{
+		Description:   "estate",
+		SellerAccount: sellAccInstID,
+		Items:         []ItemData{{Name: "table"}},
+		State:         auctioncore.StateOpen,
+		MaxBidders:    MaxAuctionBidders + 1,
+	}
+	_, err := bct.spawnAuction(t, auction)
+	require.Error(t, err)
+
+	auction.MaxBidders = 1
+	auctInstID, err := bct.spawnAuction(t, auction)
+	require.NoError(t, err)
+	require.NoError(t, bct.addBid(t, auctInstID, bidAcc1, 10, BundleBid{Items: []uint32{0}, Price: 10}))
+	require.Error(t, bct.addBid(t, auctInstID, bidAcc2, 20, BundleBid{Items: []uint32{0}, Price: 20}))
+
+	//A bidder already in can still raise its bid
+	require.NoError(t, bct.addBid(t, auctInstID, bidAcc1, 10, BundleBid{Items: []uint32{0}, Price: 20}))
+	require.Equal(t, uint64(100), bct.CoinBalance(t, bidAcc2))
+}
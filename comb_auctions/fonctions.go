@@ -0,0 +1,112 @@
+package comb_auctions
+
+import (
+	"testing"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/dedis/student_19_auctions/auctioncore/bctest"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/protobuf"
+)
+
+// bcTest is used here to provide some simple test structure for different
+// tests.
+type bcTest struct {
+	*bctest.BCTest
+}
+
+func newBCTest(t *testing.T) *bcTest {
+	// The genesis darc has the right to create and update the auction and
+	// coin contracts.
+	return &bcTest{bctest.New(t,
+		"spawn:comb_auction", "invoke:comb_auction.bid", "invoke:comb_auction.close", "invoke:comb_auction.drop",
+		"spawn:coin", "invoke:coin.mint", "invoke:coin.fetch")}
+}
+
+func (bct *bcTest) createAuction(t *testing.T, sellAccInstID byzcoin.InstanceID, items ...string) byzcoin.InstanceID {
+	auction := AuctionData{
+		Description:   "estate",
+		SellerAccount: sellAccInstID,
+		State:         auctioncore.StateOpen,
+	}
+	for _, item := range items {
+		auction.Items = append(auction.Items, ItemData{Name: item})
+	}
+	auctInstID, err := bct.spawnAuction(t, auction)
+	require.NoError(t, err)
+	return auctInstID
+}
+
+func (bct *bcTest) spawnAuction(t *testing.T, auction AuctionData) (byzcoin.InstanceID, error) {
+	auctionBuf, err := protobuf.Encode(&auction)
+	require.NoError(t, err)
+
+	ctx, err := bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(bct.GDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractCombAuctionID,
+			Args:       byzcoin.Arguments{{Name: "auction", Value: auctionBuf}},
+		},
+	})
+	if err != nil {
+		return byzcoin.InstanceID{}, err
+	}
+	return ctx.Instructions[0].DeriveID(""), nil
+}
+
+// addBid fetches escrow coins from the bidder account and bids on the
+// bundles in the same transaction.
+func (bct *bcTest) addBid(t *testing.T, auctInstID byzcoin.InstanceID, bidAccInstID byzcoin.InstanceID, escrow uint64, bundles ...BundleBid) error {
+	bidBuf, err := protobuf.Encode(&BidData{BidderAccount: bidAccInstID, Bundles: bundles})
+	require.NoError(t, err)
+
+	_, err = bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: bidAccInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: contracts.ContractCoinID,
+			Command:    "fetch",
+			Args:       byzcoin.Arguments{{Name: "coins", Value: auctioncore.EncodeAmount(escrow)}},
+		},
+	}, byzcoin.Instruction{
+		InstanceID: auctInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractCombAuctionID,
+			Command:    "bid",
+			Args:       byzcoin.Arguments{{Name: "bid", Value: bidBuf}},
+		},
+	})
+	return err
+}
+
+func (bct *bcTest) invokeAuction(t *testing.T, auctInstID byzcoin.InstanceID, command string) error {
+	_, err := bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: auctInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractCombAuctionID,
+			Command:    command,
+		},
+	})
+	return err
+}
+
+func (bct *bcTest) proofAndDecodeAuction(t *testing.T, auctInstID byzcoin.InstanceID) AuctionData {
+	//Get the proof from byzcoin
+	reply, err := bct.Cl.GetProof(auctInstID.Slice())
+	require.Nil(t, err)
+	// Make sure the proof is a matching proof and not a proof of absence.
+	proof := reply.Proof
+	require.True(t, proof.InclusionProof.Match(auctInstID.Slice()))
+
+	// Get the raw values of the proof.
+	_, val, _, _, err := proof.KeyValue()
+	require.Nil(t, err)
+
+	// And decode the buffer to a AuctionData
+	auctS := AuctionData{}
+	err = protobuf.Decode(val, &auctS)
+	require.Nil(t, err)
+
+	return auctS
+}
@@ -0,0 +1,66 @@
+package comb_auctions
+
+import "go.dedis.ch/cothority/v3/byzcoin"
+
+// PROTOSTART
+// package comb_auctions;
+// import "byzcoin.proto";
+//
+// option java_package = "ch.epfl.dedis.lib.proto";
+// option java_outer_classname = "CombAuctions";
+
+// AuctionData is the value of a combinatorial auction instance. The seller
+// lists several items and the bidders bid on bundles of them.
+type AuctionData struct {
+	Description   string
+	SellerAccount byzcoin.InstanceID // The place to credit the payments when the auction is over
+	Items         []ItemData
+	State         string
+	BidCount      uint32             // Number of bid instances attached to this auction
+	BidsRoot      byzcoin.InstanceID // Last bid instance created, the bids are chained from here
+	Winners       []WinnerData       `protobuf:"opt"`
+	Welfare       uint64             `protobuf:"opt"` // Sum of the winning bids
+	Exact         bool               `protobuf:"opt"` // The allocation has been proven optimal
+	MaxBidders    uint32             `protobuf:"opt"` // Bidders accepted, MaxAuctionBidders if 0
+}
+
+// ItemData describes one of the items of an auction. Bundles refer to the
+// items by their index in AuctionData.Items.
+type ItemData struct {
+	Name        string
+	Description string
+}
+
+// BundleBid offers Price for getting all the listed items together.
+type BundleBid struct {
+	Items []uint32
+	Price uint64
+}
+
+// BidData is the argument of a "bid" instruction. The bundles of a bidder
+// are exclusive: the bidder wins at most one of them. A new bid replaces
+// the bundles of the previous one.
+type BidData struct {
+	BidderAccount byzcoin.InstanceID
+	Bundles       []BundleBid
+}
+
+// StoredBid is the value of a bid instance, derived from the auction and the
+// bidder account. Escrow holds the coins of the bidder, which must cover the
+// most expensive bundle.
+type StoredBid struct {
+	Auction       byzcoin.InstanceID
+	BidderAccount byzcoin.InstanceID
+	Bundles       []BundleBid
+	Escrow        uint64
+	Next          byzcoin.InstanceID // Bid instance created before this one, zero for the first bid
+}
+
+// WinnerData is a bundle won at close. Payment is the VCG price paid by
+// the winner, which is never higher than its bid.
+type WinnerData struct {
+	BidderAccount byzcoin.InstanceID
+	Items         []uint32
+	Bid           uint64
+	Payment       uint64
+}
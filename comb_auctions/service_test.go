@@ -0,0 +1,11 @@
+package comb_auctions
+
+import (
+	"testing"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m, 0)
+}
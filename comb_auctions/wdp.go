@@ -0,0 +1,145 @@
+package comb_auctions
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// maxExactNodes bounds the search of the exact winner determination. When
+// the search tree is bigger, the best allocation found so far is kept,
+// seeded by the greedy heuristic. The bound is the same on all the nodes,
+// so the outcome stays deterministic.
+const maxExactNodes = 1 << 16
+
+// bundle is a bundle bid where the items are a bitmask.
+type bundle struct {
+	mask  uint64
+	price uint64
+}
+
+// allocation gives, for every bidder, the index of the bundle it wins or -1.
+type allocation struct {
+	choice  []int
+	welfare uint64
+	exact   bool
+}
+
+// determineWinners returns the allocation of the items maximizing the sum
+// of the winning bids, with at most one bundle per bidder and every item
+// sold at most once. The bidder skip, if not -1, is left out, which is
+// needed to compute the VCG payments.
+func determineWinners(bidders [][]bundle, skip int) allocation {
+	best := greedyWinners(bidders, skip)
+
+	// upper[i] is the best the bidders from i on can add to the welfare.
+	upper := make([]uint64, len(bidders)+1)
+	for i := len(bidders) - 1; i >= 0; i-- {
+		upper[i] = upper[i+1]
+		if i == skip {
+			continue
+		}
+		var max uint64
+		for _, b := range bidders[i] {
+			if b.price > max {
+				max = b.price
+			}
+		}
+		upper[i] += max
+	}
+
+	current := make([]int, len(bidders))
+	for i := range current {
+		current[i] = -1
+	}
+	nodes := 0
+	var search func(i int, used uint64, welfare uint64)
+	search = func(i int, used uint64, welfare uint64) {
+		nodes++
+		if nodes > maxExactNodes || welfare+upper[i] <= best.welfare {
+			return
+		}
+		if i == len(bidders) {
+			best.welfare = welfare
+			best.choice = append([]int{}, current...)
+			return
+		}
+		if i != skip {
+			for j, b := range bidders[i] {
+				if used&b.mask != 0 {
+					continue
+				}
+				current[i] = j
+				search(i+1, used|b.mask, welfare+b.price)
+				current[i] = -1
+			}
+		}
+		search(i+1, used, welfare)
+	}
+	search(0, 0, 0)
+	best.exact = nodes <= maxExactNodes
+	return best
+}
+
+// greedyWinners is the heuristic used to seed and bound the exact search.
+// It takes the bundles by decreasing price per item and keeps every bundle
+// that still fits.
+func greedyWinners(bidders [][]bundle, skip int) allocation {
+	type candidate struct {
+		bidder, index int
+		bundle
+	}
+	var candidates []candidate
+	for i, bs := range bidders {
+		if i == skip {
+			continue
+		}
+		for j, b := range bs {
+			candidates = append(candidates, candidate{i, j, b})
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		// price_a / size_a > price_b / size_b, without dividing
+		ha, la := bits.Mul64(candidates[a].price, uint64(bits.OnesCount64(candidates[b].mask)))
+		hb, lb := bits.Mul64(candidates[b].price, uint64(bits.OnesCount64(candidates[a].mask)))
+		return ha > hb || (ha == hb && la > lb)
+	})
+
+	alloc := allocation{choice: make([]int, len(bidders))}
+	for i := range alloc.choice {
+		alloc.choice[i] = -1
+	}
+	var used uint64
+	for _, c := range candidates {
+		if alloc.choice[c.bidder] != -1 || used&c.mask != 0 {
+			continue
+		}
+		alloc.choice[c.bidder] = c.index
+		used |= c.mask
+		alloc.welfare += c.price
+	}
+	return alloc
+}
+
+// vcgPayments returns what every bidder pays for the allocation: the
+// welfare the others would get without it, minus the welfare the others
+// get with it.
+func vcgPayments(bidders [][]bundle, alloc allocation) []uint64 {
+	payments := make([]uint64, len(bidders))
+	for i, j := range alloc.choice {
+		if j == -1 {
+			continue
+		}
+		bid := bidders[i][j].price
+		without := determineWinners(bidders, i).welfare
+		others := alloc.welfare - bid
+		// With the heuristic the allocation might not be optimal, so the
+		// payment is kept between 0 and the bid.
+		if without > others {
+			payments[i] = without - others
+		}
+		if payments[i] > bid {
+			payments[i] = bid
+		}
+	}
+	return payments
+}
@@ -0,0 +1,82 @@
+package comb_auctions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetermineWinners(t *testing.T) {
+	// Items A=1, B=2, C=4
+	bidders := [][]bundle{
+		{{mask: 3, price: 50}},
+		{{mask: 1, price: 30}},
+		{{mask: 2, price: 35}, {mask: 6, price: 45}},
+		{{mask: 4, price: 12}},
+	}
+	alloc := determineWinners(bidders, -1)
+	require.True(t, alloc.exact)
+	require.Equal(t, uint64(77), alloc.welfare)
+	require.Equal(t, []int{-1, 0, 0, 0}, alloc.choice)
+
+	// Without bidder 1, bidder 0 takes A and B.
+	require.Equal(t, uint64(62), determineWinners(bidders, 1).welfare)
+
+	payments := vcgPayments(bidders, alloc)
+	require.Equal(t, []uint64{0, 15, 20, 10}, payments)
+}
+
+func TestDetermineWinners_Greedy(t *testing.T) {
+	// The greedy heuristic takes the bundles with the best price per
+	// item. Here the two single items are worth more per item than the
+	// pair, and together more than it: greedy is already optimal.
+	bidders := [][]bundle{
+		{{mask: 3, price: 40}},
+		{{mask: 1, price: 30}},
+		{{mask: 2, price: 30}},
+	}
+	require.Equal(t, uint64(60), greedyWinners(bidders, -1).welfare)
+	require.Equal(t, uint64(60), determineWinners(bidders, -1).welfare)
+
+	// The pair at 11 per item comes first and blocks the single item and
+	// the other pair, which are worth more together. The exact search
+	// finds them.
+	bidders = [][]bundle{
+		{{mask: 3, price: 22}},
+		{{mask: 1, price: 10}},
+		{{mask: 6, price: 20}},
+	}
+	greedy := greedyWinners(bidders, -1)
+	require.Equal(t, uint64(22), greedy.welfare)
+	require.Equal(t, []int{0, -1, -1}, greedy.choice)
+	alloc := determineWinners(bidders, -1)
+	require.Equal(t, uint64(30), alloc.welfare)
+	require.Equal(t, []int{-1, 0, 0}, alloc.choice)
+}
+
+func TestDetermineWinners_Bounded(t *testing.T) {
+	// Many overlapping bids make the search tree bigger than the bound, the
+	// outcome is still a valid allocation at least as good as greedy.
+	var bidders [][]bundle
+	for i := 0; i < 40; i++ {
+		bidders = append(bidders, []bundle{
+			{mask: uint64(1)<<uint(i%20) | uint64(1)<<uint((i*7)%20+20), price: uint64(10 + i%7)},
+			{mask: uint64(1) << uint(i%20+40), price: uint64(5 + i%3)},
+		})
+	}
+	alloc := determineWinners(bidders, -1)
+	require.False(t, alloc.exact)
+	require.True(t, alloc.welfare >= greedyWinners(bidders, -1).welfare)
+
+	var used uint64
+	var welfare uint64
+	for i, j := range alloc.choice {
+		if j == -1 {
+			continue
+		}
+		require.Zero(t, used&bidders[i][j].mask)
+		used |= bidders[i][j].mask
+		welfare += bidders[i][j].price
+	}
+	require.Equal(t, alloc.welfare, welfare)
+}
@@ -0,0 +1,386 @@
+package double_auctions
+
+import (
+	"errors"
+	"math/bits"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+// ContractDoubleAuctionID identifies an order book contract
+var ContractDoubleAuctionID = "double_auction"
+
+// MaxBookOrders bounds the resting orders on each side of a book. The whole
+// book is one instance, read and written by every order. A full side makes
+// room for a better priced order by evicting its worst one, so cheap orders
+// far from the market cannot lock the book.
+const MaxBookOrders = 256
+
+type contractDoubleAuction struct {
+	byzcoin.BasicContract
+	BookData
+	s *Service
+}
+
+func (s *Service) contractDoubleAuctionFromBytes(in []byte) (byzcoin.Contract, error) {
+	cv := &contractDoubleAuction{}
+	err := protobuf.Decode(in, &cv.BookData)
+	if err != nil {
+		return nil, err
+	}
+	cv.s = s
+	return cv, nil
+}
+
+// Spawn creates a new, empty, order book for the coins given in the book
+// argument.
+func (c *contractDoubleAuction) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bookBuf := inst.Spawn.Args.Search("book")
+	if bookBuf == nil {
+		return nil, nil, errors.New("need an argument with name book")
+	}
+	book := BookData{}
+	err = protobuf.Decode(bookBuf, &book)
+	if err != nil {
+		return nil, nil, errors.New("not an order book")
+	}
+	if book.Currency == book.Good {
+		return nil, nil, errors.New("currency and good must be different coins")
+	}
+	if len(book.Asks) != 0 || len(book.Bids) != 0 || book.Trades != 0 {
+		return nil, nil, errors.New("a new order book must be empty")
+	}
+	if book.MaxOrders > MaxBookOrders {
+		return nil, nil, errors.New("the book cannot hold that many orders")
+	}
+
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""), ContractDoubleAuctionID, bookBuf, darcID),
+	}
+	return
+}
+
+// VerifyInstruction lets anybody place orders, as the escrowed coins are
+// fetched with the signature of their owner. An order can only be
+// cancelled by the identity that placed it.
+func (c *contractDoubleAuction) VerifyInstruction(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, ctxHash []byte) error {
+	if inst.GetType() != byzcoin.InvokeType {
+		return c.BasicContract.VerifyInstruction(rst, inst, ctxHash)
+	}
+	switch inst.Invoke.Command {
+	case "ask", "bid":
+		return auctioncore.VerifySignatures(inst, ctxHash)
+	case "cancel":
+		if err := auctioncore.VerifySignatures(inst, ctxHash); err != nil {
+			return err
+		}
+		cancel, err := decodeCancel(inst)
+		if err != nil {
+			return err
+		}
+		_, order, _, err := c.BookData.find(cancel.ID)
+		if err != nil {
+			return err
+		}
+		if !auctioncore.SignedBy(inst, order.Owner) {
+			return errors.New("only the owner can cancel an order")
+		}
+		return nil
+	}
+	return c.BasicContract.VerifyInstruction(rst, inst, ctxHash)
+}
+
+// The following methods are available:
+//   - ask: sells Quantity units of good, escrowed with the instruction
+//   - bid: buys Quantity units of good, escrowing Quantity times Price
+//   - cancel: removes a resting order and refunds what is left of it
+//
+// Crossing orders are filled in price-time priority at the price of the
+// resting order, and settled in the same instruction.
+func (c *contractDoubleAuction) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var bookBuf []byte
+	var darcID darc.ID
+	bookBuf, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+	book := BookData{}
+	err = protobuf.Decode(bookBuf, &book)
+	if err != nil {
+		return
+	}
+
+	payouts := auctioncore.Payouts{}
+
+	switch inst.Invoke.Command {
+	case "ask", "bid":
+		isBid := inst.Invoke.Command == "bid"
+		placeBuf := inst.Invoke.Args.Search("order")
+		if placeBuf == nil {
+			return nil, nil, errors.New("need an argument with name order")
+		}
+		place := PlaceData{}
+		err = protobuf.Decode(placeBuf, &place)
+		if err != nil {
+			return nil, nil, errors.New("not an order")
+		}
+		if place.Price == 0 || place.Quantity == 0 {
+			return nil, nil, errors.New("price and quantity must be positive")
+		}
+		if len(inst.SignerIdentities) == 0 {
+			return nil, nil, errors.New("an order must be signed")
+		}
+
+		// The escrow comes from the account of the coin type sold:
+		// goods for an ask and currency for a bid.
+		escrowAccount, escrow := place.GoodAccount, place.Quantity
+		if isBid {
+			hi, lo := bits.Mul64(place.Price, place.Quantity)
+			if hi != 0 {
+				return nil, nil, errors.New("order value overflows")
+			}
+			escrowAccount, escrow = place.CurrencyAccount, lo
+		}
+		err = checkAccounts(rst, book, place)
+		if err != nil {
+			return nil, nil, err
+		}
+		var escrowed uint64
+		escrowed, cout, err = auctioncore.CollectCoins(rst, escrowAccount, coins)
+		if err != nil {
+			return nil, nil, err
+		}
+		if escrowed != escrow {
+			return nil, nil, auctioncore.ErrEscrowMismatch
+		}
+
+		order := OrderData{
+			ID:              book.NextOrderID,
+			Owner:           inst.SignerIdentities[0].String(),
+			CurrencyAccount: place.CurrencyAccount,
+			GoodAccount:     place.GoodAccount,
+			Price:           place.Price,
+			Quantity:        place.Quantity,
+		}
+		book.NextOrderID++
+
+		for _, f := range book.match(&order, isBid) {
+			payouts.Add(f.ask.CurrencyAccount, f.quantity*f.price)
+			payouts.Add(f.bid.GoodAccount, f.quantity)
+			// An incoming bid is filled at the lower price of the
+			// ask, the difference goes back to the buyer.
+			payouts.Add(f.bid.CurrencyAccount, f.quantity*(f.bid.Price-f.price))
+		}
+		if order.Quantity > 0 {
+			var evicted *OrderData
+			evicted, err = book.insert(order, isBid)
+			if err != nil {
+				return nil, nil, err
+			}
+			if evicted != nil {
+				refund(&payouts, *evicted, isBid)
+			}
+		}
+
+	case "cancel":
+		var cancel CancelData
+		cancel, err = decodeCancel(inst)
+		if err != nil {
+			return nil, nil, err
+		}
+		var order OrderData
+		var isBid bool
+		isBid, order, _, err = book.find(cancel.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		book.remove(cancel.ID)
+		refund(&payouts, order, isBid)
+
+	default:
+		return nil, nil, errors.New("Order book contract can only ask, bid or cancel")
+	}
+
+	sc, err = payouts.StoreCoins(c.s.byzService(), rst)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bookBuf, err = protobuf.Encode(&book)
+	if err != nil {
+		return nil, nil, errors.New("encode book buf sc")
+	}
+	sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+		ContractDoubleAuctionID, bookBuf, darcID))
+	return
+}
+
+// fill is a trade between two orders, at the price of the resting one.
+type fill struct {
+	ask, bid OrderData
+	quantity uint64
+	price    uint64
+}
+
+// match fills the incoming order against the other side of the book, best
+// price first and oldest first for the same price. The filled quantities
+// are removed from the incoming and the resting orders.
+func (b *BookData) match(incoming *OrderData, isBid bool) (fills []fill) {
+	resting := &b.Asks
+	if !isBid {
+		resting = &b.Bids
+	}
+	for incoming.Quantity > 0 && len(*resting) > 0 {
+		best := &(*resting)[0]
+		if isBid && best.Price > incoming.Price || !isBid && best.Price < incoming.Price {
+			break
+		}
+		q := incoming.Quantity
+		if best.Quantity < q {
+			q = best.Quantity
+		}
+		f := fill{quantity: q, price: best.Price}
+		if isBid {
+			f.ask, f.bid = *best, *incoming
+		} else {
+			f.ask, f.bid = *incoming, *best
+		}
+		fills = append(fills, f)
+
+		incoming.Quantity -= q
+		best.Quantity -= q
+		if best.Quantity == 0 {
+			*resting = (*resting)[1:]
+		}
+		b.Trades++
+		b.LastPrice = f.price
+	}
+	if len(*resting) == 0 {
+		*resting = nil
+	}
+	return
+}
+
+// insert adds a resting order behind all the orders with the same or a
+// better price. A full side evicts its worst order, the last one, to make
+// room for an order with a strictly better price, and refuses the order
+// otherwise. The evicted order must be refunded by the caller.
+func (b *BookData) insert(order OrderData, isBid bool) (evicted *OrderData, err error) {
+	side := &b.Asks
+	if isBid {
+		side = &b.Bids
+	}
+	i := 0
+	for ; i < len(*side); i++ {
+		p := (*side)[i].Price
+		if isBid && p < order.Price || !isBid && p > order.Price {
+			break
+		}
+	}
+	if uint64(len(*side)) >= b.maxOrders() {
+		if i == len(*side) {
+			return nil, errors.New("the book is full, the order cannot rest")
+		}
+		worst := (*side)[len(*side)-1]
+		evicted = &worst
+		*side = (*side)[:len(*side)-1]
+	}
+	*side = append(*side, OrderData{})
+	copy((*side)[i+1:], (*side)[i:])
+	(*side)[i] = order
+	return evicted, nil
+}
+
+// maxOrders returns the number of resting orders a side can hold.
+func (b *BookData) maxOrders() uint64 {
+	if b.MaxOrders == 0 {
+		return MaxBookOrders
+	}
+	return b.MaxOrders
+}
+
+// find returns the resting order with the given id.
+func (b *BookData) find(id uint64) (isBid bool, order OrderData, index int, err error) {
+	for i, o := range b.Bids {
+		if o.ID == id {
+			return true, o, i, nil
+		}
+	}
+	for i, o := range b.Asks {
+		if o.ID == id {
+			return false, o, i, nil
+		}
+	}
+	return false, OrderData{}, 0, errors.New("no such order in the book")
+}
+
+// remove takes the order with the given id out of the book.
+func (b *BookData) remove(id uint64) {
+	isBid, _, i, err := b.find(id)
+	if err != nil {
+		return
+	}
+	side := &b.Asks
+	if isBid {
+		side = &b.Bids
+	}
+	*side = append((*side)[:i], (*side)[i+1:]...)
+	if len(*side) == 0 {
+		*side = nil
+	}
+}
+
+// refund pays back what is left of the escrow of a resting order.
+func refund(payouts *auctioncore.Payouts, order OrderData, isBid bool) {
+	if isBid {
+		payouts.Add(order.CurrencyAccount, order.Quantity*order.Price)
+	} else {
+		payouts.Add(order.GoodAccount, order.Quantity)
+	}
+}
+
+// checkAccounts verifies that the accounts of an order hold the coins
+// traded in the book.
+func checkAccounts(rst byzcoin.ReadOnlyStateTrie, book BookData, place PlaceData) error {
+	currency, err := auctioncore.GetCoin(rst, place.CurrencyAccount)
+	if err != nil {
+		return err
+	}
+	if !currency.Name.Equal(book.Currency) {
+		return errors.New("currency account holds the wrong coin")
+	}
+	good, err := auctioncore.GetCoin(rst, place.GoodAccount)
+	if err != nil {
+		return err
+	}
+	if !good.Name.Equal(book.Good) {
+		return errors.New("good account holds the wrong coin")
+	}
+	return nil
+}
+
+func decodeCancel(inst byzcoin.Instruction) (CancelData, error) {
+	cancel := CancelData{}
+	cancelBuf := inst.Invoke.Args.Search("cancel")
+	if cancelBuf == nil {
+		return cancel, errors.New("need an argument with name cancel")
+	}
+	err := protobuf.Decode(cancelBuf, &cancel)
+	if err != nil {
+		return cancel, errors.New("not a cancel struct")
+	}
+	return cancel, nil
+}
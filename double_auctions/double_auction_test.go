@@ -0,0 +1,115 @@
+package double_auctions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/darc"
+)
+
+func TestContractDoubleAuction_Invoke(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	apples := byzcoin.NewInstanceID([]byte("apples"))
+	sellerMoney := bct.CreateAccount(t, contracts.CoinName, 0)
+	sellerApples := bct.CreateAccount(t, apples, 10)
+	buyerMoney := bct.CreateAccount(t, contracts.CoinName, 1000)
+	buyerApples := bct.CreateAccount(t, apples, 0)
+	bookInstID := bct.createBook(t, contracts.CoinName, apples)
+
+	seller := PlaceData{CurrencyAccount: sellerMoney, GoodAccount: sellerApples}
+	buyer := PlaceData{CurrencyAccount: buyerMoney, GoodAccount: buyerApples}
+
+	//Two asks rest in the book, cheapest first
+	seller.Price, seller.Quantity = 12, 5
+	require.NoError(t, bct.placeOrder(t, bookInstID, "ask", seller))
+	seller.Price, seller.Quantity = 10, 5
+	require.NoError(t, bct.placeOrder(t, bookInstID, "ask", seller))
+	book := bct.proofAndDecodeBook(t, bookInstID)
+	require.Equal(t, 2, len(book.Asks))
+	require.Equal(t, uint64(1), book.Asks[0].ID)
+
+	//Accounts must hold the coins of the book
+	buyer.Price, buyer.Quantity = 12, 7
+	require.Error(t, bct.placeOrder(t, bookInstID, "bid", PlaceData{
+		CurrencyAccount: buyerApples, GoodAccount: buyerApples, Price: 12, Quantity: 7}))
+
+	//The bid crosses both asks: 5 at 10 and 2 at 12
+	require.NoError(t, bct.placeOrder(t, bookInstID, "bid", buyer))
+	book = bct.proofAndDecodeBook(t, bookInstID)
+	require.Equal(t, 0, len(book.Bids))
+	require.Equal(t, 1, len(book.Asks))
+	require.Equal(t, uint64(3), book.Asks[0].Quantity)
+	require.Equal(t, uint64(2), book.Trades)
+	require.Equal(t, uint64(12), book.LastPrice)
+
+	require.Equal(t, uint64(74), bct.CoinBalance(t, sellerMoney))
+	require.Equal(t, uint64(7), bct.CoinBalance(t, buyerApples))
+	require.Equal(t, uint64(1000-74), bct.CoinBalance(t, buyerMoney))
+
+	//A bid below the ask rests with its escrow
+	buyer.Price, buyer.Quantity = 11, 2
+	require.NoError(t, bct.placeOrder(t, bookInstID, "bid", buyer))
+	book = bct.proofAndDecodeBook(t, bookInstID)
+	require.Equal(t, 1, len(book.Bids))
+	require.Equal(t, uint64(1000-74-22), bct.CoinBalance(t, buyerMoney))
+
+	//Only the owner can cancel
+	other := darc.NewSignerEd25519(nil, nil)
+	require.Error(t, bct.cancelOrder(t, bookInstID, book.Bids[0].ID, other, 1))
+
+	require.NoError(t, bct.cancelOrder(t, bookInstID, book.Bids[0].ID, bct.Signer, bct.Ct))
+	bct.Ct++
+	require.NoError(t, bct.cancelOrder(t, bookInstID, book.Asks[0].ID, bct.Signer, bct.Ct))
+	bct.Ct++
+
+	book = bct.proofAndDecodeBook(t, bookInstID)
+	require.Equal(t, 0, len(book.Bids))
+	require.Equal(t, 0, len(book.Asks))
+	require.Equal(t, uint64(1000-74), bct.CoinBalance(t, buyerMoney))
+	require.Equal(t, uint64(3), bct.CoinBalance(t, sellerApples))
+}
+
+func TestBookData_Insert(t *testing.T) {
+	book := BookData{MaxOrders: 2}
+	_, err := book.insert(OrderData{ID: 0, Price: 10, Quantity: 1}, true)
+	require.NoError(t, err)
+	_, err = book.insert(OrderData{ID: 1, Price: 12, Quantity: 1}, true)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), book.Bids[0].ID)
+
+	//A full side refuses an order that is not better than its worst one,
+	//the other side is counted apart
+	_, err = book.insert(OrderData{ID: 2, Price: 10, Quantity: 1}, true)
+	require.Error(t, err)
+	_, err = book.insert(OrderData{ID: 3, Price: 20, Quantity: 1}, false)
+	require.NoError(t, err)
+
+	//A better order evicts the worst one
+	evicted, err := book.insert(OrderData{ID: 4, Price: 11, Quantity: 1}, true)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), evicted.ID)
+	require.Equal(t, []uint64{1, 4}, []uint64{book.Bids[0].ID, book.Bids[1].ID})
+
+	//A full side still fills incoming orders, which makes room
+	incoming := OrderData{ID: 5, Price: 11, Quantity: 1}
+	require.Len(t, book.match(&incoming, false), 1)
+	evicted, err = book.insert(OrderData{ID: 6, Price: 9, Quantity: 1}, true)
+	require.NoError(t, err)
+	require.Nil(t, evicted)
+
+	//Filling a side with the same price does not lock it
+	book = BookData{}
+	for i := 0; i < MaxBookOrders; i++ {
+		_, err = book.insert(OrderData{ID: uint64(i), Price: 5, Quantity: 1}, false)
+		require.NoError(t, err)
+	}
+	_, err = book.insert(OrderData{ID: MaxBookOrders, Price: 5, Quantity: 1}, false)
+	require.Error(t, err)
+	evicted, err = book.insert(OrderData{ID: MaxBookOrders, Price: 4, Quantity: 1}, false)
+	require.NoError(t, err)
+	require.Equal(t, uint64(MaxBookOrders-1), evicted.ID)
+}
@@ -0,0 +1,106 @@
+package double_auctions
+
+import (
+	"testing"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/dedis/student_19_auctions/auctioncore/bctest"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+// bcTest is used here to provide some simple test structure for different
+// tests.
+type bcTest struct {
+	*bctest.BCTest
+}
+
+func newBCTest(t *testing.T) *bcTest {
+	// The genesis darc has the right to create and update the order book and
+	// coin contracts.
+	return &bcTest{bctest.New(t,
+		"spawn:double_auction", "spawn:coin", "invoke:coin.mint", "invoke:coin.fetch")}
+}
+
+func (bct *bcTest) createBook(t *testing.T, currency, good byzcoin.InstanceID) byzcoin.InstanceID {
+	bookBuf, err := protobuf.Encode(&BookData{
+		Description: "apples",
+		Currency:    currency,
+		Good:        good,
+	})
+	require.NoError(t, err)
+
+	ctx, err := bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(bct.GDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractDoubleAuctionID,
+			Args:       byzcoin.Arguments{{Name: "book", Value: bookBuf}},
+		},
+	})
+	require.NoError(t, err)
+	return ctx.Instructions[0].DeriveID("")
+}
+
+// placeOrder fetches the escrow from the right account and places an ask
+// or a bid in the same transaction.
+func (bct *bcTest) placeOrder(t *testing.T, bookInstID byzcoin.InstanceID, command string, place PlaceData) error {
+	placeBuf, err := protobuf.Encode(&place)
+	require.NoError(t, err)
+
+	escrowAccount, escrow := place.GoodAccount, place.Quantity
+	if command == "bid" {
+		escrowAccount, escrow = place.CurrencyAccount, place.Quantity*place.Price
+	}
+
+	_, err = bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: escrowAccount,
+		Invoke: &byzcoin.Invoke{
+			ContractID: contracts.ContractCoinID,
+			Command:    "fetch",
+			Args:       byzcoin.Arguments{{Name: "coins", Value: auctioncore.EncodeAmount(escrow)}},
+		},
+	}, byzcoin.Instruction{
+		InstanceID: bookInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractDoubleAuctionID,
+			Command:    command,
+			Args:       byzcoin.Arguments{{Name: "order", Value: placeBuf}},
+		},
+	})
+	return err
+}
+
+// cancelOrder cancels an order, signed by signer.
+func (bct *bcTest) cancelOrder(t *testing.T, bookInstID byzcoin.InstanceID, id uint64, signer darc.Signer, counter uint64) error {
+	cancelBuf, err := protobuf.Encode(&CancelData{ID: id})
+	require.NoError(t, err)
+
+	ctx := byzcoin.ClientTransaction{Instructions: byzcoin.Instructions{{
+		InstanceID: bookInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractDoubleAuctionID,
+			Command:    "cancel",
+			Args:       byzcoin.Arguments{{Name: "cancel", Value: cancelBuf}},
+		},
+		SignerCounter: []uint64{counter},
+	}}}
+	require.NoError(t, ctx.FillSignersAndSignWith(signer))
+	_, err = bct.Cl.AddTransactionAndWait(ctx, 10)
+	return err
+}
+
+func (bct *bcTest) proofAndDecodeBook(t *testing.T, bookInstID byzcoin.InstanceID) BookData {
+	reply, err := bct.Cl.GetProof(bookInstID.Slice())
+	require.Nil(t, err)
+	require.True(t, reply.Proof.InclusionProof.Match(bookInstID.Slice()))
+
+	_, val, _, _, err := reply.Proof.KeyValue()
+	require.Nil(t, err)
+
+	book := BookData{}
+	require.Nil(t, protobuf.Decode(val, &book))
+	return book
+}
@@ -0,0 +1,50 @@
+package double_auctions
+
+import "go.dedis.ch/cothority/v3/byzcoin"
+
+// PROTOSTART
+// package double_auctions;
+// import "byzcoin.proto";
+//
+// option java_package = "ch.epfl.dedis.lib.proto";
+// option java_outer_classname = "DoubleAuctions";
+
+// BookData is the value of an order book instance. Goods and payments are
+// both coins: Good and Currency are the coin names (byzcoin.Coin.Name) of
+// the traded good and of the money it is paid with.
+type BookData struct {
+	Description string
+	Currency    byzcoin.InstanceID
+	Good        byzcoin.InstanceID
+	Asks        []OrderData // Resting asks, lowest price first, then oldest first
+	Bids        []OrderData // Resting bids, highest price first, then oldest first
+	NextOrderID uint64
+	Trades      uint64 // Number of fills since the book was created
+	LastPrice   uint64 // Unit price of the last fill
+	MaxOrders   uint64 `protobuf:"opt"` // Resting orders on each side, MaxBookOrders if 0
+}
+
+// OrderData is a resting limit order. Its escrow is what is left of
+// Quantity units of good for an ask, or of Quantity times Price currency
+// coins for a bid.
+type OrderData struct {
+	ID              uint64
+	Owner           string             // Darc identity allowed to cancel the order
+	CurrencyAccount byzcoin.InstanceID // Receives the payments and the currency refunds
+	GoodAccount     byzcoin.InstanceID // Receives the goods and the good refunds
+	Price           uint64             // Unit price
+	Quantity        uint64             // Units not filled yet
+}
+
+// PlaceData is the argument of the "ask" and "bid" instructions.
+type PlaceData struct {
+	CurrencyAccount byzcoin.InstanceID
+	GoodAccount     byzcoin.InstanceID
+	Price           uint64
+	Quantity        uint64
+}
+
+// CancelData is the argument of the "cancel" instruction.
+type CancelData struct {
+	ID uint64
+}
@@ -9,8 +9,10 @@ require (
 	go.dedis.ch/kyber/v3 v3.0.2
 	go.dedis.ch/onet/v3 v3.0.5
 	go.dedis.ch/protobuf v1.0.6
+	go.etcd.io/bbolt v1.3.2
 	golang.org/x/crypto v0.0.0-20190320223903-b7391e95e576 // indirect
 	golang.org/x/sys v0.0.0-20190322080309-f49334f85ddc // indirect
+	gopkg.in/urfave/cli.v1 v1.20.0
 )
 
 replace go.dedis.ch/cothority/v3 => ../dynasent/conode/cothority
@@ -0,0 +1,37 @@
+package reputation
+
+import (
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3/byzcoin"
+)
+
+// GetScore returns the aggregated ratings of the account. An account that
+// has never been rated gets empty tallies.
+func GetScore(cl *byzcoin.Client, repID byzcoin.InstanceID, account byzcoin.InstanceID) (ScoreData, error) {
+	score := ScoreData{Account: account}
+	_, err := auctioncore.ReadInstance(cl, ScoreID(repID, account), ContractScoreID, &score)
+	return score, err
+}
+
+// GetRating returns the rating left by rater on the auction, and false if
+// there is none.
+func GetRating(cl *byzcoin.Client, repID byzcoin.InstanceID, auctInstID byzcoin.InstanceID, rater byzcoin.InstanceID) (StoredRating, bool, error) {
+	rating := StoredRating{}
+	found, err := auctioncore.ReadInstance(cl, RatingID(repID, auctInstID, rater), ContractRatingID, &rating)
+	return rating, found, err
+}
+
+// GetDispute returns the dispute of the auction, and false if there is none.
+func GetDispute(cl *byzcoin.Client, repID byzcoin.InstanceID, auctInstID byzcoin.InstanceID) (StoredDispute, bool, error) {
+	dispute := StoredDispute{}
+	found, err := auctioncore.ReadInstance(cl, DisputeID(repID, auctInstID), ContractDisputeID, &dispute)
+	return dispute, found, err
+}
+
+// Average returns the mean score of the tally, 0 if it is empty.
+func (t Tally) Average() float64 {
+	if t.Count == 0 {
+		return 0
+	}
+	return float64(t.Sum) / float64(t.Count)
+}
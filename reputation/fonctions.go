@@ -0,0 +1,183 @@
+package reputation
+
+import (
+	"testing"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/dedis/student_19_auctions/auctioncore/bctest"
+	"github.com/dedis/student_19_auctions/auctions"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+// bcTest is used here to provide some simple test structure for different
+// tests.
+type bcTest struct {
+	*bctest.BCTest
+}
+
+func newBCTest(t *testing.T) *bcTest {
+	// The genesis darc has the right to run auctions and to rate them.
+	return &bcTest{bctest.New(t,
+		"spawn:reputation", "invoke:reputation.rate", "invoke:reputation.dispute", "spawn:auction",
+		"invoke:auction.bid", "invoke:auction.close", "invoke:auction.drop", "spawn:coin", "invoke:coin.mint",
+		"invoke:coin.fetch")}
+}
+
+// createDarc spawns a darc owned by the signer.
+func (bct *bcTest) createDarc(t *testing.T, owner darc.Signer) *darc.Darc {
+	d := darc.NewDarc(darc.InitRules([]darc.Identity{owner.Identity()},
+		[]darc.Identity{owner.Identity()}), []byte("darc"))
+	dBuf, err := d.ToProto()
+	require.NoError(t, err)
+
+	_, err = bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(bct.GDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: byzcoin.ContractDarcID,
+			Args:       byzcoin.Arguments{{Name: "darc", Value: dBuf}},
+		},
+	})
+	require.NoError(t, err)
+	return d
+}
+
+// createReputation spawns a reputation, with disputes resolved by the
+// arbiter darc if it is given.
+func (bct *bcTest) createReputation(t *testing.T, name string, arbiter darc.ID) byzcoin.InstanceID {
+	repBuf, err := protobuf.Encode(&ReputationData{Name: name, Arbiter: arbiter})
+	require.NoError(t, err)
+
+	ctx, err := bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(bct.GDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractReputationID,
+			Args:       byzcoin.Arguments{{Name: "reputation", Value: repBuf}},
+		},
+	})
+	require.NoError(t, err)
+	return ctx.Instructions[0].DeriveID("")
+}
+
+// createAuction spawns a forward auction without reserve price.
+func (bct *bcTest) createAuction(t *testing.T, sellAccInstID byzcoin.InstanceID) byzcoin.InstanceID {
+	auctionBuf, err := protobuf.Encode(&auctions.AuctionData{
+		GoodDescription: "good",
+		SellerAccount:   sellAccInstID,
+		State:           auctioncore.StateOpen,
+		ReservePrice:    auctioncore.CreateHash("testsalt", 0),
+	})
+	require.NoError(t, err)
+
+	ctx, err := bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(bct.GDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: auctions.ContractAuctionID,
+			Args:       byzcoin.Arguments{{Name: "auction", Value: auctionBuf}},
+		},
+	})
+	require.NoError(t, err)
+	return ctx.Instructions[0].DeriveID("")
+}
+
+// addBid fetches the bid from the account of the bidder and places it.
+func (bct *bcTest) addBid(t *testing.T, auctInstID byzcoin.InstanceID, bidAccInstID byzcoin.InstanceID, bid uint64) {
+	bidBuf, err := protobuf.Encode(&auctions.BidData{BidderAccount: bidAccInstID})
+	require.NoError(t, err)
+
+	_, err = bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: bidAccInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: contracts.ContractCoinID,
+			Command:    "fetch",
+			Args:       byzcoin.Arguments{{Name: "coins", Value: auctioncore.EncodeAmount(bid)}},
+		},
+	}, byzcoin.Instruction{
+		InstanceID: auctInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: auctions.ContractAuctionID,
+			Command:    "bid",
+			Args:       byzcoin.Arguments{{Name: "bid", Value: bidBuf}},
+		},
+	})
+	require.NoError(t, err)
+}
+
+func (bct *bcTest) closeAuction(t *testing.T, auctInstID byzcoin.InstanceID) {
+	closeBuf, err := protobuf.Encode(&auctions.CloseData{Salt: "testsalt", ReservePrice: 0})
+	require.NoError(t, err)
+
+	_, err = bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: auctInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: auctions.ContractAuctionID,
+			Command:    "close",
+			Args:       byzcoin.Arguments{{Name: "close", Value: closeBuf}},
+		},
+	})
+	require.NoError(t, err)
+}
+
+func (bct *bcTest) dropAuction(t *testing.T, auctInstID byzcoin.InstanceID) {
+	_, err := bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: auctInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: auctions.ContractAuctionID,
+			Command:    "drop",
+		},
+	})
+	require.NoError(t, err)
+}
+
+func rateInstruction(t *testing.T, repID byzcoin.InstanceID, rating RatingData) byzcoin.Instruction {
+	ratingBuf, err := protobuf.Encode(&rating)
+	require.NoError(t, err)
+	return byzcoin.Instruction{
+		InstanceID: repID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractReputationID,
+			Command:    "rate",
+			Args:       byzcoin.Arguments{{Name: "rating", Value: ratingBuf}},
+		},
+	}
+}
+
+func (bct *bcTest) rate(t *testing.T, repID byzcoin.InstanceID, rating RatingData) error {
+	_, err := bct.SendInstructions(t, rateInstruction(t, repID, rating))
+	return err
+}
+
+func (bct *bcTest) dispute(t *testing.T, repID byzcoin.InstanceID, dispute DisputeData) error {
+	disputeBuf, err := protobuf.Encode(&dispute)
+	require.NoError(t, err)
+	_, err = bct.SendInstructions(t, byzcoin.Instruction{
+		InstanceID: repID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractReputationID,
+			Command:    "dispute",
+			Args:       byzcoin.Arguments{{Name: "dispute", Value: disputeBuf}},
+		},
+	})
+	return err
+}
+
+// resolve sends the resolution signed by the signer with its counter.
+func (bct *bcTest) resolve(t *testing.T, signer darc.Signer, counter uint64, repID byzcoin.InstanceID, resolution ResolutionData) error {
+	resolutionBuf, err := protobuf.Encode(&resolution)
+	require.NoError(t, err)
+	ctx := byzcoin.ClientTransaction{Instructions: byzcoin.Instructions{{
+		InstanceID: repID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractReputationID,
+			Command:    "resolve",
+			Args:       byzcoin.Arguments{{Name: "resolution", Value: resolutionBuf}},
+		},
+		SignerCounter: []uint64{counter},
+	}}}
+	require.NoError(t, ctx.FillSignersAndSignWith(signer))
+	_, err = bct.Cl.AddTransactionAndWait(ctx, 10)
+	return err
+}
@@ -0,0 +1,95 @@
+package reputation
+
+import (
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+)
+
+// PROTOSTART
+// package reputation;
+// import "byzcoin.proto";
+//
+// option java_package = "ch.epfl.dedis.lib.proto";
+// option java_outer_classname = "Reputation";
+
+// Roles of a participant in an auction.
+const (
+	RoleSeller = "SELLER"
+	RoleBuyer  = "BUYER"
+)
+
+// States of a dispute.
+const (
+	DisputeOpen     = "OPEN"
+	DisputeResolved = "RESOLVED"
+)
+
+// ReputationData is the value of a reputation instance. Ratings, scores and
+// disputes are kept in their own instances, derived from this one. The
+// signers resolving a dispute must satisfy the sign rule of the Arbiter
+// darc; without one, no dispute can be opened.
+type ReputationData struct {
+	Name    string
+	Arbiter darc.ID `protobuf:"opt"`
+}
+
+// RatingData is the argument of a "rate" instruction. Rater is the account
+// the participant used in the auction, the instruction must be signed by
+// its owner.
+type RatingData struct {
+	Auction byzcoin.InstanceID
+	Rater   byzcoin.InstanceID
+	Score   uint32
+	Comment string
+}
+
+// DisputeData is the argument of a "dispute" instruction. Opener is the
+// account the participant used in the auction, the instruction must be
+// signed by its owner.
+type DisputeData struct {
+	Auction byzcoin.InstanceID
+	Opener  byzcoin.InstanceID
+	Reason  string
+}
+
+// ResolutionData is the argument of a "resolve" instruction, signed by the
+// arbiter.
+type ResolutionData struct {
+	Auction byzcoin.InstanceID
+	Ruling  string
+}
+
+// StoredDispute is the value of a dispute instance. There is at most one
+// per auction.
+type StoredDispute struct {
+	Auction byzcoin.InstanceID
+	Opener  byzcoin.InstanceID
+	Reason  string
+	State   string
+	Ruling  string
+}
+
+// StoredRating is the value of a rating instance. There is at most one per
+// participant of an auction.
+type StoredRating struct {
+	Auction byzcoin.InstanceID
+	Rater   byzcoin.InstanceID
+	Rated   byzcoin.InstanceID
+	Role    string // Role of the rated participant
+	Score   uint32
+	Comment string
+}
+
+// ScoreData is the value of a score instance, aggregating the ratings
+// received by an account.
+type ScoreData struct {
+	Account  byzcoin.InstanceID
+	AsSeller Tally
+	AsBuyer  Tally
+}
+
+// Tally sums the scores of ratings.
+type Tally struct {
+	Count uint64
+	Sum   uint64
+}
@@ -0,0 +1,474 @@
+package reputation
+
+import (
+	"crypto/sha256"
+	"errors"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/dedis/student_19_auctions/auctions"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+// ContractReputationID identifies a reputation contract
+var ContractReputationID = "reputation"
+
+// ContractRatingID identifies the instances holding the ratings. They are
+// only created by the reputation contract.
+var ContractRatingID = "reputation_rating"
+
+// ContractDisputeID identifies the instances holding the disputes. They are
+// only created and updated by the reputation contract.
+var ContractDisputeID = "reputation_dispute"
+
+// ContractScoreID identifies the instances holding the aggregated scores of
+// an account. They are only created and updated by the reputation contract.
+var ContractScoreID = "reputation_score"
+
+// Scores go from MinScore to MaxScore.
+const (
+	MinScore = 1
+	MaxScore = 5
+)
+
+type contractReputation struct {
+	byzcoin.BasicContract
+	ReputationData
+}
+
+func contractReputationFromBytes(in []byte) (byzcoin.Contract, error) {
+	cv := &contractReputation{}
+	err := protobuf.Decode(in, &cv.ReputationData)
+	if err != nil {
+		return nil, err
+	}
+	return cv, nil
+}
+
+type contractRating struct {
+	byzcoin.BasicContract
+	StoredRating
+}
+
+func contractRatingFromBytes(in []byte) (byzcoin.Contract, error) {
+	cv := &contractRating{}
+	err := protobuf.Decode(in, &cv.StoredRating)
+	if err != nil {
+		return nil, err
+	}
+	return cv, nil
+}
+
+type contractDispute struct {
+	byzcoin.BasicContract
+	StoredDispute
+}
+
+func contractDisputeFromBytes(in []byte) (byzcoin.Contract, error) {
+	cv := &contractDispute{}
+	err := protobuf.Decode(in, &cv.StoredDispute)
+	if err != nil {
+		return nil, err
+	}
+	return cv, nil
+}
+
+type contractScore struct {
+	byzcoin.BasicContract
+	ScoreData
+}
+
+func contractScoreFromBytes(in []byte) (byzcoin.Contract, error) {
+	cv := &contractScore{}
+	err := protobuf.Decode(in, &cv.ScoreData)
+	if err != nil {
+		return nil, err
+	}
+	return cv, nil
+}
+
+// Spawn creates a new reputation instance.
+func (c *contractReputation) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	repBuf := inst.Spawn.Args.Search("reputation")
+	if repBuf == nil {
+		return nil, nil, errors.New("need an argument with name reputation")
+	}
+	rep := ReputationData{}
+	err = protobuf.Decode(repBuf, &rep)
+	if err != nil {
+		return nil, nil, errors.New("not a reputation")
+	}
+	if len(rep.Arbiter) > 0 {
+		if _, err = auctioncore.LoadDarc(rst, rep.Arbiter); err != nil {
+			return nil, nil, errors.New("arbiter is not a darc: " + err.Error())
+		}
+	}
+
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""), ContractReputationID, repBuf, darcID),
+	}
+	return
+}
+
+// VerifyInstruction lets the participants of any auction rate and open a
+// dispute, and the arbiter resolve it. The owner of the account of the
+// participant, or the arbiter, is checked when the instruction is invoked.
+func (c *contractReputation) VerifyInstruction(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, ctxHash []byte) error {
+	if inst.GetType() == byzcoin.InvokeType {
+		switch inst.Invoke.Command {
+		case "rate", "dispute", "resolve":
+			return auctioncore.VerifySignatures(inst, ctxHash)
+		}
+	}
+	return c.BasicContract.VerifyInstruction(rst, inst, ctxHash)
+}
+
+// The following methods are available:
+//   - rate: stores the rating of the other participant of a settled
+//     auction and adds it to its score
+//   - dispute: opens a dispute on an ended auction, for the arbiter
+//   - resolve: records the ruling of the arbiter on the dispute
+//
+// The seller and the winner of an auction can each rate once. Only auctions
+// closed with a winner, whose escrow has been paid out, or whose dispute
+// has been resolved by the arbiter can be rated. An open dispute holds the
+// ratings back until it is resolved.
+func (c *contractReputation) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	switch inst.Invoke.Command {
+	case "rate":
+		sc, err = rate(rst, inst, darcID)
+	case "dispute":
+		sc, err = openDispute(rst, inst, darcID)
+	case "resolve":
+		sc, err = c.resolve(rst, inst, darcID)
+	default:
+		err = errors.New("Reputation contract can only rate dispute or resolve")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return
+}
+
+// rate stores the rating and adds it to the score of the rated account.
+func rate(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, darcID darc.ID) ([]byzcoin.StateChange, error) {
+	ratingBuf := inst.Invoke.Args.Search("rating")
+	if ratingBuf == nil {
+		return nil, errors.New("need an argument with name rating")
+	}
+	rating := RatingData{}
+	err := protobuf.Decode(ratingBuf, &rating)
+	if err != nil {
+		return nil, errors.New("not a rating")
+	}
+	if rating.Score < MinScore || rating.Score > MaxScore {
+		return nil, errors.New("score out of range")
+	}
+
+	a, err := getParticipants(rst, rating.Auction)
+	if err != nil {
+		return nil, err
+	}
+	dispute, found, err := getDispute(rst, DisputeID(inst.InstanceID, rating.Auction))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case found && dispute.State != DisputeResolved:
+		return nil, errors.New("the auction is disputed until the arbiter resolves it")
+	case !found && a.state != auctioncore.StateWClosed:
+		return nil, errors.New("can only rate an auction closed with a winner")
+	}
+
+	stored := StoredRating{
+		Auction: rating.Auction,
+		Rater:   rating.Rater,
+		Score:   rating.Score,
+		Comment: rating.Comment,
+	}
+	switch rating.Rater {
+	case a.seller:
+		stored.Rated, stored.Role = a.buyer, RoleBuyer
+	case a.buyer:
+		stored.Rated, stored.Role = a.seller, RoleSeller
+	default:
+		return nil, errors.New("rater did not take part in the auction")
+	}
+	err = auctioncore.VerifyOwner(rst, inst, rating.Rater)
+	if err != nil {
+		return nil, errors.New("rating not signed by the owner of the rater account: " + err.Error())
+	}
+
+	ratingID := RatingID(inst.InstanceID, rating.Auction, rating.Rater)
+	rated, err := exists(rst, ratingID)
+	if err != nil {
+		return nil, err
+	}
+	if rated {
+		return nil, errors.New("participant already rated this auction")
+	}
+
+	scoreID := ScoreID(inst.InstanceID, stored.Rated)
+	score := ScoreData{Account: stored.Rated}
+	action := byzcoin.Create
+	val, _, contractID, _, err := rst.GetValues(scoreID.Slice())
+	if err != nil && !auctioncore.IsKeyNotSet(err) {
+		return nil, err
+	}
+	if err == nil {
+		if contractID != ContractScoreID {
+			return nil, errors.New("instance is not a score")
+		}
+		err = protobuf.Decode(val, &score)
+		if err != nil {
+			return nil, err
+		}
+		action = byzcoin.Update
+	}
+	tally := &score.AsBuyer
+	if stored.Role == RoleSeller {
+		tally = &score.AsSeller
+	}
+	tally.Count++
+	tally.Sum += uint64(rating.Score)
+
+	storedBuf, err := protobuf.Encode(&stored)
+	if err != nil {
+		return nil, errors.New("encode rating buf sc")
+	}
+	scoreBuf, err := protobuf.Encode(&score)
+	if err != nil {
+		return nil, errors.New("encode score buf sc")
+	}
+	return []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, ratingID, ContractRatingID, storedBuf, darcID),
+		byzcoin.NewStateChange(action, scoreID, ContractScoreID, scoreBuf, darcID),
+	}, nil
+}
+
+// openDispute lets a participant of an ended auction with a leading bidder
+// bring it to the arbiter.
+func openDispute(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, darcID darc.ID) ([]byzcoin.StateChange, error) {
+	rep, err := getReputation(rst, inst.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(rep.Arbiter) == 0 {
+		return nil, errors.New("the reputation has no arbiter")
+	}
+
+	disputeBuf := inst.Invoke.Args.Search("dispute")
+	if disputeBuf == nil {
+		return nil, errors.New("need an argument with name dispute")
+	}
+	dispute := DisputeData{}
+	err = protobuf.Decode(disputeBuf, &dispute)
+	if err != nil {
+		return nil, errors.New("not a dispute")
+	}
+
+	a, err := getParticipants(rst, dispute.Auction)
+	if err != nil {
+		return nil, err
+	}
+	if a.state != auctioncore.StateWClosed && a.state != auctioncore.StateDropped {
+		return nil, errors.New("can only dispute an ended auction")
+	}
+	if dispute.Opener != a.seller && dispute.Opener != a.buyer {
+		return nil, errors.New("opener did not take part in the auction")
+	}
+	err = auctioncore.VerifyOwner(rst, inst, dispute.Opener)
+	if err != nil {
+		return nil, errors.New("dispute not signed by the owner of the opener account: " + err.Error())
+	}
+
+	disputeID := DisputeID(inst.InstanceID, dispute.Auction)
+	disputed, err := exists(rst, disputeID)
+	if err != nil {
+		return nil, err
+	}
+	if disputed {
+		return nil, errors.New("the auction has already been disputed")
+	}
+	rated, err := exists(rst, RatingID(inst.InstanceID, dispute.Auction, dispute.Opener))
+	if err != nil {
+		return nil, err
+	}
+	if rated {
+		return nil, errors.New("participant already rated this auction")
+	}
+
+	storedBuf, err := protobuf.Encode(&StoredDispute{
+		Auction: dispute.Auction,
+		Opener:  dispute.Opener,
+		Reason:  dispute.Reason,
+		State:   DisputeOpen,
+	})
+	if err != nil {
+		return nil, errors.New("encode dispute buf sc")
+	}
+	return []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, disputeID, ContractDisputeID, storedBuf, darcID),
+	}, nil
+}
+
+// resolve records the ruling of the arbiter on an open dispute.
+func (c *contractReputation) resolve(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, darcID darc.ID) ([]byzcoin.StateChange, error) {
+	if len(c.Arbiter) == 0 {
+		return nil, errors.New("the reputation has no arbiter")
+	}
+	if err := auctioncore.VerifyAllowList(rst, inst, c.Arbiter); err != nil {
+		return nil, errors.New("only the arbiter can resolve a dispute")
+	}
+
+	resolutionBuf := inst.Invoke.Args.Search("resolution")
+	if resolutionBuf == nil {
+		return nil, errors.New("need an argument with name resolution")
+	}
+	resolution := ResolutionData{}
+	err := protobuf.Decode(resolutionBuf, &resolution)
+	if err != nil {
+		return nil, errors.New("not a resolution")
+	}
+
+	disputeID := DisputeID(inst.InstanceID, resolution.Auction)
+	dispute, found, err := getDispute(rst, disputeID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("the auction is not disputed")
+	}
+	if dispute.State != DisputeOpen {
+		return nil, errors.New("the dispute is already resolved")
+	}
+	dispute.State = DisputeResolved
+	dispute.Ruling = resolution.Ruling
+
+	storedBuf, err := protobuf.Encode(&dispute)
+	if err != nil {
+		return nil, errors.New("encode dispute buf sc")
+	}
+	return []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Update, disputeID, ContractDisputeID, storedBuf, darcID),
+	}, nil
+}
+
+// participants are the seller and the buyer of an auction, with its state.
+type participants struct {
+	seller, buyer byzcoin.InstanceID
+	state         string
+}
+
+// getParticipants reads the auction. Only the single-lot auctions with a
+// leading bidder have participants.
+func getParticipants(rst byzcoin.ReadOnlyStateTrie, auctInstID byzcoin.InstanceID) (participants, error) {
+	val, _, contractID, _, err := rst.GetValues(auctInstID.Slice())
+	if err != nil {
+		return participants{}, auctioncore.ErrUnknownInstanceID
+	}
+	if contractID != auctions.ContractAuctionID {
+		return participants{}, errors.New("instance is not an auction")
+	}
+	auction, err := auctions.DecodeAuction(val)
+	if err != nil {
+		return participants{}, auctioncore.ErrNotAuction
+	}
+	if len(auction.Lots) > 0 {
+		return participants{}, errors.New("multi-lot auctions cannot be rated")
+	}
+	if auction.HighestBidder.Equal(byzcoin.InstanceID{}) {
+		return participants{}, errors.New("the auction has no bidder to rate")
+	}
+
+	// In a reverse auction the seller is the winning supplier.
+	a := participants{seller: auction.SellerAccount, buyer: auction.HighestBidder, state: auction.State}
+	if auction.Mode == auctions.ModeReverse {
+		a.seller, a.buyer = a.buyer, a.seller
+	}
+	return a, nil
+}
+
+func getReputation(rst byzcoin.ReadOnlyStateTrie, repID byzcoin.InstanceID) (ReputationData, error) {
+	rep := ReputationData{}
+	val, _, contractID, _, err := rst.GetValues(repID.Slice())
+	if err != nil {
+		return rep, err
+	}
+	if contractID != ContractReputationID {
+		return rep, errors.New("instance is not a reputation")
+	}
+	err = protobuf.Decode(val, &rep)
+	return rep, err
+}
+
+// getDispute returns the dispute, and false if there is none.
+func getDispute(rst byzcoin.ReadOnlyStateTrie, disputeID byzcoin.InstanceID) (StoredDispute, bool, error) {
+	dispute := StoredDispute{}
+	val, _, contractID, _, err := rst.GetValues(disputeID.Slice())
+	if auctioncore.IsKeyNotSet(err) {
+		return dispute, false, nil
+	}
+	if err != nil {
+		return dispute, false, err
+	}
+	if contractID != ContractDisputeID {
+		return dispute, false, errors.New("instance is not a dispute")
+	}
+	err = protobuf.Decode(val, &dispute)
+	return dispute, true, err
+}
+
+// exists tells if the instance is in the trie.
+func exists(rst byzcoin.ReadOnlyStateTrie, instID byzcoin.InstanceID) (bool, error) {
+	_, _, _, _, err := rst.GetValues(instID.Slice())
+	if auctioncore.IsKeyNotSet(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// RatingID returns the instance holding the rating of the auction by rater.
+func RatingID(repID, auctInstID, rater byzcoin.InstanceID) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write([]byte(ContractRatingID))
+	h.Write(repID.Slice())
+	h.Write(auctInstID.Slice())
+	h.Write(rater.Slice())
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
+
+// ScoreID returns the instance holding the score of the account.
+func ScoreID(repID, account byzcoin.InstanceID) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write([]byte(ContractScoreID))
+	h.Write(repID.Slice())
+	h.Write(account.Slice())
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
+
+// DisputeID returns the instance holding the dispute of the auction.
+func DisputeID(repID, auctInstID byzcoin.InstanceID) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write([]byte(ContractDisputeID))
+	h.Write(repID.Slice())
+	h.Write(auctInstID.Slice())
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
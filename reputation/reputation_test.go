@@ -0,0 +1,122 @@
+package reputation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/darc"
+)
+
+func TestContractReputation(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	sellAccInstID := bct.CreateAccount(t, contracts.CoinName, 0)
+	bidAccInstID := bct.CreateAccount(t, contracts.CoinName, 100)
+	otherAccInstID := bct.CreateAccount(t, contracts.CoinName, 0)
+	repID := bct.createReputation(t, "market", nil)
+
+	auctInstID := bct.createAuction(t, sellAccInstID)
+	bct.addBid(t, auctInstID, bidAccInstID, 30)
+
+	// Open auctions cannot be rated
+	require.Error(t, bct.rate(t, repID, RatingData{Auction: auctInstID, Rater: sellAccInstID, Score: 5}))
+
+	bct.closeAuction(t, auctInstID)
+
+	require.Error(t, bct.rate(t, repID, RatingData{Auction: auctInstID, Rater: sellAccInstID, Score: 6}))
+	require.Error(t, bct.rate(t, repID, RatingData{Auction: auctInstID, Rater: otherAccInstID, Score: 5}))
+	require.Error(t, bct.rate(t, repID, RatingData{Auction: repID, Rater: sellAccInstID, Score: 5}))
+
+	// Someone not owning the account cannot rate for it
+	intruder := darc.NewSignerEd25519(nil, nil)
+	ctx := byzcoin.ClientTransaction{Instructions: byzcoin.Instructions{
+		rateInstruction(t, repID, RatingData{Auction: auctInstID, Rater: sellAccInstID, Score: 1}),
+	}}
+	ctx.Instructions[0].SignerCounter = []uint64{1}
+	require.NoError(t, ctx.FillSignersAndSignWith(intruder))
+	_, err := bct.Cl.AddTransactionAndWait(ctx, 10)
+	require.Error(t, err)
+
+	require.NoError(t, bct.rate(t, repID, RatingData{Auction: auctInstID, Rater: sellAccInstID, Score: 4, Comment: "paid"}))
+	require.NoError(t, bct.rate(t, repID, RatingData{Auction: auctInstID, Rater: bidAccInstID, Score: 2}))
+	require.Error(t, bct.rate(t, repID, RatingData{Auction: auctInstID, Rater: bidAccInstID, Score: 5}))
+
+	rating, found, err := GetRating(bct.Cl, repID, auctInstID, sellAccInstID)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, StoredRating{Auction: auctInstID, Rater: sellAccInstID, Rated: bidAccInstID,
+		Role: RoleBuyer, Score: 4, Comment: "paid"}, rating)
+
+	score, err := GetScore(bct.Cl, repID, sellAccInstID)
+	require.NoError(t, err)
+	require.Equal(t, Tally{Count: 1, Sum: 2}, score.AsSeller)
+	require.Equal(t, Tally{}, score.AsBuyer)
+
+	// A second auction between the same accounts adds up
+	auctInstID = bct.createAuction(t, sellAccInstID)
+	bct.addBid(t, auctInstID, bidAccInstID, 20)
+	bct.closeAuction(t, auctInstID)
+	require.NoError(t, bct.rate(t, repID, RatingData{Auction: auctInstID, Rater: bidAccInstID, Score: 5}))
+
+	score, err = GetScore(bct.Cl, repID, sellAccInstID)
+	require.NoError(t, err)
+	require.Equal(t, Tally{Count: 2, Sum: 7}, score.AsSeller)
+	require.Equal(t, 3.5, score.AsSeller.Average())
+
+	score, err = GetScore(bct.Cl, repID, otherAccInstID)
+	require.NoError(t, err)
+	require.Equal(t, ScoreData{Account: otherAccInstID}, score)
+}
+
+func TestContractReputation_Dispute(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	sellAccInstID := bct.CreateAccount(t, contracts.CoinName, 0)
+	bidAccInstID := bct.CreateAccount(t, contracts.CoinName, 100)
+	arbiter := darc.NewSignerEd25519(nil, nil)
+	arbiterDarc := bct.createDarc(t, arbiter)
+	noArbiterID := bct.createReputation(t, "no arbiter", nil)
+	repID := bct.createReputation(t, "market", arbiterDarc.GetBaseID())
+
+	auctInstID := bct.createAuction(t, sellAccInstID)
+	bct.addBid(t, auctInstID, bidAccInstID, 30)
+
+	// Only ended auctions can be disputed, before an arbiter
+	require.Error(t, bct.dispute(t, repID, DisputeData{Auction: auctInstID, Opener: bidAccInstID}))
+	bct.closeAuction(t, auctInstID)
+	require.Error(t, bct.dispute(t, noArbiterID, DisputeData{Auction: auctInstID, Opener: bidAccInstID}))
+	require.Error(t, bct.dispute(t, repID, DisputeData{Auction: auctInstID, Opener: repID}))
+
+	require.NoError(t, bct.dispute(t, repID, DisputeData{Auction: auctInstID, Opener: bidAccInstID, Reason: "not delivered"}))
+	require.Error(t, bct.dispute(t, repID, DisputeData{Auction: auctInstID, Opener: sellAccInstID}))
+
+	// The dispute holds the ratings back until the arbiter resolves it
+	require.Error(t, bct.rate(t, repID, RatingData{Auction: auctInstID, Rater: bidAccInstID, Score: 1}))
+	require.Error(t, bct.resolve(t, bct.Signer, bct.Ct, repID, ResolutionData{Auction: auctInstID, Ruling: "delivered"}))
+	require.NoError(t, bct.resolve(t, arbiter, 1, repID, ResolutionData{Auction: auctInstID, Ruling: "delivered late"}))
+	require.Error(t, bct.resolve(t, arbiter, 2, repID, ResolutionData{Auction: auctInstID, Ruling: "delivered"}))
+
+	dispute, found, err := GetDispute(bct.Cl, repID, auctInstID)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, StoredDispute{Auction: auctInstID, Opener: bidAccInstID, Reason: "not delivered",
+		State: DisputeResolved, Ruling: "delivered late"}, dispute)
+	require.NoError(t, bct.rate(t, repID, RatingData{Auction: auctInstID, Rater: bidAccInstID, Score: 2}))
+
+	// A resolved dispute lets the participants of a dropped auction rate
+	auctInstID = bct.createAuction(t, sellAccInstID)
+	bct.addBid(t, auctInstID, bidAccInstID, 20)
+	bct.dropAuction(t, auctInstID)
+	require.Error(t, bct.rate(t, repID, RatingData{Auction: auctInstID, Rater: bidAccInstID, Score: 1}))
+	require.NoError(t, bct.dispute(t, repID, DisputeData{Auction: auctInstID, Opener: bidAccInstID, Reason: "dropped"}))
+	require.NoError(t, bct.resolve(t, arbiter, 2, repID, ResolutionData{Auction: auctInstID, Ruling: "seller at fault"}))
+	require.NoError(t, bct.rate(t, repID, RatingData{Auction: auctInstID, Rater: bidAccInstID, Score: 1}))
+
+	score, err := GetScore(bct.Cl, repID, sellAccInstID)
+	require.NoError(t, err)
+	require.Equal(t, Tally{Count: 2, Sum: 3}, score.AsSeller)
+}
@@ -0,0 +1,135 @@
+package sb_auctions
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+// Client sends the instructions of the sealed-bid auction contract on behalf
+// of a signer. It pairs every bid with the coin fetch escrowing it and reads
+// the signer counter from the ledger, the signer must be allowed by the
+// darcs of the accounts it spends from. The contract has no drop, an auction
+// always ends with Close.
+type Client struct {
+	*auctioncore.Sender
+}
+
+// NewClient returns a client sending as signer.
+func NewClient(cl *byzcoin.Client, signer darc.Signer) *Client {
+	return &Client{auctioncore.NewSender(cl, signer)}
+}
+
+// CreateAuction spawns the auction under the darc and returns its instance.
+func (c *Client) CreateAuction(darcID darc.ID, auction AuctionData) (byzcoin.InstanceID, error) {
+	auctionBuf, err := protobuf.Encode(&auction)
+	if err != nil {
+		return byzcoin.InstanceID{}, err
+	}
+	ctx, err := c.Send(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(darcID),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractSBAuctionID,
+			Args:       byzcoin.Arguments{{Name: "auction", Value: auctionBuf}},
+		},
+	})
+	if err != nil {
+		return byzcoin.InstanceID{}, err
+	}
+	return ctx.Instructions[0].DeriveID(""), nil
+}
+
+// Bid places or raises the bid of the account to the amount. Only the
+// increase over the previous bid of the account is fetched and escrowed.
+func (c *Client) Bid(auctInstID byzcoin.InstanceID, bidAccInstID byzcoin.InstanceID, bid uint64) error {
+	bidBuf, err := protobuf.Encode(&BidData{BidderAccount: bidAccInstID, Bid: bid})
+	if err != nil {
+		return err
+	}
+	escrow := bid
+	stored := StoredBid{}
+	found, err := auctioncore.ReadInstance(c.Client, BidInstanceID(auctInstID, bidAccInstID), ContractSBBidID, &stored)
+	if err != nil {
+		return err
+	}
+	if found {
+		if stored.Bid >= bid {
+			return auctioncore.ErrBidTooLow
+		}
+		escrow = bid - stored.Bid
+	}
+	_, err = c.Send(auctioncore.FetchCoins(bidAccInstID, escrow),
+		c.invoke(auctInstID, "bid", byzcoin.Arguments{{Name: "bid", Value: bidBuf}}))
+	return err
+}
+
+// Close ends the auction and processes it, paying the seller and refunding
+// the other bidders.
+func (c *Client) Close(auctInstID byzcoin.InstanceID) error {
+	_, err := c.Send(c.invoke(auctInstID, "close", nil))
+	if err != nil {
+		return err
+	}
+	_, err = c.Send(c.invoke(auctInstID, "process", nil))
+	return err
+}
+
+// GetAuction reads the auction with a proof verified against the ledger. An
+// auction in the legacy layout is returned with ErrMigrate.
+func (c *Client) GetAuction(auctInstID byzcoin.InstanceID) (AuctionData, error) {
+	val, found, err := auctioncore.ReadValue(c.Client, auctInstID, ContractSBAuctionID)
+	if err != nil {
+		return AuctionData{}, err
+	}
+	if !found {
+		return AuctionData{}, auctioncore.ErrUnknownInstanceID
+	}
+	return DecodeAuction(val)
+}
+
+// GetBids reads the bids of the auction, in the order they were first
+// placed.
+func (c *Client) GetBids(auction AuctionData) ([]BidData, error) {
+	bids := make([]BidData, auction.BidCount)
+	next := auction.BidsRoot
+	for i := len(bids) - 1; i >= 0; i-- {
+		stored := StoredBid{}
+		found, err := auctioncore.ReadInstance(c.Client, next, ContractSBBidID, &stored)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, errors.New("missing bid instance")
+		}
+		bids[i] = BidData{BidderAccount: stored.BidderAccount, Bid: stored.Bid}
+		next = stored.Next
+	}
+	return bids, nil
+}
+
+// WaitForState reads the auction until it is in the state, and returns it.
+// It fails with ErrTimeout if the state is not reached in time.
+func (c *Client) WaitForState(auctInstID byzcoin.InstanceID, s state, timeout time.Duration) (AuctionData, error) {
+	var auction AuctionData
+	err := auctioncore.Poll(100*time.Millisecond, timeout, func() (bool, error) {
+		var err error
+		auction, err = c.GetAuction(auctInstID)
+		return err == nil && auction.State == s, err
+	})
+	return auction, err
+}
+
+func (c *Client) invoke(auctInstID byzcoin.InstanceID, command string, args byzcoin.Arguments) byzcoin.Instruction {
+	return byzcoin.Instruction{
+		InstanceID: auctInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractSBAuctionID,
+			Command:    command,
+			Args:       args,
+		},
+	}
+}
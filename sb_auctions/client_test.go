@@ -0,0 +1,50 @@
+package sb_auctions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	sellAccInstID, depAccInstID := bct.createSellerAndDepositAccount(t)
+	bidAccInstID := bct.createBidderAccount(t, 100)
+	bid2AccInstID := bct.createBidderAccount(t, 100)
+
+	// The client reads the counters from the ledger, bct.ct is stale from
+	// here on.
+	cl := NewClient(bct.cl, bct.signer)
+	auctInstID, err := cl.CreateAuction(bct.gDarc.GetBaseID(), AuctionData{
+		GoodDescription: "bananas",
+		SellerAccount:   sellAccInstID,
+		ReservePrice:    20,
+		State:           OPEN,
+		Deposits:        depAccInstID,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, cl.Bid(auctInstID, bidAccInstID, 30))
+	require.NoError(t, cl.Bid(auctInstID, bid2AccInstID, 25))
+	// Raising a bid only escrows the increase
+	require.NoError(t, cl.Bid(auctInstID, bid2AccInstID, 40))
+	require.Equal(t, auctioncore.ErrBidTooLow, cl.Bid(auctInstID, bid2AccInstID, 40))
+	require.Equal(t, uint64(60), bct.coinBalance(t, bid2AccInstID))
+
+	auction, err := cl.GetAuction(auctInstID)
+	require.NoError(t, err)
+	bids, err := cl.GetBids(auction)
+	require.NoError(t, err)
+	require.Equal(t, []BidData{{BidderAccount: bidAccInstID, Bid: 30}, {BidderAccount: bid2AccInstID, Bid: 40}}, bids)
+
+	require.NoError(t, cl.Close(auctInstID))
+	auction, err = cl.WaitForState(auctInstID, CLOSED, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, bid2AccInstID, auction.WinnerAccount)
+	require.Equal(t, uint64(40), bct.coinBalance(t, sellAccInstID))
+	require.Equal(t, uint64(100), bct.coinBalance(t, bidAccInstID))
+}
@@ -1,11 +1,11 @@
 package sb_auctions
 
 import (
-	"encoding/binary"
 	"fmt"
 	"testing"
 	"time"
 
+	"github.com/dedis/student_19_auctions/auctioncore"
 	"github.com/stretchr/testify/require"
 	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/cothority/v3/byzcoin"
@@ -40,7 +40,7 @@ func newBCTest(t *testing.T) (out *bcTest) {
 	// to create and update keyValue contracts.
 	var err error
 	out.gMsg, err = byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, out.roster,
-		[]string{"spawn:sb_auction", "invoke:sb_auction.bid", "invoke:sb_auction.close", "invoke:sb_auction.process", "spawn:coin", "invoke:coin.mint"}, out.signer.Identity())
+		[]string{"spawn:sb_auction", "invoke:sb_auction.bid", "invoke:sb_auction.close", "invoke:sb_auction.process", "invoke:sb_auction.migrate", "spawn:coin", "invoke:coin.mint", "invoke:coin.fetch"}, out.signer.Identity())
 	require.Nil(t, err)
 	out.gDarc = &out.gMsg.GenesisDarc
 
@@ -139,7 +139,7 @@ func (bct *bcTest) createSellerAndDepositAccount(t *testing.T) (byzcoin.Instance
 	return sellAccInstID, depAccInstID
 }
 
-func (bct *bcTest) createBidderAccount(t *testing.T, amount uint32) byzcoin.InstanceID {
+func (bct *bcTest) createBidderAccount(t *testing.T, amount uint64) byzcoin.InstanceID {
 	inst := byzcoin.Instruction{
 		InstanceID: byzcoin.NewInstanceID(bct.gDarc.GetBaseID()),
 		Spawn: &byzcoin.Spawn{
@@ -159,8 +159,7 @@ func (bct *bcTest) createBidderAccount(t *testing.T, amount uint32) byzcoin.Inst
 
 	bidAccInstID := ctx.Instructions[0].DeriveID("")
 
-	credit := make([]byte, 8)
-	binary.BigEndian.PutUint32(credit, amount)
+	credit := auctioncore.EncodeAmount(amount)
 
 	inst = byzcoin.Instruction{
 		InstanceID: bidAccInstID,
@@ -185,12 +184,11 @@ func (bct *bcTest) createBidderAccount(t *testing.T, amount uint32) byzcoin.Inst
 	return bidAccInstID
 }
 
-func (bct *bcTest) createAuction(t *testing.T, sellAccInstID byzcoin.InstanceID, depAccInstID byzcoin.InstanceID, good string, reservePrice uint32) (byzcoin.InstanceID, AuctionData) {
+func (bct *bcTest) createAuction(t *testing.T, sellAccInstID byzcoin.InstanceID, depAccInstID byzcoin.InstanceID, good string, reservePrice uint64) (byzcoin.InstanceID, AuctionData) {
 	auction := AuctionData{
 		GoodDescription: good,
 		SellerAccount:   sellAccInstID,
 		ReservePrice:    reservePrice,
-		Bids:            []BidData{},
 		State:           OPEN,
 		WinnerAccount:   byzcoin.InstanceID{},
 		Deposits:        depAccInstID,
@@ -213,7 +211,7 @@ func (bct *bcTest) createAuction(t *testing.T, sellAccInstID byzcoin.InstanceID,
 	return auctInstID, auction
 }
 
-func (bct *bcTest) createBid(t *testing.T, auctInstID byzcoin.InstanceID, bidAccInstID byzcoin.InstanceID, bid uint32) (BidData, error) {
+func (bct *bcTest) createBid(t *testing.T, auctInstID byzcoin.InstanceID, bidAccInstID byzcoin.InstanceID, bid uint64) (BidData, error) {
 	bidata := BidData{
 		BidderAccount: bidAccInstID,
 		Bid:           bid,
@@ -232,22 +230,48 @@ func (bct *bcTest) createBid(t *testing.T, auctInstID byzcoin.InstanceID, bidAcc
 		},
 	}
 
+	// Only the increase over the previous bid has to be escrowed
+	escrow := bid
+	reply, err := bct.cl.GetProof(BidInstanceID(auctInstID, bidAccInstID).Slice())
+	require.Nil(t, err)
+	if reply.Proof.InclusionProof.Match(BidInstanceID(auctInstID, bidAccInstID).Slice()) {
+		_, val, _, _, err := reply.Proof.KeyValue()
+		require.Nil(t, err)
+		stored := StoredBid{}
+		require.Nil(t, protobuf.Decode(val, &stored))
+		if stored.Bid < bid {
+			escrow = bid - stored.Bid
+		} else {
+			escrow = 0
+		}
+	}
+
 	ctx := byzcoin.ClientTransaction{
 		Instructions: []byzcoin.Instruction{{
+			InstanceID: bidAccInstID,
+			Invoke: &byzcoin.Invoke{
+				ContractID: contracts.ContractCoinID,
+				Command:    "fetch",
+				Args: byzcoin.Arguments{{
+					Name:  "coins",
+					Value: auctioncore.EncodeAmount(escrow)}},
+			},
+			SignerCounter: []uint64{bct.ct},
+		}, {
 			InstanceID: auctInstID,
 			Invoke: &byzcoin.Invoke{
 				ContractID: ContractSBAuctionID,
 				Command:    "bid",
 				Args:       bidArgs,
 			},
-			SignerCounter: []uint64{bct.ct},
+			SignerCounter: []uint64{bct.ct + 1},
 		}},
 	}
 
 	require.Nil(t, ctx.FillSignersAndSignWith(bct.signer))
 	_, err = bct.cl.AddTransactionAndWait(ctx, 10)
 	if err == nil {
-		bct.ct += 1
+		bct.ct += 2
 	}
 
 	return bidata, err
@@ -321,7 +345,8 @@ func (bct *bcTest) verifAddBidToAuction(t *testing.T, auctInstID byzcoin.Instanc
 	auctS := bct.proofAndDecodeAuction(t, auctInstID)
 
 	// Verify value
-	require.Equal(t, bids, auctS.Bids)
+	require.Equal(t, uint32(len(bids)), auctS.BidCount)
+	require.Equal(t, bids, bct.proofAndDecodeBids(t, auctS))
 
 	return auctS
 
@@ -347,20 +372,51 @@ func (bct *bcTest) proofAndDecodeAuction(t *testing.T, auctInstID byzcoin.Instan
 	return auctS
 }
 
+// proofAndDecodeBids follows the bid instances of the auction and returns
+// the bids in the order they were first placed.
+func (bct *bcTest) proofAndDecodeBids(t *testing.T, auction AuctionData) []BidData {
+	bids := make([]BidData, auction.BidCount)
+	next := auction.BidsRoot
+	for i := len(bids) - 1; i >= 0; i-- {
+		reply, err := bct.cl.GetProof(next.Slice())
+		require.Nil(t, err)
+		require.True(t, reply.Proof.InclusionProof.Match(next.Slice()))
+
+		_, val, _, _, err := reply.Proof.KeyValue()
+		require.Nil(t, err)
+
+		stored := StoredBid{}
+		err = protobuf.Decode(val, &stored)
+		require.Nil(t, err)
+
+		bids[i] = BidData{BidderAccount: stored.BidderAccount, Bid: stored.Bid}
+		next = stored.Next
+	}
+	return bids
+}
+
+// coinBalance returns the coins stored in an account.
+func (bct *bcTest) coinBalance(t *testing.T, accInstID byzcoin.InstanceID) uint64 {
+	reply, err := bct.cl.GetProof(accInstID.Slice())
+	require.Nil(t, err)
+	_, val, _, _, err := reply.Proof.KeyValue()
+	require.Nil(t, err)
+
+	coin := byzcoin.Coin{}
+	require.Nil(t, protobuf.Decode(val, &coin))
+	return coin.Value
+}
+
 func printAuction(auction AuctionData) {
 	fmt.Println("Seller account: ", auction.SellerAccount)
 	fmt.Println("Good: ", auction.GoodDescription)
 	fmt.Println("Reserve price: ", auction.ReservePrice)
 	fmt.Println("State: ", auction.State.String())
 
-	if len(auction.Bids) == 0 {
+	if auction.BidCount == 0 {
 		fmt.Println("Bids: none yet")
 	} else {
-		fmt.Println("Bids: ")
-		for i, bid := range auction.Bids {
-			fmt.Println("	Bidder", i+1, ": ", bid.BidderAccount)
-			fmt.Println("		Bid:", bid.Bid)
-		}
+		fmt.Println("Bids: ", auction.BidCount, "bidders")
 	}
 
 	fmt.Println("Winner: ", auction.WinnerAccount)
@@ -1,6 +1,11 @@
 package sb_auctions
 
-import "go.dedis.ch/cothority/v3/byzcoin"
+import (
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+)
 
 // PROTOSTART
 // package auction;
@@ -10,7 +15,7 @@ import "go.dedis.ch/cothority/v3/byzcoin"
 
 //Structures for an Auction instance
 
-//Enum auction state
+// Enum auction state
 type state int
 
 const (
@@ -30,14 +35,78 @@ func (s state) String() string {
 type AuctionData struct {
 	GoodDescription string
 	SellerAccount   byzcoin.InstanceID // The place credit (transfer the coins to) when the auction is over
-	ReservePrice    uint32
-	Bids            []BidData
-	State           state // open or closed
+	ReservePrice    uint64
+	BidCount        uint32 // Number of bid instances attached to this auction
+	State           state  // open or closed
 	Deposits        byzcoin.InstanceID
 	WinnerAccount   byzcoin.InstanceID
+	BidsRoot        byzcoin.InstanceID       // Last bid instance created, the bids are chained from here
+	Settled         bool                     `protobuf:"opt"` // The escrow has been paid out by process
+	Registry        byzcoin.InstanceID       `protobuf:"opt"` // auction house the auction is listed in, if any
+	RegistryIndex   uint64                   `protobuf:"opt"`
+	Category        string                   `protobuf:"opt"`
+	AllowList       darc.ID                  `protobuf:"opt"` // darc whose sign rule the bidders must satisfy, if any
+	Metadata        auctioncore.ItemMetadata `protobuf:"opt"` // structured description of the good, if any
+	Version         uint32                   `protobuf:"opt"` // layout of the data, see AuctionVersion
 }
 
+// BidData is the argument of the "bid" instruction. The bid is the total
+// amount of the bidder, the coins escrowed with the bid instruction must
+// cover the increase over the previous bid. It keeps the layout of the
+// first sealed-bid auctions: both amounts are varints, so a uint32 bid
+// decodes unchanged.
 type BidData struct {
 	BidderAccount byzcoin.InstanceID // The place to refund if this bid is not accepted or debit if accepted.
-	Bid           uint32
+	Bid           uint64
+}
+
+// StoredBid is the value of a bid instance. Every bidder of an auction gets
+// its own instance, derived from the auction and the bidder account, so
+// that bidding never rewrites the list of all the bids.
+type StoredBid struct {
+	Auction       byzcoin.InstanceID
+	BidderAccount byzcoin.InstanceID
+	Bid           uint64
+	Next          byzcoin.InstanceID // Bid instance created before this one, zero for the first bid
+	Unbacked      bool               `protobuf:"opt"` // legacy bid carried over by migrate, without coins in escrow
+}
+
+// GetAuction asks a conode for an auction of the ledger ByzCoinID.
+type GetAuction struct {
+	ByzCoinID skipchain.SkipBlockID
+	AuctionID byzcoin.InstanceID
+}
+
+// GetAuctionReply holds the auction with the proof of its instance.
+type GetAuctionReply struct {
+	Proof   byzcoin.Proof
+	Auction AuctionData
+}
+
+// ListBids asks a conode for the bids of an auction.
+type ListBids struct {
+	ByzCoinID skipchain.SkipBlockID
+	AuctionID byzcoin.InstanceID
+}
+
+// ListBidsReply holds the bids in the order they were first placed, with
+// the proof of the auction and of every bid instance.
+type ListBidsReply struct {
+	Proof     byzcoin.Proof
+	BidProofs []byzcoin.Proof
+	Bids      []StoredBid
+}
+
+// GetOutcome asks a conode for the result of an auction.
+type GetOutcome struct {
+	ByzCoinID skipchain.SkipBlockID
+	AuctionID byzcoin.InstanceID
+}
+
+// GetOutcomeReply holds the result of the auction with the proof of the
+// auction and, once processed with a winner, of the winning bid.
+type GetOutcomeReply struct {
+	Proof       byzcoin.Proof
+	WinnerProof *byzcoin.Proof
+	Outcome     auctioncore.OutcomeData
 }
@@ -0,0 +1,233 @@
+package sb_auctions
+
+import (
+	"errors"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/protobuf"
+)
+
+// GetAuction returns the auction with the proof of its instance.
+func (s *Service) GetAuction(req *GetAuction) (*GetAuctionReply, error) {
+	proof, err := auctioncore.ProveInstance(s.byzService(), req.ByzCoinID, req.AuctionID)
+	if err != nil {
+		return nil, err
+	}
+	auction, err := auctionFromProof(proof, req.ByzCoinID, req.AuctionID)
+	if err != nil {
+		return nil, err
+	}
+	return &GetAuctionReply{Proof: proof, Auction: auction}, nil
+}
+
+// ListBids returns the bids of the auction, walking the bid instances from
+// BidsRoot, with the proof of every instance.
+func (s *Service) ListBids(req *ListBids) (*ListBidsReply, error) {
+	proof, err := auctioncore.ProveInstance(s.byzService(), req.ByzCoinID, req.AuctionID)
+	if err != nil {
+		return nil, err
+	}
+	auction, err := auctionFromProof(proof, req.ByzCoinID, req.AuctionID)
+	if err != nil {
+		return nil, err
+	}
+	reply := &ListBidsReply{Proof: proof, BidProofs: make([]byzcoin.Proof, auction.BidCount)}
+	next := auction.BidsRoot
+	for i := len(reply.BidProofs) - 1; i >= 0; i-- {
+		reply.BidProofs[i], err = auctioncore.ProveInstance(s.byzService(), req.ByzCoinID, next)
+		if err != nil {
+			return nil, err
+		}
+		var stored StoredBid
+		stored, err = bidFromProof(reply.BidProofs[i], req.ByzCoinID, next)
+		if err != nil {
+			return nil, err
+		}
+		next = stored.Next
+	}
+	reply.Bids, err = bidsFromProofs(auction, req.AuctionID, reply.BidProofs, req.ByzCoinID)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// GetOutcome returns the result of the auction, with the proof of the
+// winning bid once the auction is processed.
+func (s *Service) GetOutcome(req *GetOutcome) (*GetOutcomeReply, error) {
+	proof, err := auctioncore.ProveInstance(s.byzService(), req.ByzCoinID, req.AuctionID)
+	if err != nil {
+		return nil, err
+	}
+	auction, err := auctionFromProof(proof, req.ByzCoinID, req.AuctionID)
+	if err != nil {
+		return nil, err
+	}
+	reply := &GetOutcomeReply{Proof: proof}
+	if auction.hasWinner() {
+		var winnerProof byzcoin.Proof
+		winnerProof, err = auctioncore.ProveInstance(s.byzService(), req.ByzCoinID,
+			BidInstanceID(req.AuctionID, auction.WinnerAccount))
+		if err != nil {
+			return nil, err
+		}
+		reply.WinnerProof = &winnerProof
+	}
+	reply.Outcome, err = outcomeFromProofs(auction, req.AuctionID, reply.WinnerProof, req.ByzCoinID)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// hasWinner tells if the auction has been processed with a winner.
+func (a *AuctionData) hasWinner() bool {
+	return a.Settled && !a.WinnerAccount.Equal(byzcoin.InstanceID{})
+}
+
+// auctionFromProof verifies the proof and decodes the auction it holds.
+func auctionFromProof(proof byzcoin.Proof, bcID skipchain.SkipBlockID, auctInstID byzcoin.InstanceID) (AuctionData, error) {
+	val, err := auctioncore.ValueFromProof(proof, bcID, auctInstID, ContractSBAuctionID)
+	if err != nil {
+		return AuctionData{}, err
+	}
+	return DecodeAuction(val)
+}
+
+// bidFromProof verifies the proof and decodes the bid it holds.
+func bidFromProof(proof byzcoin.Proof, bcID skipchain.SkipBlockID, bidInstID byzcoin.InstanceID) (StoredBid, error) {
+	stored := StoredBid{}
+	val, err := auctioncore.ValueFromProof(proof, bcID, bidInstID, ContractSBBidID)
+	if err != nil {
+		return stored, err
+	}
+	return stored, protobuf.Decode(val, &stored)
+}
+
+// bidsFromProofs verifies the proofs of the bids of the auction, given in
+// the order the bids were first placed, and checks that they are the
+// chain of bid instances starting at BidsRoot.
+func bidsFromProofs(auction AuctionData, auctInstID byzcoin.InstanceID, proofs []byzcoin.Proof, bcID skipchain.SkipBlockID) ([]StoredBid, error) {
+	if len(proofs) != int(auction.BidCount) {
+		return nil, errors.New("wrong number of bids")
+	}
+	bids := make([]StoredBid, len(proofs))
+	next := auction.BidsRoot
+	for i := len(bids) - 1; i >= 0; i-- {
+		stored, err := bidFromProof(proofs[i], bcID, next)
+		if err != nil {
+			return nil, err
+		}
+		if stored.Auction != auctInstID {
+			return nil, errors.New("bid of another auction")
+		}
+		bids[i] = stored
+		next = stored.Next
+	}
+	return bids, nil
+}
+
+// outcomeFromProofs returns the result of the auction, the price being read
+// from the proof of the winning bid.
+func outcomeFromProofs(auction AuctionData, auctInstID byzcoin.InstanceID, winnerProof *byzcoin.Proof, bcID skipchain.SkipBlockID) (auctioncore.OutcomeData, error) {
+	outcome := auctioncore.OutcomeData{State: auction.State.String()}
+	if !auction.hasWinner() {
+		return outcome, nil
+	}
+	if winnerProof == nil {
+		return outcome, errors.New("missing the proof of the winning bid")
+	}
+	winner, err := bidFromProof(*winnerProof, bcID, BidInstanceID(auctInstID, auction.WinnerAccount))
+	if err != nil {
+		return outcome, err
+	}
+	outcome.Winner = auction.WinnerAccount
+	outcome.Price = winner.Bid
+	return outcome, nil
+}
+
+// QueryClient reads the auctions through the sb_auctions service of the
+// conodes. The replies are only trusted once their proofs are verified
+// against the ledger.
+type QueryClient struct {
+	*onet.Client
+	Roster    *onet.Roster
+	ByzCoinID skipchain.SkipBlockID
+}
+
+// NewQueryClient returns a client for the ledger bcID run by the roster.
+func NewQueryClient(roster *onet.Roster, bcID skipchain.SkipBlockID) *QueryClient {
+	return &QueryClient{
+		Client:    onet.NewClient(cothority.Suite, ServiceName),
+		Roster:    roster,
+		ByzCoinID: bcID,
+	}
+}
+
+// GetAuction returns the auction with the proof it was read from.
+func (c *QueryClient) GetAuction(auctInstID byzcoin.InstanceID) (AuctionData, byzcoin.Proof, error) {
+	reply := &GetAuctionReply{}
+	err := c.SendProtobuf(c.Roster.RandomServerIdentity(), &GetAuction{ByzCoinID: c.ByzCoinID, AuctionID: auctInstID}, reply)
+	if err != nil {
+		return AuctionData{}, byzcoin.Proof{}, err
+	}
+	auction, err := auctionFromProof(reply.Proof, c.ByzCoinID, auctInstID)
+	if err != nil {
+		return AuctionData{}, byzcoin.Proof{}, err
+	}
+	err = auctioncore.CheckReply(&auction, &reply.Auction)
+	if err != nil {
+		return AuctionData{}, byzcoin.Proof{}, err
+	}
+	return auction, reply.Proof, nil
+}
+
+// ListBids returns the bids of the auction in the order they were first
+// placed.
+func (c *QueryClient) ListBids(auctInstID byzcoin.InstanceID) ([]StoredBid, error) {
+	reply := &ListBidsReply{}
+	err := c.SendProtobuf(c.Roster.RandomServerIdentity(), &ListBids{ByzCoinID: c.ByzCoinID, AuctionID: auctInstID}, reply)
+	if err != nil {
+		return nil, err
+	}
+	auction, err := auctionFromProof(reply.Proof, c.ByzCoinID, auctInstID)
+	if err != nil {
+		return nil, err
+	}
+	bids, err := bidsFromProofs(auction, auctInstID, reply.BidProofs, c.ByzCoinID)
+	if err != nil {
+		return nil, err
+	}
+	type storedBids struct{ Bids []StoredBid }
+	err = auctioncore.CheckReply(&storedBids{bids}, &storedBids{reply.Bids})
+	if err != nil {
+		return nil, err
+	}
+	return bids, nil
+}
+
+// GetOutcome returns the result of the auction.
+func (c *QueryClient) GetOutcome(auctInstID byzcoin.InstanceID) (auctioncore.OutcomeData, error) {
+	reply := &GetOutcomeReply{}
+	err := c.SendProtobuf(c.Roster.RandomServerIdentity(), &GetOutcome{ByzCoinID: c.ByzCoinID, AuctionID: auctInstID}, reply)
+	if err != nil {
+		return auctioncore.OutcomeData{}, err
+	}
+	auction, err := auctionFromProof(reply.Proof, c.ByzCoinID, auctInstID)
+	if err != nil {
+		return auctioncore.OutcomeData{}, err
+	}
+	outcome, err := outcomeFromProofs(auction, auctInstID, reply.WinnerProof, c.ByzCoinID)
+	if err != nil {
+		return auctioncore.OutcomeData{}, err
+	}
+	err = auctioncore.CheckReply(&outcome, &reply.Outcome)
+	if err != nil {
+		return auctioncore.OutcomeData{}, err
+	}
+	return outcome, nil
+}
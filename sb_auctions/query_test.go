@@ -0,0 +1,49 @@
+package sb_auctions
+
+import (
+	"testing"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryClient(t *testing.T) {
+	bct := newBCTest(t)
+	defer bct.Close()
+
+	sellAccInstID, depAccInstID := bct.createSellerAndDepositAccount(t)
+	bidAccInstID := bct.createBidderAccount(t, 100)
+	bid2AccInstID := bct.createBidderAccount(t, 100)
+	auctInstID, _ := bct.createAuction(t, sellAccInstID, depAccInstID, "bananas", 20)
+	_, err := bct.createBid(t, auctInstID, bidAccInstID, 30)
+	require.NoError(t, err)
+	_, err = bct.createBid(t, auctInstID, bid2AccInstID, 40)
+	require.NoError(t, err)
+
+	qc := NewQueryClient(bct.roster, bct.cl.ID)
+	auction, _, err := qc.GetAuction(auctInstID)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), auction.BidCount)
+
+	bids, err := qc.ListBids(auctInstID)
+	require.NoError(t, err)
+	require.Len(t, bids, 2)
+	require.Equal(t, bidAccInstID, bids[0].BidderAccount)
+	require.Equal(t, uint64(40), bids[1].Bid)
+
+	outcome, err := qc.GetOutcome(auctInstID)
+	require.NoError(t, err)
+	require.Equal(t, auctioncore.OutcomeData{State: "OPEN"}, outcome)
+
+	require.NoError(t, bct.closeAuction(t, auctInstID))
+	outcome, err = qc.GetOutcome(auctInstID)
+	require.NoError(t, err)
+	require.Equal(t, auctioncore.OutcomeData{State: "CLOSED", Winner: bid2AccInstID, Price: 40}, outcome)
+
+	// The proofs of the bids must follow the chain of the auction
+	reply, err := bct.servers[0].Service(ServiceName).(*Service).ListBids(&ListBids{ByzCoinID: bct.cl.ID, AuctionID: auctInstID})
+	require.NoError(t, err)
+	reply.BidProofs[0], reply.BidProofs[1] = reply.BidProofs[1], reply.BidProofs[0]
+	_, err = bidsFromProofs(auction, auctInstID, reply.BidProofs, bct.cl.ID)
+	require.Error(t, err)
+}
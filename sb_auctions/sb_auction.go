@@ -1,11 +1,13 @@
 package sb_auctions
 
 import (
-	"encoding/binary"
+	"bytes"
+	"crypto/sha256"
 	"errors"
 
+	"github.com/dedis/student_19_auctions/auction_house"
+	"github.com/dedis/student_19_auctions/auctioncore"
 	"go.dedis.ch/cothority/v3/byzcoin"
-	"go.dedis.ch/cothority/v3/byzcoin/contracts"
 	"go.dedis.ch/cothority/v3/darc"
 	"go.dedis.ch/protobuf"
 )
@@ -13,18 +15,46 @@ import (
 // ContractAuctionID identifies an auction contract
 var ContractSBAuctionID = "sb_auction"
 
+// ContractSBBidID identifies the instances holding the bids of an auction.
+// They are only created and updated by the sb_auction contract.
+var ContractSBBidID = "sb_auction_bid"
+
 type contractSBAuction struct {
 	byzcoin.BasicContract
 	AuctionData
-	s *byzcoin.Service
+	contracts auctioncore.Contracts
 }
 
-func contractSBAuctionFromBytes(in []byte) (byzcoin.Contract, error) {
+type contractSBBid struct {
+	byzcoin.BasicContract
+	StoredBid
+}
+
+func contractSBBidFromBytes(in []byte) (byzcoin.Contract, error) {
+	cv := &contractSBBid{}
+	err := protobuf.Decode(in, &cv.StoredBid)
+	if err != nil {
+		return nil, err
+	}
+	return cv, nil
+}
+
+func (s *Service) contractSBAuctionFromBytes(in []byte) (byzcoin.Contract, error) {
+	return NewContract(s.byzService(), in)
+}
+
+// NewContract returns the sealed-bid auction contract of an instance
+// holding in. The coins it pays out are stored through the coin contract
+// of contracts, which is the ByzCoin service unless the auction is
+// replayed offline.
+func NewContract(contracts auctioncore.Contracts, in []byte) (byzcoin.Contract, error) {
 	cv := &contractSBAuction{}
-	err := protobuf.Decode(in, &cv.AuctionData)
+	var err error
+	cv.AuctionData, _, err = decodeAuction(in)
 	if err != nil {
 		return nil, err
 	}
+	cv.contracts = contracts
 	return cv, nil
 }
 
@@ -51,7 +81,7 @@ func (c *contractSBAuction) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.In
 	// auctionBuf store the value of the argument with name auction
 	auctionBuf := inst.Spawn.Args.Search("auction")
 	if auctionBuf == nil {
-		return nil, nil, errors.New("need an argument with name auction")
+		return nil, nil, auctioncore.ErrMissingAuction
 	}
 
 	//Verify that it's an auction
@@ -60,6 +90,19 @@ func (c *contractSBAuction) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.In
 	if err != nil {
 		return nil, nil, errors.New("Error: not an auction")
 	}
+	if auction.Version > AuctionVersion {
+		return nil, nil, errors.New("unknown auction version")
+	}
+	auction.Version = AuctionVersion
+	auction.GoodDescription, auction.Category, err = auctioncore.CheckMetadata(auction.Metadata,
+		auction.GoodDescription, auction.Category)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = auctioncore.CheckAllowList(rst, auction.AllowList)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// Create the auction instance in the global state thanks to
 	// a StateChange request with the data of the instance. The
@@ -67,9 +110,26 @@ func (c *contractSBAuction) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.In
 	// to create multiple instanceIDs out of a given instruction in a pseudo-
 	// random way that will be the same for all nodes.
 	auctInstID := inst.DeriveID("")
-	sc = []byzcoin.StateChange{
-		byzcoin.NewStateChange(byzcoin.Create, auctInstID, ContractSBAuctionID, auctionBuf, darcID),
+
+	//List the auction in its auction house
+	if !auction.Registry.Equal(byzcoin.InstanceID{}) {
+		sc, auction.RegistryIndex, err = auction_house.Register(rst, inst, auction.Registry, auction_house.EntryData{
+			Auction:    auctInstID,
+			ContractID: ContractSBAuctionID,
+			Seller:     auction.SellerAccount,
+			Category:   auction.Category,
+			State:      auction.entryState(),
+		}, darcID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	auctionBuf, err = protobuf.Encode(&auction)
+	if err != nil {
+		return nil, nil, errors.New("encode auction buf sc")
 	}
+
+	sc = append(sc, byzcoin.NewStateChange(byzcoin.Create, auctInstID, ContractSBAuctionID, auctionBuf, darcID))
 	return
 }
 
@@ -84,7 +144,36 @@ func (c *contractSBAuction) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.In
 //  - close: ends an auction
 // You can only delete a contractAuction instance after the auction is closed.
 
+// Invoke runs the command and, when the auction is listed in an auction
+// house, makes its entry follow the changes of state.
 func (c *contractSBAuction) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	sc, cout, err = c.invoke(rst, inst, coins)
+	if err != nil || c.Registry.Equal(byzcoin.InstanceID{}) {
+		return
+	}
+	for _, s := range sc {
+		if !bytes.Equal(s.InstanceID, inst.InstanceID.Slice()) {
+			continue
+		}
+		auction := AuctionData{}
+		err = protobuf.Decode(s.Value, &auction)
+		if err != nil {
+			return nil, nil, err
+		}
+		if auction.entryState() != c.entryState() {
+			var entrySC []byzcoin.StateChange
+			entrySC, err = auction_house.UpdateState(rst, c.Registry, c.RegistryIndex, inst.InstanceID, auction.entryState())
+			if err != nil {
+				return nil, nil, err
+			}
+			sc = append(sc, entrySC...)
+		}
+		return
+	}
+	return
+}
+
+func (c *contractSBAuction) invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
 
 	cout = coins
 
@@ -97,22 +186,34 @@ func (c *contractSBAuction) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.I
 	if inst.Invoke.Command == "bid" {
 		bidBuf := inst.Invoke.Args.Search("bid")
 		if bidBuf == nil {
-			err = errors.New("need an argument with name bid")
+			err = auctioncore.ErrMissingBid
 			return
 		}
 	}
 
 	var auctionBuf []byte
 	auctionBuf, _, _, _, err = rst.GetValues(inst.InstanceID.Slice())
-	auction := AuctionData{}
-	err = protobuf.Decode(auctionBuf, &auction)
 	if err != nil {
 		return
 	}
+	var auction AuctionData
+	var legacyBids []legacyBidData
+	auction, legacyBids, err = decodeAuction(auctionBuf)
+	if err != nil {
+		return
+	}
+
+	//Rewrites the auction in the newest layout, in any state
+	if inst.Invoke.Command == "migrate" {
+		sc, err = migrate(inst.InstanceID, auction, legacyBids, darcID)
+		return
+	}
+	if len(legacyBids) > 0 {
+		return nil, nil, ErrMigrate
+	}
 
 	if auction.State == CLOSED && inst.Invoke.Command == "bid" {
-		err = errors.New("auction is closed, cannot bid")
-		return nil, nil, err
+		return nil, nil, auctioncore.ErrAuctionClosed
 	}
 
 	//// Invoke provides two methods "bid", "close" or "process"
@@ -123,60 +224,98 @@ func (c *contractSBAuction) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.I
 		//bidBuf store the value of the argument with name bid
 		bidBuf := inst.Invoke.Args.Search("bid")
 		if bidBuf == nil {
-			return nil, nil, errors.New("need an argument with name bid")
+			return nil, nil, auctioncore.ErrMissingBid
 		}
 
 		//Verify that it's a bid
 		bid := BidData{}
 		err = protobuf.Decode(bidBuf, &bid)
 		if err != nil {
-			return nil, nil, errors.New("not a bid")
+			return nil, nil, auctioncore.ErrNotBid
+		}
+		if bid.Bid == 0 {
+			return nil, nil, auctioncore.ErrZeroBid
+		}
+		if bid.BidderAccount == auction.SellerAccount {
+			return nil, nil, auctioncore.ErrSellerBid
+		}
+		err = auctioncore.VerifyAllowList(rst, inst, auction.AllowList)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		//The coins fetched from the bidder account are kept in escrow
+		var escrowed uint64
+		escrowed, cout, err = auctioncore.CollectCoins(rst, bid.BidderAccount, coins)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		bidInstID := BidInstanceID(inst.InstanceID, bid.BidderAccount)
+		var stored StoredBid
+		var found bool
+		stored, found, err = getStoredBid(rst, bidInstID)
+		if err != nil {
+			return nil, nil, err
 		}
 
-		found, i := c.searchBidder(auction.Bids, bid.BidderAccount)
 		if found != true { //first bid
-			bidCoins := make([]byte, 8)
-			binary.BigEndian.PutUint32(bidCoins, bid.Bid)
+			if escrowed != bid.Bid {
+				return nil, nil, auctioncore.ErrEscrowMismatch
+			}
+			stored = StoredBid{
+				Auction:       inst.InstanceID,
+				BidderAccount: bid.BidderAccount,
+				Bid:           bid.Bid,
+				Next:          auction.BidsRoot,
+			}
+			var storedBuf []byte
+			storedBuf, err = protobuf.Encode(&stored)
 			if err != nil {
-				err = errors.New("making converting bid to coins")
-				return nil, nil, err
+				return nil, nil, errors.New("encode stored bid buf sc")
+			}
+
+			//The auction only keeps the counter and the root of the bids
+			auction.BidCount++
+			auction.BidsRoot = bidInstID
+			auctionBuf, err = protobuf.Encode(&auction)
+			if err != nil {
+				return nil, nil, errors.New("encode auction buf sc")
+			}
+
+			sc = []byzcoin.StateChange{
+				byzcoin.NewStateChange(byzcoin.Create, bidInstID,
+					ContractSBBidID, storedBuf, darcID),
+				byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+					ContractSBAuctionID, auctionBuf, darcID),
 			}
-			//err := c.transferCoin(rst, bidCoins, bid.BidderAccount, auction.Deposits)
-			//if err != nil {
-			//	err = errors.New("transfer coins not working")
-			//	return nil, nil, err
-			//}
-			auction.Bids = append(auction.Bids, bid)
 
 		} else { //update bid
-			prevBid := auction.Bids[i].Bid
-			if bid.Bid < prevBid {
+			if bid.Bid < stored.Bid {
 				err = errors.New("cannot bid less than previous bid")
 				return nil, nil, err
-			} else {
-				//Incremental bid
-				diff := bid.Bid - prevBid
-				bidCoins := make([]byte, 8)
-				binary.BigEndian.PutUint32(bidCoins, diff)
-
-				//err := c.transferCoin(rst, bidCoins, bid.BidderAccount, auction.Deposits)
-				//if err != nil {
-				//	err = errors.New("not enough coins to update bid")
-				//	return nil, nil, err
-				//}
-				auction.Bids[i].Bid = bid.Bid
-
 			}
-		}
-
-		auctionBuf, err = protobuf.Encode(&auction)
-		if err != nil {
-			return nil, nil, errors.New("encode auction buf sc")
-		}
+			//A legacy bid holds nothing, the whole bid is escrowed
+			held := stored.Bid
+			if stored.Unbacked {
+				held = 0
+			}
+			if escrowed != bid.Bid-held {
+				return nil, nil, auctioncore.ErrEscrowMismatch
+			}
+			//Incremental bid, only the bid instance changes
+			stored.Bid = bid.Bid
+			stored.Unbacked = false
+			var storedBuf []byte
+			storedBuf, err = protobuf.Encode(&stored)
+			if err != nil {
+				return nil, nil, errors.New("encode stored bid buf sc")
+			}
 
-		sc = []byzcoin.StateChange{
-			byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
-				ContractSBAuctionID, auctionBuf, darcID),
+			sc = []byzcoin.StateChange{
+				byzcoin.NewStateChange(byzcoin.Update, bidInstID,
+					ContractSBBidID, storedBuf, darcID),
+			}
 		}
 
 	case "close":
@@ -193,122 +332,156 @@ func (c *contractSBAuction) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.I
 		}
 
 	case "process":
-		var winner BidData
-		winner, auction.Bids = getWinner(auction.Bids)
+		if auction.State != CLOSED {
+			return nil, nil, auctioncore.ErrAuctionOpen
+		}
+		if auction.Settled {
+			return nil, nil, auctioncore.ErrAlreadySettled
+		}
 
-		if winner.Bid <= auction.ReservePrice {
-			err = errors.New("Reserve price not reached")
+		var stored []StoredBid
+		stored, err = getStoredBids(rst, auction)
+		if err != nil {
+			return nil, nil, err
+		}
+		bids := bidsOf(stored)
+		winner := getWinner(bids)
+
+		//The winner pays the seller and everybody else is refunded. If the
+		//reserve price is not reached, all the bids are refunded. Unbacked
+		//legacy bids hold no coins to pay or refund.
+		payouts := auctioncore.Payouts{}
+		for i, bid := range bids {
+			if stored[i].Unbacked {
+				continue
+			}
+			if bid.BidderAccount == winner.BidderAccount && winner.Bid > auction.ReservePrice {
+				payouts.Add(auction.SellerAccount, bid.Bid)
+			} else {
+				payouts.Add(bid.BidderAccount, bid.Bid)
+			}
+		}
+		sc, err = payouts.StoreCoins(c.contracts, rst)
+		if err != nil {
 			return nil, nil, err
 		}
 
-		//auction.Bids, err = c.creditAndRefundCoin(rst, winner, auction.SellerAccount, auction.Bids, auction.Deposits)
-		//if err != nil {
-		//	err = errors.New("refunding not working")
-		//	return nil, nil, err
-		//}
-
-		auction.WinnerAccount = winner.BidderAccount
+		if winner.Bid > auction.ReservePrice {
+			auction.WinnerAccount = winner.BidderAccount
+		}
+		auction.Settled = true
 
 		auctionBuf, err = protobuf.Encode(&auction)
 		if err != nil {
 			return nil, nil, errors.New("encode auction buf sc")
 		}
 
-		sc = []byzcoin.StateChange{
-			byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
-				ContractSBAuctionID, auctionBuf, darcID),
-		}
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+			ContractSBAuctionID, auctionBuf, darcID))
 
 	default:
-		err = errors.New("Auction contract can only bid, close or process")
+		err = errors.New("Auction contract can only bid, close, process or migrate")
 	}
 
 	return
 }
 
-//function getWinner
-func getWinner(bids []BidData) (BidData, []BidData) {
-	var highestBid BidData = bids[0]
-	index := 0
-	for i, value := range bids {
-		if highestBid.Bid < value.Bid {
-			highestBid = value
-			index = i
-		}
-	}
-	bids = remove(bids, index)
-	return highestBid, bids
+// Item returns the description of the good sold by the auction.
+func (a *AuctionData) Item() auctioncore.ItemMetadata {
+	return auctioncore.Describe(a.Metadata, a.GoodDescription)
 }
 
-func (c *contractSBAuction) transferCoin(rst byzcoin.ReadOnlyStateTrie, amount []byte, debitAccount byzcoin.InstanceID, creditAccount byzcoin.InstanceID) (err error) {
-	instruct := byzcoin.Instruction{
-		InstanceID: debitAccount,
-		Invoke: &byzcoin.Invoke{
-			ContractID: contracts.ContractCoinID,
-			Command:    "transfer",
-			Args: byzcoin.Arguments{
-				{Name: "coins", Value: amount},
-				{Name: "destination", Value: creditAccount.Slice()},
-			},
-		},
+// entryState is the state of the auction as listed in an auction house.
+// An auction is only closed with a winner once it has been processed.
+func (a *AuctionData) entryState() string {
+	if a.State != CLOSED {
+		return auctioncore.StateOpen
 	}
-
-	cFact, found := c.s.GetContractConstructor(contracts.ContractCoinID)
-	if !found {
-		return err
+	if a.Settled && !a.WinnerAccount.Equal(byzcoin.InstanceID{}) {
+		return auctioncore.StateWClosed
 	}
+	return auctioncore.StateClosed
+}
 
-	cCoin, err := cFact(nil)
+// getBids walks the bid instances of the auction, starting from BidsRoot,
+// and returns the bids in the order they were first placed. Every bid is
+// read exactly once.
+func getBids(rst byzcoin.ReadOnlyStateTrie, auction AuctionData) ([]BidData, error) {
+	stored, err := getStoredBids(rst, auction)
 	if err != nil {
-		return err
-	}
-	_, _, err = cCoin.Invoke(rst, instruct, []byzcoin.Coin{})
-	if err != nil {
-		return err
+		return nil, err
 	}
-
-	return
-	//log.LLvl4(s)
+	return bidsOf(stored), nil
 }
 
-func (c *contractSBAuction) creditAndRefundCoin(rst byzcoin.ReadOnlyStateTrie, winner BidData, sellerAccount byzcoin.InstanceID, bids []BidData, depositAccount byzcoin.InstanceID) (b []BidData, err error) {
-
-	bidCoins := make([]byte, 8)
-
-	//Credit seller account
-	binary.BigEndian.PutUint32(bidCoins, winner.Bid)
-	err = c.transferCoin(rst, bidCoins, depositAccount, sellerAccount)
-	if err != nil {
-		err = errors.New("transfer coins deposit to seller not working")
-		return bids, err
+// getStoredBids is getBids returning the bid instances.
+func getStoredBids(rst byzcoin.ReadOnlyStateTrie, auction AuctionData) ([]StoredBid, error) {
+	if auction.BidCount == 0 {
+		return nil, auctioncore.ErrNoBids
 	}
 
-	//Refund
-	for i, bid := range bids {
-		binary.BigEndian.PutUint32(bidCoins, bid.Bid)
-		err := c.transferCoin(rst, bidCoins, depositAccount, bid.BidderAccount)
+	bids := make([]StoredBid, auction.BidCount)
+	next := auction.BidsRoot
+	for i := len(bids) - 1; i >= 0; i-- {
+		stored, found, err := getStoredBid(rst, next)
 		if err != nil {
-			return bids, err
+			return nil, err
 		}
-		bids = remove(bids, i)
+		if !found {
+			return nil, errors.New("missing bid instance")
+		}
+		bids[i] = stored
+		next = stored.Next
 	}
-
-	return bids, err
+	return bids, nil
 }
 
-func remove(bids []BidData, i int) []BidData {
-	length := len(bids) - 1
-	bids[i] = bids[length]   // Copy last element to index i.
-	bids[length] = BidData{} // Erase last element
-	bids = bids[:length]
+// bidsOf returns the bids held by the bid instances.
+func bidsOf(stored []StoredBid) []BidData {
+	bids := make([]BidData, len(stored))
+	for i, s := range stored {
+		bids[i] = BidData{BidderAccount: s.BidderAccount, Bid: s.Bid}
+	}
 	return bids
 }
 
-func (c *contractSBAuction) searchBidder(bids []BidData, bidAcc byzcoin.InstanceID) (bool, int) {
-	for i, bid := range bids {
-		if bid.BidderAccount == bidAcc {
-			return true, i
+// function getWinner
+func getWinner(bids []BidData) BidData {
+	var highestBid BidData = bids[0]
+	for _, value := range bids {
+		if highestBid.Bid < value.Bid {
+			highestBid = value
 		}
 	}
-	return false, 0
+	return highestBid
+}
+
+// BidInstanceID returns the instance holding the bid of bidAcc in the
+// auction auctInstID.
+func BidInstanceID(auctInstID byzcoin.InstanceID, bidAcc byzcoin.InstanceID) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write(auctInstID.Slice())
+	h.Write(bidAcc.Slice())
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
+
+// getStoredBid reads a bid instance. It returns false if the instance does
+// not exist yet.
+func getStoredBid(rst byzcoin.ReadOnlyStateTrie, bidInstID byzcoin.InstanceID) (StoredBid, bool, error) {
+	stored := StoredBid{}
+	val, _, contractID, _, err := rst.GetValues(bidInstID.Slice())
+	if auctioncore.IsKeyNotSet(err) {
+		return stored, false, nil
+	}
+	if err != nil {
+		return stored, false, err
+	}
+	if contractID != ContractSBBidID {
+		return stored, false, errors.New("instance is not a bid")
+	}
+	err = protobuf.Decode(val, &stored)
+	if err != nil {
+		return stored, false, err
+	}
+	return stored, true, nil
 }
@@ -1,11 +1,18 @@
 package sb_auctions
 
 import (
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
 	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/byzcoin/trie"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
 )
 
 func TestContractSBAuction_Spawn(t *testing.T) {
@@ -19,7 +26,7 @@ func TestContractSBAuction_Spawn(t *testing.T) {
 
 	//Creating auction
 	good := "bananas"
-	reservePrice := uint32(0)
+	reservePrice := uint64(0)
 	auctInstID, auctionData := bct.createAuction(t, sellAccInstID, depAccInstID, good, reservePrice)
 
 	//Verify auction
@@ -38,7 +45,7 @@ func TestContractSBAuction_Invoke(t *testing.T) {
 	sellAccInstID, depAccInstID := bct.createSellerAndDepositAccount(t)
 
 	//Creating bidder account with amount
-	amount := uint32(200)
+	amount := uint64(200)
 	bidAccInstID := bct.createBidderAccount(t, amount)
 
 	//Creating another bidder account with amount
@@ -46,20 +53,20 @@ func TestContractSBAuction_Invoke(t *testing.T) {
 
 	//Creating auction
 	good := "bananas"
-	reservePrice := uint32(0)
+	reservePrice := uint64(0)
 	auctInstID, auctionData := bct.createAuction(t, sellAccInstID, depAccInstID, good, reservePrice)
 
 	//array of bids
 	bids := []BidData{}
 
 	//First bidder bids -> invoke bid
-	bid := uint32(30)
+	bid := uint64(30)
 	bidata, err := bct.createBid(t, auctInstID, bidAccInstID, bid)
 	require.NoError(t, err)
 	bids = append(bids, bidata)
 
 	//Second bidder bids -> invoke bid
-	bid = uint32(10)
+	bid = uint64(10)
 	bidata, err = bct.createBid(t, auctInstID, bidAccInstID2, bid)
 	require.NoError(t, err)
 	bids = append(bids, bidata)
@@ -67,12 +74,12 @@ func TestContractSBAuction_Invoke(t *testing.T) {
 	auctS := bct.verifAddBidToAuction(t, auctInstID, auctionData, bids)
 
 	//First bidder update bid
-	bid = uint32(20)
+	bid = uint64(20)
 	bidata, err = bct.createBid(t, auctInstID, bidAccInstID, bid)
 	require.Error(t, err, "cannot bid less than previous bid")
 
 	//Second bidder update bid
-	bid = uint32(40)
+	bid = uint64(40)
 	bidata, err = bct.createBid(t, auctInstID, bidAccInstID2, bid)
 	require.NoError(t, err)
 	bids[1].Bid = bid
@@ -88,9 +95,128 @@ func TestContractSBAuction_Invoke(t *testing.T) {
 	auctS = bct.verifCloseAuction(t, auctInstID)
 	printAuction(auctS)
 
+	//The winner paid the seller, the other bidder got refunded
+	require.Equal(t, bidAccInstID2, auctS.WinnerAccount)
+	require.Equal(t, uint64(40), bct.coinBalance(t, sellAccInstID))
+	require.Equal(t, amount, bct.coinBalance(t, bidAccInstID))
+	require.Equal(t, amount-40, bct.coinBalance(t, bidAccInstID2))
+
 	//First bidder update bid
-	bid = uint32(40)
+	bid = uint64(40)
 	_, err = bct.createBid(t, auctInstID, bidAccInstID, bid)
 	require.Error(t, err, "auction is closed, cannot bid")
 
 }
+
+// BenchmarkContractSBAuction_Bid measures the cost of a new bid for
+// auctions that already hold different numbers of bids. As every bid lives
+// in its own instance, the cost per bid must not depend on this number.
+func BenchmarkContractSBAuction_Bid(b *testing.B) {
+	for _, previous := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("previous=%d", previous), func(b *testing.B) {
+			benchmarkBid(b, previous)
+		})
+	}
+}
+
+func benchmarkBid(b *testing.B, previous int) {
+	rst := newMemTrie()
+	auctInstID := byzcoin.NewInstanceID([]byte("auction"))
+	auction := AuctionData{
+		GoodDescription: "bananas",
+		State:           OPEN,
+	}
+	auctionBuf, err := protobuf.Encode(&auction)
+	require.NoError(b, err)
+	rst.apply([]byzcoin.StateChange{byzcoin.NewStateChange(byzcoin.Create,
+		auctInstID, ContractSBAuctionID, auctionBuf, darc.ID{})})
+
+	c := &contractSBAuction{}
+	for i := 0; i < previous; i++ {
+		memBid(b, c, rst, auctInstID, i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		memBid(b, c, rst, auctInstID, previous+i)
+	}
+}
+
+// memBid creates the account of a new bidder, places its bid and stores
+// the resulting state changes.
+func memBid(b *testing.B, c *contractSBAuction, rst *memTrie, auctInstID byzcoin.InstanceID, bidder int) {
+	bidAccInstID := byzcoin.InstanceID{}
+	binary.LittleEndian.PutUint64(bidAccInstID[:], uint64(bidder))
+	coinBuf, err := protobuf.Encode(&byzcoin.Coin{Name: contracts.CoinName})
+	require.NoError(b, err)
+	rst.apply([]byzcoin.StateChange{byzcoin.NewStateChange(byzcoin.Create,
+		bidAccInstID, contracts.ContractCoinID, coinBuf, darc.ID{})})
+
+	bidBuf, err := protobuf.Encode(&BidData{BidderAccount: bidAccInstID, Bid: 10})
+	require.NoError(b, err)
+
+	inst := byzcoin.Instruction{
+		InstanceID: auctInstID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractSBAuctionID,
+			Command:    "bid",
+			Args:       byzcoin.Arguments{{Name: "bid", Value: bidBuf}},
+		},
+	}
+	coins := []byzcoin.Coin{{Name: contracts.CoinName, Value: 10}}
+	sc, _, err := c.Invoke(rst, inst, coins)
+	require.NoError(b, err)
+	rst.apply(sc)
+}
+
+func TestGetStoredBid(t *testing.T) {
+	bidInstID := byzcoin.NewInstanceID([]byte("bid"))
+	_, found, err := getStoredBid(newMemTrie(), bidInstID)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	// Only a missing instance is not found, other errors are returned
+	_, _, err = getStoredBid(failingTrie{newMemTrie()}, bidInstID)
+	require.Error(t, err)
+}
+
+// failingTrie is a memTrie whose reads fail.
+type failingTrie struct {
+	*memTrie
+}
+
+func (failingTrie) GetValues(key []byte) ([]byte, uint64, string, darc.ID, error) {
+	return nil, 0, "", nil, errors.New("cannot read the trie")
+}
+
+// memTrie is a ReadOnlyStateTrie kept in memory, so the contract can be
+// benchmarked without a ledger.
+type memTrie struct {
+	values map[string]byzcoin.StateChange
+}
+
+func newMemTrie() *memTrie {
+	return &memTrie{values: make(map[string]byzcoin.StateChange)}
+}
+
+func (m *memTrie) GetValues(key []byte) ([]byte, uint64, string, darc.ID, error) {
+	sc, ok := m.values[string(key)]
+	if !ok {
+		return nil, 0, "", nil, errors.New("key not set")
+	}
+	return sc.Value, sc.Version, sc.ContractID, sc.DarcID, nil
+}
+
+func (m *memTrie) GetProof(key []byte) (*trie.Proof, error) {
+	return nil, errors.New("not supported")
+}
+
+func (m *memTrie) GetIndex() int {
+	return 0
+}
+
+func (m *memTrie) apply(scs []byzcoin.StateChange) {
+	for _, sc := range scs {
+		m.values[string(sc.InstanceID)] = sc
+	}
+}
@@ -4,18 +4,24 @@ import (
 	"go.dedis.ch/cothority/v3/byzcoin"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
 )
 
-// This service is only used because we need to register our contracts to
-// the ByzCoin service. So we create this stub and add contracts to it
-// from the `contracts` directory.
+// ServiceName is the name of the service, used by the query clients.
+const ServiceName = "sb_auctions"
+
+// The service registers our contracts to the ByzCoin service and answers
+// the queries of the auctions with their proofs.
 
 func init() {
-	_, err := onet.RegisterNewService("sb_auctions", newService)
+	_, err := onet.RegisterNewService(ServiceName, newService)
 	log.ErrFatal(err)
+	network.RegisterMessages(&GetAuction{}, &GetAuctionReply{},
+		&ListBids{}, &ListBidsReply{},
+		&GetOutcome{}, &GetOutcomeReply{})
 }
 
-// Service is only used to being able to store our contracts
+// Service stores our contracts and answers the queries
 type Service struct {
 	// We need to embed the ServiceProcessor, so that incoming messages
 	// are correctly handled.
@@ -26,6 +32,16 @@ func newService(c *onet.Context) (onet.Service, error) {
 	s := &Service{
 		ServiceProcessor: onet.NewServiceProcessor(c),
 	}
-	byzcoin.RegisterContract(c, ContractSBAuctionID, contractSBAuctionFromBytes)
+	byzcoin.RegisterContract(c, ContractSBAuctionID, s.contractSBAuctionFromBytes)
+	byzcoin.RegisterContract(c, ContractSBBidID, contractSBBidFromBytes)
+	err := s.RegisterHandlers(s.GetAuction, s.ListBids, s.GetOutcome)
+	if err != nil {
+		return nil, err
+	}
 	return s, nil
 }
+
+// byzService returns the ByzCoin service the contracts are registered to.
+func (s *Service) byzService() *byzcoin.Service {
+	return s.Service(byzcoin.ServiceName).(*byzcoin.Service)
+}
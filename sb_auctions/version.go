@@ -0,0 +1,119 @@
+package sb_auctions
+
+import (
+	"errors"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+// AuctionVersion is the layout of AuctionData written by this code.
+// Version 0 are the auctions stored before the field was added. They either
+// only lack optional fields, or are in the legacy layout which embedded the
+// bids in the auction.
+const AuctionVersion = 1
+
+// ErrMigrate is returned when a legacy auction is used before being
+// migrated.
+var ErrMigrate = errors.New("auction in the legacy layout, it must be migrated first")
+
+// legacyAuctionData is the layout of the first sealed-bid auctions, with the
+// bids embedded in the auction.
+type legacyAuctionData struct {
+	GoodDescription string
+	SellerAccount   byzcoin.InstanceID
+	ReservePrice    uint32
+	Bids            []legacyBidData
+	State           state
+	Deposits        byzcoin.InstanceID
+	WinnerAccount   byzcoin.InstanceID
+}
+
+type legacyBidData struct {
+	BidderAccount byzcoin.InstanceID
+	Bid           uint32
+}
+
+// decodeAuction decodes an auction stored in any layout and upgrades it to
+// the newest one. The bids embedded in a legacy auction are returned, the
+// auction must be migrated to store them in bid instances before it can be
+// used.
+func decodeAuction(buf []byte) (AuctionData, []legacyBidData, error) {
+	auction := AuctionData{}
+	err := protobuf.Decode(buf, &auction)
+	if err == nil {
+		if auction.Version > AuctionVersion {
+			return auction, nil, errors.New("unknown auction version")
+		}
+		auction.Version = AuctionVersion
+		return auction, nil, nil
+	}
+
+	legacy := legacyAuctionData{}
+	if protobuf.Decode(buf, &legacy) != nil {
+		return auction, nil, err
+	}
+	return AuctionData{
+		GoodDescription: legacy.GoodDescription,
+		SellerAccount:   legacy.SellerAccount,
+		ReservePrice:    uint64(legacy.ReservePrice),
+		State:           legacy.State,
+		Deposits:        legacy.Deposits,
+		WinnerAccount:   legacy.WinnerAccount,
+		Version:         AuctionVersion,
+	}, legacy.Bids, nil
+}
+
+// DecodeAuction decodes an auction read from the ledger. An auction in the
+// legacy layout is returned with ErrMigrate.
+func DecodeAuction(buf []byte) (AuctionData, error) {
+	auction, legacyBids, err := decodeAuction(buf)
+	if err == nil && len(legacyBids) > 0 {
+		err = ErrMigrate
+	}
+	return auction, err
+}
+
+// migrate returns the state changes storing the auction in the newest
+// layout. The legacy bids become bid instances and the auction keeps its
+// state. They never held coins in escrow, so they are marked unbacked: the
+// auction is settled as before, without paying or refunding them. A legacy
+// auction with a winner was already processed, it is settled.
+func migrate(auctInstID byzcoin.InstanceID, auction AuctionData, legacyBids []legacyBidData, darcID darc.ID) ([]byzcoin.StateChange, error) {
+	var sc []byzcoin.StateChange
+	bids := make(map[byzcoin.InstanceID]*StoredBid)
+	var order []byzcoin.InstanceID
+	for _, lb := range legacyBids {
+		if stored, ok := bids[lb.BidderAccount]; ok {
+			if uint64(lb.Bid) > stored.Bid {
+				stored.Bid = uint64(lb.Bid)
+			}
+			continue
+		}
+		bids[lb.BidderAccount] = &StoredBid{Auction: auctInstID, BidderAccount: lb.BidderAccount, Bid: uint64(lb.Bid), Unbacked: true}
+		order = append(order, lb.BidderAccount)
+	}
+
+	for _, bidder := range order {
+		stored := bids[bidder]
+		stored.Next = auction.BidsRoot
+		storedBuf, err := protobuf.Encode(stored)
+		if err != nil {
+			return nil, errors.New("encode stored bid buf sc")
+		}
+		bidInstID := BidInstanceID(auctInstID, bidder)
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Create, bidInstID, ContractSBBidID, storedBuf, darcID))
+		auction.BidCount++
+		auction.BidsRoot = bidInstID
+	}
+	if !auction.WinnerAccount.Equal(byzcoin.InstanceID{}) {
+		auction.Settled = true
+	}
+
+	auctionBuf, err := protobuf.Encode(&auction)
+	if err != nil {
+		return nil, errors.New("encode auction buf sc")
+	}
+	return append(sc, byzcoin.NewStateChange(byzcoin.Update, auctInstID, ContractSBAuctionID, auctionBuf, darcID)), nil
+}
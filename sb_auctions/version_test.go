@@ -0,0 +1,166 @@
+package sb_auctions
+
+import (
+	"testing"
+
+	"github.com/dedis/student_19_auctions/auctioncore"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+func TestDecodeAuction(t *testing.T) {
+	seller := byzcoin.NewInstanceID([]byte("seller"))
+	a := byzcoin.NewInstanceID([]byte("a"))
+	b := byzcoin.NewInstanceID([]byte("b"))
+
+	// Current format, stored before the version
+	stored := AuctionData{GoodDescription: "bananas", SellerAccount: seller, ReservePrice: 10,
+		BidCount: 2, State: OPEN, BidsRoot: a, Category: "fruit", AllowList: darc.ID{}}
+	buf, err := protobuf.Encode(&stored)
+	require.NoError(t, err)
+	auction, legacyBids, err := decodeAuction(buf)
+	require.NoError(t, err)
+	require.Nil(t, legacyBids)
+	stored.Version = AuctionVersion
+	require.Equal(t, stored, auction)
+
+	// Legacy format, with the bids embedded
+	legacy := legacyAuctionData{GoodDescription: "bananas", SellerAccount: seller, ReservePrice: 10,
+		Bids: []legacyBidData{{BidderAccount: a, Bid: 5}, {BidderAccount: b, Bid: 20}, {BidderAccount: a, Bid: 30}}, State: OPEN}
+	buf, err = protobuf.Encode(&legacy)
+	require.NoError(t, err)
+	auction, legacyBids, err = decodeAuction(buf)
+	require.NoError(t, err)
+	require.Equal(t, legacy.Bids, legacyBids)
+	require.Equal(t, AuctionData{GoodDescription: "bananas", SellerAccount: seller, ReservePrice: 10,
+		State: OPEN, Version: AuctionVersion}, auction)
+
+	stored.Version = AuctionVersion + 1
+	buf, err = protobuf.Encode(&stored)
+	require.NoError(t, err)
+	_, _, err = decodeAuction(buf)
+	require.Error(t, err)
+}
+
+func TestBidData(t *testing.T) {
+	// A bid of the first layout decodes unchanged
+	a := byzcoin.NewInstanceID([]byte("a"))
+	buf, err := protobuf.Encode(&legacyBidData{BidderAccount: a, Bid: 30})
+	require.NoError(t, err)
+	bid := BidData{}
+	require.NoError(t, protobuf.Decode(buf, &bid))
+	require.Equal(t, BidData{BidderAccount: a, Bid: 30}, bid)
+}
+
+func TestMigrate(t *testing.T) {
+	auctInstID := byzcoin.NewInstanceID([]byte("auction"))
+	seller := byzcoin.NewInstanceID([]byte("seller"))
+	a := byzcoin.NewInstanceID([]byte("a"))
+	b := byzcoin.NewInstanceID([]byte("b"))
+	auction := AuctionData{SellerAccount: seller, ReservePrice: 10, State: OPEN, Version: AuctionVersion}
+
+	// The legacy bids are carried over, the auction stays open
+	sc, err := migrate(auctInstID, auction, []legacyBidData{{BidderAccount: a, Bid: 5},
+		{BidderAccount: b, Bid: 20}, {BidderAccount: a, Bid: 30}}, darc.ID{})
+	require.NoError(t, err)
+	require.Len(t, sc, 3)
+
+	rst := newMemTrie()
+	rst.apply(sc)
+	for _, account := range []byzcoin.InstanceID{seller, a, b} {
+		coinBuf, err := protobuf.Encode(&byzcoin.Coin{Name: contracts.CoinName})
+		require.NoError(t, err)
+		rst.apply([]byzcoin.StateChange{byzcoin.NewStateChange(byzcoin.Create,
+			account, contracts.ContractCoinID, coinBuf, darc.ID{})})
+	}
+	migrated := migratedAuction(t, rst, auctInstID)
+	require.Equal(t, OPEN, migrated.State)
+	require.False(t, migrated.Settled)
+	require.Equal(t, byzcoin.InstanceID{}, migrated.WinnerAccount)
+
+	stored, err := getStoredBids(rst, migrated)
+	require.NoError(t, err)
+	require.Equal(t, []BidData{{BidderAccount: a, Bid: 30}, {BidderAccount: b, Bid: 20}}, bidsOf(stored))
+	for _, bid := range stored {
+		require.True(t, bid.Unbacked)
+	}
+
+	// Raising a legacy bid escrows all of it
+	payouts := make(map[byzcoin.InstanceID]uint64)
+	c := &contractSBAuction{contracts: recordedCoins(payouts)}
+	invoke := func(command string, bid *BidData, escrow uint64) error {
+		inst := byzcoin.Instruction{
+			InstanceID: auctInstID,
+			Invoke:     &byzcoin.Invoke{ContractID: ContractSBAuctionID, Command: command},
+		}
+		if bid != nil {
+			bidBuf, err := protobuf.Encode(bid)
+			require.NoError(t, err)
+			inst.Invoke.Args = byzcoin.Arguments{{Name: "bid", Value: bidBuf}}
+		}
+		sc, _, err := c.invoke(rst, inst, []byzcoin.Coin{{Name: contracts.CoinName, Value: escrow}})
+		if err == nil {
+			rst.apply(sc)
+		}
+		return err
+	}
+	require.Equal(t, auctioncore.ErrEscrowMismatch, invoke("bid", &BidData{BidderAccount: b, Bid: 40}, 20))
+	require.NoError(t, invoke("bid", &BidData{BidderAccount: b, Bid: 40}, 40))
+
+	// Only the backed bids are paid or refunded
+	require.NoError(t, invoke("close", nil, 0))
+	require.NoError(t, invoke("process", nil, 0))
+	migrated = migratedAuction(t, rst, auctInstID)
+	require.True(t, migrated.Settled)
+	require.Equal(t, b, migrated.WinnerAccount)
+	require.Equal(t, map[byzcoin.InstanceID]uint64{seller: 40}, payouts)
+
+	// A processed legacy auction stays settled
+	auction.State = CLOSED
+	auction.WinnerAccount = a
+	sc, err = migrate(auctInstID, auction, []legacyBidData{{BidderAccount: a, Bid: 30}}, darc.ID{})
+	require.NoError(t, err)
+	rst.apply(sc)
+	migrated = migratedAuction(t, rst, auctInstID)
+	require.True(t, migrated.Settled)
+	require.Equal(t, a, migrated.WinnerAccount)
+
+	// Without legacy bids the auction is only rewritten
+	sc, err = migrate(auctInstID, auction, nil, darc.ID{})
+	require.NoError(t, err)
+	require.Len(t, sc, 1)
+}
+
+// migratedAuction reads the auction from the trie.
+func migratedAuction(t *testing.T, rst *memTrie, auctInstID byzcoin.InstanceID) AuctionData {
+	val, _, _, _, err := rst.GetValues(auctInstID.Slice())
+	require.NoError(t, err)
+	auction := AuctionData{}
+	require.NoError(t, protobuf.Decode(val, &auction))
+	return auction
+}
+
+// recordedCoins stands in for the coin contract, it records the coins
+// stored in every account.
+type recordedCoins map[byzcoin.InstanceID]uint64
+
+func (r recordedCoins) GetContractConstructor(contractID string) (byzcoin.ContractFn, bool) {
+	return func([]byte) (byzcoin.Contract, error) {
+		return &recordedCoin{payouts: r}, nil
+	}, contractID == contracts.ContractCoinID
+}
+
+type recordedCoin struct {
+	byzcoin.BasicContract
+	payouts recordedCoins
+}
+
+func (r *recordedCoin) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+	for _, co := range coins {
+		r.payouts[inst.InstanceID] += co.Value
+	}
+	return nil, nil, nil
+}
@@ -1,15 +1,12 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/binary"
-	"encoding/hex"
 	"errors"
 	"go.dedis.ch/onet/v3/simul/monitor"
-	"strconv"
 	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/dedis/student_19_auctions/auctioncore"
 	"github.com/dedis/student_19_auctions/auctions"
 	"go.dedis.ch/cothority/v3/byzcoin"
 	"go.dedis.ch/cothority/v3/byzcoin/contracts"
@@ -138,8 +135,8 @@ func (s *SimulationOpenAuction) Run(config *onet.SimulationConfig) error {
 		GoodDescription: "bananas",
 		HighestBid:      0,
 		HighestBidder:   instID,
-		State:           "OPEN",
-		ReservePrice:    createHash("simulationsalt", 0),
+		State:           auctioncore.StateOpen,
+		ReservePrice:    auctioncore.CreateHash("simulationsalt", 0),
 	}
 
 	for round := 0; round < s.Rounds; round++ {
@@ -211,8 +208,7 @@ func (s *SimulationOpenAuction) Run(config *onet.SimulationConfig) error {
 	}
 
 	// Create accounts for each bidder and give them 1000 coins to use.
-	coins := make([]byte, 8)
-	binary.LittleEndian.PutUint64(coins, 100000)
+	coins := auctioncore.EncodeAmount(100000)
 	instr = nil
 
 	for i := 0; i < s.Bids; i++ {
@@ -279,7 +275,6 @@ func (s *SimulationOpenAuction) Run(config *onet.SimulationConfig) error {
 		return errors.New("couldn't initialize accounts: " + err.Error())
 	}
 
-	amount := make([]byte, 8)
 	bidamount := uint64(0)
 
 	bidata := auctions.BidData{
@@ -292,7 +287,7 @@ func (s *SimulationOpenAuction) Run(config *onet.SimulationConfig) error {
 		for i := 0; i < s.Bids; i++ {
 
 			bidamount = bidamount + uint64(1)
-			binary.LittleEndian.PutUint64(amount, uint64(bidamount))
+			amount := auctioncore.EncodeAmount(bidamount)
 
 			bidata.BidderAccount = bidderAccounts[i]
 			bidata.BidderPubKey = bidderAccounts[i].String()
@@ -446,12 +441,3 @@ func (s *SimulationOpenAuction) Run(config *onet.SimulationConfig) error {
 
 	return nil
 }
-
-func createHash(salt string, reservP uint64) string {
-	strReservePrice := strconv.Itoa(int(reservP))
-	h := sha256.New()
-	h.Write([]byte(salt + strReservePrice))
-	hashed := h.Sum(nil)
-	hash := hex.EncodeToString(hashed)
-	return hash
-}